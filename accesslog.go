@@ -0,0 +1,210 @@
+package hooklab
+
+// This file contains access logging: every request the server answers is
+// written to standard output as one line in the Apache common or combined log
+// format, or as JSON, so the logs can be fed into existing pipelines. Noisy
+// paths, such as the dashboard's /api/stream, can be left out.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Access log formats, as given to -access-log.
+const (
+	AccessLogNone     = "none"     // Don't log requests (default)
+	AccessLogCommon   = "common"   // Apache common log format
+	AccessLogCombined = "combined" // Common log format plus the Referer and User-Agent
+	AccessLogJSON     = "json"     // One JSON object per request
+)
+
+// clfTime is the timestamp layout of the common log format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogger writes a line for every request it wraps, except requests to
+// excluded paths.
+type accessLogger struct {
+	format  string
+	exclude []string
+	out     *log.Logger
+}
+
+// accessLogEntry is one logged request, in the JSON format.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+// newAccessLogger returns a logger writing format lines to out, or nil for
+// AccessLogNone. exclude lists comma-separated paths that aren't logged; a
+// path ending in "/" also excludes every path below it.
+func newAccessLogger(format, exclude string, out io.Writer) (*accessLogger, error) {
+	switch format {
+	case AccessLogNone, "":
+		return nil, nil
+	case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown -access-log %q, want none, common, combined, or json", format)
+	}
+	l := &accessLogger{format: format, out: log.New(out, "", 0)}
+	for _, path := range strings.Split(exclude, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("-access-log-exclude path %q must start with /", path)
+		}
+		l.exclude = append(l.exclude, path)
+	}
+	return l, nil
+}
+
+// excluded reports whether requests to path are left out of the log.
+func (l *accessLogger) excluded(path string) bool {
+	for _, prefix := range l.exclude {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap returns next, logging each request once it has been answered.
+func (l *accessLogger) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		l.out.Print(l.line(r, recorder, start, time.Since(start)))
+	})
+}
+
+// line formats the log line of r, answered through recorder.
+func (l *accessLogger) line(r *http.Request, recorder *statusRecorder, start time.Time, elapsed time.Duration) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+	user, _, _ := r.BasicAuth()
+	status := recorder.status
+	if status == 0 && !recorder.hijacked {
+		status = http.StatusOK
+	}
+
+	if l.format == AccessLogJSON {
+		line, _ := json.Marshal(accessLogEntry{
+			Time:       start,
+			RemoteAddr: host,
+			User:       user,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     status,
+			Bytes:      recorder.bytes,
+			DurationMs: float64(elapsed) / float64(time.Millisecond),
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+		return string(line)
+	}
+
+	// Hijacked connections have no status, and empty bodies no size.
+	statusField, bytesField := strconv.Itoa(status), strconv.FormatInt(recorder.bytes, 10)
+	if status == 0 {
+		statusField = "-"
+	}
+	if recorder.bytes == 0 {
+		bytesField = "-"
+	}
+	line := fmt.Sprintf("%s - %s [%s] %s %s %s",
+		host, clfField(user), start.Format(clfTime), clfQuote(r.Method+" "+r.RequestURI+" "+r.Proto), statusField, bytesField)
+	if l.format == AccessLogCombined {
+		line += " " + clfQuote(r.Referer()) + " " + clfQuote(r.UserAgent())
+	}
+	return line
+}
+
+// clfField returns value as an unquoted common log format field, escaped like
+// clfQuote and with spaces replaced, or "-" when it is empty.
+func clfField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	quoted := strconv.Quote(value)
+	return strings.ReplaceAll(quoted[1:len(quoted)-1], " ", "_")
+}
+
+// clfQuote quotes value for the common log format, escaping quotes,
+// backslashes, and control characters so a line can't be split or forged.
+func clfQuote(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+// statusRecorder is a ResponseWriter noting the status and body size of the
+// response. It passes flushes and hijacks through, so streaming and dropped
+// connections work as without it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	// Informational responses precede the final one.
+	if s.status == 0 && status >= http.StatusOK {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil {
+		s.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,134 @@
+package hooklab
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// logRequest serves req through an access logger with format and returns the
+// line it logged.
+func logRequest(t *testing.T, format, exclude string, handler http.HandlerFunc, req *http.Request) string {
+	t.Helper()
+	var out bytes.Buffer
+	logger, err := newAccessLogger(format, exclude, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.wrap(handler).ServeHTTP(httptest.NewRecorder(), req)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	created := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/orders?x=1", strings.NewReader(`{}`))
+		req.RemoteAddr = "192.0.2.7:51234"
+		req.SetBasicAuth("vera", "v")
+		req.Header.Set("Referer", "https://example.com/")
+		req.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+		return req
+	}
+
+	common := logRequest(t, AccessLogCommon, "", created, newRequest())
+	if !regexp.MustCompile(`^192\.0\.2\.7 - vera \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /webhook/orders\?x=1 HTTP/1\.1" 201 8$`).MatchString(common) {
+		t.Errorf("unexpected common log line %q", common)
+	}
+
+	combined := logRequest(t, AccessLogCombined, "", created, newRequest())
+	if !strings.HasPrefix(combined, "192.0.2.7 - vera [") || !strings.HasSuffix(combined, `201 8 "https://example.com/" "curl/8.0 \"quoted\""`) {
+		t.Errorf("unexpected combined log line %q", combined)
+	}
+
+	var entry accessLogEntry
+	if err := json.Unmarshal([]byte(logRequest(t, AccessLogJSON, "", created, newRequest())), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.RemoteAddr != "192.0.2.7" || entry.User != "vera" || entry.Method != http.MethodPost || entry.URI != "/webhook/orders?x=1" ||
+		entry.Status != http.StatusCreated || entry.Bytes != 8 || entry.UserAgent != `curl/8.0 "quoted"` {
+		t.Errorf("unexpected JSON log entry %+v", entry)
+	}
+}
+
+func TestAccessLogDefaultsAndEscaping(t *testing.T) {
+	empty := func(w http.ResponseWriter, r *http.Request) {}
+	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.SetBasicAuth("eve\n192.0.2.8", "x")
+	line := logRequest(t, AccessLogCommon, "", empty, req)
+	if strings.Contains(line, "\n") || !strings.Contains(line, `- eve\n192.0.2.8 [`) || !strings.HasSuffix(line, `"GET /api/events HTTP/1.1" 200 -`) {
+		t.Errorf("unexpected log line %q", line)
+	}
+}
+
+func TestAccessLogExclude(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		path   string
+		logged bool
+	}{
+		{"/api/stream", false},
+		{"/api/streams", true},
+		{"/api/rules/history", false},
+		{"/api/rules", true},
+		{"/webhook/orders", true},
+	}
+	for _, tt := range tests {
+		line := logRequest(t, AccessLogCommon, "/api/stream, /api/rules/", ok, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if logged := line != ""; logged != tt.logged {
+			t.Errorf("%s: expected logged %v, got %q", tt.path, tt.logged, line)
+		}
+	}
+}
+
+func TestNewAccessLoggerValidation(t *testing.T) {
+	if logger, err := newAccessLogger(AccessLogNone, "/api/stream", nil); logger != nil || err != nil {
+		t.Errorf("expected none to disable logging, got %v %v", logger, err)
+	}
+	if _, err := newAccessLogger("apache", "", nil); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+	if _, err := newAccessLogger(AccessLogJSON, "api/stream", nil); err == nil {
+		t.Error("expected relative exclude path to be rejected")
+	}
+}
+
+func TestAccessLogPassesThroughFlushAndHijack(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := newAccessLogger(AccessLogCommon, "", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := New()
+	app.setResponseConfig("drop", ResponseConfig{StatusCode: http.StatusOK, Drop: DropClose})
+	logged := make(chan struct{})
+	handler := logger.wrap(http.HandlerFunc(app.webhookHandler))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		close(logged)
+	}))
+	defer server.Close()
+
+	if _, err := http.Post(server.URL+"/webhook/drop", "application/json", strings.NewReader(`{}`)); err == nil {
+		t.Error("expected the connection to be dropped")
+	}
+	<-logged
+	if line := out.String(); !strings.Contains(line, `"POST /webhook/drop HTTP/1.1" - -`) {
+		t.Errorf("expected a hijacked request to be logged without a status, got %q", line)
+	}
+
+	recorder := httptest.NewRecorder()
+	logger.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	})).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/stream", nil))
+	if !recorder.Flushed {
+		t.Error("expected flushes to reach the underlying writer")
+	}
+}
@@ -0,0 +1,56 @@
+package hooklab
+
+// This file contains automatic certificates: with -domain, hooklab obtains and
+// renews certificates from Let's Encrypt through ACME, so a cloud-hosted instance
+// serves valid HTTPS without any certificate files.
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECache is the directory obtained certificates and the ACME account
+// key are kept in, so restarts don't request new ones.
+const defaultACMECache = "hooklab-certs"
+
+// parseDomains splits a comma-separated list of domains, as given by flag,
+// normalizing their case and dropping trailing dots.
+func parseDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		if domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// newACMEManager returns an autocert manager obtaining certificates for domains
+// only, caching them in cacheDir. email is given to Let's Encrypt for expiry
+// notices and may be empty. Using it accepts the Let's Encrypt terms of service.
+func newACMEManager(domains []string, cacheDir, email string) (*autocert.Manager, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("no domain given")
+	}
+	if cacheDir == "" {
+		return nil, errors.New("a certificate cache directory is required")
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}, nil
+}
+
+// acmeTLSConfig returns a server TLS config getting certificates from manager and
+// answering its TLS-ALPN-01 challenges, which requires the server to be reachable
+// on port 443.
+func acmeTLSConfig(manager *autocert.Manager) *tls.Config {
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
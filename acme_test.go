@@ -0,0 +1,34 @@
+package hooklab
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestParseDomains(t *testing.T) {
+	got := parseDomains(" Hooks.Example.com., ,hooklab.example.org ")
+	if len(got) != 2 || got[0] != "hooks.example.com" || got[1] != "hooklab.example.org" {
+		t.Errorf("unexpected domains %q", got)
+	}
+}
+
+func TestACMETLSConfig(t *testing.T) {
+	if _, err := newACMEManager(nil, defaultACMECache, ""); err == nil {
+		t.Error("expected an error without domains")
+	}
+
+	manager, err := newACMEManager([]string{"hooks.example.com"}, t.TempDir(), "ops@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	config := acmeTLSConfig(manager)
+	if config.MinVersion != tls.VersionTLS12 || !slices.Contains(config.NextProtos, "acme-tls/1") {
+		t.Errorf("unexpected config: min version %x, protocols %q", config.MinVersion, config.NextProtos)
+	}
+
+	// Certificates are only requested for the configured domains.
+	if _, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "attacker.example.net"}); err == nil {
+		t.Error("expected a certificate for another domain to be refused")
+	}
+}
@@ -0,0 +1,326 @@
+package hooklab
+
+// This file contains traffic alerts: rules registered through the API that
+// watch a key's webhooks, such as "no webhooks on payments for 30 minutes" or
+// "more than 20% error responses", and tell the notifiers when they start and
+// stop firing — a lightweight watchdog for integration environments.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Alert kinds.
+const (
+	AlertSilence   = "silence"    // No webhooks for the window
+	AlertErrorRate = "error-rate" // Too many webhooks answered with a 4xx or 5xx in the window
+)
+
+// Alert states, as sent to notifiers.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// alertCheckInterval is how often alert rules are checked.
+var alertCheckInterval = 15 * time.Second
+
+// AlertRule watches a key's webhooks and notifies when its condition starts
+// or stops holding.
+type AlertRule struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	Key         string    `json:"key"`                   // Webhook key watched
+	Kind        string    `json:"kind"`                  // silence or error-rate
+	Window      Duration  `json:"window"`                // How far back the condition looks, e.g. "30m"
+	Threshold   float64   `json:"threshold,omitempty"`   // error-rate: percentage of error responses above which the alert fires
+	MinRequests int       `json:"minRequests,omitempty"` // error-rate: webhooks the window needs before the rate counts (default 1)
+	Notifiers   []string  `json:"notifiers,omitempty"`   // IDs of the notifiers told; empty for every enabled notifier of the key
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Firing      bool      `json:"firing"`               // The condition held when last checked
+	FiringSince time.Time `json:"firingSince,omitzero"` // When the alert started firing
+}
+
+// AlertNotification is a change of an alert's state.
+type AlertNotification struct {
+	AlertID   string    `json:"alertId"`
+	Name      string    `json:"name,omitempty"`
+	Key       string    `json:"key"`
+	Kind      string    `json:"kind"`
+	State     string    `json:"state"`   // firing or resolved
+	Message   string    `json:"message"` // What was seen, e.g. "no webhooks on payments for 30m0s"
+	Timestamp time.Time `json:"timestamp"`
+
+	notifiers []string // IDs of the notifiers told, from the alert rule
+}
+
+// AlertPayload is the JSON body POSTed to a notifier with the json format when
+// an alert changes state.
+type AlertPayload struct {
+	NotifierID string            `json:"notifierId"`
+	Alert      AlertNotification `json:"alert"`
+}
+
+// validate checks the alert's key, kind, window, and threshold.
+func (rule AlertRule) validate() error {
+	if rule.Key == "" {
+		return errors.New("key: required")
+	}
+	if rule.Window <= 0 || time.Duration(rule.Window) > maxAnalyticsWindow {
+		return fmt.Errorf("window: must be positive and at most %v", maxAnalyticsWindow)
+	}
+	switch rule.Kind {
+	case AlertSilence:
+		if rule.Threshold != 0 || rule.MinRequests != 0 {
+			return errors.New("threshold and minRequests: only used by error-rate alerts")
+		}
+	case AlertErrorRate:
+		if rule.Threshold < 0 || rule.Threshold >= 100 {
+			return errors.New("threshold: must be a percentage from 0 to below 100")
+		}
+		if rule.MinRequests < 0 {
+			return errors.New("minRequests: must not be negative")
+		}
+	default:
+		return fmt.Errorf("kind: unknown kind %q, want silence or error-rate", rule.Kind)
+	}
+	return nil
+}
+
+// check reports whether the alert's condition holds at now for samples, the
+// key's answered webhooks in arrival order, and describes what was seen.
+func (rule AlertRule) check(samples []webhookSample, now time.Time) (bool, string) {
+	window := time.Duration(rule.Window)
+	since := now.Add(-window)
+	recent := samples[sort.Search(len(samples), func(i int) bool { return samples[i].time.After(since) }):]
+
+	if rule.Kind == AlertSilence {
+		// A new alert waits a whole window before calling the key silent.
+		if len(recent) > 0 || rule.CreatedAt.After(since) {
+			return false, fmt.Sprintf("webhooks on %s resumed", rule.Key)
+		}
+		return true, fmt.Sprintf("no webhooks on %s for %v", rule.Key, window)
+	}
+
+	errs := 0
+	for _, sample := range recent {
+		if sample.status >= http.StatusBadRequest {
+			errs++
+		}
+	}
+	rate := 0.0
+	if len(recent) > 0 {
+		rate = float64(errs) / float64(len(recent)) * 100
+	}
+	message := fmt.Sprintf("%.1f%% of %d webhooks on %s answered with errors in the last %v", rate, len(recent), rule.Key, window)
+	return len(recent) >= max(rule.MinRequests, 1) && rate > rule.Threshold, message
+}
+
+// addAlert stores a new alert rule and returns it with its ID.
+func (a *App) addAlert(rule AlertRule) AlertRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.alertLastID++
+	rule.ID = fmt.Sprintf("alert_%d", a.alertLastID)
+	rule.CreatedAt = a.now()
+	rule.Firing, rule.FiringSince = false, time.Time{}
+	a.alerts = append(a.alerts, rule)
+	return rule
+}
+
+// getAlerts returns every alert rule in creation order.
+func (a *App) getAlerts() []AlertRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]AlertRule{}, a.alerts...)
+}
+
+// deleteAlert removes an alert rule, reporting whether it existed.
+func (a *App) deleteAlert(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, rule := range a.alerts {
+		if rule.ID == id {
+			a.alerts = slices.Delete(a.alerts, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// checkAlerts checks every enabled alert rule at now and notifies about the
+// ones that started or stopped firing.
+func (a *App) checkAlerts(now time.Time) {
+	var changes []AlertNotification
+	a.mu.Lock()
+	for i := range a.alerts {
+		rule := &a.alerts[i]
+		if !rule.Enabled {
+			continue
+		}
+		firing, message := rule.check(a.samples[rule.Key], now)
+		if firing == rule.Firing {
+			continue
+		}
+		rule.Firing = firing
+		state := AlertResolved
+		if firing {
+			state = AlertFiring
+			rule.FiringSince = now
+		} else {
+			rule.FiringSince = time.Time{}
+		}
+		changes = append(changes, AlertNotification{
+			AlertID:   rule.ID,
+			Name:      rule.Name,
+			Key:       rule.Key,
+			Kind:      rule.Kind,
+			State:     state,
+			Message:   message,
+			Timestamp: now,
+			notifiers: rule.Notifiers,
+		})
+	}
+	a.mu.Unlock()
+
+	for _, change := range changes {
+		a.notifyAlert(change)
+	}
+}
+
+// notifyAlert delivers an alert's state change to the enabled notifiers the
+// alert rule names or, when it names none, to those of its key. Notifier
+// conditions are about events and don't apply.
+func (a *App) notifyAlert(change AlertNotification) {
+	for _, notifier := range a.getNotifiers() {
+		if !notifier.Enabled {
+			continue
+		}
+		if len(change.notifiers) > 0 && !slices.Contains(change.notifiers, notifier.ID) {
+			continue
+		}
+		if len(change.notifiers) == 0 && notifier.Key != "" && notifier.Key != change.Key {
+			continue
+		}
+		body, err := notifier.alertPayload(change)
+		if err != nil {
+			continue
+		}
+		a.postToNotifier(notifier, body, NotifierDelivery{AlertID: change.AlertID})
+	}
+}
+
+// alertPayload returns the JSON body POSTed to the notifier for an alert's
+// state change.
+func (n Notifier) alertPayload(change AlertNotification) ([]byte, error) {
+	title := change.Name
+	if title == "" {
+		title = change.AlertID
+	}
+	switch n.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": slackEscaper.Replace(fmt.Sprintf("*%s* %s: %s", change.State, title, change.Message))})
+	case FormatDiscord:
+		return json.Marshal(map[string]interface{}{
+			"content":          truncate(fmt.Sprintf("**%s** %s: %s", change.State, title, change.Message), maxDiscordContentLen),
+			"allowed_mentions": map[string][]string{"parse": {}},
+		})
+	default:
+		return json.Marshal(AlertPayload{NotifierID: n.ID, Alert: change})
+	}
+}
+
+// watchAlerts checks the alert rules every interval until the server shuts down.
+func (a *App) watchAlerts(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	shutdown := a.shutdownSignal()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case now := <-ticker.C:
+			a.checkAlerts(now)
+		}
+	}
+}
+
+// alertsHandler handles /api/alerts requests:
+//   - GET: list alert rules with their current state
+//   - POST: register an alert rule; returns it with its ID (201)
+//   - DELETE ?id={id}: remove an alert rule
+func (a *App) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"alerts": a.getAlerts(),
+		}); err != nil {
+			http.Error(w, "Error creating response", http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		// Alert rules are enabled unless the request says otherwise.
+		rule := AlertRule{Enabled: true}
+		if err := json.Unmarshal(body, &rule); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := a.validateAlert(rule); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		rule = a.addAlert(rule)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Alert ID required", http.StatusBadRequest)
+			return
+		}
+		if !a.deleteAlert(id) {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateAlert checks rule and that the notifiers it names exist.
+func (a *App) validateAlert(rule AlertRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	notifiers := a.getNotifiers()
+	for i, id := range rule.Notifiers {
+		if !slices.ContainsFunc(notifiers, func(n Notifier) bool { return n.ID == id }) {
+			return errors.New("notifiers[" + strconv.Itoa(i) + "]: no notifier " + strconv.Quote(id))
+		}
+	}
+	return nil
+}
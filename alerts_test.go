@@ -0,0 +1,193 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertRuleCheck(t *testing.T) {
+	now := time.Now()
+	samples := []webhookSample{
+		{time: now.Add(-40 * time.Minute), status: 200},
+		{time: now.Add(-4 * time.Minute), status: 200},
+		{time: now.Add(-3 * time.Minute), status: 500},
+		{time: now.Add(-2 * time.Minute), status: 429},
+		{time: now.Add(-time.Minute), status: 200},
+	}
+	old := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		rule AlertRule
+		want bool
+	}{
+		{"silent", AlertRule{Kind: AlertSilence, Window: Duration(30 * time.Second), CreatedAt: old}, true},
+		{"not silent", AlertRule{Kind: AlertSilence, Window: Duration(5 * time.Minute), CreatedAt: old}, false},
+		{"silent but new", AlertRule{Kind: AlertSilence, Window: Duration(30 * time.Second), CreatedAt: now.Add(-10 * time.Second)}, false},
+		{"error rate above", AlertRule{Kind: AlertErrorRate, Window: Duration(10 * time.Minute), Threshold: 20}, true},
+		{"error rate below", AlertRule{Kind: AlertErrorRate, Window: Duration(10 * time.Minute), Threshold: 50}, false},
+		{"too few requests", AlertRule{Kind: AlertErrorRate, Window: Duration(10 * time.Minute), Threshold: 20, MinRequests: 5}, false},
+		{"no requests", AlertRule{Kind: AlertErrorRate, Window: Duration(30 * time.Second)}, false},
+	}
+	for _, tt := range tests {
+		tt.rule.Key = "payments"
+		if got, message := tt.rule.check(samples, now); got != tt.want {
+			t.Errorf("%s: expected %v, got %v (%s)", tt.name, tt.want, got, message)
+		}
+	}
+}
+
+func TestAlertRuleValidate(t *testing.T) {
+	valid := []AlertRule{
+		{Key: "payments", Kind: AlertSilence, Window: Duration(30 * time.Minute)},
+		{Key: "payments", Kind: AlertErrorRate, Window: Duration(10 * time.Minute), Threshold: 20, MinRequests: 10},
+	}
+	for _, rule := range valid {
+		if err := rule.validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", rule, err)
+		}
+	}
+	invalid := []AlertRule{
+		{Kind: AlertSilence, Window: Duration(time.Minute)},
+		{Key: "payments", Kind: "latency", Window: Duration(time.Minute)},
+		{Key: "payments", Kind: AlertSilence},
+		{Key: "payments", Kind: AlertSilence, Window: Duration(48 * time.Hour)},
+		{Key: "payments", Kind: AlertSilence, Window: Duration(time.Minute), Threshold: 10},
+		{Key: "payments", Kind: AlertErrorRate, Window: Duration(time.Minute), Threshold: 100},
+	}
+	for _, rule := range invalid {
+		if err := rule.validate(); err == nil {
+			t.Errorf("%+v: expected error", rule)
+		}
+	}
+}
+
+func TestCheckAlertsNotifies(t *testing.T) {
+	payloads := make(chan AlertPayload, 8)
+	jsonTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload AlertPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		if r.Header.Get("X-Hooklab-Alert-Id") != payload.Alert.AlertID {
+			t.Errorf("expected alert ID header %q, got %q", payload.Alert.AlertID, r.Header.Get("X-Hooklab-Alert-Id"))
+		}
+		payloads <- payload
+	}))
+	defer jsonTarget.Close()
+
+	app := New()
+	notifier := app.addNotifier(Notifier{URL: jsonTarget.URL, Key: "payments", Enabled: true})
+	app.addNotifier(Notifier{URL: jsonTarget.URL, Key: "orders", Enabled: true})
+	app.addNotifier(Notifier{URL: jsonTarget.URL, Enabled: false})
+	alert := app.addAlert(AlertRule{Key: "payments", Kind: AlertErrorRate, Window: Duration(time.Minute), Threshold: 20, Enabled: true})
+
+	now := time.Now()
+	app.recordSample("payments", webhookSample{time: now, status: http.StatusInternalServerError})
+	app.checkAlerts(now)
+	app.checkAlerts(now) // Still firing: no second notification.
+
+	select {
+	case payload := <-payloads:
+		if payload.NotifierID != notifier.ID || payload.Alert.AlertID != alert.ID || payload.Alert.State != AlertFiring || payload.Alert.Key != "payments" {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the firing notification")
+	}
+	if alerts := app.getAlerts(); !alerts[0].Firing || !alerts[0].FiringSince.Equal(now) {
+		t.Errorf("expected the alert to be firing, got %+v", alerts[0])
+	}
+
+	app.checkAlerts(now.Add(2 * time.Minute))
+	select {
+	case payload := <-payloads:
+		if payload.Alert.State != AlertResolved {
+			t.Errorf("expected a resolved notification, got %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the resolved notification")
+	}
+	select {
+	case payload := <-payloads:
+		t.Errorf("unexpected extra notification %+v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	deliveries := waitForDeliveries(t, app, notifier.ID, 2)
+	if deliveries[0].AlertID != alert.ID || deliveries[0].EventID != 0 {
+		t.Errorf("unexpected delivery %+v", deliveries[0])
+	}
+}
+
+func TestAlertPayloadChatFormats(t *testing.T) {
+	change := AlertNotification{AlertID: "alert_1", Name: "<!channel> payments", Key: "payments", State: AlertFiring, Message: "no webhooks on payments for 30m0s"}
+
+	body, err := Notifier{Format: FormatSlack}.alertPayload(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slack struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(body, &slack)
+	if slack.Text != "*firing* &lt;!channel&gt; payments: no webhooks on payments for 30m0s" {
+		t.Errorf("unexpected slack payload %s", body)
+	}
+
+	body, err = Notifier{Format: FormatDiscord}.alertPayload(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discord struct {
+		Content         string              `json:"content"`
+		AllowedMentions map[string][]string `json:"allowed_mentions"`
+	}
+	json.Unmarshal(body, &discord)
+	if discord.Content != "**firing** <!channel> payments: no webhooks on payments for 30m0s" || discord.AllowedMentions["parse"] == nil {
+		t.Errorf("unexpected discord payload %s", body)
+	}
+}
+
+func TestAlertsHandler(t *testing.T) {
+	app := New()
+	notifier := app.addNotifier(Notifier{URL: "http://example.com/hook", Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.alertsHandler(w, httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(`{"key":"payments","kind":"silence","window":"30m","notifiers":["`+notifier.ID+`"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created AlertRule
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.ID != "alert_1" || !created.Enabled || created.Window != Duration(30*time.Minute) {
+		t.Errorf("unexpected alert %+v", created)
+	}
+
+	for _, body := range []string{`{"key":"payments","kind":"silence"}`, `{"key":"payments","kind":"silence","window":"1m","notifiers":["notifier_9"]}`, `{`} {
+		w = httptest.NewRecorder()
+		app.alertsHandler(w, httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.alertsHandler(w, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	if !strings.Contains(w.Body.String(), `"id":"alert_1"`) || !strings.Contains(w.Body.String(), `"firing":false`) {
+		t.Errorf("unexpected list %s", w.Body.String())
+	}
+
+	for target, want := range map[string]int{
+		"/api/alerts":            http.StatusBadRequest,
+		"/api/alerts?id=alert_9": http.StatusNotFound,
+		"/api/alerts?id=alert_1": http.StatusOK,
+	} {
+		w = httptest.NewRecorder()
+		app.alertsHandler(w, httptest.NewRequest(http.MethodDelete, target, nil))
+		if w.Code != want {
+			t.Errorf("DELETE %s: expected status %d, got %d", target, want, w.Code)
+		}
+	}
+}
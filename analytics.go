@@ -0,0 +1,183 @@
+package hooklab
+
+// This file contains the /api/analytics endpoint: a per-key log of answered
+// webhooks, with the status each was answered with and how long answering took,
+// summarized into time buckets for the dashboard's charts.
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAnalyticsWindow  = 24 * time.Hour // Longest window analytics can look back over
+	maxAnalyticsBuckets = 1440           // Most buckets one analytics request may ask for
+	maxSamples          = 10000          // Answered webhooks remembered per webhook key
+)
+
+// webhookSample records one answered webhook.
+type webhookSample struct {
+	time    time.Time     // When the webhook arrived
+	status  int           // Status it was answered with
+	latency time.Duration // How long answering took, including configured delays
+}
+
+// AnalyticsBucket summarizes the webhooks that arrived in one bucket.
+type AnalyticsBucket struct {
+	Start        time.Time      `json:"start"`
+	Count        int            `json:"count"`
+	Statuses     map[string]int `json:"statuses"`     // Webhooks per response status code
+	AvgLatencyMs float64        `json:"avgLatencyMs"` // Mean time to answer, 0 without webhooks
+}
+
+// Analytics summarizes a key's webhooks over a window, split into buckets.
+type Analytics struct {
+	Key          string            `json:"key"`
+	Window       Duration          `json:"window"`
+	Bucket       Duration          `json:"bucket"`
+	Count        int               `json:"count"`
+	Statuses     map[string]int    `json:"statuses"`
+	AvgLatencyMs float64           `json:"avgLatencyMs"`
+	Buckets      []AnalyticsBucket `json:"buckets"` // Oldest first, including empty ones
+}
+
+// responseStatusKey is the context key of the status a webhook is answered with.
+type responseStatusKey struct{}
+
+// withResponseStatus returns r with a place in its context for the status it
+// is answered with, and that place.
+func withResponseStatus(r *http.Request) (*http.Request, *int) {
+	status := new(int)
+	return r.WithContext(context.WithValue(r.Context(), responseStatusKey{}, status)), status
+}
+
+// setResponseStatus records the status a webhook is answered with, for its
+// span and the key's analytics.
+func setResponseStatus(ctx context.Context, status int) {
+	if recorded, ok := ctx.Value(responseStatusKey{}).(*int); ok {
+		*recorded = status
+	}
+	setSpanStatusCode(ctx, status)
+}
+
+// recordSample logs an answered webhook for key, forgetting webhooks that are
+// older than maxAnalyticsWindow or beyond the maxSamples most recent ones. The
+// log stays in arrival order, though slow webhooks are answered after faster
+// ones that arrived later.
+func (a *App) recordSample(key string, sample webhookSample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	samples := a.samples[key]
+	cutoff := sample.time.Add(-maxAnalyticsWindow)
+	samples = samples[sort.Search(len(samples), func(i int) bool { return samples[i].time.After(cutoff) }):]
+	if len(samples) >= maxSamples {
+		samples = samples[len(samples)-maxSamples+1:]
+	}
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].time.After(sample.time) })
+	a.samples[key] = slices.Insert(samples, i, sample)
+}
+
+// analytics summarizes key's webhooks in the window ending at now. Buckets are
+// aligned to multiples of bucket, and the last one holds now.
+func (a *App) analytics(key string, window, bucket time.Duration, now time.Time) Analytics {
+	end := now.Truncate(bucket).Add(bucket)
+	n := int((window + bucket - 1) / bucket)
+	start := end.Add(-time.Duration(n) * bucket)
+
+	result := Analytics{
+		Key:      key,
+		Window:   Duration(window),
+		Bucket:   Duration(bucket),
+		Statuses: map[string]int{},
+		Buckets:  make([]AnalyticsBucket, n),
+	}
+	latencies := make([]time.Duration, n)
+	for i := range result.Buckets {
+		result.Buckets[i] = AnalyticsBucket{Start: start.Add(time.Duration(i) * bucket), Statuses: map[string]int{}}
+	}
+
+	a.mu.Lock()
+	samples := a.samples[key]
+	first := sort.Search(len(samples), func(i int) bool { return !samples[i].time.Before(start) })
+	samples = samples[first:]
+	var total time.Duration
+	for _, sample := range samples {
+		if !sample.time.Before(end) {
+			break
+		}
+		i := int(sample.time.Sub(start) / bucket)
+		status := strconv.Itoa(sample.status)
+		result.Buckets[i].Count++
+		result.Buckets[i].Statuses[status]++
+		latencies[i] += sample.latency
+		result.Count++
+		result.Statuses[status]++
+		total += sample.latency
+	}
+	a.mu.Unlock()
+
+	for i := range result.Buckets {
+		result.Buckets[i].AvgLatencyMs = averageMs(latencies[i], result.Buckets[i].Count)
+	}
+	result.AvgLatencyMs = averageMs(total, result.Count)
+	return result
+}
+
+// averageMs returns the mean of count latencies adding up to total, in milliseconds.
+func averageMs(total time.Duration, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count) / float64(time.Millisecond)
+}
+
+// parseAnalyticsRange parses the window and bucket query parameters, which
+// default to an hour and a minute.
+func parseAnalyticsRange(rawWindow, rawBucket string) (time.Duration, time.Duration, error) {
+	window, bucket := time.Hour, time.Minute
+	var err error
+	if rawWindow != "" {
+		if window, err = time.ParseDuration(rawWindow); err != nil || window <= 0 || window > maxAnalyticsWindow {
+			return 0, 0, errors.New("window must be a positive duration of at most 24h, such as 1h")
+		}
+	}
+	if rawBucket != "" {
+		if bucket, err = time.ParseDuration(rawBucket); err != nil || bucket < time.Second {
+			return 0, 0, errors.New("bucket must be a duration of at least 1s, such as 1m")
+		}
+	}
+	if bucket > window {
+		return 0, 0, errors.New("bucket must not be longer than window")
+	}
+	if (window+bucket-1)/bucket > maxAnalyticsBuckets {
+		return 0, 0, errors.New("window must hold at most " + strconv.Itoa(maxAnalyticsBuckets) + " buckets")
+	}
+	return window, bucket, nil
+}
+
+// analyticsHandler handles GET /api/analytics requests. The "key" query
+// parameter selects the webhook key, and "window" and "bucket" how far back to
+// look and how long each bucket is, e.g. window=1h&bucket=1m.
+func (a *App) analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := cmp.Or(r.URL.Query().Get("key"), "default")
+	window, bucket, err := parseAnalyticsRange(r.URL.Query().Get("window"), r.URL.Query().Get("bucket"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.analytics(key, window, bucket, a.now()))
+}
@@ -0,0 +1,80 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalytics(t *testing.T) {
+	app := New()
+	now := time.Date(2026, 3, 1, 12, 30, 20, 0, time.UTC)
+	app.recordSample("orders", webhookSample{time: now.Add(-25 * time.Hour), status: 200})
+	app.recordSample("orders", webhookSample{time: now.Add(-90 * time.Second), status: 200, latency: 10 * time.Millisecond})
+	app.recordSample("orders", webhookSample{time: now.Add(-2 * time.Second), status: 500, latency: 30 * time.Millisecond})
+	// Answered after the next one arrived, but still logged in arrival order.
+	app.recordSample("orders", webhookSample{time: now.Add(-5 * time.Second), status: 200, latency: 20 * time.Millisecond})
+	app.recordSample("payments", webhookSample{time: now, status: 200})
+
+	if n := len(app.samples["orders"]); n != 3 {
+		t.Errorf("expected samples older than %v to be forgotten, have %d", maxAnalyticsWindow, n)
+	}
+
+	got := app.analytics("orders", 3*time.Minute, time.Minute, now)
+	if len(got.Buckets) != 3 || !got.Buckets[2].Start.Equal(time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected buckets %+v", got.Buckets)
+	}
+	if got.Count != 3 || got.Statuses["200"] != 2 || got.Statuses["500"] != 1 || got.AvgLatencyMs != 20 {
+		t.Errorf("unexpected totals %+v", got)
+	}
+	counts := []int{got.Buckets[0].Count, got.Buckets[1].Count, got.Buckets[2].Count}
+	if counts[0] != 1 || counts[1] != 0 || counts[2] != 2 {
+		t.Errorf("expected bucket counts [1 0 2], got %v", counts)
+	}
+	if last := got.Buckets[2]; last.AvgLatencyMs != 25 || last.Statuses["500"] != 1 {
+		t.Errorf("unexpected last bucket %+v", last)
+	}
+}
+
+func TestParseAnalyticsRange(t *testing.T) {
+	if window, bucket, err := parseAnalyticsRange("", ""); err != nil || window != time.Hour || bucket != time.Minute {
+		t.Errorf("expected defaults of 1h and 1m, got %v %v %v", window, bucket, err)
+	}
+	for _, tt := range [][2]string{{"soon", ""}, {"0s", ""}, {"48h", ""}, {"1h", "500ms"}, {"1m", "1h"}, {"24h", "1s"}} {
+		if _, _, err := parseAnalyticsRange(tt[0], tt[1]); err == nil {
+			t.Errorf("window %q bucket %q: expected error", tt[0], tt[1])
+		}
+	}
+}
+
+func TestWebhookHandlerRecordsAnalytics(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: http.StatusAccepted})
+	app.addRule("orders", Rule{Condition: `body.fail == true`, StatusCode: http.StatusServiceUnavailable, Enabled: true})
+
+	for _, body := range []string{`{}`, `{}`, `{"fail":true}`} {
+		app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(body)))
+	}
+
+	w := httptest.NewRecorder()
+	app.analyticsHandler(w, httptest.NewRequest(http.MethodGet, "/api/analytics?key=orders&window=10m&bucket=1m", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got Analytics
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 3 || got.Statuses["202"] != 2 || got.Statuses["503"] != 1 || len(got.Buckets) != 10 {
+		t.Errorf("unexpected analytics %+v", got)
+	}
+
+	w = httptest.NewRecorder()
+	app.analyticsHandler(w, httptest.NewRequest(http.MethodGet, "/api/analytics?key=orders&bucket=2h", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
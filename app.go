@@ -1,62 +1,380 @@
-package main
+package hooklab
 
 // This file contains the core application state and business logic for Hooklab.
 // It manages webhook events, response configurations, rules, and SSE subscribers.
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/expr-lang/expr"
 )
 
+// maxEvents is how many captured events are kept, newest first.
+const maxEvents = 50
+
 // App holds the application state including webhook events, response configurations,
 // conditional rules, and SSE subscribers. All fields are protected by a mutex for
 // concurrent access safety.
+//
+// An App must be built by New, which initializes its state; Handler refuses
+// the zero App.
 type App struct {
-	responses   map[string]ResponseConfig
-	rules       map[string][]Rule // rules per webhook key
-	mu          sync.Mutex
-	events      []Event
-	lastID      int
-	ruleLastID  int
-	subscribers map[chan Event]struct{}
+	responses      map[string]ResponseConfig
+	rules          map[string][]Rule // rules per webhook key
+	mu             sync.Mutex
+	store          EventStore // captured events; see WithStore
+	lastID         int
+	ruleLastID     int
+	subscribers    map[chan Event]struct{}
+	subscriberKeys map[chan Event]map[string]bool   // keys a subscriber streams; absent streams every key
+	notices        map[chan Event]chan StreamNotice // named stream messages per subscriber
+	streamBuffer   int                              // messages a subscriber can fall behind by; 0 uses defaultStreamBuffer
+	drops          map[chan Event]int               // messages dropped per subscriber
+	droppedTotal   int                              // messages dropped over all subscribers, including removed ones
+	delivered      map[chan Event]int               // messages queued per subscriber
+	deliveredTotal int                              // messages queued over all subscribers, including removed ones
+	broadcasts     int                              // events and notices broadcast to the subscribers
+	rateWindows    map[string]rateWindow            // simulated rate limit counters per webhook key
+	captureLimit   CaptureLimit                     // webhooks each client may send per key before being throttled
+	captureBuckets map[string]captureBucket         // capture throttling buckets per client address and key
+	schemas        map[string]*responseSchema       // JSON Schemas that mock responses must satisfy, per webhook key
+	openAPISpecs   map[string]*openAPISpec          // OpenAPI documents webhooks are validated against, per webhook key
+	avroSchemas    map[string]*avroSchema           // Avro schemas uploaded for decoding webhooks, per webhook key
+	schemaRegistry *schemaRegistry                  // registry Avro bodies in the Confluent wire format are decoded with, if set
+	jwksSets       map[string]jwksEntry             // JWKS documents JWTs are verified with, by URL
+	state          map[string]*mockState            // template counters and stored values per webhook key
+	scenarios      map[string]string                // current state per scenario name
+	shutdown       chan struct{}                    // closed when the server begins shutting down
+	startedAt      time.Time                        // when the server started, for /api/info
+	overrides      map[string]*responseOverride     // temporary response configs awaiting restore
+	arrivals       map[string][]time.Time           // recent webhook arrival times per key, for rate()
+	samples        map[string][]webhookSample       // recent answered webhooks per key, for analytics
+	latency        map[string]phaseHistograms       // answering time histograms per key
+	slowRequest    time.Duration                    // processing time past which webhooks are logged; 0 disables
+	slowRequests   map[string]int                   // webhooks logged as slow per key
+	ruleHistory    map[string][]RuleVersion         // saved versions per rule ID
+	sinks          []EventSink                      // external systems captured events are published to
+	bridge         Bridge                           // fans broadcast events out to other instances
+	notifiers      []Notifier                       // URLs receiving captured events
+	notifierLastID int
+	alerts         []AlertRule // traffic alert rules and their state
+	alertLastID    int
+	deliveries     map[string][]NotifierDelivery // recent delivery attempts per notifier ID
+	users          credentials                   // dashboard and API logins; empty leaves them open
+	ipFilter       IPFilter                      // addresses webhooks of every key are accepted from
+	rejections     RejectionStats                // refused webhook counters
+	reloader       *configReloader               // re-reads the -config file; nil without one
+	basePath       string                        // -base-path prefix the server is reached under, e.g. /hooklab
+	draining       bool                          // refusing webhooks while shutting down
+	drainRetry     time.Duration                 // Retry-After of webhooks refused while draining
+	forwards       int                           // forwards and deliveries in flight, which draining waits for
+	verbosity      Verbosity                     // how much is logged about every webhook
+	noUI           bool                          // serve the API without the dashboard
+	url            string                        // where the server is reached, with the port picked for -port 0
+	eventLimit     int                           // captured events kept; 0 keeps maxEvents
+	clock          Clock                         // tells the time; nil uses the wall clock
+	adminURL       string                        // where the -admin-addr server is reached
+	eventHooks     []func(Event)                 // OnEvent callbacks
+	matchHooks     []func(Event, RuleTrace)      // OnRuleMatch callbacks
+	configHooks    []func(ConfigChange)          // OnConfigChange callbacks
+	configQueue    []ConfigChange                // changes not yet passed to configHooks
+	configHooksRun bool                          // a goroutine is passing configQueue to configHooks
+	pluginsDir     string                        // directory plugins are run from; empty disables them
+	plugins        map[string]*pluginProcess     // plugins started so far, by name
 }
 
 // ResponseConfig defines the response to return for a webhook request.
 // Response can be any JSON-serializable value, and StatusCode is the HTTP status.
 type ResponseConfig struct {
-	Response    interface{} // JSON response body
-	ResponseRaw string      // Raw JSON string of the response
-	StatusCode  int         // HTTP status code (e.g., 200, 404)
+	Response       interface{}               `json:"response"`                 // JSON response body
+	ResponseRaw    string                    `json:"-"`                        // Raw JSON string of the response
+	StatusCode     int                       `json:"statusCode"`               // HTTP status code (e.g., 200, 404)
+	StatusCodeExpr string                    `json:"statusCodeExpr,omitempty"` // expr expression computing the status per request; StatusCode is the fallback
+	Location       string                    `json:"location,omitempty"`       // Location header template, e.g. for 3xx redirects
+	Delay          Duration                  `json:"delay,omitempty"`          // Wait this long before responding
+	ForwardTo      string                    `json:"forwardTo,omitempty"`      // Proxy the request to this URL and relay its response
+	Cookies        []CookieConfig            `json:"cookies,omitempty"`        // Cookies to set via Set-Cookie
+	Redeliver      *RedeliveryConfig         `json:"redeliver,omitempty"`      // Re-deliver received webhooks to a target, simulating at-least-once delivery
+	RateLimit      *RateLimitConfig          `json:"rateLimit,omitempty"`      // Simulated rate limit for the key
+	Chunked        *ChunkConfig              `json:"chunked,omitempty"`        // Stream the body in delayed chunks
+	BytesPerSecond int                       `json:"bytesPerSecond,omitempty"` // Bandwidth cap for writing the body (0 = unlimited)
+	Drop           string                    `json:"drop,omitempty"`           // Connection drop mode: close, reset, or mid-body
+	Malformed      string                    `json:"malformed,omitempty"`      // Malformation: invalid-json, wrong-length, or wrong-content-type
+	Methods        map[string]ResponseConfig `json:"methods,omitempty"`        // Per-HTTP-method overrides, e.g. "GET"
+	Variants       []ResponseVariant         `json:"variants,omitempty"`       // Weighted random alternatives to this response
+	Hold           Duration                  `json:"hold,omitempty"`           // Hold the connection this long, then close it unanswered
+	Blackhole      bool                      `json:"blackhole,omitempty"`      // Hold the connection until the client gives up, never answering
+	Echo           *EchoConfig               `json:"echo,omitempty"`           // Reflect the request back instead of Response
+	RuleHeader     bool                      `json:"ruleHeader,omitempty"`     // Report the matched rules in an X-Hooklab-Rule response header
+	RuleMatch      string                    `json:"ruleMatch,omitempty"`      // How matching rules combine: first (default), last, or merge
+	Capture        *CaptureConfig            `json:"capture,omitempty"`        // Token webhooks must present to be accepted
+	Verify         *VerifyConfig             `json:"verify,omitempty"`         // Provider signature verification for the key's webhooks
+	IPFilter       *IPFilter                 `json:"ipFilter,omitempty"`       // Addresses the key accepts webhooks from, on top of the global filter
+	JWT            *JWTConfig                `json:"jwt,omitempty"`            // Where the key's webhooks carry a JWT and how to verify it
+	Plugins        []PluginConfig            `json:"plugins,omitempty"`        // Programs in -plugins-dir the key's webhooks are passed to, in order
+	Avro           bool                      `json:"avro,omitempty"`           // Decode wire format bodies with schemas from -schema-registry
+
+	captures        map[string]interface{}     // Values captured by the matching rules, available to templates as .captures
+	Representations map[string]string          `json:"representations,omitempty"` // Alternative body templates by media type, chosen via Accept
+	GraphQL         map[string]GraphQLResponse `json:"graphql,omitempty"`         // Responses per GraphQL operation name ("*" for any), wrapped in {"data", "errors"}
+}
+
+// ResponseVariant is a weighted alternative response. When a config has variants,
+// each request picks one at random with probability proportional to its weight.
+type ResponseVariant struct {
+	Weight int `json:"weight"`
+	ResponseConfig
+}
+
+// pickVariant returns a weighted random variant, or the config itself when it has none.
+func (c ResponseConfig) pickVariant() ResponseConfig {
+	total := 0
+	for _, variant := range c.Variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return c
+	}
+
+	n := rand.IntN(total)
+	for _, variant := range c.Variants {
+		if n < variant.Weight {
+			return variant.ResponseConfig
+		}
+		n -= variant.Weight
+	}
+	return c
+}
+
+// candidates returns the config along with every method override and variant it
+// may resolve to, e.g. for validating all possible response bodies.
+func (c ResponseConfig) candidates() []ResponseConfig {
+	all := []ResponseConfig{c}
+	for _, override := range c.Methods {
+		all = append(all, override.candidates()...)
+	}
+	for _, variant := range c.Variants {
+		all = append(all, variant.candidates()...)
+	}
+	return all
+}
+
+// forMethod returns the override configured for the HTTP method, or the config itself.
+func (c ResponseConfig) forMethod(method string) ResponseConfig {
+	if override, ok := c.Methods[strings.ToUpper(method)]; ok {
+		return override
+	}
+	return c
+}
+
+// Duration is a time.Duration that is encoded in JSON as a string such as "1m30s".
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a Go duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a Go duration string such as "500ms" or "10m".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
 }
 
 // Rule represents a conditional response rule that can override the default response
 // based on request content. Rules are evaluated using the expr expression language.
 type Rule struct {
-	ID         string      `json:"id"`
-	Name       string      `json:"name"`
-	Condition  string      `json:"condition"` // expr expression, e.g., "body.amount > 100"
-	Response   interface{} `json:"response"`
-	StatusCode int         `json:"statusCode"`
-	Priority   int         `json:"priority"` // Lower = higher priority
-	Enabled    bool        `json:"enabled"`
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Condition      string            `json:"condition"` // expr expression, e.g., "body.amount > 100"
+	Response       interface{}       `json:"response"`
+	StatusCode     int               `json:"statusCode"`
+	StatusCodeExpr string            `json:"statusCodeExpr,omitempty"` // expr expression computing the status, e.g. "body.amount > 1000 ? 402 : 200"
+	Location       string            `json:"location,omitempty"`       // Location header template, e.g. for 3xx redirects
+	Captures       map[string]string `json:"captures,omitempty"`       // Named expressions evaluated on a match, available to templates as .captures
+	ElseResponse   interface{}       `json:"elseResponse,omitempty"`   // Response when the condition is false, ending evaluation
+	ElseStatusCode int               `json:"elseStatusCode,omitempty"` // Status code of the else response
+	NotifyURL      string            `json:"notifyUrl,omitempty"`      // URL receiving a RuleNotification when the condition matches
+	Priority       int               `json:"priority"`                 // Lower = higher priority
+	Enabled        bool              `json:"enabled"`
+
+	// Action selects what a match does (see the Action constants); the default
+	// responds with Response. The remaining fields are action parameters.
+	Action    string   `json:"action,omitempty"`
+	Delay     Duration `json:"delay,omitempty"`     // ActionDelay: wait before responding
+	Drop      string   `json:"drop,omitempty"`      // ActionDrop: drop mode (default close)
+	ForwardTo string   `json:"forwardTo,omitempty"` // ActionForward: URL to proxy the request to
+	Tags      []string `json:"tags,omitempty"`      // ActionTag: tags added to the captured event
+
+	// Time window: the rule only matches between ActiveFrom and ActiveUntil and,
+	// with a Schedule, during the minutes matching the cron expression, e.g.
+	// "* 9-17 * * 1-5" for weekday business hours in Timezone.
+	ActiveFrom  *time.Time `json:"activeFrom,omitempty"`
+	ActiveUntil *time.Time `json:"activeUntil,omitempty"`
+	Schedule    string     `json:"schedule,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"` // IANA name, e.g. "Europe/Berlin"; default local time
+
+	// Expiry: a rule created or updated with ExpiresIn expires at ExpiresAt, after
+	// which it is disabled and flagged as Expired.
+	ExpiresIn Duration   `json:"expiresIn,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+
+	// Grouping: rules in a Group are only evaluated when a matching rule chains
+	// into the group with Then, e.g. a signature gate followed by payload rules.
+	Group string `json:"group,omitempty"`
+	Then  string `json:"then,omitempty"`
+
+	// Scenario support: a rule with RequiredState only matches while its scenario
+	// is in that state, and a match moves the scenario to NewState.
+	Scenario      string `json:"scenario,omitempty"`
+	RequiredState string `json:"requiredState,omitempty"`
+	NewState      string `json:"newState,omitempty"`
+
+	window *ruleWindow // Schedule and Timezone as parsed by validateRule
+}
+
+// Rule match strategies, choosing which matching rules produce the response.
+const (
+	RuleMatchFirst = "first" // The first matching rule in priority order (default)
+	RuleMatchLast  = "last"  // The last matching rule in priority order
+	RuleMatchMerge = "merge" // All matching rules, merged in priority order
+)
+
+// Rule actions.
+const (
+	ActionRespond = "respond" // Respond with the rule's response (default)
+	ActionDelay   = "delay"   // Wait for Delay, then respond
+	ActionDrop    = "drop"    // Drop the connection without a response
+	ActionForward = "forward" // Proxy the request to ForwardTo and relay its response
+	ActionTag     = "tag"     // Tag the captured event; evaluation continues with the next rule
+)
+
+// responseConfig returns the response produced by a matching rule.
+func (rule Rule) responseConfig() ResponseConfig {
+	config := ResponseConfig{
+		Response:       rule.Response,
+		StatusCode:     rule.StatusCode,
+		StatusCodeExpr: rule.StatusCodeExpr,
+		Location:       rule.Location,
+	}
+	switch rule.Action {
+	case ActionDelay:
+		config.Delay = rule.Delay
+	case ActionDrop:
+		config.Drop = rule.Drop
+		if config.Drop == "" {
+			config.Drop = DropClose
+		}
+	case ActionForward:
+		config.ForwardTo = rule.ForwardTo
+	}
+	return config
+}
+
+// hasElse reports whether the rule has an else branch.
+func (rule Rule) hasElse() bool {
+	return rule.ElseResponse != nil || rule.ElseStatusCode != 0
+}
+
+// elseBranch returns the rule that responds when rule's condition is false.
+func (rule Rule) elseBranch() Rule {
+	return Rule{ID: rule.ID, Name: rule.Name, Response: rule.ElseResponse, StatusCode: rule.ElseStatusCode}
+}
+
+// mergeRuleResponses combines the responses of matching rules. Each field comes
+// from the first rule, in priority order, that sets it, so one rule can add a
+// delay while another sets the body.
+func mergeRuleResponses(rules []Rule) ResponseConfig {
+	config := rules[0].responseConfig()
+	for _, rule := range rules[1:] {
+		next := rule.responseConfig()
+		if config.Response == nil {
+			config.Response = next.Response
+		}
+		if config.StatusCode == 0 {
+			config.StatusCode = next.StatusCode
+		}
+		config.StatusCodeExpr = cmp.Or(config.StatusCodeExpr, next.StatusCodeExpr)
+		config.Location = cmp.Or(config.Location, next.Location)
+		config.Delay = cmp.Or(config.Delay, next.Delay)
+		config.Drop = cmp.Or(config.Drop, next.Drop)
+		config.ForwardTo = cmp.Or(config.ForwardTo, next.ForwardTo)
+	}
+	return config
+}
+
+// withKeyTransport returns c, the response of matching rules, with the
+// transport settings of keyConfig, the key's own response, that c leaves
+// unset: the bandwidth cap, chunking, cookies, malformation, representations,
+// and echo. Rules pick what to answer, while the key still shapes how it is
+// sent.
+func (c ResponseConfig) withKeyTransport(keyConfig ResponseConfig) ResponseConfig {
+	c.BytesPerSecond = cmp.Or(c.BytesPerSecond, keyConfig.BytesPerSecond)
+	c.Malformed = cmp.Or(c.Malformed, keyConfig.Malformed)
+	if c.Chunked == nil {
+		c.Chunked = keyConfig.Chunked
+	}
+	if c.Cookies == nil {
+		c.Cookies = keyConfig.Cookies
+	}
+	if c.Representations == nil {
+		c.Representations = keyConfig.Representations
+	}
+	if c.Echo == nil {
+		c.Echo = keyConfig.Echo
+	}
+	return c
 }
 
 // Event represents a captured webhook request with all its metadata.
 // Events are stored in memory and broadcast to SSE subscribers in real-time.
 type Event struct {
-	ID        int                 `json:"id"`        // Unique event identifier
-	Timestamp time.Time           `json:"timestamp"` // When the event was received
-	Method    string              `json:"method"`    // HTTP method (GET, POST, etc.)
-	Path      string              `json:"path"`      // Request path
-	Key       string              `json:"key"`       // Webhook key from path
-	Headers   map[string][]string `json:"headers"`   // Request headers
-	Body      string              `json:"body"`      // Request body
+	ID           int                 `json:"id"`                     // Unique event identifier
+	Timestamp    time.Time           `json:"timestamp"`              // When the event was received
+	Method       string              `json:"method"`                 // HTTP method (GET, POST, etc.)
+	Path         string              `json:"path"`                   // Request path
+	Key          string              `json:"key"`                    // Webhook key from path
+	Tags         []string            `json:"tags,omitempty"`         // Tags added by matching tag rules
+	RuleErrors   []RuleError         `json:"ruleErrors,omitempty"`   // Rule conditions that failed to evaluate
+	RuleTrace    []RuleTrace         `json:"ruleTrace,omitempty"`    // Every rule considered for the request, in evaluation order
+	MatchedRules []string            `json:"matchedRules,omitempty"` // IDs of the rules whose response was used
+	Instance     string              `json:"instance,omitempty"`     // Instance that captured the event, set on events relayed from other instances
+	Rejected     string              `json:"rejected,omitempty"`     // Why the webhook was refused, for refused webhooks that are recorded
+	Signature    *SignatureResult    `json:"signature,omitempty"`    // Outcome of signature verification, for keys that verify
+	ClientCert   *ClientCertInfo     `json:"clientCert,omitempty"`   // Certificate chain the client presented over mutual TLS
+	OpenAPI      *OpenAPIResult      `json:"openapi,omitempty"`      // Outcome of validation against the key's OpenAPI document
+	Avro         *AvroResult         `json:"avro,omitempty"`         // Outcome of Avro decoding, for Avro bodies
+	JWT          *JWTResult          `json:"jwt,omitempty"`          // Decoded bearer token, for webhooks that carry one
+	Plugins      []PluginResult      `json:"plugins,omitempty"`      // Outcomes of the key's validate plugins, and of plugins that failed
+	Headers      map[string][]string `json:"headers"`                // Request headers
+	Body         string              `json:"body"`                   // Request body
+	PrettyBody   string              `json:"prettyBody,omitempty"`   // Body re-indented for display, for XML bodies
+}
+
+// RuleError records a rule whose condition failed while a webhook was evaluated.
+type RuleError struct {
+	RuleID string `json:"ruleId"`
+	Rule   string `json:"rule,omitempty"` // Rule name
+	Error  string `json:"error"`
 }
 
 // EventsResponse is the JSON response structure for the /api/events endpoint.
@@ -64,32 +382,131 @@ type EventsResponse struct {
 	Events []Event `json:"events"`
 }
 
-// storeEvent captures an incoming webhook request and stores it in memory.
-// It maintains a maximum of 50 events, discarding the oldest when the limit is reached.
-func (a *App) storeEvent(r *http.Request, key, body string) Event {
+// RuleTrace records how one rule was evaluated for a webhook request.
+type RuleTrace struct {
+	RuleID  string `json:"ruleId"`
+	Rule    string `json:"rule,omitempty"`    // Rule name
+	Group   string `json:"group,omitempty"`   // Group the rule belongs to
+	Matched bool   `json:"matched"`           // Result of the condition
+	Else    bool   `json:"else,omitempty"`    // The rule's else response was used
+	Skipped string `json:"skipped,omitempty"` // Why the condition was not evaluated
+	Error   string `json:"error,omitempty"`   // Why the condition or a capture failed to evaluate
+}
+
+// ruleEvaluation collects the trace of evaluating a key's rules for one request.
+type ruleEvaluation struct {
+	trace   []RuleTrace
+	matched []string // IDs of the rules whose response is used
+}
+
+// record appends a rule's trace and reports whether the rule matched.
+func (e *ruleEvaluation) record(trace RuleTrace) bool {
+	e.trace = append(e.trace, trace)
+	return trace.Matched
+}
+
+// fail records an evaluation failure on the latest trace of a rule.
+func (e *ruleEvaluation) fail(ruleID string, err error) {
+	for i := len(e.trace) - 1; i >= 0; i-- {
+		if e.trace[i].RuleID == ruleID {
+			e.trace[i].Error = strings.TrimPrefix(e.trace[i].Error+"; "+err.Error(), "; ")
+			return
+		}
+	}
+}
+
+// errors returns the rules whose condition or captures failed to evaluate.
+func (e *ruleEvaluation) errors() []RuleError {
+	var errs []RuleError
+	for _, trace := range e.trace {
+		if trace.Error != "" {
+			errs = append(errs, RuleError{RuleID: trace.RuleID, Rule: trace.Rule, Error: trace.Error})
+		}
+	}
+	return errs
+}
+
+// recordRuleEvaluation stores the outcome of rule evaluation on a stored event and
+// returns the updated event.
+func (a *App) recordRuleEvaluation(event Event, eval *ruleEvaluation) Event {
+	if len(eval.trace) == 0 {
+		return event
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	event.RuleErrors = eval.errors()
+	event.RuleTrace = eval.trace
+	event.MatchedRules = eval.matched
+	a.store.Update(event)
+	return event
+}
+
+// announceEvent records the outcome of rule evaluation on a stored event, then
+// broadcasts it to SSE subscribers, notifies matched rules and registered
+// notifiers, publishes it to the configured sinks, runs the event hooks, and
+// passes it to the key's notify plugins.
+func (a *App) announceEvent(key string, event Event, eval *ruleEvaluation) {
+	event = a.recordRuleEvaluation(event, eval)
+	a.broadcastEvent(event)
+	a.notifyRuleMatches(key, event, eval)
+	a.dispatchNotifiers(event)
+	a.publishEvent(event)
+	a.runEventHooks(event, eval)
+	a.notifyPlugins(key, event)
+}
+
+// storeEvent captures an incoming webhook request and stores it in the app's
+// EventStore, which keeps the maxEventsLocked newest events: maxEvents unless
+// set by WithMaxEvents.
+func (a *App) storeEvent(r *http.Request, key string, body *requestBody, tags ...string) Event {
+	pretty := body.prettyBody()
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	known := a.keyKnownLocked(key)
 	a.lastID++
 	event := Event{
-		ID:        a.lastID,
-		Timestamp: time.Now(),
-		Method:    r.Method,
-		Path:      r.URL.Path,
-		Key:       key,
-		Headers:   r.Header,
-		Body:      body,
+		ID:         a.lastID,
+		Timestamp:  a.now(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Key:        key,
+		Tags:       tags,
+		Headers:    r.Header,
+		Body:       body.text,
+		PrettyBody: pretty,
+		ClientCert: clientCertInfo(r.TLS),
 	}
 
-	const maxEvents = 50
-	a.events = append([]Event{event}, a.events...)
-	if len(a.events) > maxEvents {
-		a.events = a.events[:maxEvents]
-	}
+	a.store.Add(event, a.maxEventsLocked())
+	a.keyChangedLocked(key, known)
 
 	return event
 }
 
+// saveEvent replaces the stored event with the same ID as event, if it is still stored.
+func (a *App) saveEvent(event Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.store.Update(event)
+}
+
+// getEvent returns a stored event by ID.
+func (a *App) getEvent(id int) (Event, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, event := range a.store.Events() {
+		if event.ID == id {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
 // getResponseConfig returns the response configuration for the given webhook key.
 // If no configuration exists for the key, it falls back to "default", then to a
 // hardcoded fallback response.
@@ -97,10 +514,6 @@ func (a *App) getResponseConfig(key string) ResponseConfig {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.responses == nil {
-		a.responses = make(map[string]ResponseConfig)
-	}
-
 	if config, ok := a.responses[key]; ok {
 		return config
 	}
@@ -123,27 +536,144 @@ func (a *App) setResponseConfig(key string, config ResponseConfig) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.responses == nil {
-		a.responses = make(map[string]ResponseConfig)
+	if key == "" {
+		key = "default"
 	}
+	a.cancelOverrideLocked(key)
+	known := a.keyKnownLocked(key)
+	a.responses[key] = config
+	a.configChangedLocked(key, known)
+}
+
+// responseOverride tracks a temporary response configuration and the config it replaced.
+type responseOverride struct {
+	previous  *ResponseConfig // nil if the key had no config of its own
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// setTemporaryResponseConfig stores a response configuration for the given webhook key
+// that is reverted after ttl. Overriding an active override keeps the original config
+// as the one to restore.
+func (a *App) setTemporaryResponseConfig(key string, config ResponseConfig, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if key == "" {
 		key = "default"
 	}
+
+	override := &responseOverride{expiresAt: a.now().Add(ttl)}
+	if active, ok := a.overrides[key]; ok {
+		active.timer.Stop()
+		override.previous = active.previous
+	} else if current, ok := a.responses[key]; ok {
+		override.previous = &current
+	}
+	override.timer = time.AfterFunc(ttl, func() {
+		a.restoreResponseConfig(key, override)
+	})
+
+	a.overrides[key] = override
+	known := a.keyKnownLocked(key)
 	a.responses[key] = config
+	a.configChangedLocked(key, known)
 }
 
-// addSubscriber creates a new SSE subscriber channel and registers it.
-// Events will be broadcast to this channel until removeSubscriber is called.
-func (a *App) addSubscriber() chan Event {
+// restoreResponseConfig reverts an expired override, unless it was replaced in the meantime.
+func (a *App) restoreResponseConfig(key string, override *responseOverride) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.overrides[key] != override {
+		return
+	}
+	delete(a.overrides, key)
+	if override.previous != nil {
+		a.responses[key] = *override.previous
+	} else {
+		delete(a.responses, key)
+	}
+	a.configChangedLocked(key, true)
+}
+
+// cancelOverrideLocked discards a pending override restore for key.
+// The caller must hold a.mu.
+func (a *App) cancelOverrideLocked(key string) {
+	if override, ok := a.overrides[key]; ok {
+		override.timer.Stop()
+		delete(a.overrides, key)
+	}
+}
+
+// getOverrideExpiry returns when the temporary config of key expires, if it has one.
+func (a *App) getOverrideExpiry(key string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if override, ok := a.overrides[key]; ok {
+		return override.expiresAt, true
+	}
+	return time.Time{}, false
+}
+
+// getResponseConfigs returns a copy of every stored response configuration keyed by webhook key.
+func (a *App) getResponseConfigs() map[string]ResponseConfig {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.subscribers == nil {
-		a.subscribers = make(map[chan Event]struct{})
+	configs := make(map[string]ResponseConfig, len(a.responses))
+	for key, config := range a.responses {
+		configs[key] = config
+	}
+	return configs
+}
+
+// deleteResponseConfig removes the response configuration for the given webhook key,
+// so the key falls back to the default response. Returns true if a config was removed.
+func (a *App) deleteResponseConfig(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key == "" {
+		key = "default"
+	}
+	if _, ok := a.responses[key]; !ok {
+		return false
 	}
+	a.cancelOverrideLocked(key)
+	delete(a.responses, key)
+	delete(a.rateWindows, key)
+	a.configChangedLocked(key, true)
+	return true
+}
+
+// setStreamBuffer sets how many messages subscribers added from now on can
+// fall behind by.
+func (a *App) setStreamBuffer(size int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.streamBuffer = size
+}
+
+// addSubscriber creates a new SSE subscriber channel and registers it.
+// Events will be broadcast to this channel until removeSubscriber is called.
+// With keys, only events of those webhook keys are sent to the channel.
+func (a *App) addSubscriber(keys ...string) chan Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	ch := make(chan Event, 1)
+	size := cmp.Or(a.streamBuffer, defaultStreamBuffer)
+	ch := make(chan Event, size)
 	a.subscribers[ch] = struct{}{}
+	a.notices[ch] = make(chan StreamNotice, size)
+	if len(keys) > 0 {
+		filter := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			filter[key] = true
+		}
+		a.subscriberKeys[ch] = filter
+	}
 	return ch
 }
 
@@ -156,19 +686,45 @@ func (a *App) removeSubscriber(ch chan Event) {
 		return
 	}
 	delete(a.subscribers, ch)
+	delete(a.subscriberKeys, ch)
+	delete(a.notices, ch)
+	delete(a.drops, ch)
+	delete(a.delivered, ch)
 	close(ch)
 }
 
-// broadcastEvent sends an event to all registered SSE subscribers.
-// Non-blocking: if a subscriber's channel is full, the event is dropped for that subscriber.
+// broadcastEvent sends an event to all registered SSE subscribers of its key and,
+// with a bridge, to the subscribers of the other instances.
 func (a *App) broadcastEvent(event Event) {
+	a.deliverEvent(event)
+
+	a.mu.Lock()
+	bridge := a.bridge
+	a.mu.Unlock()
+	if bridge != nil {
+		if err := bridge.Publish(event); err != nil {
+			log.Printf("Publishing event %d to %s failed: %v", event.ID, bridge.Name(), err)
+		}
+	}
+}
+
+// deliverEvent sends an event to the SSE subscribers of its key on this instance.
+// Non-blocking: if a subscriber's channel is full, the event is dropped for that
+// subscriber and counted (see dropLocked).
+func (a *App) deliverEvent(event Event) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	a.broadcasts++
 	for ch := range a.subscribers {
+		if keys, ok := a.subscriberKeys[ch]; ok && !keys[event.Key] {
+			continue
+		}
 		select {
 		case ch <- event:
+			a.deliveredLocked(ch)
 		default:
+			a.dropLocked(ch)
 		}
 	}
 }
@@ -182,6 +738,31 @@ func (a *App) closeSubscribers() {
 		close(ch)
 	}
 	a.subscribers = make(map[chan Event]struct{})
+	a.subscriberKeys = make(map[chan Event]map[string]bool)
+	a.notices = make(map[chan Event]chan StreamNotice)
+	a.drops = make(map[chan Event]int)
+	a.delivered = make(map[chan Event]int)
+}
+
+// shutdownSignal returns a channel that is closed once the server begins shutting down.
+func (a *App) shutdownSignal() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.shutdown
+}
+
+// beginShutdown signals in-flight handlers, such as held connections, that the
+// server is stopping so they can finish before the shutdown timeout.
+func (a *App) beginShutdown() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	select {
+	case <-a.shutdown:
+	default:
+		close(a.shutdown)
+	}
 }
 
 // getKeys returns a sorted list of all known webhook keys.
@@ -193,7 +774,7 @@ func (a *App) getKeys() []string {
 	keySet := make(map[string]struct{})
 
 	// Add keys from events
-	for _, event := range a.events {
+	for _, event := range a.store.Events() {
 		keySet[event.Key] = struct{}{}
 	}
 
@@ -219,6 +800,38 @@ func (a *App) getKeys() []string {
 	return keys
 }
 
+// copyKey duplicates the response configuration and rules of src into dst,
+// replacing whatever dst had. Copied rules get new IDs. Returns false if src has
+// neither a response configuration nor rules.
+func (a *App) copyKey(src, dst string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	config, hasConfig := a.responses[src]
+	rules := a.rules[src]
+	if !hasConfig && len(rules) == 0 {
+		return false
+	}
+	known := a.keyKnownLocked(dst)
+
+	if hasConfig {
+		a.responses[dst] = config
+	}
+
+	copied := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		a.ruleLastID++
+		rule.ID = fmt.Sprintf("rule_%d", a.ruleLastID)
+		copied = append(copied, rule)
+	}
+	a.rules[dst] = copied
+	if hasConfig {
+		a.configChangedLocked(dst, true)
+	}
+	a.rulesChangedLocked(dst, known)
+	return true
+}
+
 // getRules returns all rules for the given webhook key, sorted by priority (ascending).
 // Lower priority values are evaluated first.
 func (a *App) getRules(key string) []Rule {
@@ -233,44 +846,192 @@ func (a *App) getRules(key string) []Rule {
 	if rules == nil {
 		return []Rule{}
 	}
+	expireRulesLocked(rules, a.now())
 
-	// Return sorted by priority
+	// Return sorted by priority; rules with equal priority keep creation order
 	sorted := make([]Rule, len(rules))
 	copy(sorted, rules)
-	sort.Slice(sorted, func(i, j int) bool {
+	sort.SliceStable(sorted, func(i, j int) bool {
 		return sorted[i].Priority < sorted[j].Priority
 	})
 	return sorted
 }
 
-// setRules replaces all rules for the given webhook key.
-func (a *App) setRules(key string, rules []Rule) {
+// nextPriority returns the priority after the last rule of key in group, or 0 if
+// the group has no rules, so rules created without a priority are evaluated last.
+func (a *App) nextPriority(key, group string) int {
+	next := 0
+	for _, rule := range a.getRules(key) {
+		if rule.Group == group && rule.Priority >= next {
+			next = rule.Priority + 1
+		}
+	}
+	return next
+}
+
+// getRule returns a rule of key by ID.
+func (a *App) getRule(key, ruleID string) (Rule, bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.rules == nil {
-		a.rules = make(map[string][]Rule)
+	rules := a.rules[key]
+	expireRulesLocked(rules, a.now())
+	for _, rule := range rules {
+		if rule.ID == ruleID {
+			return rule, true
+		}
 	}
-	a.rules[key] = rules
+	return Rule{}, false
 }
 
-// addRule adds a new rule for the given webhook key and assigns it a unique ID.
-func (a *App) addRule(key string, rule Rule) Rule {
+// setRules atomically replaces all rules for the given webhook key and returns the
+// stored rules. Rules keep their IDs, so a rule set can be synced repeatedly;
+// rules without an ID are assigned one. Each rule is saved as a new version, and
+// the history of rules that are no longer present is discarded. An ID may appear
+// only once and must not belong to a rule of another key.
+func (a *App) setRules(key string, rules []Rule) ([]Rule, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.rules == nil {
-		a.rules = make(map[string][]Rule)
+	owners := make(map[string]string)
+	for ruleKey, keyRules := range a.rules {
+		for _, rule := range keyRules {
+			owners[rule.ID] = ruleKey
+		}
+	}
+	ids := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.ID == "" {
+			continue
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule ID %q", rule.ID)
+		}
+		if owner, ok := owners[rule.ID]; ok && owner != key {
+			return nil, fmt.Errorf("rule ID %q belongs to key %q", rule.ID, owner)
+		}
+		ids[rule.ID] = true
+	}
+
+	known := a.keyKnownLocked(key)
+	previous := make(map[string]Rule)
+	for _, rule := range a.rules[key] {
+		previous[rule.ID] = rule
+		if !ids[rule.ID] {
+			delete(a.ruleHistory, rule.ID)
+		}
+	}
+	now := a.now()
+	stored := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			a.ruleLastID++
+			rule.ID = fmt.Sprintf("rule_%d", a.ruleLastID)
+		}
+		if old, ok := previous[rule.ID]; ok {
+			rule.updateExpiry(old, now)
+		} else {
+			rule.startExpiry(now)
+		}
+		a.recordRuleVersionLocked(rule, now)
+		stored[i] = rule
+	}
+	a.rules[key] = stored
+	a.rulesChangedLocked(key, known)
+	return append([]Rule(nil), stored...), nil
+}
+
+// startExpiry sets ExpiresAt for a rule with a TTL that is being stored at now,
+// and clears a previous expiry flag.
+func (rule *Rule) startExpiry(now time.Time) {
+	if rule.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(rule.ExpiresIn))
+		rule.ExpiresAt = &expiresAt
+	}
+	rule.Expired = false
+}
+
+// updateExpiry carries the expiry of previous, the stored version of rule,
+// over to rule, so edits such as renaming or toggling it don't push its
+// deadline back. The countdown restarts at now only when ExpiresIn changes, or
+// when an expired rule is enabled again.
+func (rule *Rule) updateExpiry(previous Rule, now time.Time) {
+	if rule.ExpiresIn != previous.ExpiresIn || (previous.Expired && rule.Enabled) {
+		if rule.ExpiresIn <= 0 {
+			rule.ExpiresAt = nil
+		}
+		rule.startExpiry(now)
+		return
+	}
+	rule.ExpiresAt, rule.Expired = previous.ExpiresAt, previous.Expired && !rule.Enabled
+}
+
+// expireRulesLocked disables the rules whose expiry time has passed.
+// The caller must hold a.mu.
+func expireRulesLocked(rules []Rule, now time.Time) {
+	for i := range rules {
+		if rules[i].ExpiresAt != nil && !rules[i].Expired && !now.Before(*rules[i].ExpiresAt) {
+			rules[i].Enabled = false
+			rules[i].Expired = true
+		}
 	}
+}
+
+// replaceRules replaces all rules for the given webhook key, assigning each a new ID.
+func (a *App) replaceRules(key string, rules []Rule) []Rule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	known := a.keyKnownLocked(key)
+	for _, rule := range a.rules[key] {
+		delete(a.ruleHistory, rule.ID)
+	}
+	now := a.now()
+	replaced := make([]Rule, len(rules))
+	for i, rule := range rules {
+		rule.startExpiry(now)
+		a.ruleLastID++
+		rule.ID = fmt.Sprintf("rule_%d", a.ruleLastID)
+		a.recordRuleVersionLocked(rule, now)
+		replaced[i] = rule
+	}
+	a.rules[key] = replaced
+	a.rulesChangedLocked(key, known)
+	return append([]Rule(nil), replaced...)
+}
+
+// globalRuleKey is the rule scope whose rules apply to every webhook key.
+const globalRuleKey = "*"
+
+// keyRules returns the rules evaluated for webhooks to key: the global rules,
+// then the key's own rules, each in priority order.
+func (a *App) keyRules(key string) []Rule {
+	if key == globalRuleKey {
+		return a.getRules(key)
+	}
+	return append(a.getRules(globalRuleKey), a.getRules(key)...)
+}
+
+// addRule adds a new rule for the given webhook key and assigns it a unique ID.
+// The rule is saved as the first version in its history.
+func (a *App) addRule(key string, rule Rule) Rule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
 	a.ruleLastID++
 	rule.ID = fmt.Sprintf("rule_%d", a.ruleLastID)
+	now := a.now()
+	rule.startExpiry(now)
+	a.recordRuleVersionLocked(rule, now)
 
+	known := a.keyKnownLocked(key)
 	a.rules[key] = append(a.rules[key], rule)
+	a.rulesChangedLocked(key, known)
 	return rule
 }
 
-// updateRule updates an existing rule by ID. Returns true if the rule was found and updated.
+// updateRule updates an existing rule by ID, saving it as a new version in the
+// rule's history. Returns true if the rule was found and updated.
 func (a *App) updateRule(key string, ruleID string, updated Rule) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -283,15 +1044,19 @@ func (a *App) updateRule(key string, ruleID string, updated Rule) bool {
 	for i, r := range rules {
 		if r.ID == ruleID {
 			updated.ID = ruleID
+			now := a.now()
+			updated.updateExpiry(r, now)
+			a.recordRuleVersionLocked(updated, now)
 			rules[i] = updated
 			a.rules[key] = rules
+			a.rulesChangedLocked(key, true)
 			return true
 		}
 	}
 	return false
 }
 
-// deleteRule removes a rule by ID. Returns true if the rule was found and deleted.
+// deleteRule removes a rule and its history by ID. Returns true if the rule was found and deleted.
 func (a *App) deleteRule(key string, ruleID string) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -304,61 +1069,381 @@ func (a *App) deleteRule(key string, ruleID string) bool {
 	for i, r := range rules {
 		if r.ID == ruleID {
 			a.rules[key] = append(rules[:i], rules[i+1:]...)
+			delete(a.ruleHistory, ruleID)
+			a.rulesChangedLocked(key, true)
 			return true
 		}
 	}
 	return false
 }
 
+// reorderRules rewrites the priorities of a key's rules to follow the given order
+// of rule IDs (the first ID gets priority 0). ids must list every rule of the key
+// exactly once; otherwise no priorities change.
+func (a *App) reorderRules(key string, ids []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rules := a.rules[key]
+	if len(ids) != len(rules) {
+		return fmt.Errorf("expected %d rule IDs, got %d", len(rules), len(ids))
+	}
+
+	positions := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, dup := positions[id]; dup {
+			return fmt.Errorf("duplicate rule ID %q", id)
+		}
+		positions[id] = i
+	}
+	for _, rule := range rules {
+		if _, ok := positions[rule.ID]; !ok {
+			return fmt.Errorf("rule %q missing from order", rule.ID)
+		}
+	}
+
+	for i := range rules {
+		rules[i].Priority = positions[rules[i].ID]
+	}
+	a.rulesChangedLocked(key, true)
+	return nil
+}
+
 // evaluateRules checks all enabled rules for a key and returns the first matching response.
-// Rules are evaluated in priority order. The expression environment includes:
-//   - body: parsed JSON body (or raw string if not valid JSON)
-//   - method: HTTP method string
-//   - headers: map of header names to values
+// It evaluates the rules against an environment with only body, method, and headers
+// set; see evaluateRulesEnv.
 //
 // Returns nil if no rule matches.
 func (a *App) evaluateRules(key string, body string, method string, headers map[string][]string) (*ResponseConfig, error) {
-	rules := a.getRules(key)
+	return a.evaluateRulesEnv(key, expressionEnv(parseBody(body), method, headers), &ruleEvaluation{}), nil
+}
 
-	// Parse body as JSON for expression evaluation
-	var bodyData interface{}
-	if body != "" {
-		if err := json.Unmarshal([]byte(body), &bodyData); err != nil {
-			// If body is not valid JSON, use it as a string
-			bodyData = body
-		}
+// evaluateRulesEnv checks all enabled rules for a key against env and returns the
+// response of the matching rules, combined according to the key's rule match
+// strategy. Global rules (see keyRules) are evaluated before the key's rules, each
+// in priority order. Rules whose scenario is not in their required state are
+// skipped, and a match moves the rule's scenario to its new state.
+// Tag rules never produce a response (see matchTags).
+//
+// Only ungrouped rules are evaluated at first. A matching rule with Then continues
+// into the rules of that group; if none of them match, evaluation resumes after
+// the chaining rule. A rule with an else branch whose condition is false responds
+// with its else response instead of letting evaluation continue.
+//
+// Every rule considered is recorded in eval. Returns nil if no rule matches.
+func (a *App) evaluateRulesEnv(key string, env map[string]interface{}, eval *ruleEvaluation) *ResponseConfig {
+	strategy := a.getResponseConfig(key).RuleMatch
+	all := strategy == RuleMatchLast || strategy == RuleMatchMerge
+	matches := a.evaluateGroup(a.keyRules(key), "", env, map[string]bool{"": true}, all, eval)
+	if len(matches) == 0 {
+		return nil // No rule matched
+	}
+	if strategy == RuleMatchLast {
+		matches = matches[len(matches)-1:]
 	}
 
-	// Build environment for expression evaluation
-	env := map[string]interface{}{
-		"body":    bodyData,
-		"method":  method,
-		"headers": headers,
+	for _, rule := range matches {
+		eval.matched = append(eval.matched, rule.ID)
 	}
+	config := mergeRuleResponses(matches)
+	config.captures = captureValues(matches, env, eval)
+	return &config
+}
 
+// captureValues evaluates the captures of the rules producing a response. A name
+// captured by several merged rules takes the first rule's value. Captures that fail
+// to evaluate are left unset and recorded as errors of their rule in eval.
+func captureValues(rules []Rule, env map[string]interface{}, eval *ruleEvaluation) map[string]interface{} {
+	var captures map[string]interface{}
 	for _, rule := range rules {
-		if !rule.Enabled {
-			continue
+		for name, expression := range rule.Captures {
+			if _, ok := captures[name]; ok {
+				continue
+			}
+			program, err := compileExpression(expression, env, false)
+			if err != nil {
+				eval.fail(rule.ID, fmt.Errorf("capture %q: %w", name, err))
+				continue
+			}
+			value, err := runExpression(program, env)
+			if err != nil {
+				eval.fail(rule.ID, fmt.Errorf("capture %q: %w", name, err))
+				continue
+			}
+			if captures == nil {
+				captures = make(map[string]interface{})
+			}
+			captures[name] = value
 		}
+	}
+	return captures
+}
 
-		// Compile and evaluate the expression
-		program, err := expr.Compile(rule.Condition, expr.Env(env), expr.AsBool())
-		if err != nil {
-			continue // Skip invalid expressions
+// evaluateGroup returns the matching rules in group that produce a response,
+// following chains into other groups. Unless all is set, it stops at the first one.
+// visited holds the groups on the current chain so cycles are not followed.
+func (a *App) evaluateGroup(rules []Rule, group string, env map[string]interface{}, visited map[string]bool, all bool, eval *ruleEvaluation) []Rule {
+	var matches []Rule
+	for _, rule := range rules {
+		if rule.Group != group || rule.Action == ActionTag {
+			continue
+		}
+		trace := a.traceRule(rule, env)
+		if trace.Matched && rule.Scenario != "" && rule.NewState != "" {
+			// Another webhook may have moved the scenario on since traceRule
+			// checked it, so the match only counts if the transition is made.
+			if state, ok := a.moveScenario(rule.Scenario, rule.RequiredState, rule.NewState); !ok {
+				trace.Matched = false
+				trace.Skipped = fmt.Sprintf("scenario %q is in state %q", rule.Scenario, state)
+			}
+		}
+		if !trace.Matched {
+			// A false condition selects the else branch, which ends evaluation like a match.
+			trace.Else = trace.Skipped == "" && trace.Error == "" && rule.hasElse()
+			eval.record(trace)
+			if trace.Else {
+				matches = append(matches, rule.elseBranch())
+				if !all {
+					return matches
+				}
+			}
+			continue
 		}
+		eval.record(trace)
+		if rule.Then != "" {
+			if visited[rule.Then] {
+				continue
+			}
+			visited[rule.Then] = true
+			chained := a.evaluateGroup(rules, rule.Then, env, visited, all, eval)
+			delete(visited, rule.Then)
+			matches = append(matches, chained...)
+			if !all && len(matches) > 0 {
+				return matches
+			}
+			continue
+		}
+		matches = append(matches, rule)
+		if !all {
+			return matches
+		}
+	}
+	return matches
+}
 
-		result, err := expr.Run(program, env)
-		if err != nil {
+// matchTags returns the tags of every enabled tag rule for key that matches env,
+// global ones included, in evaluation order and without duplicates. Tag rules apply
+// regardless of group.
+// Every tag rule considered is recorded in eval.
+func (a *App) matchTags(key string, env map[string]interface{}, eval *ruleEvaluation) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, rule := range a.keyRules(key) {
+		if rule.Action != ActionTag || !eval.record(a.traceRule(rule, env)) {
 			continue
 		}
+		for _, tag := range rule.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// traceRule evaluates a rule against the request described by env and reports the
+// outcome. Disabled rules, rules outside their active window, and rules whose
+// scenario is not in the required state are skipped without evaluating the condition.
+// A condition that fails to compile or evaluate, exceeds the evaluation limits, or
+// does not return a boolean never matches; the failure is reported in Error.
+func (a *App) traceRule(rule Rule, env map[string]interface{}) RuleTrace {
+	trace := RuleTrace{RuleID: rule.ID, Rule: rule.Name, Group: rule.Group}
+	if !rule.Enabled {
+		trace.Skipped = "disabled"
+		return trace
+	}
+	if !rule.activeAt(a.now()) {
+		trace.Skipped = "inactive"
+		return trace
+	}
+	if rule.Scenario != "" && rule.RequiredState != "" {
+		if state := a.scenarioState(rule.Scenario); state != rule.RequiredState {
+			trace.Skipped = fmt.Sprintf("scenario %q is in state %q", rule.Scenario, state)
+			return trace
+		}
+	}
+
+	matched, err := conditionMatches(rule.Condition, env)
+	trace.Matched = matched
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	return trace
+}
+
+// conditionMatches compiles (or reuses the cached program for) a rule condition and
+// evaluates it against env.
+func conditionMatches(condition string, env map[string]interface{}) (bool, error) {
+	program, err := compileExpression(condition, env, true)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := runExpression(program, env)
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %T, want bool", result)
+	}
+	return matched, nil
+}
+
+// expressionEnv builds the environment for rule conditions and status code
+// expressions from the request body, method, and headers. The other request
+// variables are present but empty; requestEnv and webhookEnv fill them in.
+// The environment includes:
+//   - body: parsed JSON body (or raw string if not valid JSON)
+//   - rawBody: the body exactly as received, e.g. for signature checks
+//   - method: HTTP method string
+//   - headers: map of header names to values
+//   - path: request path
+//   - query: map of query parameters (first value)
+//   - cookies: map of cookie names to values
+//   - remoteAddr: client IP address
+//   - contentType: media type of the body without parameters, e.g. "application/json"
+//   - isJSON, isXML, isForm: whether the body is valid JSON, well-formed XML, or
+//     URL-encoded form data, whatever its Content-Type says
+//   - key: webhook key
+//   - signature: {provider, valid, error} outcome of the key's signature verification
+//   - cert: {present, verified, subject, commonName, issuer, ...} client certificate
+//     presented over mutual TLS, with the whole chain
+//   - openapi: {operation, valid, violations} outcome of validation against the
+//     key's OpenAPI document
+//   - avro: {decoded, schemaId, schema, error} outcome of decoding an Avro body
+//   - jwt: {present, source, header, claims, verified, expired, error} bearer token
+//     the webhook carries
+//   - header(name): first value of a header, matching name case-insensitively
+//   - rate(key, window): webhooks key received in the window, e.g. "1m"
+//   - seen(key, expression, value): whether an earlier event of key has expression equal value
+//   - countMatching(condition, window): earlier events of this key in the window matching condition
+//
+// The last three only work in environments built by webhookEnv.
+// It also holds the helper functions from expressionFuncs.
+func expressionEnv(body *requestBody, method string, headers map[string][]string) map[string]interface{} {
+	env := map[string]interface{}{
+		"body":        body.value,
+		"rawBody":     body.text,
+		"method":      method,
+		"headers":     headers,
+		"path":        "",
+		"query":       map[string]string{},
+		"cookies":     map[string]string{},
+		"remoteAddr":  "",
+		"contentType": mediaType(headerValue(headers, "Content-Type")),
+		"isJSON":      body.isJSON,
+		"isXML":       body.xml != nil,
+		"isForm":      isFormBody(body.text),
+		"key":         "",
+		"signature":   signatureEnv(nil),
+		"cert":        clientCertEnv(nil),
+		"openapi":     openAPIEnv(nil),
+		"avro":        avroEnv(nil),
+		"jwt":         jwtEnv(nil),
+		"plugins":     pluginEnv(nil),
+		"header": func(name string) string {
+			return headerValue(headers, name)
+		},
+		"rate": func(key, window string) (int, error) {
+			return 0, errHelperUnavailable
+		},
+		"seen": func(key, expression string, value interface{}) (bool, error) {
+			return false, errHelperUnavailable
+		},
+		"countMatching": func(condition, window string) (int, error) {
+			return 0, errHelperUnavailable
+		},
+	}
+	for name, fn := range expressionFuncs() {
+		env[name] = fn
+	}
+	return env
+}
+
+// requestEnv builds the expression environment for a webhook request.
+func requestEnv(r *http.Request, body *requestBody) map[string]interface{} {
+	env := expressionEnv(body, r.Method, r.Header)
+	env["path"] = r.URL.Path
+
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+	env["query"] = query
 
-		if matched, ok := result.(bool); ok && matched {
-			return &ResponseConfig{
-				Response:   rule.Response,
-				StatusCode: rule.StatusCode,
-			}, nil
+	cookies := make(map[string]string)
+	for _, cookie := range r.Cookies() {
+		if _, ok := cookies[cookie.Name]; !ok {
+			cookies[cookie.Name] = cookie.Value
 		}
 	}
+	env["cookies"] = cookies
+
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	env["remoteAddr"] = remoteAddr
+	env["cert"] = clientCertEnv(clientCertInfo(r.TLS))
+
+	return env
+}
+
+// validationEnv is an empty expression environment used to check expressions
+// for syntax errors before they are stored.
+func validationEnv() map[string]interface{} {
+	env := expressionEnv(parseBody(""), "", map[string][]string{})
+	env["body"] = map[string]interface{}{}
+	return env
+}
+
+// validateStatusCodeExpr checks that a status code expression compiles.
+func validateStatusCodeExpr(expression string) error {
+	_, err := expr.Compile(expression, expr.Env(validationEnv()), expr.MaxNodes(maxExpressionNodes))
+	return err
+}
+
+// evaluateStatusCode runs a status code expression against env. The result must
+// be a whole number between 100 and 599.
+func evaluateStatusCode(expression string, env map[string]interface{}) (int, error) {
+	program, err := compileExpression(expression, env, false)
+	if err != nil {
+		return 0, err
+	}
+	result, err := runExpression(program, env)
+	if err != nil {
+		return 0, err
+	}
 
-	return nil, nil // No rule matched
+	var code int
+	switch v := result.(type) {
+	case int:
+		code = v
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("status code %v is not a whole number", v)
+		}
+		code = int(v)
+	default:
+		return 0, fmt.Errorf("status code expression returned %T, want a number", result)
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("status code %d out of range", code)
+	}
+	return code, nil
 }
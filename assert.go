@@ -0,0 +1,424 @@
+package hooklab
+
+// This file contains contract assertions: CI calls POST /api/assert with the
+// webhooks a producer should have sent (method, header and body matchers, how
+// many, and when), and gets back whether the stored events satisfy each
+// expectation, with the reasons the closest events didn't match when not.
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxAssertMismatches is how many non-matching events are explained per failed expectation.
+const maxAssertMismatches = 3
+
+// AssertRequest is the body of a POST /api/assert request.
+type AssertRequest struct {
+	Key    string        `json:"key,omitempty"`    // Key expectations default to (default: the key query parameter, then "default")
+	Within Duration      `json:"within,omitempty"` // Only count events received this long ago or later
+	Since  time.Time     `json:"since,omitzero"`   // Only count events received at or after this time
+	Expect []Expectation `json:"expect"`
+}
+
+// Expectation describes webhooks a producer is expected to have sent. Without
+// count, min, or max, at least one matching event is expected.
+type Expectation struct {
+	Name      string                     `json:"name,omitempty"`
+	Key       string                     `json:"key,omitempty"`       // Key the webhooks were sent to (default: the request's key)
+	Method    string                     `json:"method,omitempty"`    // HTTP method, matched case-insensitively
+	Headers   map[string]json.RawMessage `json:"headers,omitempty"`   // Matchers for the first value of each header
+	Body      map[string]json.RawMessage `json:"body,omitempty"`      // Matchers by JSONPath into the body, e.g. "$.type"
+	Condition string                     `json:"condition,omitempty"` // Rule expression evaluated against each event
+	Count     *int                       `json:"count,omitempty"`     // Exact number of matching events
+	Min       *int                       `json:"min,omitempty"`       // Fewest matching events
+	Max       *int                       `json:"max,omitempty"`       // Most matching events
+	Within    Duration                   `json:"within,omitempty"`    // Overrides the request's window
+}
+
+// AssertResult is the outcome of one expectation.
+type AssertResult struct {
+	Name       string          `json:"name,omitempty"`
+	Pass       bool            `json:"pass"`
+	Matched    int             `json:"matched"`              // Matching events in the window
+	Expected   string          `json:"expected"`             // e.g. "exactly 1" or "at least 1"
+	EventIDs   []int           `json:"eventIds"`             // IDs of the matching events, newest first
+	Mismatches []AssertMissing `json:"mismatches,omitempty"` // Why the newest other events of the key didn't match, on failure
+}
+
+// AssertMissing explains why an event didn't match an expectation.
+type AssertMissing struct {
+	EventID int      `json:"eventId"`
+	Reasons []string `json:"reasons"`
+}
+
+// matcher checks a value found in an event. It is a JSON literal the value must
+// equal, numbers being compared by value, or an object of operators that must
+// all hold: $eq, $ne, $regex, $contains, $exists, $gt, $gte, $lt, and $lte.
+type matcher struct {
+	literal interface{}
+	ops     map[string]interface{}
+	re      *regexp.Regexp
+}
+
+// matcherOps are the operators a matcher object can use.
+var matcherOps = []string{"$eq", "$ne", "$regex", "$contains", "$exists", "$gt", "$gte", "$lt", "$lte"}
+
+// parseMatcher parses a matcher from its JSON form.
+func parseMatcher(raw json.RawMessage) (*matcher, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) == 0 {
+		return &matcher{literal: value}, nil
+	}
+	operators := 0
+	for name := range object {
+		if strings.HasPrefix(name, "$") {
+			operators++
+		}
+	}
+	if operators == 0 {
+		return &matcher{literal: value}, nil
+	}
+	if operators != len(object) {
+		return nil, errors.New("operators can't be mixed with fields")
+	}
+
+	m := &matcher{ops: object}
+	for _, name := range sortedKeys(object) {
+		operand := object[name]
+		switch name {
+		case "$eq", "$ne":
+		case "$regex", "$contains":
+			s, ok := operand.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s needs a string", name)
+			}
+			if name == "$regex" {
+				re, err := regexp.Compile(s)
+				if err != nil {
+					return nil, fmt.Errorf("$regex: %w", err)
+				}
+				m.re = re
+			}
+		case "$exists":
+			if _, ok := operand.(bool); !ok {
+				return nil, errors.New("$exists needs true or false")
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			if _, ok := operand.(float64); !ok {
+				return nil, fmt.Errorf("%s needs a number", name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown operator %s, want one of %s", name, strings.Join(matcherOps, ", "))
+		}
+	}
+	return m, nil
+}
+
+// matches reports whether value satisfies the matcher. A nil value is a
+// missing one.
+func (m *matcher) matches(value interface{}) bool {
+	if m.ops == nil {
+		return sameValue(value, m.literal)
+	}
+	for name, operand := range m.ops {
+		var ok bool
+		switch name {
+		case "$eq":
+			ok = sameValue(value, operand)
+		case "$ne":
+			ok = !sameValue(value, operand)
+		case "$regex":
+			s, isString := value.(string)
+			ok = isString && m.re.MatchString(s)
+		case "$contains":
+			ok = containsValue(value, operand.(string))
+		case "$exists":
+			ok = (value != nil) == operand.(bool)
+		default:
+			n, isNumber := toFloat(value)
+			want := operand.(float64)
+			switch name {
+			case "$gt":
+				ok = isNumber && n > want
+			case "$gte":
+				ok = isNumber && n >= want
+			case "$lt":
+				ok = isNumber && n < want
+			case "$lte":
+				ok = isNumber && n <= want
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// containsValue reports whether value is a string containing s or a list with
+// an element equal to s.
+func containsValue(value interface{}, s string) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, s)
+	case []interface{}:
+		for _, item := range v {
+			if item == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String describes the matcher for mismatch reasons.
+func (m *matcher) String() string {
+	if m.ops == nil {
+		return compactJSON(m.literal)
+	}
+	return compactJSON(m.ops)
+}
+
+// compactJSON formats a value as JSON, or "missing" for nil.
+func compactJSON(value interface{}) string {
+	if value == nil {
+		return "missing"
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(out)
+}
+
+// compiledExpectation is an Expectation with its matchers parsed and window resolved.
+type compiledExpectation struct {
+	Expectation
+	headers map[string]*matcher
+	body    map[string]*matcher
+	since   time.Time
+	min     int
+	max     int // -1 for no upper bound
+}
+
+// compileExpectations validates req and resolves each expectation's key and
+// window against now.
+func compileExpectations(req AssertRequest, key string, now time.Time) ([]compiledExpectation, error) {
+	if len(req.Expect) == 0 {
+		return nil, errors.New("expect must list at least one expectation")
+	}
+	compiled := make([]compiledExpectation, 0, len(req.Expect))
+	for i, exp := range req.Expect {
+		label := cmp.Or(exp.Name, fmt.Sprintf("expect[%d]", i))
+		c := compiledExpectation{Expectation: exp, min: 1, max: -1}
+		c.Key = cmp.Or(exp.Key, key)
+
+		switch {
+		case exp.Count != nil && (exp.Min != nil || exp.Max != nil):
+			return nil, fmt.Errorf("%s: count can't be combined with min or max", label)
+		case exp.Count != nil:
+			c.min, c.max = *exp.Count, *exp.Count
+		case exp.Min != nil || exp.Max != nil:
+			c.min = 0
+			if exp.Min != nil {
+				c.min = *exp.Min
+			}
+			if exp.Max != nil {
+				c.max = *exp.Max
+			}
+		}
+		if c.min < 0 || (c.max >= 0 && c.max < c.min) || (exp.Max != nil && *exp.Max < 0) {
+			return nil, fmt.Errorf("%s: counts must be non-negative, with max at least min", label)
+		}
+
+		within := cmp.Or(exp.Within, req.Within)
+		if within < 0 {
+			return nil, fmt.Errorf("%s: within must be positive", label)
+		}
+		c.since = req.Since
+		if within > 0 {
+			if start := now.Add(-time.Duration(within)); start.After(c.since) {
+				c.since = start
+			}
+		}
+
+		c.headers = make(map[string]*matcher, len(exp.Headers))
+		for name, raw := range exp.Headers {
+			m, err := parseMatcher(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: header %s: %w", label, name, err)
+			}
+			c.headers[http.CanonicalHeaderKey(name)] = m
+		}
+		c.body = make(map[string]*matcher, len(exp.Body))
+		for path, raw := range exp.Body {
+			if _, err := parseJSONPath(path); err != nil {
+				return nil, fmt.Errorf("%s: %w", label, err)
+			}
+			m, err := parseMatcher(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: body %s: %w", label, path, err)
+			}
+			c.body[path] = m
+		}
+		if exp.Condition != "" {
+			if _, err := compileExpression(exp.Condition, validationEnv(), true); err != nil {
+				return nil, fmt.Errorf("%s: condition: %w", label, err)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// mismatches returns why event doesn't meet the expectation, or nothing when it does.
+func (c compiledExpectation) mismatches(event Event) []string {
+	var reasons []string
+	if c.Method != "" && !strings.EqualFold(event.Method, c.Method) {
+		reasons = append(reasons, fmt.Sprintf("method: got %s, want %s", event.Method, strings.ToUpper(c.Method)))
+	}
+	for _, name := range sortedMatcherKeys(c.headers) {
+		var value interface{}
+		if values := http.Header(event.Headers).Values(name); len(values) > 0 {
+			value = values[0]
+		}
+		if m := c.headers[name]; !m.matches(value) {
+			reasons = append(reasons, fmt.Sprintf("header %s: got %s, want %s", name, compactJSON(value), m))
+		}
+	}
+	if len(c.body) > 0 {
+		body := bodyValue(event.Body)
+		for _, path := range sortedMatcherKeys(c.body) {
+			value, _ := jsonPath(path, body)
+			if m := c.body[path]; !m.matches(value) {
+				reasons = append(reasons, fmt.Sprintf("body %s: got %s, want %s", path, compactJSON(value), m))
+			}
+		}
+	}
+	if c.Condition != "" {
+		matched, err := conditionMatches(c.Condition, eventEnv(event))
+		switch {
+		case err != nil:
+			reasons = append(reasons, "condition: "+err.Error())
+		case !matched:
+			reasons = append(reasons, "condition: false")
+		}
+	}
+	return reasons
+}
+
+// expected describes the expected number of events.
+func (c compiledExpectation) expected() string {
+	switch {
+	case c.min == c.max:
+		return fmt.Sprintf("exactly %d", c.min)
+	case c.max < 0:
+		return fmt.Sprintf("at least %d", c.min)
+	case c.min == 0:
+		return fmt.Sprintf("at most %d", c.max)
+	default:
+		return fmt.Sprintf("between %d and %d", c.min, c.max)
+	}
+}
+
+// sortedMatcherKeys returns the keys of a matcher map in sorted order.
+func sortedMatcherKeys(matchers map[string]*matcher) []string {
+	keys := make([]string, 0, len(matchers))
+	for key := range matchers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// assertExpectations evaluates the expectations against the stored events, which are
+// newest first. Refused webhooks are not counted.
+func assertExpectations(expectations []compiledExpectation, events []Event) []AssertResult {
+	results := make([]AssertResult, 0, len(expectations))
+	for _, c := range expectations {
+		result := AssertResult{Name: c.Name, Expected: c.expected(), EventIDs: []int{}}
+		var misses []AssertMissing
+		for _, event := range events {
+			if event.Key != c.Key || event.Rejected != "" || event.Timestamp.Before(c.since) {
+				continue
+			}
+			reasons := c.mismatches(event)
+			if len(reasons) == 0 {
+				result.Matched++
+				result.EventIDs = append(result.EventIDs, event.ID)
+			} else if len(misses) < maxAssertMismatches {
+				misses = append(misses, AssertMissing{EventID: event.ID, Reasons: reasons})
+			}
+		}
+		result.Pass = result.Matched >= c.min && (c.max < 0 || result.Matched <= c.max)
+		if !result.Pass && result.Matched < c.min {
+			result.Mismatches = misses
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// assertHandler handles POST /api/assert?key={key} requests. The body lists the
+// webhooks a producer was expected to send, and the response reports for each
+// expectation whether the stored events meet it:
+// {"pass": bool, "results": [...]}. The status is 200 when every expectation
+// passes and 417 Expectation Failed otherwise, so CI can fail on it directly.
+func (a *App) assertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var req AssertRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	key := cmp.Or(req.Key, r.URL.Query().Get("key"), "default")
+	expectations, err := compileExpectations(req, key, a.now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	a.mu.Lock()
+	events := append([]Event(nil), a.store.Events()...)
+	a.mu.Unlock()
+
+	results := assertExpectations(expectations, events)
+	pass := true
+	for _, result := range results {
+		pass = pass && result.Pass
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !pass {
+		w.WriteHeader(http.StatusExpectationFailed)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pass":    pass,
+		"results": results,
+	})
+}
@@ -0,0 +1,136 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendWebhook sends a webhook with the given headers and body to key.
+func sendWebhook(t *testing.T, app *App, method, key, body string, headers map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/webhook/"+key, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	app.webhookHandler(httptest.NewRecorder(), req)
+}
+
+// postAssert POSTs an assertion and decodes its response.
+func postAssert(t *testing.T, app *App, target, body string) (int, struct {
+	Pass    bool           `json:"pass"`
+	Results []AssertResult `json:"results"`
+	Error   string         `json:"error"`
+}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.assertHandler(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	var resp struct {
+		Pass    bool           `json:"pass"`
+		Results []AssertResult `json:"results"`
+		Error   string         `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestAssertHandler(t *testing.T) {
+	app := New()
+	sendWebhook(t, app, http.MethodPost, "orders", `{"type":"order.created","id":"ord_1","total":120,"items":["a","b"]}`, map[string]string{"X-Event": "order.created"})
+	sendWebhook(t, app, http.MethodPost, "orders", `{"type":"order.paid","id":"ord_1","total":120}`, map[string]string{"X-Event": "order.paid"})
+	sendWebhook(t, app, http.MethodPost, "refunds", `{"type":"refund.created"}`, nil)
+
+	code, resp := postAssert(t, app, "/api/assert?key=orders", `{
+		"within": "1m",
+		"expect": [
+			{"name": "created", "method": "post", "headers": {"x-event": "order.created"},
+			 "body": {"$.id": {"$regex": "^ord_"}, "$.total": {"$gte": 100}, "$.items": {"$contains": "b"}}, "count": 1},
+			{"name": "paid", "body": {"$.type": "order.paid", "$.coupon": {"$exists": false}}},
+			{"name": "refund", "key": "refunds", "condition": "body.type == \"refund.created\""},
+			{"name": "no deletes", "method": "DELETE", "max": 0}
+		]
+	}`)
+	if code != http.StatusOK || !resp.Pass {
+		t.Fatalf("expected assertions to pass, got %d %+v", code, resp)
+	}
+	if got := resp.Results[0]; got.Matched != 1 || got.Expected != "exactly 1" || len(got.EventIDs) != 1 || got.EventIDs[0] != 1 {
+		t.Errorf("unexpected result %+v", got)
+	}
+	if got := resp.Results[3]; got.Matched != 0 || got.Expected != "exactly 0" {
+		t.Errorf("unexpected result %+v", got)
+	}
+
+	code, resp = postAssert(t, app, "/api/assert?key=orders", `{"expect": [
+		{"name": "shipped", "headers": {"X-Event": "order.shipped"}, "body": {"$.total": 150}},
+		{"name": "two orders", "body": {"$.id": "ord_1"}, "count": 1}
+	]}`)
+	if code != http.StatusExpectationFailed || resp.Pass {
+		t.Fatalf("expected assertions to fail, got %d %+v", code, resp)
+	}
+	shipped := resp.Results[0]
+	if shipped.Pass || shipped.Matched != 0 || len(shipped.Mismatches) != 2 {
+		t.Fatalf("unexpected result %+v", shipped)
+	}
+	want := []string{`header X-Event: got "order.paid", want "order.shipped"`, `body $.total: got 120, want 150`}
+	if got := shipped.Mismatches[0]; got.EventID != 2 || strings.Join(got.Reasons, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected mismatch %+v", got)
+	}
+	if twice := resp.Results[1]; twice.Pass || twice.Matched != 2 || twice.Mismatches != nil {
+		t.Errorf("unexpected result %+v", twice)
+	}
+}
+
+func TestAssertWindow(t *testing.T) {
+	app := New()
+	sendWebhook(t, app, http.MethodPost, "default", `{"n":1}`, nil)
+	event := app.store.Events()[0]
+	event.Timestamp = time.Now().Add(-time.Hour)
+	app.store.Update(event)
+	sendWebhook(t, app, http.MethodPost, "default", `{"n":2}`, nil)
+
+	_, resp := postAssert(t, app, "/api/assert", `{"within": "10m", "expect": [{"count": 1}, {"count": 2, "within": "2h"}]}`)
+	if !resp.Pass {
+		t.Errorf("expected the window to exclude the old event, got %+v", resp)
+	}
+
+	since := time.Now().Add(-30 * time.Minute).UTC().Format(time.RFC3339)
+	_, resp = postAssert(t, app, "/api/assert", `{"since": "`+since+`", "expect": [{"count": 1}]}`)
+	if !resp.Pass {
+		t.Errorf("expected since to exclude the old event, got %+v", resp)
+	}
+}
+
+func TestAssertHandlerInvalid(t *testing.T) {
+	app := New()
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"expect": []}`, "at least one expectation"},
+		{`{"expect": [{"count": 1, "min": 1}]}`, "count can't be combined"},
+		{`{"expect": [{"min": 3, "max": 1}]}`, "max at least min"},
+		{`{"expect": [{"name": "bad", "headers": {"X-A": {"$regex": "("}}}]}`, "bad: header X-A: $regex"},
+		{`{"expect": [{"body": {"$.a": {"$gt": "1"}}}]}`, "$gt needs a number"},
+		{`{"expect": [{"body": {"$.a": {"$near": 1}}}]}`, "unknown operator $near"},
+		{`{"expect": [{"body": {"$.a": {"$eq": 1, "b": 2}}}]}`, "can't be mixed"},
+		{`{"expect": [{"body": {"a": 1}}]}`, "must start with $"},
+		{`{"expect": [{"condition": "body.("}]}`, "condition"},
+	}
+	for _, tt := range tests {
+		code, resp := postAssert(t, app, "/api/assert", tt.body)
+		if code != http.StatusBadRequest || !strings.Contains(resp.Error, tt.want) {
+			t.Errorf("%s: expected 400 containing %q, got %d %q", tt.body, tt.want, code, resp.Error)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	app.assertHandler(w, httptest.NewRequest(http.MethodGet, "/api/assert", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,241 @@
+package hooklab
+
+// This file contains optional HTTP basic authentication for the dashboard and
+// API, with roles: viewers can look, editors can change configs and rules, and
+// admins can also manage notifiers. Webhook endpoints stay open, since providers
+// can't log in. Viewers see response configs with their secrets redacted, and
+// only admins see notifier URLs past their host.
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User roles, from least to most privileged.
+const (
+	RoleViewer = "viewer" // Read the dashboard and API
+	RoleEditor = "editor" // Also change response configs, rules, and other key settings
+	RoleAdmin  = "admin"  // Also manage notifiers, which receive every key's events
+)
+
+// roleRanks orders the roles by privilege.
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// account is a user's password and role.
+type account struct {
+	password string // Plain text or bcrypt hash
+	role     string
+}
+
+// credentials maps usernames to their accounts.
+type credentials map[string]account
+
+// parseCredential parses a "user:password" or "user:password:role" entry. The
+// password may be a bcrypt hash such as one made by `htpasswd -nB user`. Entries
+// without a role are admins.
+func parseCredential(entry string) (string, account, error) {
+	user, password, ok := strings.Cut(entry, ":")
+	if !ok || user == "" || password == "" {
+		return "", account{}, fmt.Errorf("want user:password or user:password:role")
+	}
+	role := RoleAdmin
+	if i := strings.LastIndex(password, ":"); i >= 0 {
+		if _, ok := roleRanks[password[i+1:]]; ok {
+			password, role = password[:i], password[i+1:]
+		}
+	}
+	if password == "" {
+		return "", account{}, fmt.Errorf("want user:password or user:password:role")
+	}
+	return user, account{password: password, role: role}, nil
+}
+
+// loadCredentials reads "user:password[:role]" lines from path, skipping blank
+// lines and lines starting with "#".
+func loadCredentials(path string) (credentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	users := make(credentials)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, account, err := parseCredential(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		users[user] = account
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// check reports whether password is right for user, and the user's role.
+func (c credentials) check(user, password string) (string, bool) {
+	account, ok := c[user]
+	want := account.password
+	if !ok {
+		// Compare anyway so unknown users take as long as wrong passwords.
+		want = user
+	}
+	var match bool
+	if isBcryptHash(want) {
+		match = bcrypt.CompareHashAndPassword([]byte(want), []byte(password)) == nil
+	} else {
+		match = subtle.ConstantTimeCompare([]byte(want), []byte(password)) == 1
+	}
+	return account.role, ok && match
+}
+
+// isBcryptHash reports whether password is a bcrypt hash rather than plain text.
+func isBcryptHash(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
+
+// setCredentials requires users to log in to the dashboard and API. With no
+// users, both stay open.
+func (a *App) setCredentials(users credentials) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users = users
+}
+
+// requireAuth wraps next with basic authentication when credentials are set,
+// refusing requests the user's role doesn't allow with 403. Webhook endpoints are
+// never protected.
+func (a *App) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		users := a.users
+		a.mu.Unlock()
+
+		if len(users) == 0 || isWebhookPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, password, _ := r.BasicAuth()
+		role, ok := users.check(user, password)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="hooklab", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if roleRanks[role] < roleRanks[requiredRole(r)] {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleKey{}, role)))
+	})
+}
+
+// roleKey is the request context key of the logged in user's role.
+type roleKey struct{}
+
+// canSeeSecrets reports whether the user making request r may read the
+// secrets in response configs: editors and admins, who can change them anyway,
+// and everyone when authentication is off.
+func canSeeSecrets(r *http.Request) bool {
+	return hasRole(r, RoleEditor)
+}
+
+// hasRole reports whether the user making request r has role or a more
+// privileged one, as everyone does when authentication is off.
+func hasRole(r *http.Request, role string) bool {
+	user, ok := r.Context().Value(roleKey{}).(string)
+	return !ok || roleRanks[user] >= roleRanks[role]
+}
+
+// redactedSecret replaces secrets in response configs shown to viewers and
+// stream subscribers.
+const redactedSecret = "[redacted]"
+
+// redacted returns c with its capture token, signature secrets, and JWT secret
+// replaced by redactedSecret, including in its method overrides and variants.
+func (c ResponseConfig) redacted() ResponseConfig {
+	redact := func(secret *string) {
+		if *secret != "" {
+			*secret = redactedSecret
+		}
+	}
+	if c.Capture != nil {
+		capture := *c.Capture
+		redact(&capture.Token)
+		c.Capture = &capture
+	}
+	if c.Verify != nil {
+		verify := *c.Verify
+		redact(&verify.GitHubSecret)
+		redact(&verify.SlackSigningSecret)
+		c.Verify = &verify
+	}
+	if c.JWT != nil {
+		jwt := *c.JWT
+		redact(&jwt.Secret)
+		c.JWT = &jwt
+	}
+	if c.Methods != nil {
+		methods := make(map[string]ResponseConfig, len(c.Methods))
+		for method, override := range c.Methods {
+			methods[method] = override.redacted()
+		}
+		c.Methods = methods
+	}
+	if c.Variants != nil {
+		variants := make([]ResponseVariant, len(c.Variants))
+		for i, variant := range c.Variants {
+			variants[i] = ResponseVariant{Weight: variant.Weight, ResponseConfig: variant.ResponseConfig.redacted()}
+		}
+		c.Variants = variants
+	}
+	return c
+}
+
+// redacted returns n with its URL cut down to the scheme and host, since the
+// path and query of Slack and Discord webhook URLs are their secret.
+func (n Notifier) redacted() Notifier {
+	if u, err := url.Parse(n.URL); err == nil && u.Host != "" {
+		n.URL = u.Scheme + "://" + u.Host + "/" + redactedSecret
+	} else {
+		n.URL = redactedSecret
+	}
+	return n
+}
+
+// requiredRole returns the least privileged role allowed to make request r.
+// Reads, including dry runs of rule conditions, need a viewer; changing
+// notifiers needs an admin, since they receive every key's events, and so do
+// admin actions such as reloading the config file; every other change needs an
+// editor.
+func requiredRole(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return RoleViewer
+	case r.URL.Path == "/api/rules/validate" || r.URL.Path == "/api/assert":
+		return RoleViewer
+	case r.URL.Path == "/api/notifiers" || strings.HasPrefix(r.URL.Path, "/api/admin/"):
+		return RoleAdmin
+	default:
+		return RoleEditor
+	}
+}
+
+// isWebhookPath reports whether path is served by the webhook handler.
+func isWebhookPath(path string) bool {
+	return path == "/webhook" || strings.HasPrefix(path, "/webhook/")
+}
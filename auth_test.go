@@ -0,0 +1,228 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequireAuth(t *testing.T) {
+	app := New()
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	request := func(path, user, password string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without credentials everything is open.
+	if code := request("/api/events", "", ""); code != http.StatusOK {
+		t.Errorf("expected open API without credentials, got %d", code)
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	app.setCredentials(credentials{"admin": {password: "hunter2", role: RoleAdmin}, "ops": {password: string(hash), role: RoleViewer}})
+	tests := []struct {
+		path, user, password string
+		want                 int
+	}{
+		{"/api/events", "", "", http.StatusUnauthorized},
+		{"/", "", "", http.StatusUnauthorized},
+		{"/api/events", "admin", "wrong", http.StatusUnauthorized},
+		{"/api/events", "nobody", "hunter2", http.StatusUnauthorized},
+		{"/api/events", "admin", "hunter2", http.StatusOK},
+		{"/api/events", "ops", "s3cret", http.StatusOK},
+		{"/api/events", "ops", string(hash), http.StatusUnauthorized},
+		{"/webhook/payments", "", "", http.StatusOK},
+		{"/webhook", "", "", http.StatusOK},
+		{"/webhooks", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := request(tt.path, tt.user, tt.password); code != tt.want {
+			t.Errorf("%s as %q/%q: expected status %d, got %d", tt.path, tt.user, tt.password, tt.want, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("expected a basic auth challenge, got %q", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	os.WriteFile(path, []byte("# dashboard users\nadmin:hunter2\n\nops:pa:ss\n"), 0o600)
+	users, err := loadCredentials(path)
+	if err != nil {
+		t.Fatalf("failed to load credentials: %v", err)
+	}
+	if len(users) != 2 || users["admin"] != (account{"hunter2", RoleAdmin}) || users["ops"] != (account{"pa:ss", RoleAdmin}) {
+		t.Errorf("unexpected credentials %v", users)
+	}
+	if role, ok := users.check("ops", "pa:ss"); !ok || role != RoleAdmin {
+		t.Errorf("expected ops to log in as admin, got %q, %v", role, ok)
+	}
+
+	os.WriteFile(path, []byte("admin:hunter2\nadmin\n"), 0o600)
+	if _, err := loadCredentials(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+	for _, entry := range []string{":hunter2", "admin::viewer"} {
+		if _, _, err := parseCredential(entry); err == nil {
+			t.Errorf("%q: expected an error", entry)
+		}
+	}
+}
+
+func TestParseCredentialRole(t *testing.T) {
+	tests := []struct {
+		entry, password, role string
+	}{
+		{"ana:hunter2", "hunter2", RoleAdmin},
+		{"ana:hunter2:viewer", "hunter2", RoleViewer},
+		{"ana:hunter2:editor", "hunter2", RoleEditor},
+		{"ana:pa:ss:admin", "pa:ss", RoleAdmin},
+		{"ana:pa:ss", "pa:ss", RoleAdmin},
+	}
+	for _, tt := range tests {
+		_, got, err := parseCredential(tt.entry)
+		if err != nil || got.password != tt.password || got.role != tt.role {
+			t.Errorf("%q: got %+v, %v", tt.entry, got, err)
+		}
+	}
+}
+
+func TestRequireAuthRoles(t *testing.T) {
+	app := New()
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	app.setCredentials(credentials{
+		"vera":  {password: "v", role: RoleViewer},
+		"eddie": {password: "e", role: RoleEditor},
+		"ada":   {password: "a", role: RoleAdmin},
+	})
+
+	tests := []struct {
+		method, target string
+		body           string
+		want           map[string]int // status per user
+	}{
+		{http.MethodGet, "/api/rules?key=payments", "", map[string]int{"vera": http.StatusOK, "eddie": http.StatusOK, "ada": http.StatusOK}},
+		{http.MethodPost, "/api/rules/validate?key=payments", `{"condition":"true"}`, map[string]int{"vera": http.StatusOK, "eddie": http.StatusOK, "ada": http.StatusOK}},
+		{http.MethodPost, "/api/assert?key=payments", `{"expect":[{"min":0}]}`, map[string]int{"vera": http.StatusOK, "eddie": http.StatusOK, "ada": http.StatusOK}},
+		{http.MethodPost, "/api/response?key=payments", `{"response":{},"statusCode":200}`, map[string]int{"vera": http.StatusForbidden, "eddie": http.StatusOK, "ada": http.StatusOK}},
+		{http.MethodPost, "/api/rules?key=payments", `{"condition":"true","response":{},"statusCode":200}`, map[string]int{"vera": http.StatusForbidden, "eddie": http.StatusCreated, "ada": http.StatusCreated}},
+		{http.MethodPost, "/api/notifiers", `{"url":"http://example.com/hook"}`, map[string]int{"vera": http.StatusForbidden, "eddie": http.StatusForbidden, "ada": http.StatusCreated}},
+		{http.MethodGet, "/api/notifiers", "", map[string]int{"vera": http.StatusOK, "eddie": http.StatusOK, "ada": http.StatusOK}},
+	}
+	for _, tt := range tests {
+		for _, user := range []string{"vera", "eddie", "ada"} {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.SetBasicAuth(user, user[:1])
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, req)
+			if w.Code != tt.want[user] {
+				t.Errorf("%s %s as %s: expected status %d, got %d %s", tt.method, tt.target, user, tt.want[user], w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestResponseSecretsRedacted(t *testing.T) {
+	app := New()
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	app.setCredentials(credentials{
+		"vera":  {password: "v", role: RoleViewer},
+		"eddie": {password: "e", role: RoleEditor},
+	})
+	ch := app.addSubscriber("payments")
+	defer app.removeSubscriber(ch)
+	notices := app.subscriberNotices(ch)
+
+	secrets := []string{"cap-token", "gh-secret", "slack-secret", "jwt-secret"}
+	app.setResponseConfig("payments", ResponseConfig{
+		StatusCode: http.StatusOK,
+		Capture:    &CaptureConfig{Token: "cap-token"},
+		Verify:     &VerifyConfig{GitHubSecret: "gh-secret", SlackSigningSecret: "slack-secret"},
+		Methods:    map[string]ResponseConfig{"PUT": {StatusCode: http.StatusOK, JWT: &JWTConfig{Secret: "jwt-secret"}}},
+	})
+
+	for _, target := range []string{"/api/responses", "/api/response?key=payments"} {
+		for user, visible := range map[string]bool{"vera": false, "eddie": true} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.SetBasicAuth(user, user[:1])
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, req)
+			for _, secret := range secrets {
+				if target == "/api/response?key=payments" && secret != "jwt-secret" {
+					continue // only the method overrides of the key's own config are returned
+				}
+				if strings.Contains(w.Body.String(), secret) != visible {
+					t.Errorf("GET %s as %s: expected %s shown %v, got %s", target, user, secret, visible, w.Body.String())
+				}
+			}
+		}
+	}
+
+	notice := <-notices
+	data, _ := json.Marshal(notice.Data)
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %s redacted from the stream, got %s", secret, data)
+		}
+	}
+	if config := app.getResponseConfig("payments"); config.Capture.Token != "cap-token" || config.Methods["PUT"].JWT.Secret != "jwt-secret" {
+		t.Errorf("expected the stored config left intact, got %+v", config)
+	}
+}
+
+func TestNotifierURLsRedacted(t *testing.T) {
+	app := New()
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	app.setCredentials(credentials{
+		"vera":  {password: "v", role: RoleViewer},
+		"eddie": {password: "e", role: RoleEditor},
+		"ada":   {password: "a", role: RoleAdmin},
+	})
+	app.addNotifier(Notifier{URL: "https://hooks.slack.com/services/T000/B000/XXXX", Format: "slack", Enabled: true})
+
+	for user, want := range map[string]string{
+		"vera":  "https://hooks.slack.com/[redacted]",
+		"eddie": "https://hooks.slack.com/[redacted]",
+		"ada":   "https://hooks.slack.com/services/T000/B000/XXXX",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/notifiers", nil)
+		req.SetBasicAuth(user, user[:1])
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		var list struct{ Notifiers []Notifier }
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Notifiers) != 1 || list.Notifiers[0].URL != want {
+			t.Errorf("GET /api/notifiers as %s: expected the URL %s, got %s", user, want, w.Body.String())
+		}
+	}
+	if notifiers := app.getNotifiers(); notifiers[0].URL != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("expected the stored notifier left intact, got %+v", notifiers[0])
+	}
+}
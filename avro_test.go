@@ -0,0 +1,221 @@
+package hooklab
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const avroOrderSchema = `{
+  "type": "record", "name": "Order", "namespace": "shop",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "email", "type": ["null", "string"]},
+    {"name": "total", "type": "double"}
+  ]
+}`
+
+// encodeOrder returns an Order encoded as Avro, framed in the Confluent wire
+// format when id isn't 0.
+func encodeOrder(t *testing.T, id uint32, order map[string]interface{}) []byte {
+	t.Helper()
+	codec, err := goavro.NewCodec(avroOrderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := codec.BinaryFromNative(nil, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 0 {
+		return data
+	}
+	header := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], id)
+	return append(header, data...)
+}
+
+func testOrder() map[string]interface{} {
+	return map[string]interface{}{"id": int64(7), "email": goavro.Union("string", "a@example.com"), "total": 150.5}
+}
+
+// assertOrderJSON checks that decoded is testOrder as JSON, in any field order.
+func assertOrderJSON(t *testing.T, decoded string) {
+	t.Helper()
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(decoded), &got); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", decoded, err)
+	}
+	want := map[string]interface{}{"id": float64(7), "email": "a@example.com", "total": 150.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDecodeAvroUploadedSchema(t *testing.T) {
+	app := New()
+	codec, err := compileAvroSchema(avroOrderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.setAvroSchema("orders", &avroSchema{id: 42, codec: codec})
+
+	decoded, result := app.decodeAvro("orders", false, encodeOrder(t, 0, testOrder()))
+	if result == nil || result.Error != "" || result.Schema != "shop.Order" || result.SchemaID != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	assertOrderJSON(t, decoded)
+
+	if _, result := app.decodeAvro("orders", false, encodeOrder(t, 42, testOrder())); result.Error != "" || result.SchemaID != 42 {
+		t.Errorf("expected framed body with the schema's ID to decode, got %+v", result)
+	}
+	if _, result := app.decodeAvro("orders", false, []byte(`{"id":7}`)); result == nil || result.Error == "" {
+		t.Errorf("expected JSON body to fail decoding, got %+v", result)
+	}
+	if _, result := app.decodeAvro("other", false, encodeOrder(t, 42, testOrder())); result != nil {
+		t.Errorf("expected key without a schema or registry not to decode, got %+v", result)
+	}
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/schemas/ids/5":
+			json.NewEncoder(w).Encode(map[string]string{"schema": avroOrderSchema})
+		case "/schemas/ids/6":
+			json.NewEncoder(w).Encode(map[string]string{"schema": "syntax = \"proto3\";", "schemaType": "PROTOBUF"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	registry, err := newSchemaRegistry(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	app := New(WithClock(clock))
+	app.setSchemaRegistry(registry)
+
+	for range 2 {
+		decoded, result := app.decodeAvro("orders", true, encodeOrder(t, 5, testOrder()))
+		if result == nil || result.Error != "" || result.SchemaID != 5 || !strings.Contains(decoded, `"total":150.5`) {
+			t.Fatalf("unexpected decode %s %+v", decoded, result)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("expected the schema to be fetched once, got %d", got)
+	}
+
+	if _, result := app.decodeAvro("orders", true, encodeOrder(t, 6, testOrder())); result == nil || !strings.Contains(result.Error, "PROTOBUF") {
+		t.Errorf("expected non-Avro schema error, got %+v", result)
+	}
+	fetches.Store(0)
+	for range 3 {
+		if _, result := app.decodeAvro("orders", true, encodeOrder(t, 9, testOrder())); result == nil || !strings.Contains(result.Error, "404") {
+			t.Errorf("expected missing schema error, got %+v", result)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("expected the failed fetch to be remembered, got %d fetches", got)
+	}
+	clock.t = clock.t.Add(registryFailureTTL)
+	app.decodeAvro("orders", true, encodeOrder(t, 9, testOrder()))
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("expected the failed fetch retried after %v, got %d fetches", registryFailureTTL, got)
+	}
+	if _, result := app.decodeAvro("orders", false, encodeOrder(t, 10, testOrder())); result != nil || fetches.Load() != 2 {
+		t.Errorf("expected a key that doesn't opt in not to use the registry, got %+v", result)
+	}
+	if _, result := app.decodeAvro("orders", true, encodeOrder(t, 0, testOrder())); result != nil {
+		t.Errorf("expected unframed body not to be decoded, got %+v", result)
+	}
+
+	if _, err := newSchemaRegistry("localhost:8081"); err == nil {
+		t.Error("expected URL without scheme to be rejected")
+	}
+}
+
+func TestWebhookHandlerDecodesAvro(t *testing.T) {
+	app := New()
+	codec, err := compileAvroSchema(avroOrderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.setAvroSchema("orders", &avroSchema{codec: codec})
+	app.addRule("orders", Rule{Condition: `avro.decoded && avro.schema == "shop.Order" && body.total > 100`, StatusCode: http.StatusAccepted, Enabled: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(string(encodeOrder(t, 0, testOrder()))))
+	req.Header.Set("Content-Type", "avro/binary")
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	event := app.store.Events()[0]
+	assertOrderJSON(t, event.Body)
+	if event.Avro == nil || event.Avro.Schema != "shop.Order" {
+		t.Errorf("unexpected avro result %+v", event.Avro)
+	}
+}
+
+func TestAvroHandler(t *testing.T) {
+	app := New()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/avro?key=orders&id=12", strings.NewReader(avroOrderSchema))
+	w := httptest.NewRecorder()
+	app.avroHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	app.avroHandler(w, httptest.NewRequest(http.MethodGet, "/api/avro?key=orders", nil))
+	var got struct {
+		ID     int             `json:"id"`
+		Schema json.RawMessage `json:"schema"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 12 || !strings.Contains(string(got.Schema), `"Order"`) {
+		t.Errorf("unexpected schema %d %s", got.ID, got.Schema)
+	}
+
+	for _, target := range []string{"/api/avro?key=orders&id=x", "/api/avro?key=orders&id=0"} {
+		w = httptest.NewRecorder()
+		app.avroHandler(w, httptest.NewRequest(http.MethodPut, target, strings.NewReader(avroOrderSchema)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	app.avroHandler(w, httptest.NewRequest(http.MethodPut, "/api/avro?key=orders", strings.NewReader(`{"type":"record"}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid Avro schema") {
+		t.Errorf("expected invalid schema to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	app.avroHandler(w, httptest.NewRequest(http.MethodDelete, "/api/avro?key=orders", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.avroHandler(w, httptest.NewRequest(http.MethodGet, "/api/avro?key=orders", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package hooklab
+
+// This file contains bridges, which let several Hooklab replicas share one live
+// stream: every event broadcast by an instance is passed to the bridge, and the
+// events other instances passed to theirs are delivered to this instance's SSE
+// subscribers. The Redis bridge is in redisbridge.
+
+import "log"
+
+// Bridge shares the live stream with other instances through a broker, such as
+// a Redis channel.
+type Bridge interface {
+	Name() string                // Names the broker in logs and /api/info, e.g. "Redis"
+	Publish(event Event) error   // Sends an event captured by this instance to the others
+	Receive(deliver func(Event)) // Passes the others' events, with Instance set, to deliver until closed
+	Close() error                // Stops receiving, once the server stops
+}
+
+// setBridge makes broadcastEvent fan events out through bridge and starts
+// delivering the events of other instances.
+func (a *App) setBridge(bridge Bridge) {
+	a.mu.Lock()
+	a.bridge = bridge
+	a.mu.Unlock()
+	go bridge.Receive(a.deliverEvent)
+}
+
+// closeBridge stops fanning events out, if a bridge is set.
+func (a *App) closeBridge() {
+	a.mu.Lock()
+	bridge := a.bridge
+	a.bridge = nil
+	a.mu.Unlock()
+
+	if bridge != nil {
+		if err := bridge.Close(); err != nil {
+			log.Printf("Closing %s bridge failed: %v", bridge.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeBridge connects instances in one process, the way a broker does.
+type pipeBridge struct {
+	instance string
+	peers    *[]*pipeBridge
+	received chan Event
+	once     sync.Once
+}
+
+// newPipeBridges returns bridges connected to each other, one per instance.
+func newPipeBridges(instances ...string) []*pipeBridge {
+	bridges := make([]*pipeBridge, 0, len(instances))
+	for _, instance := range instances {
+		bridges = append(bridges, &pipeBridge{instance: instance, peers: &bridges, received: make(chan Event, 10)})
+	}
+	return bridges
+}
+
+func (b *pipeBridge) Name() string { return "pipe" }
+
+func (b *pipeBridge) Publish(event Event) error {
+	event.Instance = b.instance
+	for _, peer := range *b.peers {
+		if peer != b {
+			peer.received <- event
+		}
+	}
+	return nil
+}
+
+func (b *pipeBridge) Receive(deliver func(Event)) {
+	for event := range b.received {
+		deliver(event)
+	}
+}
+
+func (b *pipeBridge) Close() error {
+	b.once.Do(func() { close(b.received) })
+	return nil
+}
+
+func TestBridgeFansOutEvents(t *testing.T) {
+	bridges := newPipeBridges("pod-a", "pod-b")
+	replicas := []*App{New(WithBridge(bridges[0])), New(WithBridge(bridges[1]))}
+	for _, replica := range replicas {
+		defer replica.closeBridge()
+	}
+	if got := replicas[0].info(time.Now()).Storage.SharedStream; got != "pipe" {
+		t.Errorf("expected the stream to be shared through the bridge, got %q", got)
+	}
+
+	local := replicas[0].addSubscriber()
+	remote := replicas[1].addSubscriber()
+	filtered := replicas[1].addSubscriber("orders")
+
+	replicas[0].webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":5}`)))
+
+	select {
+	case event := <-local:
+		if event.Instance != "" || event.Key != "payments" {
+			t.Errorf("unexpected local event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the local event")
+	}
+	select {
+	case event := <-remote:
+		if event.Instance != "pod-a" || event.Key != "payments" || event.Body != `{"amount":5}` {
+			t.Errorf("unexpected relayed event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the relayed event")
+	}
+
+	// An instance doesn't receive its own events twice, and key filters apply to
+	// relayed events.
+	select {
+	case event := <-local:
+		t.Errorf("unexpected duplicate event %+v", event)
+	case event := <-filtered:
+		t.Errorf("unexpected event for a filtered subscriber %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(replicas[1].store.Events()) != 0 {
+		t.Errorf("expected relayed events not to be stored, got %d", len(replicas[1].store.Events()))
+	}
+}
@@ -0,0 +1,39 @@
+package hooklab
+
+// This file contains capture tokens: a key can require webhooks to present a
+// secret before they are accepted, so scanners hitting a public instance don't
+// pollute its captures.
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// captureTokenHeader is the header webhooks can present a capture token in,
+// instead of the token query parameter.
+const captureTokenHeader = "X-Hooklab-Token"
+
+// CaptureConfig requires webhooks of a key to present Token, either as the
+// token query parameter or in the X-Hooklab-Token header.
+type CaptureConfig struct {
+	Token          string `json:"token"`                    // Secret webhooks must present
+	RecordRejected bool   `json:"recordRejected,omitempty"` // Store refused webhooks as rejected events
+}
+
+// validate checks that a token is set.
+func (c CaptureConfig) validate() error {
+	if c.Token == "" {
+		return errors.New("capture.token must not be empty")
+	}
+	return nil
+}
+
+// allows reports whether r presents the capture token.
+func (c CaptureConfig) allows(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get(captureTokenHeader)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+}
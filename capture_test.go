@@ -0,0 +1,80 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandlerCaptureToken(t *testing.T) {
+	app := New()
+	app.setResponseConfig("payments", ResponseConfig{Response: map[string]string{"ok": "yes"}, StatusCode: http.StatusOK, Capture: &CaptureConfig{Token: "s3cret"}})
+	subscriber := app.addSubscriber()
+
+	tests := []struct {
+		target, header string
+		want           int
+	}{
+		{"/webhook/payments", "", http.StatusUnauthorized},
+		{"/webhook/payments?token=wrong", "", http.StatusUnauthorized},
+		{"/webhook/payments", "wrong", http.StatusUnauthorized},
+		{"/webhook/payments?token=s3cret", "", http.StatusOK},
+		{"/webhook/payments", "s3cret", http.StatusOK},
+		{"/webhook/orders", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(`{}`))
+		if tt.header != "" {
+			req.Header.Set(captureTokenHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s with header %q: expected status %d, got %d", tt.target, tt.header, tt.want, w.Code)
+		}
+		if tt.want == http.StatusUnauthorized && !strings.Contains(w.Body.String(), "invalid capture token") {
+			t.Errorf("%s: unexpected body %s", tt.target, w.Body.String())
+		}
+	}
+
+	// Refused webhooks aren't recorded by default.
+	if len(app.store.Events()) != 3 || len(subscriber) != 3 {
+		t.Errorf("expected only accepted webhooks to be stored and broadcast, got %d events and %d broadcasts", len(app.store.Events()), len(subscriber))
+	}
+}
+
+func TestWebhookHandlerRecordsRejected(t *testing.T) {
+	app := New()
+	app.setResponseConfig("payments", ResponseConfig{StatusCode: http.StatusOK, Capture: &CaptureConfig{Token: "s3cret", RecordRejected: true}})
+	app.addRule("payments", Rule{Condition: "true", Action: ActionTag, Tags: []string{"seen"}, Enabled: true})
+	subscriber := app.addSubscriber()
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/payments?token=guess", strings.NewReader(`{"probe":true}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", w.Code)
+	}
+
+	event := <-subscriber
+	if event.Rejected != "invalid capture token" || event.Body != `{"probe":true}` || len(event.Tags) != 0 || len(event.RuleTrace) != 0 {
+		t.Errorf("expected a rejected event without rule evaluation, got %+v", event)
+	}
+	if stored := app.store.Events()[0]; stored.Rejected != event.Rejected {
+		t.Errorf("expected the stored event to be marked rejected, got %+v", stored)
+	}
+}
+
+func TestResponseHandlerValidatesCapture(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"response":{},"statusCode":200,"capture":{"token":""}}`,
+		`{"response":{},"statusCode":200,"methods":{"GET":{"capture":{"token":"x"}}}}`,
+	} {
+		w := httptest.NewRecorder()
+		app.responseHandler(w, httptest.NewRequest(http.MethodPost, "/api/response?key=payments", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "capture") {
+			t.Errorf("%s: expected a capture error, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+}
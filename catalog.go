@@ -0,0 +1,178 @@
+package hooklab
+
+// This file contains the catalog of built-in rule templates for common webhook
+// providers, which can be instantiated into a key with one call.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// RuleTemplate is a named set of ready-made rules for a webhook provider.
+type RuleTemplate struct {
+	ID          string `json:"id"`
+	Provider    string `json:"provider"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Rules       []Rule `json:"rules"`
+}
+
+// githubEventIs returns a condition matching GitHub deliveries of the given event type.
+func githubEventIs(event string) string {
+	return `"X-Github-Event" in headers && headers["X-Github-Event"][0] == "` + event + `"`
+}
+
+// ruleTemplates is the built-in template catalog. Rule priorities are relative
+// to each other; they are shifted after a key's existing rules on instantiation.
+var ruleTemplates = []RuleTemplate{
+	{
+		ID:          "github-events",
+		Provider:    "GitHub",
+		Name:        "GitHub push and pull request events",
+		Description: "Acknowledges ping, push, and pull_request deliveries based on the X-GitHub-Event header.",
+		Rules: []Rule{
+			{
+				Name:       "GitHub ping",
+				Condition:  githubEventIs("ping"),
+				Response:   map[string]interface{}{"ok": true, "hook_id": "{{.body.hook_id}}"},
+				StatusCode: http.StatusOK,
+				Priority:   0,
+				Enabled:    true,
+			},
+			{
+				Name:       "GitHub push",
+				Condition:  githubEventIs("push"),
+				Response:   map[string]interface{}{"received": "push", "ref": "{{.body.ref}}", "after": "{{.body.after}}"},
+				StatusCode: http.StatusAccepted,
+				Priority:   1,
+				Enabled:    true,
+			},
+			{
+				Name:       "GitHub pull request",
+				Condition:  githubEventIs("pull_request"),
+				Response:   map[string]interface{}{"received": "pull_request", "action": "{{.body.action}}", "number": "{{.body.number}}"},
+				StatusCode: http.StatusAccepted,
+				Priority:   2,
+				Enabled:    true,
+			},
+		},
+	},
+	{
+		ID:          "stripe-events",
+		Provider:    "Stripe",
+		Name:        "Stripe event types",
+		Description: "Acknowledges Stripe events the way Stripe expects, and fails payment_intent.payment_failed deliveries to exercise retries.",
+		Rules: []Rule{
+			{
+				Name:       "Stripe payment succeeded",
+				Condition:  `body.object == "event" && body.type == "payment_intent.succeeded"`,
+				Response:   map[string]interface{}{"received": true, "id": "{{.body.id}}"},
+				StatusCode: http.StatusOK,
+				Priority:   0,
+				Enabled:    true,
+			},
+			{
+				Name:       "Stripe payment failed",
+				Condition:  `body.object == "event" && body.type == "payment_intent.payment_failed"`,
+				Response:   map[string]interface{}{"error": "simulated handler failure", "id": "{{.body.id}}"},
+				StatusCode: http.StatusInternalServerError,
+				Priority:   1,
+				Enabled:    true,
+			},
+			{
+				Name:       "Stripe subscription events",
+				Condition:  `body.object == "event" && body.type startsWith "customer.subscription."`,
+				Response:   map[string]interface{}{"received": true, "type": "{{.body.type}}"},
+				StatusCode: http.StatusOK,
+				Priority:   2,
+				Enabled:    true,
+			},
+			{
+				Name:       "Stripe other events",
+				Condition:  `body.object == "event"`,
+				Response:   map[string]interface{}{"received": true},
+				StatusCode: http.StatusOK,
+				Priority:   3,
+				Enabled:    true,
+			},
+		},
+	},
+	{
+		ID:          "slack-url-verification",
+		Provider:    "Slack",
+		Name:        "Slack URL verification challenge",
+		Description: "Answers the Events API url_verification handshake by echoing the challenge.",
+		Rules: []Rule{
+			{
+				Name:       "Slack URL verification",
+				Condition:  `body.type == "url_verification"`,
+				Response:   map[string]interface{}{"challenge": "{{.body.challenge}}"},
+				StatusCode: http.StatusOK,
+				Priority:   0,
+				Enabled:    true,
+			},
+		},
+	},
+}
+
+// findRuleTemplate returns the catalog template with the given ID.
+func findRuleTemplate(id string) (RuleTemplate, bool) {
+	for _, template := range ruleTemplates {
+		if template.ID == id {
+			return template, true
+		}
+	}
+	return RuleTemplate{}, false
+}
+
+// instantiateTemplate adds a template's rules to key after its existing rules,
+// preserving the template's relative order. It returns the created rules.
+func (a *App) instantiateTemplate(key string, template RuleTemplate) []Rule {
+	offset := 0
+	for _, rule := range a.getRules(key) {
+		offset = max(offset, rule.Priority+1)
+	}
+
+	created := make([]Rule, 0, len(template.Rules))
+	for _, rule := range template.Rules {
+		rule.Priority += offset
+		validateRule(&rule) // keeps the parsed schedule; TestRuleTemplatesAreValid checks they are valid
+		created = append(created, a.addRule(key, rule))
+	}
+	return created
+}
+
+// ruleTemplatesHandler handles requests to /api/rules/templates.
+// GET lists the catalog; POST /api/rules/templates/{id}?key={key} adds the
+// template's rules to the key.
+func (a *App) ruleTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/rules/templates"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"templates": ruleTemplates})
+	case id != "" && r.Method == http.MethodPost:
+		template, ok := findRuleTemplate(id)
+		if !ok {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			key = "default"
+		}
+
+		created := a.instantiateTemplate(key, template)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"template": template.ID,
+			"rules":    created,
+			"key":      key,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,97 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleTemplatesAreValid(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, template := range ruleTemplates {
+		if seen[template.ID] {
+			t.Errorf("duplicate template ID %q", template.ID)
+		}
+		seen[template.ID] = true
+		for _, rule := range template.Rules {
+			if err := validateRule(&rule); err != nil {
+				t.Errorf("%s/%s: %v", template.ID, rule.Name, err)
+			}
+		}
+	}
+}
+
+func TestRuleTemplatesHandlerList(t *testing.T) {
+	app := New()
+	w := httptest.NewRecorder()
+	app.ruleTemplatesHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/templates", nil))
+
+	var response struct {
+		Templates []RuleTemplate `json:"templates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(response.Templates) != len(ruleTemplates) {
+		t.Errorf("expected %d templates, got %d", len(ruleTemplates), len(response.Templates))
+	}
+}
+
+func TestRuleTemplatesHandlerInstantiate(t *testing.T) {
+	app := New()
+	app.addRule("slack", Rule{Name: "Existing", Condition: "false", Priority: 4, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.ruleTemplatesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules/templates/slack-url-verification?key=slack", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+
+	rules := app.getRules("slack")
+	if len(rules) != 2 || rules[1].Name != "Slack URL verification" || rules[1].Priority != 5 {
+		t.Fatalf("template rules should be appended after existing rules, got %+v", rules)
+	}
+
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/slack", strings.NewReader(`{"type":"url_verification","challenge":"3eZbrw1a"}`)))
+	if strings.TrimSpace(w.Body.String()) != `{"challenge":"3eZbrw1a"}` {
+		t.Errorf("unexpected challenge response: %s", w.Body.String())
+	}
+}
+
+func TestRuleTemplatesGitHubEvents(t *testing.T) {
+	app := New()
+	template, _ := findRuleTemplate("github-events")
+	app.instantiateTemplate("github", template)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(`{"ref":"refs/heads/main","after":"abc"}`))
+	req.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"ref":"refs/heads/main"`) {
+		t.Errorf("unexpected push response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRuleTemplatesHandlerErrors(t *testing.T) {
+	app := New()
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodPost, "/api/rules/templates/unknown?key=x", http.StatusNotFound},
+		{http.MethodPost, "/api/rules/templates", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/rules/templates/github-events", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.ruleTemplatesHandler(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package hooklab
+
+// This file contains the chat formats of notifiers: instead of the raw event,
+// Slack and Discord incoming webhooks receive a short message summarizing the
+// key, method, and selected body fields, for passive monitoring in a channel.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Notifier formats.
+const (
+	FormatJSON    = "json"    // NotifierPayload (default)
+	FormatSlack   = "slack"   // Slack incoming webhook message
+	FormatDiscord = "discord" // Discord webhook message
+)
+
+// Chat message limits.
+const (
+	maxChatFieldLength   = 200  // characters of a single field value
+	maxDiscordContentLen = 2000 // Discord rejects longer content
+)
+
+// slackEscaper escapes the characters Slack treats as control sequences.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// validateFormat checks a notifier's format and the field expressions it shows.
+func (n Notifier) validateFormat() error {
+	switch n.Format {
+	case "", FormatJSON:
+		if len(n.Fields) > 0 {
+			return errors.New("fields: only used by the slack and discord formats")
+		}
+	case FormatSlack, FormatDiscord:
+		for i, field := range n.Fields {
+			if _, err := compileExpression(field, validationEnv(), false); err != nil {
+				return fmt.Errorf("fields[%d]: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("format: unknown format %q, want json, slack, or discord", n.Format)
+	}
+	return nil
+}
+
+// payload returns the JSON body POSTed to the notifier for event.
+func (n Notifier) payload(event Event) ([]byte, error) {
+	switch n.Format {
+	case FormatSlack:
+		// Escaping keeps payload text such as "<!channel>" from pinging anyone.
+		return json.Marshal(map[string]string{"text": slackEscaper.Replace(chatSummary(event, n.Fields, "*", "`"))})
+	case FormatDiscord:
+		return json.Marshal(map[string]interface{}{
+			"content": truncate(chatSummary(event, n.Fields, "**", "`"), maxDiscordContentLen),
+			// Payload text such as "@everyone" must not ping anyone.
+			"allowed_mentions": map[string][]string{"parse": {}},
+		})
+	default:
+		return json.Marshal(NotifierPayload{NotifierID: n.ID, Event: event})
+	}
+}
+
+// chatSummary formats event as a short chat message, e.g.
+//
+//	*POST* /webhook/payments on `payments` (#3)
+//	• body.amount: 500
+//
+// bold and code are the markup for bold and inline code. Each field is a rule
+// expression evaluated against the event; fields that fail show the error.
+func chatSummary(event Event, fields []string, bold, code string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s%s %s on %s%s%s (#%d)", bold, event.Method, bold, event.Path, code, event.Key, code, event.ID)
+	if len(event.Tags) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(event.Tags, ", "))
+	}
+
+	env := eventEnv(event)
+	for _, field := range fields {
+		fmt.Fprintf(&b, "\n• %s: %s", field, truncate(fieldValue(field, env), maxChatFieldLength))
+	}
+	return b.String()
+}
+
+// fieldValue evaluates a field expression against env and formats the result,
+// or the first line of the error.
+func fieldValue(field string, env map[string]interface{}) string {
+	program, err := compileExpression(field, env, false)
+	if err == nil {
+		var value interface{}
+		if value, err = runExpression(program, env); err == nil {
+			return formatFieldValue(value)
+		}
+	}
+	message, _, _ := strings.Cut(err.Error(), "\n")
+	return "error: " + message
+}
+
+// formatFieldValue formats strings as they are and other values as JSON.
+func formatFieldValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,107 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifierChatPayloads(t *testing.T) {
+	event := Event{ID: 3, Method: http.MethodPost, Path: "/webhook/payments", Key: "payments", Tags: []string{"large"}, Body: `{"amount":500,"note":"<!channel> @everyone","customer":{"id":"c_1"}}`}
+	fields := []string{"body.amount", "body.note", "body.customer", "body.missing.id"}
+
+	body, err := Notifier{Format: FormatSlack, Fields: fields}.payload(event)
+	if err != nil {
+		t.Fatalf("failed to build slack payload: %v", err)
+	}
+	var slack struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(body, &slack)
+	lines := strings.Split(slack.Text, "\n")
+	want := []string{
+		"*POST* /webhook/payments on `payments` (#3) [large]",
+		"• body.amount: 500",
+		"• body.note: &lt;!channel&gt; @everyone",
+		`• body.customer: {"id":"c_1"}`,
+	}
+	if len(lines) != 5 || strings.Join(lines[:4], "\n") != strings.Join(want, "\n") || !strings.HasPrefix(lines[4], "• body.missing.id: error: ") {
+		t.Errorf("unexpected slack text:\n%s", slack.Text)
+	}
+
+	body, err = Notifier{Format: FormatDiscord, Fields: []string{"body.note"}}.payload(event)
+	if err != nil {
+		t.Fatalf("failed to build discord payload: %v", err)
+	}
+	var discord struct {
+		Content         string              `json:"content"`
+		AllowedMentions map[string][]string `json:"allowed_mentions"`
+	}
+	json.Unmarshal(body, &discord)
+	if discord.Content != "**POST** /webhook/payments on `payments` (#3) [large]\n• body.note: <!channel> @everyone" {
+		t.Errorf("unexpected discord content:\n%s", discord.Content)
+	}
+	if parse, ok := discord.AllowedMentions["parse"]; !ok || len(parse) != 0 {
+		t.Errorf("expected mentions to be disabled, got %v", discord.AllowedMentions)
+	}
+
+	long := Event{Method: http.MethodPost, Key: "payments", Body: `{"text":"` + strings.Repeat("x", 5000) + `"}`}
+	body, _ = Notifier{Format: FormatDiscord, Fields: []string{"body.text", "body.text", "rawBody"}}.payload(long)
+	json.Unmarshal(body, &discord)
+	if n := len([]rune(discord.Content)); n > maxDiscordContentLen {
+		t.Errorf("expected discord content to be truncated, got %d characters", n)
+	}
+	if !strings.Contains(discord.Content, strings.Repeat("x", maxChatFieldLength-1)+"…") {
+		t.Error("expected long field values to be truncated")
+	}
+}
+
+func TestNotifierFormatValidation(t *testing.T) {
+	tests := []struct {
+		notifier Notifier
+		err      string
+	}{
+		{Notifier{URL: "https://hooks.slack.com/services/T/B/X", Format: FormatSlack, Fields: []string{"body.amount"}}, ""},
+		{Notifier{URL: "https://discord.com/api/webhooks/1/x", Format: FormatDiscord}, ""},
+		{Notifier{URL: "https://example.com", Format: "teams"}, "format"},
+		{Notifier{URL: "https://example.com", Fields: []string{"body.amount"}}, "fields"},
+		{Notifier{URL: "https://example.com", Format: FormatSlack, Fields: []string{"body.amount", "body. >"}}, "fields[1]"},
+	}
+	for _, tt := range tests {
+		err := tt.notifier.validate()
+		if (tt.err == "") != (err == nil) || (err != nil && !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("%+v: expected error %q, got %v", tt.notifier, tt.err, err)
+		}
+	}
+}
+
+func TestWebhookHandlerPostsSlackSummary(t *testing.T) {
+	received := make(chan string, 1)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&message)
+		received <- message.Text
+	}))
+	defer slack.Close()
+
+	app := New()
+	app.addNotifier(Notifier{URL: slack.URL, Key: "payments", Condition: `header("X-Event") == "refund"`, Format: FormatSlack, Fields: []string{"body.amount"}, Enabled: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":42}`))
+	req.Header.Set("X-Event", "refund")
+	app.webhookHandler(httptest.NewRecorder(), req)
+
+	select {
+	case text := <-received:
+		if text != "*POST* /webhook/payments on `payments` (#1)\n• body.amount: 42" {
+			t.Errorf("unexpected slack text:\n%s", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the slack message")
+	}
+}
@@ -0,0 +1,353 @@
+package hooklab
+
+// This file contains the subcommands besides serve: export, replay, and tail
+// work against a running instance through its API, so captured webhooks can
+// be saved, re-sent, and watched from a terminal without the dashboard, and
+// version prints the build.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultServerURL is the instance the client commands talk to by default.
+const defaultServerURL = "http://localhost:8080"
+
+// apiClient calls the API of a running instance.
+type apiClient struct {
+	base     *url.URL
+	user     string
+	password string
+	http     *http.Client
+}
+
+// clientFlags adds the -server and -auth flags of the client commands to fs
+// and returns a function building the client once fs is parsed.
+func clientFlags(fs *flag.FlagSet) func() (*apiClient, error) {
+	server := fs.String("server", defaultServerURL, "URL of the hooklab instance, or its -admin-addr listener")
+	auth := fs.String("auth", "", "user:password for an instance started with -auth or -auth-file")
+	return func() (*apiClient, error) {
+		base, err := url.Parse(strings.TrimSuffix(*server, "/"))
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return nil, fmt.Errorf("-server %q must be an absolute http(s) URL", *server)
+		}
+		client := &apiClient{base: base, http: &http.Client{}}
+		if *auth != "" {
+			user, password, ok := strings.Cut(*auth, ":")
+			if !ok {
+				return nil, errors.New("-auth must be user:password")
+			}
+			client.user, client.password = user, password
+		}
+		return client, nil
+	}
+}
+
+// get sends a GET request for path with query and returns the response,
+// turning error statuses into errors.
+func (c *apiClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	target := *c.base
+	target.Path += path
+	target.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s: %s", target.Path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// events returns the instance's stored events, newest first, optionally only
+// those of key or with tag.
+func (c *apiClient) events(ctx context.Context, key, tag string) ([]Event, error) {
+	query := url.Values{}
+	if key != "" {
+		query.Set("key", key)
+	}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := c.get(ctx, "/api/events", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var events EventsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("decoding events: %w", err)
+	}
+	return events.Events, nil
+}
+
+// runExport implements "hooklab export": it writes the stored events of a
+// running instance to out or a file, as one JSON document or JSON lines.
+func runExport(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	client := clientFlags(fs)
+	key := fs.String("key", "", "Only export events of this webhook key")
+	tag := fs.String("tag", "", "Only export events with this tag")
+	format := fs.String("format", "json", "Output format: json (an {\"events\": [...]} document, newest first) or jsonl (one event per line, oldest first)")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "jsonl" {
+		return fmt.Errorf("unknown -format %q, want json or jsonl", *format)
+	}
+	c, err := client()
+	if err != nil {
+		return err
+	}
+	events, err := c.events(context.Background(), *key, *tag)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	if *format == "jsonl" {
+		slices.Reverse(events)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(EventsResponse{Events: events})
+}
+
+// readEvents reads events written by export, in either format, from r.
+func readEvents(r io.Reader) ([]Event, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var document EventsResponse
+	if err := json.Unmarshal(data, &document); err == nil && document.Events != nil {
+		return document.Events, nil
+	}
+	var events []Event
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+}
+
+// runReplay implements "hooklab replay": it re-sends captured events, from an
+// export file or a running instance, to a target URL with their original
+// method, headers, and body, oldest first.
+func runReplay(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	client := clientFlags(fs)
+	target := fs.String("target", "", "URL the events are sent to (required)")
+	file := fs.String("file", "", "Replay the events of this export file (- for stdin) instead of fetching them from -server")
+	key := fs.String("key", "", "Only replay events of this webhook key")
+	ids := fs.String("ids", "", "Only replay the events with these comma-separated IDs")
+	delay := fs.Duration("delay", 0, "Wait between events")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := validateTarget(*target); err != nil {
+		return fmt.Errorf("-target %w", err)
+	}
+	var only []int
+	for _, field := range strings.Split(*ids, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("-ids: invalid event ID %q", field)
+		}
+		only = append(only, id)
+	}
+
+	var events []Event
+	var err error
+	switch *file {
+	case "":
+		c, err := client()
+		if err != nil {
+			return err
+		}
+		events, err = c.events(context.Background(), *key, "")
+		if err != nil {
+			return err
+		}
+	case "-":
+		events, err = readEvents(os.Stdin)
+	default:
+		var f *os.File
+		if f, err = os.Open(*file); err == nil {
+			events, err = readEvents(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	events = slices.DeleteFunc(events, func(event Event) bool {
+		return (*key != "" && event.Key != *key) || (len(only) > 0 && !slices.Contains(only, event.ID)) || event.Rejected != ""
+	})
+	slices.SortFunc(events, func(x, y Event) int { return x.Timestamp.Compare(y.Timestamp) })
+	if len(events) == 0 {
+		return errors.New("no events to replay")
+	}
+
+	failed := 0
+	for i, event := range events {
+		if i > 0 && *delay > 0 {
+			time.Sleep(*delay)
+		}
+		resp, err := forwardEvent(context.Background(), *target, event, http.Header{"X-Hooklab-Replay": {strconv.Itoa(event.ID)}})
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "#%d %s %s: %v\n", event.ID, event.Method, event.Path, err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			failed++
+		}
+		fmt.Fprintf(out, "#%d %s %s: %s\n", event.ID, event.Method, event.Path, resp.Status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, len(events))
+	}
+	return nil
+}
+
+// runTail implements "hooklab tail": it prints the webhooks a running instance
+// captures, as they arrive, until ctx is done.
+func runTail(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	client := clientFlags(fs)
+	key := fs.String("key", "", "Only show webhooks of these comma-separated keys")
+	backlog := fs.Int("backlog", 10, "Stored events shown before live ones")
+	format := fs.String("format", "text", "Output format: text (one summary line per webhook) or json (one event per line)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown -format %q, want text or json", *format)
+	}
+	if *backlog < 0 {
+		return errors.New("-backlog must not be negative")
+	}
+	c, err := client()
+	if err != nil {
+		return err
+	}
+	query := url.Values{"backlog": {strconv.Itoa(*backlog)}}
+	if *key != "" {
+		query.Set("key", *key)
+	}
+	resp, err := c.get(ctx, "/api/stream", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Captured webhooks are unnamed messages; named notices are skipped.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*maxBodySize)
+	named := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			named = false
+		case strings.HasPrefix(line, "event:"):
+			named = true
+		case strings.HasPrefix(line, "data:") && !named:
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if *format == "json" {
+				fmt.Fprintln(out, data)
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(data), &event); err == nil {
+				fmt.Fprintln(out, tailLine(event))
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by the server")
+}
+
+// tailLine summarizes event on one line.
+func tailLine(event Event) string {
+	line := fmt.Sprintf("%s #%d %s %s %d bytes", event.Timestamp.Local().Format("15:04:05"), event.ID, event.Method, event.Path, len(event.Body))
+	if len(event.Tags) > 0 {
+		line += " [" + strings.Join(event.Tags, ",") + "]"
+	}
+	if event.Rejected != "" {
+		line += " rejected: " + event.Rejected
+	}
+	return line
+}
+
+// runVersion implements "hooklab version".
+func runVersion(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ver, commit, modified := buildInfo()
+	line := "hooklab " + ver
+	if commit != "" {
+		line += " (" + commit
+		if modified {
+			line += ", modified"
+		}
+		line += ")"
+	}
+	fmt.Fprintf(out, "%s %s %s/%s\n", line, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -0,0 +1,189 @@
+package hooklab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cliServer starts an instance with two captured webhooks and returns it.
+func cliServer(t *testing.T) (*App, *httptest.Server) {
+	t.Helper()
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{StatusCode: http.StatusOK, Response: map[string]string{"ok": "yes"}})
+	server, err := newServer(app, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler)
+	t.Cleanup(ts.Close)
+	for _, body := range []string{`{"n":1}`, `{"n":2}`} {
+		resp, err := http.Post(ts.URL+"/webhook/orders", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	return app, ts
+}
+
+func TestRunExport(t *testing.T) {
+	_, ts := cliServer(t)
+
+	var out bytes.Buffer
+	if err := runExport([]string{"-server", ts.URL, "-key", "orders"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var document EventsResponse
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Events) != 2 || document.Events[0].Body != `{"n":2}` {
+		t.Errorf("expected both events newest first, got %+v", document.Events)
+	}
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := runExport([]string{"-server", ts.URL, "-format", "jsonl", "-o", path}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := readEvents(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Body != `{"n":1}` || strings.Count(string(data), "\n") != 2 {
+		t.Errorf("expected one event per line oldest first, got %q", data)
+	}
+
+	if err := runExport([]string{"-server", ts.URL, "-format", "csv"}, io.Discard); err == nil {
+		t.Error("expected an unknown format to be refused")
+	}
+	if err := runExport([]string{"-server", "localhost:8080"}, io.Discard); err == nil {
+		t.Error("expected a -server without a scheme to be refused")
+	}
+}
+
+func TestRunExportAuth(t *testing.T) {
+	app, ts := cliServer(t)
+	app.setCredentials(credentials{"vera": {password: "secret", role: RoleViewer}})
+
+	if err := runExport([]string{"-server", ts.URL}, io.Discard); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+	if err := runExport([]string{"-server", ts.URL, "-auth", "vera:secret"}, io.Discard); err != nil {
+		t.Errorf("expected -auth to log in, got %v", err)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	_, ts := cliServer(t)
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer target.Close()
+
+	var out bytes.Buffer
+	if err := runReplay([]string{"-server", ts.URL, "-target", target.URL}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != `{"n":1}` || bodies[1] != `{"n":2}` {
+		t.Errorf("expected both events oldest first, got %q", bodies)
+	}
+	if got := received[0].Header.Get("X-Hooklab-Replay"); got != "1" {
+		t.Errorf("expected the replayed event's ID in a header, got %q", got)
+	}
+	if received[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected the original headers, got %v", received[0].Header)
+	}
+	if !strings.Contains(out.String(), "#2 POST /webhook/orders: 200 OK") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	file := filepath.Join(t.TempDir(), "events.json")
+	var exported bytes.Buffer
+	if err := runExport([]string{"-server", ts.URL}, &exported); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(file, exported.Bytes(), 0o600)
+	bodies = nil
+	if err := runReplay([]string{"-file", file, "-ids", "2", "-target", target.URL}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || bodies[0] != `{"n":2}` {
+		t.Errorf("expected only event 2, got %q", bodies)
+	}
+
+	if err := runReplay([]string{"-server", ts.URL}, io.Discard); err == nil {
+		t.Error("expected a missing -target to be refused")
+	}
+	if err := runReplay([]string{"-server", ts.URL, "-key", "missing", "-target", target.URL}, io.Discard); err == nil {
+		t.Error("expected replaying no events to fail")
+	}
+}
+
+func TestRunTail(t *testing.T) {
+	_, ts := cliServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- runTail(ctx, []string{"-server", ts.URL, "-key", "orders", "-backlog", "1"}, writer)
+		writer.Close()
+	}()
+
+	lines := bufio.NewScanner(reader)
+	if !lines.Scan() || !strings.Contains(lines.Text(), "#2 POST /webhook/orders 7 bytes") {
+		t.Fatalf("expected the backlog event, got %q", lines.Text())
+	}
+	resp, err := http.Post(ts.URL+"/webhook/orders", "application/json", strings.NewReader(`{"n":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !lines.Scan() || !strings.Contains(lines.Text(), "#3 POST /webhook/orders") {
+		t.Fatalf("expected the live event, got %q", lines.Text())
+	}
+
+	cancel()
+	go io.Copy(io.Discard, reader)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected tail to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail didn't stop")
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	var out bytes.Buffer
+	if err := runVersion(nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "hooklab ") || !strings.Contains(out.String(), " go") {
+		t.Errorf("unexpected version %q", out.String())
+	}
+}
@@ -0,0 +1,131 @@
+// Hooklab is a lightweight, self-hosted webhook testing and API mocking tool.
+//
+// It provides real-time webhook capture, custom response configuration,
+// and a rule engine for conditional responses based on request content.
+//
+// Usage:
+//
+//	hooklab -port 8080 -response '{"result":"ok"}'
+//	hooklab <command> [flags]
+//
+// Commands:
+//
+//	serve                 Run the webhook server with the flags below (the default when the first argument is a flag)
+//	export                Write a running instance's captured events as JSON (-server, -key, -tag, -format json|jsonl, -o)
+//	replay                Re-send captured events to -target, from -file or a running instance (-key, -ids, -delay)
+//	tail                  Print a running instance's webhooks as they arrive (-server, -key, -backlog, -format text|json)
+//	version               Print the version, commit, and Go version
+//
+// Flags of serve:
+//
+//	-config               Read settings, response configs, and rules from this YAML file; flags override it; SIGHUP reloads it
+//	-rules-file           Load rule sets per webhook key from this YAML or JSON file at startup
+//	-responses-file       Load response configs per webhook key from this YAML or JSON file at startup
+//	-port                 Port for the HTTP server; 0 picks a free one (default: 8080)
+//	-admin-addr           Serve the API and dashboard on this separate address, e.g. 127.0.0.1:9090, and only webhooks on -port
+//	-base-path            Path prefix hooklab is reached under behind a reverse proxy, e.g. /hooklab
+//	-response             JSON string to be returned by the webhook handler
+//	-tls-cert             Serve HTTPS with this PEM certificate chain file (requires -tls-key)
+//	-tls-key              Private key file for -tls-cert
+//	-domain               Serve HTTPS for these comma-separated domains with certificates from Let's Encrypt
+//	-acme-cache           Directory Let's Encrypt certificates are kept in (default: hooklab-certs)
+//	-acme-email           Contact email given to Let's Encrypt for expiry notices
+//	-client-auth          Client certificates to ask for over HTTPS: none, request, require, verify-if-given, or require-and-verify (default: none)
+//	-client-ca            PEM file of the CA certificates client certificates are verified against
+//	-stream-buffer        Messages an SSE client can fall behind by before they are dropped (default: 16)
+//	-nats-url             Publish captured webhooks to this NATS server, e.g. nats://localhost:4222
+//	-nats-subject         Subject template for published webhooks (default: hooklab.{{.key}})
+//	-kafka-brokers        Publish captured webhooks to these comma-separated Kafka brokers
+//	-kafka-topic          Topic template for published webhooks (default: hooklab-events)
+//	-kafka-batch-size     Messages per Kafka batch (default: 100)
+//	-kafka-batch-timeout  How long an incomplete Kafka batch waits before it is sent (default: 100ms)
+//	-kafka-retries        Attempts to deliver a Kafka batch before it is dropped (default: 10)
+//	-auth                 Require this user:password[:role] for the dashboard and API
+//	-auth-file            Require a login from this file of user:password[:role] lines (passwords may be bcrypt hashes)
+//	-allow-ips            Only accept webhooks from these comma-separated CIDR prefixes or addresses
+//	-deny-ips             Refuse webhooks from these comma-separated CIDR prefixes or addresses
+//	-capture-rate         Webhooks per second each client may send to a key before being throttled (default: 0, unlimited)
+//	-capture-burst        Webhooks a client may send to a key at once under -capture-rate (default: 20)
+//	-mqtt-url             Publish captured webhooks to this MQTT broker, e.g. tcp://localhost:1883
+//	-mqtt-topic           Topic template for published webhooks (default: hooklab/{{.key}})
+//	-mqtt-qos             QoS for published webhooks: 0, 1, or 2 (default: 1)
+//	-redis-url            Share the live stream with other instances through this Redis server, e.g. redis://localhost:6379
+//	-redis-channel        Redis pub/sub channel for the shared stream (default: hooklab:events)
+//	-schema-registry      Decode Avro webhooks in the Confluent wire format with schemas from this registry, e.g. http://localhost:8081
+//	-otlp-endpoint        Export traces over OTLP/HTTP to this collector, e.g. http://localhost:4318 (default: OTEL_EXPORTER_OTLP_ENDPOINT)
+//	-access-log           Log every request to stdout: none, common, combined, or json (default: none)
+//	-access-log-exclude   Comma-separated paths left out of the access log, e.g. /api/stream; a trailing / covers the paths below
+//	-slow-request         Log webhooks whose processing, not counting configured delays, takes longer than this, e.g. 200ms (default: 0, off)
+//	-no-ui                Serve only the webhook endpoints and API, without the dashboard
+//	-demo                 Seed a few keys with sample webhooks, response configs, and rules to explore
+//	-quiet                Log nothing about each webhook, instead of a summary line
+//	-v                    Log each webhook's headers after its summary line
+//	-vv                   Log each webhook's headers and body after its summary line
+//	-shutdown-timeout     How long shutting down may take, draining forwards and finishing requests, before connections are closed (default: 10s)
+//	-drain-retry-after    Retry-After given to webhooks refused with 503 while shutting down (default: 5s)
+//	-plugins-dir          Directory of the plugin programs key configs may pass webhooks to (default: none, plugins disabled)
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/essajiwa/hooklab/internal/command"
+)
+
+// usage describes the subcommands.
+const usage = `Usage: hooklab <command> [flags]
+
+Commands:
+  serve     Run the webhook server (the default when the first argument is a flag)
+  export    Write a running instance's captured events as JSON
+  replay    Re-send captured events to a URL
+  tail      Print a running instance's webhooks as they arrive
+  version   Print the version and build
+
+Run "hooklab <command> -h" for a command's flags.
+`
+
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	var err error
+	switch name {
+	case "serve":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+		err = command.Serve(ctx, fs, args, sinkFlags(fs))
+		stop()
+	case "export":
+		err = command.Export(args, os.Stdout)
+	case "replay":
+		err = command.Replay(args, os.Stdout)
+	case "tail":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err = command.Tail(ctx, args, os.Stdout)
+		stop()
+	case "version":
+		err = command.Version(args, os.Stdout)
+	case "help":
+		fmt.Fprint(os.Stderr, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "hooklab: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hooklab %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
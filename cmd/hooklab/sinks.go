@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/kafkasink"
+	"github.com/essajiwa/hooklab/mqttsink"
+	"github.com/essajiwa/hooklab/natssink"
+	"github.com/essajiwa/hooklab/redisbridge"
+)
+
+// sinkFlags adds the flags of the sinks and the shared stream to fs and
+// returns a function connecting those that are set, once fs is parsed.
+func sinkFlags(fs *flag.FlagSet) func() ([]hooklab.Option, error) {
+	natsURL := fs.String("nats-url", "", "Publish captured webhooks to this NATS server")
+	natsSubject := fs.String("nats-subject", natssink.DefaultSubject, "Subject template for webhooks published to NATS")
+	kafkaBrokers := fs.String("kafka-brokers", "", "Publish captured webhooks to these comma-separated Kafka brokers")
+	kafkaTopic := fs.String("kafka-topic", kafkasink.DefaultTopic, "Topic template for webhooks published to Kafka")
+	kafkaBatchSize := fs.Int("kafka-batch-size", kafkasink.DefaultBatchSize, "Messages per Kafka batch")
+	kafkaBatchTimeout := fs.Duration("kafka-batch-timeout", kafkasink.DefaultBatchTimeout, "How long an incomplete Kafka batch waits before it is sent")
+	kafkaRetries := fs.Int("kafka-retries", kafkasink.DefaultRetries, "Attempts to deliver a Kafka batch before it is dropped")
+	mqttURL := fs.String("mqtt-url", "", "Publish captured webhooks to this MQTT broker")
+	mqttTopic := fs.String("mqtt-topic", mqttsink.DefaultTopic, "Topic template for webhooks published to MQTT")
+	mqttQoS := fs.Int("mqtt-qos", mqttsink.DefaultQoS, "QoS for webhooks published to MQTT: 0, 1, or 2")
+	redisURL := fs.String("redis-url", "", "Share the live stream with other instances through this Redis server")
+	redisChannel := fs.String("redis-channel", redisbridge.DefaultChannel, "Redis pub/sub channel for the shared stream")
+
+	return func() ([]hooklab.Option, error) {
+		var options []hooklab.Option
+		if *natsURL != "" {
+			sink, err := natssink.New(*natsURL, *natsSubject)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+			}
+			options = append(options, hooklab.WithSink(sink))
+		}
+
+		if *kafkaBrokers != "" {
+			if *kafkaBatchSize < 1 || *kafkaBatchTimeout <= 0 || *kafkaRetries < 1 {
+				return nil, errors.New("invalid Kafka batching: -kafka-batch-size, -kafka-batch-timeout, and -kafka-retries must be positive")
+			}
+			sink, err := kafkasink.New(kafkasink.Config{
+				Brokers:      parseBrokers(*kafkaBrokers),
+				Topic:        *kafkaTopic,
+				BatchSize:    *kafkaBatchSize,
+				BatchTimeout: *kafkaBatchTimeout,
+				Retries:      *kafkaRetries,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("invalid Kafka sink: %w", err)
+			}
+			options = append(options, hooklab.WithSink(sink))
+		}
+
+		if *mqttURL != "" {
+			sink, err := mqttsink.New(*mqttURL, *mqttTopic, *mqttQoS)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to MQTT: %w", err)
+			}
+			options = append(options, hooklab.WithSink(sink))
+		}
+
+		if *redisURL != "" {
+			bridge, err := redisbridge.New(*redisURL, *redisChannel)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+			}
+			options = append(options, hooklab.WithBridge(bridge))
+		}
+		return options, nil
+	}
+}
+
+// parseBrokers splits a comma-separated broker list such as "kafka1:9092,kafka2:9092".
+func parseBrokers(list string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(list, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBrokers(t *testing.T) {
+	if got, want := parseBrokers("kafka1:9092, kafka2:9092,"), []string{"kafka1:9092", "kafka2:9092"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected brokers %v, got %v", want, got)
+	}
+}
+
+func TestSinkFlags(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	options := sinkFlags(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := options(); err != nil || len(got) != 0 {
+		t.Errorf("expected no sinks without their flags, got %d, %v", len(got), err)
+	}
+
+	fs = flag.NewFlagSet("serve", flag.ContinueOnError)
+	options = sinkFlags(fs)
+	if err := fs.Parse([]string{"-kafka-brokers", "kafka1:9092", "-kafka-retries", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := options(); err == nil || !strings.Contains(err.Error(), "batching") {
+		t.Errorf("expected a batching error, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package hooklab
+
+// This file contains the serve subcommand, which runs the webhook server from
+// its flags and the -config file. It and the other subcommands are handed to
+// cmd/hooklab through internal/command, so the library exports only New,
+// Handler, and the options.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/essajiwa/hooklab/internal/command"
+)
+
+func init() {
+	command.SetServe(serve)
+	command.Export = runExport
+	command.Replay = runReplay
+	command.Tail = runTail
+	command.Version = runVersion
+}
+
+// serve runs the webhook server with the flags in args until ctx is done. fs
+// holds the command's own flags; once they are parsed and merged with the
+// -config file, extra returns the options the App is built with besides those
+// of the flags below, such as its sinks.
+func serve(ctx context.Context, fs *flag.FlagSet, args []string, extra func() ([]Option, error)) error {
+	configPath := fs.String("config", "", "Read settings, response configs, and rules from this YAML file; flags override it")
+	rulesFile := fs.String("rules-file", "", "Load rule sets per webhook key from this YAML or JSON file at startup")
+	responsesFile := fs.String("responses-file", "", "Load response configs per webhook key from this YAML or JSON file at startup")
+	responseJSON := fs.String("response", `{"result":"ok"}`, "JSON string to be returned by the handler")
+	port := fs.Int("port", 8080, "Port for the HTTP server; 0 picks a free one")
+	adminAddr := fs.String("admin-addr", "", "Serve the API and dashboard on this separate address, e.g. 127.0.0.1:9090, and only webhooks on -port")
+	basePathFlag := fs.String("base-path", "", "Path prefix hooklab is reached under behind a reverse proxy, e.g. /hooklab")
+	tlsCert := fs.String("tls-cert", "", "Serve HTTPS with this PEM certificate chain file (requires -tls-key)")
+	tlsKey := fs.String("tls-key", "", "Private key file for -tls-cert")
+	domain := fs.String("domain", "", "Serve HTTPS for these comma-separated domains with certificates from Let's Encrypt")
+	acmeCache := fs.String("acme-cache", defaultACMECache, "Directory Let's Encrypt certificates are kept in")
+	acmeEmail := fs.String("acme-email", "", "Contact email given to Let's Encrypt for expiry notices")
+	clientAuth := fs.String("client-auth", ClientAuthNone, "Client certificates to ask for over HTTPS: none, request, require, verify-if-given, or require-and-verify")
+	clientCA := fs.String("client-ca", "", "PEM file of the CA certificates client certificates are verified against")
+	streamBuffer := fs.Int("stream-buffer", defaultStreamBuffer, "Messages an SSE client can fall behind by before they are dropped")
+	auth := fs.String("auth", "", "Require this user:password[:role] for the dashboard and API; role is viewer, editor, or admin (default)")
+	authFile := fs.String("auth-file", "", "Require a login from this file of user:password[:role] lines for the dashboard and API")
+	allowIPs := fs.String("allow-ips", "", "Only accept webhooks from these comma-separated CIDR prefixes or addresses")
+	denyIPs := fs.String("deny-ips", "", "Refuse webhooks from these comma-separated CIDR prefixes or addresses")
+	captureRate := fs.Float64("capture-rate", 0, "Webhooks per second each client may send to a key before being throttled (0 is unlimited)")
+	captureBurst := fs.Int("capture-burst", defaultCaptureBurst, "Webhooks a client may send to a key at once under -capture-rate")
+	schemaRegistryURL := fs.String("schema-registry", "", "Decode Avro webhooks in the Confluent wire format with schemas from this registry")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "Export traces over OTLP/HTTP to this collector")
+	accessLog := fs.String("access-log", AccessLogNone, "Log every request to stdout: none, common, combined, or json")
+	accessLogExclude := fs.String("access-log-exclude", "", "Comma-separated paths left out of the access log, e.g. /api/stream")
+	slowRequest := fs.Duration("slow-request", 0, "Log webhooks whose processing, not counting configured delays, takes longer than this (0 is off)")
+	noUI := fs.Bool("no-ui", false, "Serve only the webhook endpoints and API, without the dashboard")
+	demo := fs.Bool("demo", false, "Seed a few keys with sample webhooks, response configs, and rules to explore")
+	quiet := fs.Bool("quiet", false, "Log nothing about each webhook, instead of a summary line")
+	verbose := fs.Bool("v", false, "Log each webhook's headers after its summary line")
+	veryVerbose := fs.Bool("vv", false, "Log each webhook's headers and body after its summary line")
+	shutdownTimeout := fs.Duration("shutdown-timeout", defaultShutdownTimeout, "How long shutting down may take, draining forwards and finishing requests, before connections are closed")
+	drainRetryAfter := fs.Duration("drain-retry-after", defaultDrainRetryAfter, "Retry-After given to webhooks refused with 503 while shutting down")
+	pluginsDir := fs.String("plugins-dir", "", "Directory of the plugin programs key configs may pass webhooks to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	explicit := explicitFlags(fs)
+	var fileConfig *FileConfig
+	if *configPath != "" {
+		var err error
+		if fileConfig, err = loadFileConfig(*configPath); err != nil {
+			return fmt.Errorf("invalid -config: %w", err)
+		}
+		// Logins given on the command line replace the file's.
+		if explicit["auth"] || explicit["auth-file"] {
+			fileConfig.Auth = AuthFileConfig{}
+		}
+		// So does a verbosity.
+		if explicitVerbosity(explicit) {
+			fileConfig.Verbosity = ""
+		}
+		if err := fileConfig.applyFlags(fs, explicit); err != nil {
+			return fmt.Errorf("invalid -config: %w", err)
+		}
+	}
+
+	if *streamBuffer < 1 {
+		return fmt.Errorf("invalid -stream-buffer %d: must be at least 1", *streamBuffer)
+	}
+	if *slowRequest < 0 {
+		return fmt.Errorf("invalid -slow-request %v: must not be negative", *slowRequest)
+	}
+	if *shutdownTimeout <= 0 || *drainRetryAfter <= 0 {
+		return errors.New("invalid -shutdown-timeout or -drain-retry-after: must be positive")
+	}
+	verbosity, err := verbosityFromFlags(*quiet, *verbose, *veryVerbose)
+	if err != nil {
+		return fmt.Errorf("invalid verbosity: %w", err)
+	}
+
+	var responseData interface{}
+	if err := json.Unmarshal([]byte(*responseJSON), &responseData); err != nil {
+		return fmt.Errorf("invalid JSON for -response flag: %w", err)
+	}
+
+	basePath, err := parseBasePath(*basePathFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -base-path %q: %w", *basePathFlag, err)
+	}
+
+	options := []Option{WithStreamBuffer(*streamBuffer), WithBasePath(basePath)}
+	if *noUI {
+		options = append(options, WithoutUI())
+	}
+	if *pluginsDir != "" {
+		if info, err := os.Stat(*pluginsDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid -plugins-dir %q: not a directory", *pluginsDir)
+		}
+		options = append(options, WithPluginsDir(*pluginsDir))
+	}
+	more, err := extra()
+	if err != nil {
+		return err
+	}
+	options = append(options, more...)
+	app := New(options...)
+	// Seed before any filter or limit could refuse the demo webhooks.
+	if *demo {
+		keys, err := app.seedDemo()
+		if err != nil {
+			return fmt.Errorf("seeding the demo failed: %w", err)
+		}
+		log.Printf("Demo mode: seeded %d webhooks to keys %s", len(demoWebhooks), strings.Join(keys, ", "))
+	}
+	users := make(credentials)
+	if *authFile != "" {
+		loaded, err := loadCredentials(*authFile)
+		if err != nil {
+			return fmt.Errorf("invalid -auth-file: %w", err)
+		}
+		users = loaded
+	}
+	if fileConfig != nil {
+		for _, line := range fileConfig.Auth.Users {
+			user, account, _ := parseCredential(line)
+			users[user] = account
+		}
+	}
+	if *auth != "" {
+		user, account, err := parseCredential(*auth)
+		if err != nil {
+			return fmt.Errorf("invalid -auth: %w", err)
+		}
+		users[user] = account
+	}
+	app.setCredentials(users)
+
+	ipFilter := IPFilter{Allow: parseIPList(*allowIPs), Deny: parseIPList(*denyIPs)}
+	if err := ipFilter.validate(); err != nil {
+		return fmt.Errorf("invalid -allow-ips or -deny-ips: %w", err)
+	}
+	app.setIPFilter(ipFilter)
+
+	captureLimit := CaptureLimit{Rate: *captureRate, Burst: *captureBurst}
+	if err := captureLimit.validate(); err != nil {
+		return fmt.Errorf("invalid -capture-rate or -capture-burst: %w", err)
+	}
+	app.setCaptureLimit(captureLimit)
+	app.setSlowRequest(*slowRequest)
+	app.setVerbosity(verbosity)
+	defaultResponse := ResponseConfig{
+		Response:    responseData,
+		ResponseRaw: string(*responseJSON),
+		StatusCode:  http.StatusOK,
+	}
+	app.setResponseConfig("default", defaultResponse)
+	if fileConfig != nil {
+		app.applyFileConfig(fileConfig, explicit["response"])
+		app.reloader = newConfigReloader(*configPath, fs, explicit, fileConfig, defaultResponse)
+	}
+	if *responsesFile != "" {
+		responses, err := loadResponsesFile(*responsesFile)
+		if err != nil {
+			return fmt.Errorf("invalid -responses-file: %w", err)
+		}
+		app.applyFileConfig(&FileConfig{Responses: responses}, explicit["response"])
+	}
+	if *rulesFile != "" {
+		rules, err := loadRulesFile(*rulesFile)
+		if err != nil {
+			return fmt.Errorf("invalid -rules-file: %w", err)
+		}
+		app.applyFileConfig(&FileConfig{Rules: rules}, false)
+	}
+
+	if *schemaRegistryURL != "" {
+		registry, err := newSchemaRegistry(*schemaRegistryURL)
+		if err != nil {
+			return fmt.Errorf("invalid -schema-registry: %w", err)
+		}
+		app.setSchemaRegistry(registry)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), *otlpEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	var server, adminServer *http.Server
+	if *adminAddr != "" {
+		server, adminServer, err = newSplitServers(app, *port, *adminAddr)
+	} else {
+		server, err = newServer(app, *port)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	if *domain != "" {
+		if *tlsCert != "" || *tlsKey != "" {
+			return errors.New("-domain can't be combined with -tls-cert or -tls-key")
+		}
+		manager, err := newACMEManager(parseDomains(*domain), *acmeCache, *acmeEmail)
+		if err != nil {
+			return fmt.Errorf("invalid -domain: %w", err)
+		}
+		server.TLSConfig = acmeTLSConfig(manager)
+	} else {
+		server.TLSConfig, err = loadTLSConfig(*tlsCert, *tlsKey)
+		if err != nil {
+			return fmt.Errorf("invalid TLS certificate: %w", err)
+		}
+	}
+	if err := applyClientAuth(server.TLSConfig, *clientAuth, *clientCA); err != nil {
+		return fmt.Errorf("invalid client certificate settings: %w", err)
+	}
+	accessLogger, err := newAccessLogger(*accessLog, *accessLogExclude, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("invalid access log settings: %w", err)
+	}
+	if accessLogger != nil {
+		server.Handler = accessLogger.wrap(server.Handler)
+	}
+	servers := []*http.Server{server}
+	if adminServer != nil {
+		// The admin listener shares the certificate and client certificate settings.
+		adminServer.TLSConfig = server.TLSConfig
+		if accessLogger != nil {
+			adminServer.Handler = accessLogger.wrap(adminServer.Handler)
+		}
+		servers = append(servers, adminServer)
+	}
+	sockets, err := activatedSockets()
+	if err != nil {
+		return fmt.Errorf("invalid systemd sockets: %w", err)
+	}
+	listeners, err := pairSockets(server, adminServer, sockets)
+	if err != nil {
+		return fmt.Errorf("invalid systemd sockets: %w", err)
+	}
+	go app.watchAlerts(alertCheckInterval)
+
+	// Open the servers' own addresses before serving, so with -port 0 the
+	// picked port is known for the URLs.
+	scheme := "HTTP"
+	if server.TLSConfig != nil {
+		scheme = "HTTPS"
+	}
+	urlHost := ""
+	if *domain != "" {
+		urlHost = parseDomains(*domain)[0]
+	}
+	urls := make(map[*http.Server]string)
+	for _, s := range servers {
+		name, where := "Server", "systemd socket "
+		if s == adminServer {
+			name = "Admin server"
+		}
+		if listeners[s] == nil {
+			ln, err := listen(s)
+			if err != nil {
+				return fmt.Errorf("could not start server: %w", err)
+			}
+			listeners[s], where = ln, ""
+		}
+		urls[s] = listenURL(s, listeners[s], urlHost, app.basePath)
+		log.Printf("%s starting on %s%s (%s): %s", name, where, listeners[s].Addr(), scheme, urls[s])
+	}
+	app.setListenURLs(urls[server], urls[adminServer])
+
+	// Goroutines to start the servers
+	failed := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			if err := serveListener(s, listeners[s]); err != nil && err != http.ErrServerClosed {
+				failed <- fmt.Errorf("could not start server: %w", err)
+			}
+		}()
+	}
+
+	// Reload the config file on SIGHUP
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for range hangup {
+			app.reloadConfig()
+		}
+	}()
+
+	// Waiting for the command to be interrupted
+	select {
+	case <-ctx.Done():
+	case err = <-failed:
+	}
+
+	log.Println("Server is shutting down...")
+
+	// Create a context with a timeout for the shutdown
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), *shutdownTimeout)
+	defer cancel()
+
+	// Refuse new webhooks while forwards and deliveries under way finish
+	app.beginDrain(*drainRetryAfter)
+	if !app.waitForForwards(ctx) {
+		log.Printf("Shutdown timeout reached with forwards or deliveries in flight; abandoning them")
+	}
+
+	// Shutdown the server gracefully
+	app.beginShutdown()
+	app.closeBridge()
+	app.closeSubscribers()
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown timed out, closing open connections: %v", err)
+			s.Close()
+		}
+	}
+	app.closeSinks()
+	app.closePlugins()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
+	log.Println("Server stopped gracefully")
+	return err
+}
@@ -0,0 +1,334 @@
+package hooklab
+
+// This file contains the -config file: a YAML document holding the settings
+// otherwise given as flags, plus the response configs and rules keys start
+// with, so a whole setup can be kept in one place. Flags given on the command
+// line override the file.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FileConfig is the -config file. Settings left out keep their flag's value.
+type FileConfig struct {
+	Port       int                       `json:"port,omitempty"`
+	AdminAddr  string                    `json:"adminAddr,omitempty"` // -admin-addr
+	BasePath   string                    `json:"basePath,omitempty"`  // -base-path
+	TLS        TLSFileConfig             `json:"tls,omitempty"`
+	Auth       AuthFileConfig            `json:"auth,omitempty"`
+	Storage    StorageFileConfig         `json:"storage,omitempty"`
+	Limits     LimitsFileConfig          `json:"limits,omitempty"`
+	AccessLog  AccessLogFileConfig       `json:"accessLog,omitempty"`
+	Tracing    TracingFileConfig         `json:"tracing,omitempty"`
+	Shutdown   ShutdownFileConfig        `json:"shutdown,omitempty"`
+	Verbosity  string                    `json:"verbosity,omitempty"`  // quiet (-quiet), summary, headers (-v), or body (-vv)
+	Demo       bool                      `json:"demo,omitempty"`       // -demo
+	NoUI       bool                      `json:"noUI,omitempty"`       // -no-ui
+	PluginsDir string                    `json:"pluginsDir,omitempty"` // -plugins-dir
+	Responses  map[string]ResponseConfig `json:"responses,omitempty"`  // Response configs per webhook key; "default" replaces -response
+	Rules      map[string][]Rule         `json:"rules,omitempty"`      // Rules per webhook key, as exported by /api/rules/export
+	Forwards   map[string]string         `json:"forwards,omitempty"`   // URLs the webhooks of a key are proxied to, per webhook key
+}
+
+// TLSFileConfig holds the HTTPS settings.
+type TLSFileConfig struct {
+	Cert       string   `json:"cert,omitempty"`       // -tls-cert
+	Key        string   `json:"key,omitempty"`        // -tls-key
+	Domains    []string `json:"domains,omitempty"`    // -domain
+	ACMECache  string   `json:"acmeCache,omitempty"`  // -acme-cache
+	ACMEEmail  string   `json:"acmeEmail,omitempty"`  // -acme-email
+	ClientAuth string   `json:"clientAuth,omitempty"` // -client-auth
+	ClientCA   string   `json:"clientCA,omitempty"`   // -client-ca
+}
+
+// AuthFileConfig holds the dashboard and API logins.
+type AuthFileConfig struct {
+	Users []string `json:"users,omitempty"` // user:password[:role] lines, like -auth
+	File  string   `json:"file,omitempty"`  // -auth-file
+}
+
+// StorageFileConfig holds where captured events are published and shared.
+type StorageFileConfig struct {
+	NATS           NATSFileConfig  `json:"nats,omitempty"`
+	Kafka          KafkaFileConfig `json:"kafka,omitempty"`
+	MQTT           MQTTFileConfig  `json:"mqtt,omitempty"`
+	Redis          RedisFileConfig `json:"redis,omitempty"`
+	SchemaRegistry string          `json:"schemaRegistry,omitempty"` // -schema-registry
+}
+
+// NATSFileConfig holds the NATS sink settings.
+type NATSFileConfig struct {
+	URL     string `json:"url,omitempty"`     // -nats-url
+	Subject string `json:"subject,omitempty"` // -nats-subject
+}
+
+// KafkaFileConfig holds the Kafka sink settings.
+type KafkaFileConfig struct {
+	Brokers      []string `json:"brokers,omitempty"`      // -kafka-brokers
+	Topic        string   `json:"topic,omitempty"`        // -kafka-topic
+	BatchSize    int      `json:"batchSize,omitempty"`    // -kafka-batch-size
+	BatchTimeout Duration `json:"batchTimeout,omitempty"` // -kafka-batch-timeout
+	Retries      int      `json:"retries,omitempty"`      // -kafka-retries
+}
+
+// MQTTFileConfig holds the MQTT sink settings.
+type MQTTFileConfig struct {
+	URL   string `json:"url,omitempty"`   // -mqtt-url
+	Topic string `json:"topic,omitempty"` // -mqtt-topic
+	QoS   *int   `json:"qos,omitempty"`   // -mqtt-qos
+}
+
+// RedisFileConfig holds the shared stream settings.
+type RedisFileConfig struct {
+	URL     string `json:"url,omitempty"`     // -redis-url
+	Channel string `json:"channel,omitempty"` // -redis-channel
+}
+
+// LimitsFileConfig holds the limits on capture and streaming.
+type LimitsFileConfig struct {
+	StreamBuffer int      `json:"streamBuffer,omitempty"` // -stream-buffer
+	CaptureRate  float64  `json:"captureRate,omitempty"`  // -capture-rate
+	CaptureBurst int      `json:"captureBurst,omitempty"` // -capture-burst
+	AllowIPs     []string `json:"allowIPs,omitempty"`     // -allow-ips
+	DenyIPs      []string `json:"denyIPs,omitempty"`      // -deny-ips
+	SlowRequest  Duration `json:"slowRequest,omitempty"`  // -slow-request
+}
+
+// AccessLogFileConfig holds the access log settings.
+type AccessLogFileConfig struct {
+	Format  string   `json:"format,omitempty"`  // -access-log
+	Exclude []string `json:"exclude,omitempty"` // -access-log-exclude
+}
+
+// TracingFileConfig holds the tracing settings.
+type TracingFileConfig struct {
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"` // -otlp-endpoint
+}
+
+// ShutdownFileConfig holds how shutting down drains.
+type ShutdownFileConfig struct {
+	Timeout         Duration `json:"timeout,omitempty"`         // -shutdown-timeout
+	DrainRetryAfter Duration `json:"drainRetryAfter,omitempty"` // -drain-retry-after
+}
+
+// loadFileConfig reads and validates the config file at path. Unknown fields
+// are refused, so misspelled settings aren't silently ignored.
+func loadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config FileConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// loadRulesFile reads the rule sets per webhook key in the -rules-file at path,
+// shaped like the rules section of the config file.
+func loadRulesFile(path string) (map[string][]Rule, error) {
+	var rules map[string][]Rule
+	if err := loadSeedFile(path, &rules); err != nil {
+		return nil, err
+	}
+	if err := (&FileConfig{Rules: rules}).validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// loadResponsesFile reads the response configs per webhook key in the
+// -responses-file at path, shaped like the responses section of the config
+// file.
+func loadResponsesFile(path string) (map[string]ResponseConfig, error) {
+	var responses map[string]ResponseConfig
+	if err := loadSeedFile(path, &responses); err != nil {
+		return nil, err
+	}
+	if err := (&FileConfig{Responses: responses}).validate(); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// loadSeedFile reads the YAML or JSON file at path into v, refusing unknown
+// fields like loadFileConfig.
+func loadSeedFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, v)
+}
+
+// validate checks the response configs, rules, and forwards, and folds the
+// forwards into the response configs.
+func (c *FileConfig) validate() error {
+	for key, url := range c.Forwards {
+		config, ok := c.Responses[key]
+		if !ok {
+			config.StatusCode = http.StatusOK
+		}
+		config.ForwardTo = url
+		if c.Responses == nil {
+			c.Responses = make(map[string]ResponseConfig)
+		}
+		c.Responses[key] = config
+	}
+	for key, config := range c.Responses {
+		if config.StatusCode == 0 {
+			config.StatusCode = http.StatusOK
+		}
+		config.Methods = normalizeMethods(config.Methods)
+		if err := validateResponseConfig(config); err != nil {
+			return fmt.Errorf("responses.%s: %w", key, err)
+		}
+		c.Responses[key] = config
+	}
+	for key, rules := range c.Rules {
+		if key == "" {
+			return errors.New("rules: webhook key required")
+		}
+		for i := range rules {
+			if err := validateRule(&rules[i]); err != nil {
+				return fmt.Errorf("rules.%s[%d]: %w", key, i, err)
+			}
+		}
+	}
+	for _, line := range c.Auth.Users {
+		if _, _, err := parseCredential(line); err != nil {
+			return fmt.Errorf("auth.users: %w", err)
+		}
+	}
+	if c.Verbosity != "" {
+		if _, err := parseVerbosity(c.Verbosity); err != nil {
+			return fmt.Errorf("verbosity: %w", err)
+		}
+	}
+	return nil
+}
+
+// flagValues returns the file's settings as flag values by flag name.
+func (c *FileConfig) flagValues() map[string]string {
+	values := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			values[name] = strconv.Itoa(value)
+		}
+	}
+	setDuration := func(name string, value Duration) {
+		if value != 0 {
+			values[name] = time.Duration(value).String()
+		}
+	}
+
+	setInt("port", c.Port)
+	set("admin-addr", c.AdminAddr)
+	set("base-path", c.BasePath)
+	set("tls-cert", c.TLS.Cert)
+	set("tls-key", c.TLS.Key)
+	set("domain", strings.Join(c.TLS.Domains, ","))
+	set("acme-cache", c.TLS.ACMECache)
+	set("acme-email", c.TLS.ACMEEmail)
+	set("client-auth", c.TLS.ClientAuth)
+	set("client-ca", c.TLS.ClientCA)
+	set("auth-file", c.Auth.File)
+	set("nats-url", c.Storage.NATS.URL)
+	set("nats-subject", c.Storage.NATS.Subject)
+	set("kafka-brokers", strings.Join(c.Storage.Kafka.Brokers, ","))
+	set("kafka-topic", c.Storage.Kafka.Topic)
+	setInt("kafka-batch-size", c.Storage.Kafka.BatchSize)
+	setDuration("kafka-batch-timeout", c.Storage.Kafka.BatchTimeout)
+	setInt("kafka-retries", c.Storage.Kafka.Retries)
+	set("mqtt-url", c.Storage.MQTT.URL)
+	set("mqtt-topic", c.Storage.MQTT.Topic)
+	if c.Storage.MQTT.QoS != nil {
+		values["mqtt-qos"] = strconv.Itoa(*c.Storage.MQTT.QoS)
+	}
+	set("redis-url", c.Storage.Redis.URL)
+	set("redis-channel", c.Storage.Redis.Channel)
+	set("schema-registry", c.Storage.SchemaRegistry)
+	setInt("stream-buffer", c.Limits.StreamBuffer)
+	if c.Limits.CaptureRate != 0 {
+		values["capture-rate"] = strconv.FormatFloat(c.Limits.CaptureRate, 'g', -1, 64)
+	}
+	setInt("capture-burst", c.Limits.CaptureBurst)
+	set("allow-ips", strings.Join(c.Limits.AllowIPs, ","))
+	set("deny-ips", strings.Join(c.Limits.DenyIPs, ","))
+	setDuration("slow-request", c.Limits.SlowRequest)
+	set("access-log", c.AccessLog.Format)
+	set("access-log-exclude", strings.Join(c.AccessLog.Exclude, ","))
+	set("otlp-endpoint", c.Tracing.OTLPEndpoint)
+	setDuration("shutdown-timeout", c.Shutdown.Timeout)
+	setDuration("drain-retry-after", c.Shutdown.DrainRetryAfter)
+	set("plugins-dir", c.PluginsDir)
+	if c.Demo {
+		values["demo"] = "true"
+	}
+	if c.NoUI {
+		values["no-ui"] = "true"
+	}
+	switch c.Verbosity {
+	case "quiet":
+		values["quiet"] = "true"
+	case "headers":
+		values["v"] = "true"
+	case "body":
+		values["vv"] = "true"
+	}
+	return values
+}
+
+// applyFlags sets the flags of fs that the command line didn't set to the
+// file's values. explicit holds the names of the flags the command line set.
+func (c *FileConfig) applyFlags(fs *flag.FlagSet, explicit map[string]bool) error {
+	for name, value := range c.flagValues() {
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// explicitFlags returns the names of the flags of fs set on the command line.
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
+
+// applyFileConfig stores the file's response configs and rules. The default
+// response config is left alone when keepDefault is set, because -response
+// was given on the command line.
+func (a *App) applyFileConfig(c *FileConfig, keepDefault bool) {
+	for key, config := range c.Responses {
+		if key == "default" && keepDefault {
+			continue
+		}
+		a.setResponseConfig(key, config)
+	}
+	for key, rules := range c.Rules {
+		a.replaceRules(key, rules)
+	}
+}
@@ -0,0 +1,206 @@
+package hooklab
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with content and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooklab.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	config, err := loadFileConfig(writeConfig(t, `
+port: 9000
+tls:
+  domains: [hooks.example.com, example.com]
+auth:
+  users: ["vera:secret:viewer"]
+storage:
+  kafka:
+    brokers: [kafka-1:9092, kafka-2:9092]
+    batchTimeout: 250ms
+  mqtt:
+    qos: 0
+limits:
+  captureRate: 2.5
+  allowIPs: [10.0.0.0/8]
+  slowRequest: 200ms
+accessLog:
+  format: json
+  exclude: [/api/stream]
+responses:
+  default:
+    response: {result: accepted}
+    statusCode: 202
+  github:
+    response: {ok: true}
+    delay: 1s
+rules:
+  payments:
+    - name: Large
+      condition: body.amount > 1000
+      response: {review: true}
+      statusCode: 402
+      enabled: true
+forwards:
+  legacy: http://localhost:3000/hooks
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := config.flagValues()
+	want := map[string]string{
+		"port":                "9000",
+		"domain":              "hooks.example.com,example.com",
+		"kafka-brokers":       "kafka-1:9092,kafka-2:9092",
+		"kafka-batch-timeout": "250ms",
+		"mqtt-qos":            "0",
+		"capture-rate":        "2.5",
+		"allow-ips":           "10.0.0.0/8",
+		"slow-request":        "200ms",
+		"access-log":          "json",
+		"access-log-exclude":  "/api/stream",
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("-%s: expected %q, got %q", name, value, values[name])
+		}
+	}
+	if len(values) != len(want) {
+		t.Errorf("expected %d flag values, got %v", len(want), values)
+	}
+
+	if github := config.Responses["github"]; github.StatusCode != http.StatusOK || github.Delay != Duration(time.Second) {
+		t.Errorf("unexpected github response %+v", github)
+	}
+	if legacy := config.Responses["legacy"]; legacy.ForwardTo != "http://localhost:3000/hooks" || legacy.StatusCode != http.StatusOK {
+		t.Errorf("unexpected legacy response %+v", legacy)
+	}
+
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"result": "ok"}, StatusCode: http.StatusOK})
+	app.applyFileConfig(config, false)
+	if got := app.getResponseConfig("default").StatusCode; got != http.StatusAccepted {
+		t.Errorf("expected the file's default response, got status %d", got)
+	}
+	if rules := app.getRules("payments"); len(rules) != 1 || rules[0].ID == "" || rules[0].StatusCode != http.StatusPaymentRequired {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	app = New()
+	app.setResponseConfig("default", ResponseConfig{StatusCode: http.StatusTeapot})
+	app.applyFileConfig(config, true)
+	if got := app.getResponseConfig("default").StatusCode; got != http.StatusTeapot {
+		t.Errorf("expected -response to be kept, got status %d", got)
+	}
+}
+
+func TestFileConfigFlagsOverride(t *testing.T) {
+	fs := flag.NewFlagSet("hooklab", flag.ContinueOnError)
+	port := fs.Int("port", 8080, "")
+	accessLog := fs.String("access-log", AccessLogNone, "")
+	streamBuffer := fs.Int("stream-buffer", defaultStreamBuffer, "")
+	if err := fs.Parse([]string{"-port", "7000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &FileConfig{Port: 9000, AccessLog: AccessLogFileConfig{Format: AccessLogCommon}}
+	if err := config.applyFlags(fs, explicitFlags(fs)); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 7000 || *accessLog != AccessLogCommon || *streamBuffer != defaultStreamBuffer {
+		t.Errorf("unexpected flags: port %d, access log %q, stream buffer %d", *port, *accessLog, *streamBuffer)
+	}
+
+	config = &FileConfig{Limits: LimitsFileConfig{StreamBuffer: 4}, Tracing: TracingFileConfig{OTLPEndpoint: "http://localhost:4318"}}
+	if err := config.applyFlags(fs, nil); err == nil || !strings.Contains(err.Error(), "otlp-endpoint") {
+		t.Errorf("expected a file setting without a flag to be refused, got %v", err)
+	}
+}
+
+func TestLoadFileConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"prot: 8080", "unknown field"},
+		{"responses:\n  default:\n    delay: -1s", "responses.default"},
+		{"forwards:\n  legacy: ftp://example.com", "responses.legacy"},
+		{"rules:\n  payments:\n    - condition: body.amount >", "rules.payments[0]"},
+		{"auth:\n  users: [vera]", "auth.users"},
+		{"verbosity: loud", "verbosity"},
+	}
+	for _, tt := range tests {
+		if _, err := loadFileConfig(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected an error mentioning %q, got %v", tt.content, tt.want, err)
+		}
+	}
+	if _, err := loadFileConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected a missing file to be refused")
+	}
+}
+
+func TestLoadSeedFiles(t *testing.T) {
+	rules, err := loadRulesFile(writeConfig(t, `
+payments:
+  - name: Large
+    condition: body.amount > 1000
+    statusCode: 402
+    enabled: true
+orders: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules["payments"]) != 1 || rules["orders"] == nil {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	responses, err := loadResponsesFile(writeConfig(t, `{"default": {"response": {"result": "seeded"}}, "github": {"response": {"ok": true}, "statusCode": 202}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responses["default"].StatusCode != http.StatusOK || responses["github"].StatusCode != http.StatusAccepted {
+		t.Errorf("unexpected responses %+v", responses)
+	}
+
+	app := New()
+	app.applyFileConfig(&FileConfig{Responses: responses, Rules: rules}, false)
+	if got := app.getResponseConfig("github").StatusCode; got != http.StatusAccepted {
+		t.Errorf("expected the seeded github response, got status %d", got)
+	}
+	if got := app.getRules("payments"); len(got) != 1 || got[0].ID == "" {
+		t.Errorf("expected the seeded payments rules, got %+v", got)
+	}
+
+	loadRules := func(path string) error { _, err := loadRulesFile(path); return err }
+	loadResponses := func(path string) error { _, err := loadResponsesFile(path); return err }
+	tests := []struct {
+		load    func(string) error
+		content string
+		want    string
+	}{
+		{loadRules, "payments:\n  - condition: body.amount >", "rules.payments[0]"},
+		{loadRules, "rules:\n  payments: {}", "cannot unmarshal"},
+		{loadResponses, "github:\n  statusCod: 202", "unknown field"},
+		{loadResponses, "github:\n  delay: -1s", "responses.github"},
+	}
+	for _, tt := range tests {
+		if err := tt.load(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected an error mentioning %q, got %v", tt.content, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package hooklab
+
+// This file contains rule conflict detection: rules whose evaluation order is
+// ambiguous because they share a priority, and rules that can never match because
+// an earlier rule always does.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+)
+
+// RuleWarning describes a conflict between rules of a key.
+type RuleWarning struct {
+	Rules   []string `json:"rules"` // IDs of the rules involved
+	Message string   `json:"message"`
+}
+
+// ruleWarnings returns the conflicts among the rules evaluated for key: rules of the
+// same scope and group that share a priority, and, with the first-match strategy,
+// rules shadowed by an earlier rule that always matches.
+func (a *App) ruleWarnings(key string) []RuleWarning {
+	warnings := []RuleWarning{}
+	if key != globalRuleKey {
+		warnings = append(warnings, priorityWarnings(a.getRules(globalRuleKey))...)
+	}
+	warnings = append(warnings, priorityWarnings(a.getRules(key))...)
+
+	strategy := a.getResponseConfig(key).RuleMatch
+	if strategy == "" || strategy == RuleMatchFirst {
+		warnings = append(warnings, shadowWarnings(a.keyRules(key))...)
+	}
+	return warnings
+}
+
+// priorityWarnings reports enabled rules of the same group that share a priority.
+// Such rules are evaluated in creation order.
+func priorityWarnings(rules []Rule) []RuleWarning {
+	type slot struct {
+		group    string
+		priority int
+	}
+	var slots []slot
+	ids := make(map[slot][]string)
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		s := slot{rule.Group, rule.Priority}
+		if _, ok := ids[s]; !ok {
+			slots = append(slots, s)
+		}
+		ids[s] = append(ids[s], rule.ID)
+	}
+
+	var warnings []RuleWarning
+	for _, s := range slots {
+		if len(ids[s]) < 2 {
+			continue
+		}
+		message := "rules " + strings.Join(ids[s], ", ") + " share priority " + strconv.Itoa(s.priority)
+		if s.group != "" {
+			message += " in group " + strconv.Quote(s.group)
+		}
+		warnings = append(warnings, RuleWarning{Rules: ids[s], Message: message + "; they are evaluated in creation order"})
+	}
+	return warnings
+}
+
+// shadowWarnings reports rules, in evaluation order, that can never produce a
+// response because an earlier enabled rule of the same group always responds.
+func shadowWarnings(rules []Rule) []RuleWarning {
+	var warnings []RuleWarning
+	shadowing := make(map[string]Rule) // group -> first rule that always responds
+	shadowed := make(map[string][]string)
+	var groups []string
+	for _, rule := range rules {
+		if !rule.Enabled || rule.Action == ActionTag {
+			continue
+		}
+		if first, ok := shadowing[rule.Group]; ok {
+			if len(shadowed[first.Group]) == 0 {
+				groups = append(groups, first.Group)
+			}
+			shadowed[first.Group] = append(shadowed[first.Group], rule.ID)
+			continue
+		}
+		if alwaysResponds(rule) {
+			shadowing[rule.Group] = rule
+		}
+	}
+
+	for _, group := range groups {
+		first := shadowing[group]
+		verb := "never match"
+		if len(shadowed[group]) == 1 {
+			verb = "never matches"
+		}
+		warnings = append(warnings, RuleWarning{
+			Rules:   append([]string{first.ID}, shadowed[group]...),
+			Message: fmt.Sprintf("rule %s always matches, so %s %s", first.ID, strings.Join(shadowed[group], ", "), verb),
+		})
+	}
+	return warnings
+}
+
+// alwaysResponds reports whether a rule produces a response for every request:
+// its condition is constant true and nothing else gates it.
+func alwaysResponds(rule Rule) bool {
+	if rule.Then != "" || rule.ActiveFrom != nil || rule.ActiveUntil != nil || rule.Schedule != "" ||
+		rule.ExpiresAt != nil || (rule.Scenario != "" && rule.RequiredState != "") {
+		return false
+	}
+	program, err := expr.Compile(rule.Condition, expr.Env(validationEnv()), expr.AsBool())
+	if err != nil {
+		return false
+	}
+	node, ok := program.Node().(*ast.BoolNode)
+	return ok && node.Value
+}
+
+// rulesConflictsHandler handles GET requests to /api/rules/conflicts?key={key},
+// listing rule conflicts as {"key": ..., "warnings": [...]}.
+func (a *App) rulesConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":      key,
+		"warnings": a.ruleWarnings(key),
+	})
+}
@@ -0,0 +1,114 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRulesHandlerPostAssignsPriority(t *testing.T) {
+	app := New()
+	post := func(body string) Rule {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=payments", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: expected status 201, got %d: %s", body, w.Code, w.Body.String())
+		}
+		var rule Rule
+		if err := json.Unmarshal(w.Body.Bytes(), &rule); err != nil {
+			t.Fatalf("failed to decode rule: %v", err)
+		}
+		return rule
+	}
+
+	if rule := post(`{"condition":"true"}`); rule.Priority != 0 {
+		t.Errorf("expected first rule to get priority 0, got %d", rule.Priority)
+	}
+	if rule := post(`{"condition":"true","priority":7}`); rule.Priority != 7 {
+		t.Errorf("expected explicit priority 7, got %d", rule.Priority)
+	}
+	if rule := post(`{"condition":"true"}`); rule.Priority != 8 {
+		t.Errorf("expected next priority 8, got %d", rule.Priority)
+	}
+	if rule := post(`{"condition":"true","group":"payload"}`); rule.Priority != 0 {
+		t.Errorf("expected first rule of a group to get priority 0, got %d", rule.Priority)
+	}
+	if rule := post(`{"condition":"true","priority":0}`); rule.Priority != 0 {
+		t.Errorf("expected explicit priority 0 to be kept, got %d", rule.Priority)
+	}
+}
+
+func TestRulesConflictsHandler(t *testing.T) {
+	app := New()
+	catchAll := app.addRule("payments", Rule{Condition: "true", StatusCode: 200, Priority: 1, Enabled: true})
+	large := app.addRule("payments", Rule{Condition: "body.amount > 100", StatusCode: 402, Priority: 1, Enabled: true})
+	late := app.addRule("payments", Rule{Condition: "body.amount > 5", StatusCode: 400, Priority: 2, Enabled: true})
+	app.addRule("payments", Rule{Condition: "true", StatusCode: 500, Priority: 2, Enabled: false})
+	app.addRule("payments", Rule{Condition: "true", Action: ActionTag, Tags: []string{"seen"}, Priority: 3, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.rulesConflictsHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/conflicts?key=payments", nil))
+	var got struct {
+		Key      string        `json:"key"`
+		Warnings []RuleWarning `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode conflicts: %v", err)
+	}
+	if got.Key != "payments" || len(got.Warnings) != 2 {
+		t.Fatalf("expected 2 warnings for payments, got %+v", got)
+	}
+	if ids := strings.Join(got.Warnings[0].Rules, ","); ids != catchAll.ID+","+large.ID {
+		t.Errorf("expected priority warning for %s and %s, got %+v", catchAll.ID, large.ID, got.Warnings[0])
+	}
+	if ids := strings.Join(got.Warnings[1].Rules, ","); ids != catchAll.ID+","+large.ID+","+late.ID {
+		t.Errorf("expected %s to shadow %s and %s, got %+v", catchAll.ID, large.ID, late.ID, got.Warnings[1])
+	}
+
+	// Only the first matching rule responds, so other strategies shadow nothing.
+	app.setResponseConfig("payments", ResponseConfig{RuleMatch: RuleMatchMerge})
+	if warnings := app.ruleWarnings("payments"); len(warnings) != 1 {
+		t.Errorf("expected only the priority warning with merge, got %+v", warnings)
+	}
+}
+
+func TestRulesConflictsGlobalRules(t *testing.T) {
+	app := New()
+	global := app.addRule(globalRuleKey, Rule{Condition: "true", StatusCode: 200, Enabled: true})
+	rule := app.addRule("payments", Rule{Condition: "body.amount > 100", StatusCode: 402, Enabled: true})
+	app.addRule("payments", Rule{Condition: "true", Then: "payload", Priority: 1, Enabled: true})
+
+	warnings := app.ruleWarnings("payments")
+	if len(warnings) != 1 || strings.Join(warnings[0].Rules, ",") != global.ID+","+rule.ID+",rule_3" {
+		t.Errorf("expected the global rule to shadow the key's rules, got %+v", warnings)
+	}
+	// Rules of different scopes never share a priority.
+	for _, warning := range warnings {
+		if strings.Contains(warning.Message, "share priority") {
+			t.Errorf("unexpected priority warning %+v", warning)
+		}
+	}
+}
+
+func TestAlwaysResponds(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{Condition: "true"}, true},
+		{Rule{Condition: "false"}, false},
+		{Rule{Condition: "body.amount > 100"}, false},
+		{Rule{Condition: "true", Then: "payload"}, false},
+		{Rule{Condition: "true", Schedule: "* 9-17 * * *"}, false},
+		{Rule{Condition: "true", Scenario: "retry", RequiredState: "failing"}, false},
+		{Rule{Condition: "not valid +"}, false},
+	}
+	for _, tt := range tests {
+		if got := alwaysResponds(tt.rule); got != tt.want {
+			t.Errorf("%+v: expected %v, got %v", tt.rule, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package hooklab
+
+// This file contains demo mode (-demo): a few keys set up like real
+// integrations, with response configs, rules, and sample webhooks from GitHub,
+// Stripe, Shopify, Slack, and Twilio, so a fresh instance has something to
+// show in screenshots, talks, and first-time exploration.
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// demoConfig holds the response configs and rules of the demo keys.
+const demoConfig = `
+responses:
+  github:
+    response: {received: "{{.body.repository.full_name}}"}
+    statusCode: 202
+  stripe:
+    response: {received: true}
+  shopify:
+    response: {status: accepted, order: "{{.body.id}}"}
+    statusCode: 201
+  slack:
+    response: {ok: true}
+  twilio:
+    response: {reply: "Thanks, we got it!"}
+rules:
+  github:
+    - name: Tag pushes to main
+      condition: header("X-GitHub-Event") == "push" && body.ref == "refs/heads/main"
+      action: tag
+      tags: [main]
+      enabled: true
+    - name: Ignore bot pull requests
+      condition: header("X-GitHub-Event") == "pull_request" && body.sender.type == "Bot"
+      response: {ignored: true}
+      statusCode: 200
+      enabled: true
+  stripe:
+    - name: Tag refunds
+      condition: body.type == "charge.refunded"
+      action: tag
+      tags: [refund]
+      enabled: true
+    - name: Decline large payments
+      condition: body.type == "payment_intent.created" && body.data.object.amount > 100000
+      response: {error: {code: card_declined, message: "Your card was declined."}}
+      statusCode: 402
+      enabled: true
+  shopify:
+    - name: Flag high-value orders
+      condition: float(body.total_price) >= 500
+      response: {status: review, order: "{{.body.id}}"}
+      statusCode: 202
+      enabled: true
+`
+
+// demoWebhook is a sample webhook sent to a demo key.
+type demoWebhook struct {
+	key     string
+	headers map[string]string
+	body    string
+}
+
+// demoWebhooks are the sample webhooks, oldest first.
+var demoWebhooks = []demoWebhook{
+	{"github", map[string]string{"X-GitHub-Event": "push", "User-Agent": "GitHub-Hookshot/5a1c2e0"},
+		`{"ref":"refs/heads/main","before":"9c1b7e4","after":"e3f7a21","repository":{"full_name":"acme/storefront"},"pusher":{"name":"maria"},"commits":[{"id":"e3f7a21","message":"Fix checkout rounding"}]}`},
+	{"stripe", map[string]string{"Stripe-Signature": "t=1760000000,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd", "User-Agent": "Stripe/1.0 (+https://stripe.com/docs/webhooks)"},
+		`{"id":"evt_1Q2w3E","type":"payment_intent.succeeded","data":{"object":{"id":"pi_3Q2w3E","amount":4900,"currency":"usd","customer":"cus_R7t8Y9"}}}`},
+	{"shopify", map[string]string{"X-Shopify-Topic": "orders/create", "X-Shopify-Shop-Domain": "acme-store.myshopify.com", "User-Agent": "Shopify-Captain-Hook"},
+		`{"id":5501,"email":"sam@example.com","total_price":"89.00","currency":"USD","line_items":[{"title":"Canvas Tote","quantity":2,"price":"44.50"}]}`},
+	{"slack", map[string]string{"User-Agent": "Slackbot 1.0 (+https://api.slack.com/robots)"},
+		`{"token":"Jhj5dZrVaK7ZwHHjRyZWjbDl","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification"}`},
+	{"github", map[string]string{"X-GitHub-Event": "pull_request", "User-Agent": "GitHub-Hookshot/5a1c2e0"},
+		`{"action":"opened","number":42,"pull_request":{"title":"Add gift cards","head":{"ref":"gift-cards"}},"repository":{"full_name":"acme/storefront"},"sender":{"login":"maria","type":"User"}}`},
+	{"stripe", map[string]string{"Stripe-Signature": "t=1760000060,v1=9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", "User-Agent": "Stripe/1.0 (+https://stripe.com/docs/webhooks)"},
+		`{"id":"evt_4R5t6Y","type":"payment_intent.created","data":{"object":{"id":"pi_3R5t6Y","amount":250000,"currency":"usd","customer":"cus_K2l3M4"}}}`},
+	{"twilio", map[string]string{"Content-Type": "application/x-www-form-urlencoded", "User-Agent": "TwilioProxy/1.1"},
+		`MessageSid=SM5f2c8e&From=%2B15555550123&To=%2B15555550100&Body=Is+my+order+on+its+way%3F`},
+	{"shopify", map[string]string{"X-Shopify-Topic": "orders/create", "X-Shopify-Shop-Domain": "acme-store.myshopify.com", "User-Agent": "Shopify-Captain-Hook"},
+		`{"id":5502,"email":"lee@example.com","total_price":"740.00","currency":"USD","line_items":[{"title":"Standing Desk","quantity":1,"price":"740.00"}]}`},
+	{"github", map[string]string{"X-GitHub-Event": "pull_request", "User-Agent": "GitHub-Hookshot/5a1c2e0"},
+		`{"action":"opened","number":43,"pull_request":{"title":"Bump express from 4.19.2 to 4.21.0","head":{"ref":"dependabot/npm_and_yarn/express-4.21.0"}},"repository":{"full_name":"acme/storefront"},"sender":{"login":"dependabot[bot]","type":"Bot"}}`},
+	{"slack", map[string]string{"User-Agent": "Slackbot 1.0 (+https://api.slack.com/robots)"},
+		`{"type":"event_callback","team_id":"T0001","event":{"type":"app_mention","user":"U2147483697","text":"<@U0LAN0Z89> deploy storefront","channel":"C2147483705"}}`},
+	{"stripe", map[string]string{"Stripe-Signature": "t=1760000120,v1=2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "User-Agent": "Stripe/1.0 (+https://stripe.com/docs/webhooks)"},
+		`{"id":"evt_7U8i9O","type":"charge.refunded","data":{"object":{"id":"ch_3U8i9O","amount":4900,"amount_refunded":4900,"currency":"usd"}}}`},
+	{"github", map[string]string{"X-GitHub-Event": "push", "User-Agent": "GitHub-Hookshot/5a1c2e0"},
+		`{"ref":"refs/heads/gift-cards","before":"0000000","after":"b4d2c19","repository":{"full_name":"acme/storefront"},"pusher":{"name":"maria"},"commits":[{"id":"b4d2c19","message":"Gift card balance endpoint"}]}`},
+}
+
+// demoAddr is the address the demo webhooks appear to come from, from the
+// range reserved for documentation.
+const demoAddr = "198.51.100.24:41234"
+
+// discardResponseWriter is a ResponseWriter that throws the response away.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+// seedDemo stores the demo response configs and rules, then sends the demo
+// webhooks through the webhook handler, so they're stored, tagged, and
+// answered like real ones. It returns the demo keys.
+func (a *App) seedDemo() ([]string, error) {
+	var config FileConfig
+	if err := yaml.UnmarshalStrict([]byte(demoConfig), &config); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	a.applyFileConfig(&config, false)
+
+	for _, webhook := range demoWebhooks {
+		r, err := http.NewRequest(http.MethodPost, "/webhook/"+webhook.key, strings.NewReader(webhook.body))
+		if err != nil {
+			return nil, err
+		}
+		r.RemoteAddr = demoAddr
+		r.Header.Set("Content-Type", "application/json")
+		for name, value := range webhook.headers {
+			r.Header.Set(name, value)
+		}
+		a.webhookHandler(&discardResponseWriter{}, r)
+	}
+	if stats := a.rejectionStats(); stats.Total > 0 {
+		return nil, fmt.Errorf("%d demo webhooks were refused", stats.Total)
+	}
+
+	keys := make([]string, 0, len(config.Responses))
+	for key := range config.Responses {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
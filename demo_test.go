@@ -0,0 +1,48 @@
+package hooklab
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestSeedDemo(t *testing.T) {
+	app := New()
+	keys, err := app.seedDemo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"github", "shopify", "slack", "stripe", "twilio"}) {
+		t.Errorf("unexpected demo keys %v", keys)
+	}
+
+	app.mu.Lock()
+	events := append([]Event(nil), app.store.Events()...)
+	app.mu.Unlock()
+	if len(events) != len(demoWebhooks) {
+		t.Fatalf("expected %d demo events, got %d", len(demoWebhooks), len(events))
+	}
+	tags := map[string]int{}
+	for _, event := range events {
+		for _, tag := range event.Tags {
+			tags[tag]++
+		}
+		if len(event.RuleErrors) > 0 {
+			t.Errorf("event %d: rule errors %+v", event.ID, event.RuleErrors)
+		}
+	}
+	if tags["main"] != 1 || tags["refund"] != 1 {
+		t.Errorf("expected one push to main and one refund tagged, got %v", tags)
+	}
+	statuses := map[int]int{}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	for _, key := range keys {
+		for _, sample := range app.samples[key] {
+			statuses[sample.status]++
+		}
+	}
+	if statuses[http.StatusPaymentRequired] != 1 || statuses[http.StatusAccepted] != 4 {
+		t.Errorf("expected the demo rules to answer some webhooks, got statuses %v", statuses)
+	}
+}
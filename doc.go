@@ -0,0 +1,24 @@
+// Package hooklab is a lightweight, self-hosted webhook testing and API mocking
+// tool.
+//
+// It provides real-time webhook capture, custom response configuration,
+// and a rule engine for conditional responses based on request content.
+//
+// The hooklab command in cmd/hooklab runs it as a server. Go programs can also
+// embed it: New returns an App configured by options such as WithMaxEvents,
+// and Handler serves its webhook endpoints, API, and dashboard, for example
+// under a path of an existing mux:
+//
+//	app := hooklab.New(hooklab.WithBasePath("/hooks"))
+//	app.OnEvent(func(event hooklab.Event) { log.Print(event.Key) })
+//	handler, err := hooklab.Handler(app)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	mux.Handle("/hooks/", handler)
+//
+// The NATS, Kafka, and MQTT sinks WithSink publishes events to, and the Redis
+// bridge WithBridge shares the live stream through, are in natssink,
+// kafkasink, mqttsink, and redisbridge, so only programs using them import
+// their clients.
+package hooklab
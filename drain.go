@@ -0,0 +1,70 @@
+package hooklab
+
+// This file contains the drain phase of shutting down: new webhooks are refused
+// with 503 and a Retry-After, so senders try again once hooklab is back, while
+// forwards, redeliveries, and notifier deliveries already under way finish
+// within -shutdown-timeout.
+
+import (
+	"context"
+	"time"
+)
+
+// Shutdown defaults.
+const (
+	defaultShutdownTimeout = 10 * time.Second
+	defaultDrainRetryAfter = 5 * time.Second
+)
+
+// forwardPollInterval is how often draining checks for forwards in flight.
+const forwardPollInterval = 10 * time.Millisecond
+
+// beginDrain makes webhooks be refused from now on, telling senders to retry
+// after retryAfter.
+func (a *App) beginDrain(retryAfter time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.draining = true
+	a.drainRetry = retryAfter
+}
+
+// drainState reports whether webhooks are being refused, and the Retry-After
+// to give them.
+func (a *App) drainState() (bool, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.draining, a.drainRetry
+}
+
+// startForward counts a forward or delivery as in flight until the returned
+// function is called, so draining waits for it.
+func (a *App) startForward() (done func()) {
+	a.mu.Lock()
+	a.forwards++
+	a.mu.Unlock()
+	return func() {
+		a.mu.Lock()
+		a.forwards--
+		a.mu.Unlock()
+	}
+}
+
+// waitForForwards waits until no forward or delivery is in flight, returning
+// false if ctx is done first.
+func (a *App) waitForForwards(ctx context.Context) bool {
+	ticker := time.NewTicker(forwardPollInterval)
+	defer ticker.Stop()
+	for {
+		a.mu.Lock()
+		inFlight := a.forwards
+		a.mu.Unlock()
+		if inFlight == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
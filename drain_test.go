@@ -0,0 +1,95 @@
+package hooklab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainRefusesWebhooks(t *testing.T) {
+	app := New()
+	app.beginDrain(7 * time.Second)
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "7" {
+		t.Errorf("expected 503 with Retry-After 7, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if _, ok := app.getEvent(1); ok {
+		t.Error("expected a webhook refused while draining not to be stored")
+	}
+	if stats := app.rejectionStats(); stats.Causes[RejectDraining] != 1 || stats.Keys["orders"] != 1 {
+		t.Errorf("expected the refusal to be counted, got %+v", stats)
+	}
+}
+
+func TestDrainWaitsForForwards(t *testing.T) {
+	release := make(chan struct{})
+	var delivered atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		delivered.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer target.Close()
+
+	app := New()
+	app.setResponseConfig("proxy", ResponseConfig{StatusCode: http.StatusOK, ForwardTo: target.URL})
+	app.scheduleRedelivery(context.Background(), Event{ID: 1, Method: http.MethodPost}, RedeliveryConfig{Target: target.URL, Delay: Duration(20 * time.Millisecond)})
+
+	answered := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/proxy", strings.NewReader(`{}`)))
+		answered <- w.Code
+	}()
+	// Drain once the forward is under way too.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		app.mu.Lock()
+		inFlight := app.forwards
+		app.mu.Unlock()
+		if inFlight == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 forwards in flight, got %d", inFlight)
+		}
+	}
+	app.beginDrain(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if app.waitForForwards(ctx) {
+		t.Fatal("expected draining to wait for the blocked forwards")
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !app.waitForForwards(ctx) {
+		t.Fatal("expected the forwards to finish")
+	}
+	if code := <-answered; code != http.StatusAccepted {
+		t.Errorf("expected the in-flight forward to be answered, got %d", code)
+	}
+	if got := delivered.Load(); got != 2 {
+		t.Errorf("expected the forward and the redelivery to arrive, got %d", got)
+	}
+}
+
+func TestDrainSkipsPendingRedeliveries(t *testing.T) {
+	app := New()
+	app.scheduleRedelivery(context.Background(), Event{ID: 1, Method: http.MethodPost}, RedeliveryConfig{Target: "http://127.0.0.1:1", Delay: Duration(time.Hour)})
+	defer app.beginShutdown()
+
+	app.beginDrain(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !app.waitForForwards(ctx) {
+		t.Error("expected draining not to wait for a redelivery still waiting out its delay")
+	}
+}
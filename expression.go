@@ -0,0 +1,407 @@
+package hooklab
+
+// This file contains the compiled expression cache and the helper functions
+// available to rule expressions, including a small JSONPath implementation for
+// reaching into nested payloads and signature helpers for verifying signed webhooks.
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// expressionFuncs returns the helper functions added to every expression environment:
+//   - regexMatch(pattern, s): reports whether s contains a match of the regular expression
+//   - regexFind(pattern, s): returns the first submatch of s (or the whole match when the
+//     pattern has no groups), or "" when nothing matches
+//   - jsonpath(path, value): evaluates a JSONPath such as "$.items[0].id" against value;
+//     string values are parsed as JSON first
+//   - hmacSHA256(secret, data), hmacSHA1(secret, data): hex-encoded HMAC of data
+//   - hmacSHA256Base64(secret, data): base64-encoded HMAC-SHA256 of data
+//   - sha256(data), sha1(data): hex-encoded digest of data
+//   - secureCompare(a, b): constant-time string comparison for signatures
+//
+// expr already provides lower, upper, trim, len, and the infix "matches" operator.
+func expressionFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"regexMatch": regexMatch,
+		"regexFind":  regexFind,
+		"jsonpath":   jsonPath,
+
+		"hmacSHA256": func(secret, data string) string {
+			return hex.EncodeToString(hmacSum(sha256.New, secret, data))
+		},
+		"hmacSHA256Base64": func(secret, data string) string {
+			return base64.StdEncoding.EncodeToString(hmacSum(sha256.New, secret, data))
+		},
+		"hmacSHA1": func(secret, data string) string {
+			return hex.EncodeToString(hmacSum(sha1.New, secret, data))
+		},
+		"sha256": func(data string) string {
+			sum := sha256.Sum256([]byte(data))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha1": func(data string) string {
+			sum := sha1.Sum([]byte(data))
+			return hex.EncodeToString(sum[:])
+		},
+		"secureCompare": func(a, b string) bool {
+			return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+		},
+	}
+}
+
+// hmacSum returns the HMAC of data keyed with secret using the given hash.
+func hmacSum(h func() hash.Hash, secret, data string) []byte {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// regexMatch reports whether s contains a match of pattern.
+func regexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// headerValue returns the first value of the named header, or "" if it is absent.
+// Names match case-insensitively, so lookups don't depend on canonical casing.
+func headerValue(headers map[string][]string, name string) string {
+	if values := headers[http.CanonicalHeaderKey(name)]; len(values) > 0 {
+		return values[0]
+	}
+	for key, values := range headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// regexFind returns the first capture group of the leftmost match of pattern in s,
+// or the whole match when pattern has no groups. It returns "" when nothing matches.
+func regexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	match := re.FindStringSubmatch(s)
+	switch {
+	case match == nil:
+		return "", nil
+	case len(match) > 1:
+		return match[1], nil
+	default:
+		return match[0], nil
+	}
+}
+
+// Expression evaluation limits, so a pathological condition cannot stall webhook handling.
+const (
+	maxExpressionNodes     = 1000    // AST nodes allowed when compiling an expression
+	expressionMemoryBudget = 100_000 // VM memory units (roughly, allocated items) per evaluation
+	maxExpressionSteps     = 100_000 // Predicate calls, such as one per element in all() or filter(), per evaluation
+)
+
+// stepsVar is the environment variable holding an evaluation's step budget.
+// It is added by runExpression, not by the callers building environments.
+const stepsVar = "__steps"
+
+// expressionSteps is the step budget of one evaluation. The memory budget
+// bounds what an expression allocates but not how often its predicates run, so
+// nested loops over a large body would otherwise run unbounded.
+type expressionSteps struct{ left int }
+
+// Step spends one step of the budget, failing the evaluation once it is spent.
+func (s *expressionSteps) Step() (bool, error) {
+	if s.left <= 0 {
+		return false, fmt.Errorf("expression evaluation exceeded %d steps", maxExpressionSteps)
+	}
+	s.left--
+	return true, nil
+}
+
+// stepCounter is an expr patch that spends a step of the budget every time a
+// predicate runs.
+type stepCounter struct{}
+
+// Visit prefixes the body of every predicate with a call to __steps.Step().
+func (stepCounter) Visit(node *ast.Node) {
+	if predicate, ok := (*node).(*ast.PredicateNode); ok {
+		step := &ast.CallNode{Callee: &ast.MemberNode{Node: &ast.IdentifierNode{Value: stepsVar}, Property: &ast.StringNode{Value: "Step"}, Method: true}}
+		predicate.Node = &ast.SequenceNode{Nodes: []ast.Node{step, predicate.Node}}
+	}
+}
+
+// runExpression evaluates a compiled program within the memory and step budgets.
+func runExpression(program *vm.Program, env map[string]interface{}) (interface{}, error) {
+	env = maps.Clone(env)
+	env[stepsVar] = &expressionSteps{left: maxExpressionSteps}
+	machine := vm.VM{MemoryBudget: expressionMemoryBudget}
+	return machine.Run(program, env)
+}
+
+// maxCachedPrograms bounds the compiled program cache; it is cleared when full.
+const maxCachedPrograms = 1024
+
+// programKey identifies a compiled program. Programs are compiled against the
+// types of the environment, so the key includes the types of the values that
+// differ between requests: the body (map, list, string, ...) and the headers.
+type programKey struct {
+	expression  string
+	condition   bool
+	bodyType    reflect.Type
+	headersType reflect.Type
+}
+
+// compiledProgram is a cached compilation result, including compile errors so
+// invalid expressions are not recompiled on every request.
+type compiledProgram struct {
+	program *vm.Program
+	err     error
+}
+
+// programCache holds compiled expressions shared by all keys. Since the key is
+// the expression text itself, updating a rule's condition never reuses a stale program.
+var programCache = struct {
+	sync.Mutex
+	programs map[programKey]compiledProgram
+}{programs: make(map[programKey]compiledProgram)}
+
+// compileExpression returns the compiled program for expression, compiling it on
+// first use. Rule conditions are type-checked against env and must evaluate to a
+// boolean; other expressions, such as status codes, are only checked at run time.
+func compileExpression(expression string, env map[string]interface{}, condition bool) (*vm.Program, error) {
+	key := programKey{
+		expression:  expression,
+		condition:   condition,
+		bodyType:    reflect.TypeOf(env["body"]),
+		headersType: reflect.TypeOf(env["headers"]),
+	}
+
+	programCache.Lock()
+	cached, ok := programCache.programs[key]
+	programCache.Unlock()
+	if ok {
+		return cached.program, cached.err
+	}
+
+	options := []expr.Option{expr.MaxNodes(maxExpressionNodes), expr.Patch(stepCounter{})}
+	if condition {
+		env = maps.Clone(env)
+		env[stepsVar] = (*expressionSteps)(nil)
+		options = append(options, expr.Env(env), expr.AsBool())
+	}
+	program, err := expr.Compile(expression, options...)
+
+	programCache.Lock()
+	if len(programCache.programs) >= maxCachedPrograms {
+		clear(programCache.programs)
+	}
+	programCache.programs[key] = compiledProgram{program: program, err: err}
+	programCache.Unlock()
+	return program, err
+}
+
+// jsonPathStep is one segment of a parsed JSONPath.
+type jsonPathStep struct {
+	name      string // member name; "" for index or wildcard steps
+	index     int    // array index (negative counts from the end) when isIndex is set
+	isIndex   bool
+	wildcard  bool // .* or [*]
+	recursive bool // ..name: match name at any depth
+}
+
+// jsonPath evaluates a JSONPath against a decoded JSON value. Supported syntax:
+// $ (root), .name, ['name'], [n], [-n], .* / [*], and ..name (recursive descent).
+// Paths with a wildcard or recursive descent return a list of all matches; other
+// paths return the single value found, or nil when it does not exist.
+func jsonPath(path string, value interface{}) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := value.(string); ok {
+		var decoded interface{}
+		if json.Unmarshal([]byte(s), &decoded) == nil {
+			value = decoded
+		}
+	}
+
+	multi := false
+	current := []interface{}{value}
+	for _, step := range steps {
+		multi = multi || step.wildcard || step.recursive
+		var next []interface{}
+		for _, v := range current {
+			next = append(next, step.apply(v)...)
+		}
+		current = next
+	}
+
+	if multi {
+		if current == nil {
+			current = []interface{}{}
+		}
+		return current, nil
+	}
+	if len(current) == 0 {
+		return nil, nil
+	}
+	return current[0], nil
+}
+
+// apply returns the values the step selects from v.
+func (s jsonPathStep) apply(v interface{}) []interface{} {
+	if s.recursive {
+		var found []interface{}
+		collectMember(v, s.name, &found)
+		return found
+	}
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			out := make([]interface{}, 0, len(node))
+			for _, name := range sortedKeys(node) {
+				out = append(out, node[name])
+			}
+			return out
+		}
+		if child, ok := node[s.name]; ok && !s.isIndex {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return node
+		}
+		if s.isIndex {
+			i := s.index
+			if i < 0 {
+				i += len(node)
+			}
+			if i >= 0 && i < len(node) {
+				return []interface{}{node[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// collectMember appends every value stored under name at any depth of v.
+func collectMember(v interface{}, name string, found *[]interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(node) {
+			if key == name {
+				*found = append(*found, node[key])
+			}
+			collectMember(node[key], name, found)
+		}
+	case []interface{}:
+		for _, item := range node {
+			collectMember(item, name, found)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order so wildcard results are stable.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseJSONPath splits a JSONPath into steps.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", path)
+	}
+	rest := path[1:]
+	var steps []jsonPathStep
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			name, remaining := readJSONPathName(rest[2:])
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath %q: expected member name after ..", path)
+			}
+			steps = append(steps, jsonPathStep{name: name, recursive: true})
+			rest = remaining
+		case strings.HasPrefix(rest, ".*"):
+			steps = append(steps, jsonPathStep{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			name, remaining := readJSONPathName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath %q: expected member name after .", path)
+			}
+			steps = append(steps, jsonPathStep{name: name})
+			rest = remaining
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: unterminated [", path)
+			}
+			step, err := parseJSONPathBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath %q: %w", path, err)
+			}
+			steps = append(steps, step)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// readJSONPathName reads a dot-notation member name up to the next '.' or '['.
+func readJSONPathName(s string) (name, rest string) {
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+// parseJSONPathBracket parses the contents of a bracket step: *, an index, or a quoted name.
+func parseJSONPathBracket(inner string) (jsonPathStep, error) {
+	inner = strings.TrimSpace(inner)
+	if inner == "*" {
+		return jsonPathStep{wildcard: true}, nil
+	}
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+		return jsonPathStep{name: inner[1 : len(inner)-1]}, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return jsonPathStep{}, errors.New("bracket must hold *, an index, or a quoted name")
+	}
+	return jsonPathStep{index: index, isIndex: true}, nil
+}
@@ -0,0 +1,299 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	body := expressionEnv(parseBody(`{
+		"order": {"id": "ord_1", "items": [{"sku": "a", "qty": 1}, {"sku": "b", "qty": 3}]},
+		"meta": {"weird key": true, "id": "meta_1"}
+	}`), "", nil)["body"]
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$", body},
+		{"$.order.id", "ord_1"},
+		{"$.order.items[1].sku", "b"},
+		{"$.order.items[-1].qty", 3.0},
+		{"$['meta']['weird key']", true},
+		{`$["order"].id`, "ord_1"},
+		{"$.order.items[*].sku", []interface{}{"a", "b"}},
+		{"$..id", []interface{}{"meta_1", "ord_1"}},
+		{"$.order.missing", nil},
+		{"$.order.items[5]", nil},
+		{"$.nothing[*]", []interface{}{}},
+	}
+	for _, tt := range tests {
+		got, err := jsonPath(tt.path, body)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPathParsesStrings(t *testing.T) {
+	got, err := jsonPath("$.inner", `{"inner": 1}`)
+	if err != nil || got != 1.0 {
+		t.Errorf("expected JSON string to be parsed, got %v (%v)", got, err)
+	}
+}
+
+func TestJSONPathInvalid(t *testing.T) {
+	for _, path := range []string{"order.id", "$.", "$..", "$[1", "$[abc]", "$x"} {
+		if _, err := jsonPath(path, nil); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
+func TestRegexHelpers(t *testing.T) {
+	if ok, err := regexMatch(`^ord_\d+$`, "ord_42"); err != nil || !ok {
+		t.Errorf("regexMatch: got %v, %v", ok, err)
+	}
+	if got, _ := regexFind(`ord_(\d+)`, "ref ord_42"); got != "42" {
+		t.Errorf("regexFind with group: got %q", got)
+	}
+	if got, _ := regexFind(`ord_\d+`, "ref ord_42"); got != "ord_42" {
+		t.Errorf("regexFind without group: got %q", got)
+	}
+	if got, _ := regexFind(`x`, "abc"); got != "" {
+		t.Errorf("regexFind without match: got %q", got)
+	}
+	if _, err := regexMatch(`(`, "abc"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestWebhookHandlerExpressionHelpers(t *testing.T) {
+	tests := []struct {
+		condition string
+		match     bool
+	}{
+		{`jsonpath("$.data.object.amount", body) > 100`, true},
+		{`jsonpath("$.data.items[*].sku", body)[1] == "b"`, true},
+		{`regexMatch("^evt_[0-9]+$", body.id)`, true},
+		{`regexFind("evt_([0-9]+)", body.id) == "123"`, true},
+		{`lower(body.type) == "charge.succeeded"`, true},
+		{`regexMatch("(", body.id)`, false},
+	}
+	for _, tt := range tests {
+		app := New()
+		app.addRule("stripe", Rule{Condition: tt.condition, StatusCode: http.StatusTeapot, Enabled: true})
+
+		body := `{"id":"evt_123","type":"Charge.Succeeded","data":{"object":{"amount":500},"items":[{"sku":"a"},{"sku":"b"}]}}`
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/stripe", strings.NewReader(body)))
+
+		if matched := w.Code == http.StatusTeapot; matched != tt.match {
+			t.Errorf("%s: expected match=%v, got status %d", tt.condition, tt.match, w.Code)
+		}
+	}
+}
+
+func TestHeaderHelper(t *testing.T) {
+	app := New()
+	app.addRule("auth", Rule{Condition: `header("authorization") startsWith "Bearer "`, StatusCode: http.StatusAccepted, Enabled: true})
+
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"Bearer token", http.StatusAccepted},
+		{"Basic dXNlcg==", http.StatusOK},
+		{"", http.StatusOK},
+		{"Bearer other", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/auth", strings.NewReader(`{}`))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: expected status %d, got %d", tt.auth, tt.want, w.Code)
+		}
+	}
+
+	// Non-canonical keys, e.g. from evaluateRules callers, are matched too.
+	headers := map[string][]string{"x-signature": {"abc", "def"}}
+	if got := headerValue(headers, "X-Signature"); got != "abc" {
+		t.Errorf("expected abc, got %q", got)
+	}
+	if got := headerValue(headers, "X-Missing"); got != "" {
+		t.Errorf("expected empty value, got %q", got)
+	}
+}
+
+func TestSignatureHelpers(t *testing.T) {
+	funcs := expressionFuncs()
+	// Test vector from RFC 4231, test case 2.
+	hmacSHA256 := funcs["hmacSHA256"].(func(string, string) string)
+	if got := hmacSHA256("Jefe", "what do ya want for nothing?"); got != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("hmacSHA256: got %s", got)
+	}
+	hmacSHA256Base64 := funcs["hmacSHA256Base64"].(func(string, string) string)
+	if got := hmacSHA256Base64("Jefe", "what do ya want for nothing?"); got != "W9zBRr9gdU5qBCQmCJV1x1oAPwidJzmDnexYuWTsOEM=" {
+		t.Errorf("hmacSHA256Base64: got %s", got)
+	}
+	hmacSHA1 := funcs["hmacSHA1"].(func(string, string) string)
+	if got := hmacSHA1("Jefe", "what do ya want for nothing?"); got != "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79" {
+		t.Errorf("hmacSHA1: got %s", got)
+	}
+	sha256 := funcs["sha256"].(func(string) string)
+	if got := sha256("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("sha256: got %s", got)
+	}
+	sha1 := funcs["sha1"].(func(string) string)
+	if got := sha1("abc"); got != "a9993e364706816aba3e25717850c26c9cd0d89d" {
+		t.Errorf("sha1: got %s", got)
+	}
+	secureCompare := funcs["secureCompare"].(func(string, string) bool)
+	if !secureCompare("sig", "sig") || secureCompare("sig", "sig2") {
+		t.Error("secureCompare returned wrong result")
+	}
+}
+
+func TestWebhookHandlerSignatureRule(t *testing.T) {
+	app := New()
+	app.addRule("github", Rule{
+		Condition:  `!("X-Hub-Signature-256" in headers) || !secureCompare(headers["X-Hub-Signature-256"][0], "sha256=" + hmacSHA256("s3cret", rawBody))`,
+		Response:   map[string]string{"error": "invalid signature"},
+		StatusCode: http.StatusUnauthorized,
+		Enabled:    true,
+	})
+
+	body := `{"action":"opened"}`
+	tests := []struct {
+		signature string
+		want      int
+	}{
+		{"sha256=" + expressionFuncs()["hmacSHA256"].(func(string, string) string)("s3cret", body), http.StatusOK},
+		{"sha256=deadbeef", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+		if tt.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+		}
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("signature %q: expected status %d, got %d", tt.signature, tt.want, w.Code)
+		}
+	}
+}
+
+func TestCompileExpressionCache(t *testing.T) {
+	mapEnv := expressionEnv(parseBody(`{"amount": 100}`), "POST", nil)
+	first, err := compileExpression("body.amount > 50", mapEnv, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _ := compileExpression("body.amount > 50", expressionEnv(parseBody(`{"amount": 1}`), "GET", nil), true)
+	if first != second {
+		t.Error("expected the cached program to be reused for the same expression and body type")
+	}
+
+	// A string body has a different type, so the condition is compiled separately.
+	if _, err := compileExpression("body.amount > 50", expressionEnv(parseBody("raw"), "POST", nil), true); err == nil {
+		t.Error("expected compile error for field access on a string body")
+	}
+	if program, _ := compileExpression("body.amount > 50", mapEnv, true); program != first {
+		t.Error("compiling for another body type should not evict the map program")
+	}
+
+	// Compile errors are cached too.
+	_, err1 := compileExpression("invalid !!!", mapEnv, true)
+	_, err2 := compileExpression("invalid !!!", mapEnv, true)
+	if err1 == nil || err1 != err2 {
+		t.Errorf("expected cached compile error, got %v and %v", err1, err2)
+	}
+}
+
+func TestExpressionLimits(t *testing.T) {
+	env := expressionEnv(parseBody(`{}`), "POST", nil)
+
+	// Too many nodes is a compile error.
+	long := "1" + strings.Repeat(" + 1", maxExpressionNodes) + " > 0"
+	if _, err := compileExpression(long, env, true); err == nil {
+		t.Error("expected compile error for an expression over the node limit")
+	}
+
+	// Allocating past the memory budget is a runtime error.
+	program, err := compileExpression("len(map(1..1000000, #)) > 0", env, true)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	if _, err := runExpression(program, env); err == nil {
+		t.Error("expected memory budget error")
+	}
+
+	// Running predicates past the step budget is a runtime error, and each
+	// evaluation gets a budget of its own.
+	items := strings.Repeat("1,", 999) + "1"
+	env = expressionEnv(parseBody(`{"items": [`+items+`]}`), "POST", nil)
+	program, err = compileExpression("all(body.items, {all(body.items, {# > 0})})", env, true)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	if _, err := runExpression(program, env); err == nil || !strings.Contains(err.Error(), "steps") {
+		t.Errorf("expected step budget error, got %v", err)
+	}
+	program, err = compileExpression("all(body.items, {# > 0})", env, true)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	for range 2 {
+		if value, err := runExpression(program, env); err != nil || value != true {
+			t.Errorf("expected a single loop within the budget, got %v, %v", value, err)
+		}
+	}
+}
+
+func TestWebhookHandlerRecordsRuleErrors(t *testing.T) {
+	app := New()
+	failing := app.addRule("limits", Rule{Name: "Greedy", Condition: "len(map(1..1000000, #)) > 0", Priority: 1, Enabled: true})
+	app.addRule("limits", Rule{Name: "Catch-all", Condition: "true", StatusCode: http.StatusAccepted, Priority: 2, Enabled: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/limits", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected the next rule to match with status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	events := app.store.Events()
+	if len(events) != 1 || len(events[0].RuleErrors) != 1 {
+		t.Fatalf("expected one rule error on the stored event, got %+v", events)
+	}
+	if got := events[0].RuleErrors[0]; got.RuleID != failing.ID || got.Rule != "Greedy" || got.Error == "" {
+		t.Errorf("unexpected rule error %+v", got)
+	}
+}
+
+func BenchmarkEvaluateRules(b *testing.B) {
+	app := New()
+	for i := 0; i < 20; i++ {
+		app.addRule("bench", Rule{Condition: `body.type == "never" && body.amount > 100`, Priority: i, Enabled: true})
+	}
+	app.addRule("bench", Rule{Condition: "true", Priority: 100, Enabled: true})
+	body := `{"type":"payment","amount":500}`
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		app.evaluateRules("bench", body, "POST", nil)
+	}
+}
@@ -0,0 +1,86 @@
+package hooklab
+
+// This file contains payload format detection for rule expressions, so rules can
+// route by what a body actually is (isJSON, isXML, isForm) rather than by string
+// checks on rawBody or a Content-Type the sender may have gotten wrong.
+
+import (
+	"encoding/json"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// mediaType returns the media type of a Content-Type value without parameters,
+// lowercased, e.g. "application/json" for "application/json; charset=utf-8".
+// Values that don't parse are returned unchanged.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+// isFormBody reports whether body is URL-encoded form data such as "a=1&b=2":
+// every field has a name and a value separator, and nothing is left unescaped
+// that form encoding would have escaped.
+func isFormBody(body string) bool {
+	body = strings.TrimSpace(body)
+	if body == "" || strings.ContainsAny(body, " \t\r\n\"{}<>") {
+		return false
+	}
+	for _, field := range strings.Split(body, "&") {
+		if name, _, ok := strings.Cut(field, "="); !ok || name == "" {
+			return false
+		}
+	}
+	_, err := url.ParseQuery(body)
+	return err == nil
+}
+
+// requestBody is a webhook body parsed once per request, so rule evaluation,
+// response templates, and the stored event share one parse.
+type requestBody struct {
+	text   string
+	value  interface{}  // The body as rules and templates see it; see parseBody
+	isJSON bool         // Whether the body is a single valid JSON value
+	xml    *xmlDocument // The parsed document, if the body is XML
+}
+
+// parseBody parses body into the value rules and templates see: decoded
+// JSON, an XML document as xmlDocument.value returns it, or otherwise the body
+// itself as a string. An empty body is nil.
+func parseBody(text string) *requestBody {
+	body := &requestBody{text: text}
+	if text == "" {
+		return body
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		body.value, body.isJSON = value, true
+		return body
+	}
+	if doc, err := parseXMLDocument(text); err == nil {
+		body.value, body.xml = doc.value(), doc
+		return body
+	}
+	body.value = text
+	return body
+}
+
+// bodyValue returns body as rules and templates see it; see parseBody.
+func bodyValue(body string) interface{} {
+	return parseBody(body).value
+}
+
+// prettyBody returns the body re-indented for the API and UI if it is XML, or
+// "" otherwise.
+func (b *requestBody) prettyBody() string {
+	if b.xml == nil {
+		return ""
+	}
+	return b.xml.pretty()
+}
@@ -0,0 +1,73 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyFormats(t *testing.T) {
+	tests := []struct {
+		body                string
+		isJSON, isXML, form bool
+	}{
+		{`{"amount":5}`, true, false, false},
+		{` [1, 2] `, true, false, false},
+		{`"text"`, true, false, false},
+		{`{"amount":`, false, false, false},
+		{`<order><id>1</id></order>`, false, true, false},
+		{`<?xml version="1.0"?>` + "\n" + `<order id="1"/>`, false, true, false},
+		{`<order><id>1</order>`, false, false, false},
+		{`<a/><b/>`, false, false, false},
+		{`<a></b>`, false, false, false},
+		{`<a/> trailing`, false, false, false},
+		{`amount=5&currency=EUR`, false, false, true},
+		{`amount=&note=hello+world%21`, false, false, true},
+		{`amount`, false, false, false},
+		{`amount=5&&x=1`, false, false, false},
+		{`amount=5%zz`, false, false, false},
+		{`hello world`, false, false, false},
+		{``, false, false, false},
+	}
+	for _, tt := range tests {
+		body := parseBody(tt.body)
+		if got := body.isJSON; got != tt.isJSON {
+			t.Errorf("isJSON(%q): expected %v, got %v", tt.body, tt.isJSON, got)
+		}
+		if got := body.xml != nil; got != tt.isXML {
+			t.Errorf("isXML(%q): expected %v, got %v", tt.body, tt.isXML, got)
+		}
+		if got := isFormBody(tt.body); got != tt.form {
+			t.Errorf("isForm(%q): expected %v, got %v", tt.body, tt.form, got)
+		}
+	}
+}
+
+func TestWebhookHandlerFormatRouting(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{Condition: `isXML && contentType endsWith "/xml"`, StatusCode: http.StatusAccepted, Priority: 0, Enabled: true})
+	app.addRule("orders", Rule{Condition: `isForm`, StatusCode: http.StatusCreated, Priority: 1, Enabled: true})
+	app.addRule("orders", Rule{Condition: `contentType == "application/json" && !isJSON`, StatusCode: http.StatusBadRequest, Priority: 2, Enabled: true})
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        int
+	}{
+		{"application/xml; charset=utf-8", `<order id="1"/>`, http.StatusAccepted},
+		{"text/plain", `<order id="1"/>`, http.StatusOK},
+		{"application/x-www-form-urlencoded", `id=1&total=5`, http.StatusCreated},
+		{"application/JSON", `{"id":`, http.StatusBadRequest},
+		{"application/json", `{"id":1}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.contentType, tt.body, tt.want, w.Code)
+		}
+	}
+}
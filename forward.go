@@ -0,0 +1,164 @@
+package hooklab
+
+// This file contains delivery of captured webhooks to other endpoints, such as
+// scheduled duplicate deliveries that simulate at-least-once providers.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRedeliveries caps how many duplicates a single webhook can produce.
+const maxRedeliveries = 100
+
+// forwardTimeout bounds each forwarded request.
+const forwardTimeout = 10 * time.Second
+
+// forwardClient sends forwarded webhooks.
+var forwardClient = &http.Client{Timeout: forwardTimeout}
+
+// hopHeaders are connection-specific headers that are not copied to forwarded requests.
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RedeliveryConfig re-delivers every webhook received by a key to Target,
+// Count times, waiting Delay before each delivery.
+type RedeliveryConfig struct {
+	Target string   `json:"target"`          // Absolute http(s) URL receiving the duplicates
+	Delay  Duration `json:"delay,omitempty"` // Wait before each duplicate, e.g. "5s"
+	Count  int      `json:"count,omitempty"` // Number of duplicates (default 1)
+}
+
+// validateTarget checks that target is an absolute http(s) URL.
+func validateTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// validate checks the redelivery target, delay, and count.
+func (c RedeliveryConfig) validate() error {
+	if err := validateTarget(c.Target); err != nil {
+		return errors.New("redeliver.target: " + err.Error())
+	}
+	if c.Delay < 0 {
+		return errors.New("redeliver.delay: must not be negative")
+	}
+	if c.Count < 0 || c.Count > maxRedeliveries {
+		return errors.New("redeliver.count: must be between 0 (default 1) and " + strconv.Itoa(maxRedeliveries))
+	}
+	return nil
+}
+
+// forwardEvent sends a captured webhook to target with its original method,
+// body, and headers, plus any extra headers.
+func forwardEvent(ctx context.Context, target string, event Event, extra http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, event.Method, target, bytes.NewReader([]byte(event.Body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = http.Header(event.Headers).Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+	for name, values := range extra {
+		req.Header[name] = values
+	}
+	req, span := startForwardSpan(req)
+	resp, err := forwardClient.Do(req)
+	if err == nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	}
+	endSpan(span, err)
+	return resp, err
+}
+
+// forwardResponse proxies a webhook request to target and relays the target's
+// status, headers, and body back to the sender.
+func forwardResponse(w http.ResponseWriter, r *http.Request, body, target string) {
+	event := Event{Method: r.Method, Headers: r.Header, Body: body}
+	resp, err := forwardEvent(r.Context(), target, event, nil)
+	if err != nil {
+		setResponseStatus(r.Context(), http.StatusBadGateway)
+		http.Error(w, "Error forwarding request", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	setResponseStatus(r.Context(), resp.StatusCode)
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	for _, name := range hopHeaders {
+		w.Header().Del(name)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// scheduleRedelivery sends the configured duplicates of event in the background.
+// Only a duplicate being sent counts as in flight, so draining doesn't wait out
+// the delay of pending ones, which are abandoned when the server shuts down.
+// Their spans join the trace of parent, the context of the webhook being
+// duplicated.
+func (a *App) scheduleRedelivery(parent context.Context, event Event, config RedeliveryConfig) {
+	count := config.Count
+	if count == 0 {
+		count = 1
+	}
+	shutdown := a.shutdownSignal()
+
+	go func() {
+		ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(parent)))
+		defer cancel()
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for attempt := 1; attempt <= count; attempt++ {
+			if !sleepContext(ctx, time.Duration(config.Delay)) {
+				return
+			}
+			extra := http.Header{}
+			extra.Set("X-Hooklab-Redelivery", strconv.Itoa(attempt))
+			extra.Set("X-Hooklab-Event-Id", strconv.Itoa(event.ID))
+			done := a.startForward()
+			resp, err := forwardEvent(ctx, config.Target, event, extra)
+			if err != nil {
+				log.Printf("Redelivery %d of event %d to %s failed: %v", attempt, event.ID, config.Target, err)
+			} else {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			done()
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+package hooklab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandlerRedelivery(t *testing.T) {
+	type delivery struct {
+		method  string
+		body    string
+		attempt string
+		custom  string
+	}
+	var mu sync.Mutex
+	var received []delivery
+	done := make(chan struct{}, 2)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, delivery{r.Method, string(body), r.Header.Get("X-Hooklab-Redelivery"), r.Header.Get("X-Custom")})
+		mu.Unlock()
+		done <- struct{}{}
+	}))
+	defer target.Close()
+
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{
+		StatusCode: http.StatusOK,
+		Redeliver:  &RedeliveryConfig{Target: target.URL, Delay: Duration(10 * time.Millisecond), Count: 2},
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/webhook/orders", strings.NewReader(`{"id":1}`))
+	req.Header.Set("X-Custom", "kept")
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for redelivery %d", i+1)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, d := range received {
+		if d.method != http.MethodPut || d.body != `{"id":1}` || d.custom != "kept" {
+			t.Errorf("redelivery %d does not match the original request: %+v", i+1, d)
+		}
+		if d.attempt != []string{"1", "2"}[i] {
+			t.Errorf("redelivery %d has attempt header %q", i+1, d.attempt)
+		}
+	}
+}
+
+func TestRedeliveryStopsOnShutdown(t *testing.T) {
+	received := make(chan struct{}, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer target.Close()
+
+	app := New()
+	app.scheduleRedelivery(context.Background(), Event{ID: 1, Method: http.MethodPost}, RedeliveryConfig{Target: target.URL, Delay: Duration(50 * time.Millisecond)})
+	app.beginShutdown()
+
+	select {
+	case <-received:
+		t.Error("redelivery should be abandoned after shutdown")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestResponseHandlerPostInvalidRedelivery(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"redeliver":{"target":"not a url"}}`,
+		`{"redeliver":{"target":"ftp://example.com"}}`,
+		`{"redeliver":{"target":"http://example.com","count":-1}}`,
+		`{"redeliver":{"target":"http://example.com","count":1000}}`,
+		`{"redeliver":{"target":"http://example.com","delay":"-1s"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, res.Code)
+		}
+	}
+}
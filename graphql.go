@@ -0,0 +1,103 @@
+package hooklab
+
+// This file contains GraphQL support: webhook requests carrying a GraphQL
+// operation are answered with the response configured for the operation name,
+// wrapped in a GraphQL result document.
+
+import (
+	"errors"
+	"regexp"
+)
+
+// GraphQLResponse is the mock result for a single GraphQL operation. Data is
+// returned under "data" and Errors under "errors"; plain string errors are
+// expanded to {"message": ...}.
+type GraphQLResponse struct {
+	Data   interface{}   `json:"data,omitempty"`
+	Errors []interface{} `json:"errors,omitempty"`
+}
+
+// operationNamePattern extracts the name of the first named operation in a query,
+// e.g. "OrderPaid" from "mutation OrderPaid($id: ID!) { ... }".
+var operationNamePattern = regexp.MustCompile(`\b(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// graphQLOperationName returns the operation name of a GraphQL request body, as
+// sent by GraphQL clients: {"query": "...", "operationName": "...", "variables": {...}}.
+// The explicit operationName wins; otherwise the name is taken from the query.
+// ok is false when the body is not a GraphQL request.
+func graphQLOperationName(body interface{}) (name string, ok bool) {
+	request, isMap := body.(map[string]interface{})
+	if !isMap {
+		return "", false
+	}
+	query, isString := request["query"].(string)
+	if !isString {
+		return "", false
+	}
+
+	if name, _ := request["operationName"].(string); name != "" {
+		return name, true
+	}
+	if match := operationNamePattern.FindStringSubmatch(query); match != nil {
+		return match[1], true
+	}
+	return "", true
+}
+
+// graphQLResult returns the result document configured for a GraphQL request
+// body, or false when the body is not a GraphQL operation or the operation has
+// no configured response. Unnamed operations use the "*" entry, which also
+// serves as the fallback for names without their own entry.
+func (c ResponseConfig) graphQLResult(body interface{}) (map[string]interface{}, bool) {
+	if len(c.GraphQL) == 0 {
+		return nil, false
+	}
+	name, ok := graphQLOperationName(body)
+	if !ok {
+		return nil, false
+	}
+	response, ok := c.GraphQL[name]
+	if !ok {
+		if response, ok = c.GraphQL["*"]; !ok {
+			return nil, false
+		}
+	}
+	return response.document(), true
+}
+
+// document builds the GraphQL result document. A response without errors
+// always has a "data" member, even if it is null.
+func (g GraphQLResponse) document() map[string]interface{} {
+	document := make(map[string]interface{})
+	if g.Data != nil || len(g.Errors) == 0 {
+		document["data"] = g.Data
+	}
+	if len(g.Errors) > 0 {
+		errs := make([]interface{}, len(g.Errors))
+		for i, e := range g.Errors {
+			if message, ok := e.(string); ok {
+				errs[i] = map[string]interface{}{"message": message}
+			} else {
+				errs[i] = e
+			}
+		}
+		document["errors"] = errs
+	}
+	return document
+}
+
+// validateGraphQL checks the operation names and templates of GraphQL responses.
+func validateGraphQL(responses map[string]GraphQLResponse) error {
+	for name, response := range responses {
+		if name == "" {
+			return errors.New("graphql: operation name must not be empty")
+		}
+		if err := validateTemplates(response.Data); err != nil {
+			return errors.New("graphql." + name + ": invalid data template: " + err.Error())
+		}
+		if err := validateTemplates(response.Errors); err != nil {
+			return errors.New("graphql." + name + ": invalid errors template: " + err.Error())
+		}
+	}
+	return nil
+}
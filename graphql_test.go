@@ -0,0 +1,95 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLOperationName(t *testing.T) {
+	tests := []struct {
+		body   string
+		want   string
+		wantOK bool
+	}{
+		{`{"query":"mutation OrderPaid($id: ID!) { orderPaid(id: $id) { id } }"}`, "OrderPaid", true},
+		{`{"query":"query A { a } query B { b }","operationName":"B"}`, "B", true},
+		{`{"query":"{ viewer { id } }"}`, "", true},
+		{`{"event":"order.paid"}`, "", false},
+		{`"query"`, "", false},
+	}
+	for _, tt := range tests {
+		var body interface{}
+		json.Unmarshal([]byte(tt.body), &body)
+		name, ok := graphQLOperationName(body)
+		if name != tt.want || ok != tt.wantOK {
+			t.Errorf("graphQLOperationName(%s) = %q, %v; want %q, %v", tt.body, name, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestWebhookHandlerGraphQL(t *testing.T) {
+	app := New()
+	app.setResponseConfig("graphql", ResponseConfig{
+		Response:   map[string]interface{}{"plain": true},
+		StatusCode: http.StatusOK,
+		GraphQL: map[string]GraphQLResponse{
+			"OrderPaid": {Data: map[string]interface{}{"orderPaid": map[string]interface{}{"id": "{{.body.variables.id}}"}}},
+			"Refund":    {Errors: []interface{}{"refunds are disabled"}},
+			"*":         {Data: map[string]interface{}{"ok": true}},
+		},
+	})
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"named operation", `{"query":"mutation OrderPaid($id: ID!) { orderPaid(id: $id) { id } }","variables":{"id":"ord_1"}}`, `{"data":{"orderPaid":{"id":"ord_1"}}}`},
+		{"errors", `{"query":"mutation Refund { refund }"}`, `{"errors":[{"message":"refunds are disabled"}]}`},
+		{"fallback", `{"query":"{ viewer { id } }"}`, `{"data":{"ok":true}}`},
+		{"not graphql", `{"event":"order.paid"}`, `{"plain":true}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/graphql", strings.NewReader(tt.body))
+		res := httptest.NewRecorder()
+		app.webhookHandler(res, req)
+		if got := strings.TrimSpace(res.Body.String()); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGraphQLResponseDocument(t *testing.T) {
+	document := GraphQLResponse{
+		Data:   map[string]interface{}{"partial": true},
+		Errors: []interface{}{map[string]interface{}{"message": "boom", "path": []interface{}{"partial"}}},
+	}.document()
+	encoded, _ := json.Marshal(document)
+	want := `{"data":{"partial":true},"errors":[{"message":"boom","path":["partial"]}]}`
+	if string(encoded) != want {
+		t.Errorf("got %s, want %s", encoded, want)
+	}
+
+	encoded, _ = json.Marshal(GraphQLResponse{}.document())
+	if string(encoded) != `{"data":null}` {
+		t.Errorf("empty response should have null data, got %s", encoded)
+	}
+}
+
+func TestResponseHandlerPostInvalidGraphQL(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"graphql":{"":{"data":{}}}}`,
+		`{"graphql":{"Op":{"data":{"id":"{{.body"}}}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, res.Code)
+		}
+	}
+}
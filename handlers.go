@@ -1,14 +1,20 @@
-package main
+package hooklab
 
 // This file contains HTTP handlers for the Hooklab API endpoints.
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/expr-lang/expr"
+	"sigs.k8s.io/yaml"
 )
 
 // maxBodySize limits request body to 1MB to prevent DoS attacks.
@@ -19,50 +25,177 @@ const maxBodySize = 1 << 20 // 1MB
 // the appropriate response.
 func (a *App) webhookHandler(w http.ResponseWriter, r *http.Request) {
 	key := webhookKeyFromPath(r.URL.Path)
+	r, span := startWebhookSpan(r, key)
+	defer span.End()
+	start, received := time.Now(), a.now()
+	r, answered := withResponseStatus(r)
+	r, timing := withWebhookTiming(r)
+	var body []byte
+	defer func() {
+		elapsed := time.Since(start)
+		status := cmp.Or(*answered, http.StatusOK)
+		a.recordSample(key, webhookSample{time: received, status: status, latency: elapsed})
+		a.recordLatency(r, key, timing, elapsed)
+		a.logWebhook(r, key, status, elapsed, timing.eventID, timing.matched, string(body))
+	}()
+	keyConfig := a.getResponseConfig(key)
+
+	if draining, retryAfter := a.drainState(); draining {
+		setRetryAfter(w, retryAfter)
+		a.rejectWebhook(w, r, key, "", rejection{status: http.StatusServiceUnavailable, cause: RejectDraining, reason: "shutting down"})
+		return
+	}
+	// Refuse filtered addresses before reading anything they send.
+	if !a.allowsAddr(keyConfig.IPFilter, clientAddr(r)) {
+		a.rejectWebhook(w, r, key, "", rejection{status: http.StatusForbidden, cause: RejectIP, reason: "address not allowed"})
+		return
+	}
+	if ok, wait := a.takeCaptureToken(clientAddr(r).String(), key, a.now()); !ok {
+		setRetryAfter(w, wait)
+		a.rejectWebhook(w, r, key, "", rejection{status: http.StatusTooManyRequests, cause: RejectThrottled, reason: "too many webhooks"})
+		return
+	}
+
 	// Ensure r.Body is not nil for io.ReadAll
 	if r.Body == nil {
 		r.Body = http.NoBody
 	}
 
 	// Read body with size limit
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	var err error
+	body, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize))
 	if err != nil {
+		setResponseStatus(r.Context(), http.StatusInternalServerError)
 		http.Error(w, "Error reading request body", http.StatusInternalServerError)
 		return
 	}
 	defer r.Body.Close()
 
-	event := a.storeEvent(r, key, string(body))
-	a.broadcastEvent(event)
+	if capture := keyConfig.Capture; capture != nil && !capture.allows(r) {
+		a.rejectWebhook(w, r, key, string(body), rejection{status: http.StatusUnauthorized, cause: RejectToken, reason: "invalid capture token", record: capture.RecordRejected})
+		return
+	}
 
-	// Try to match a rule first
-	ruleConfig, _ := a.evaluateRules(key, string(body), r.Method, r.Header)
-	var config ResponseConfig
-	if ruleConfig != nil {
-		config = *ruleConfig
-	} else {
-		config = a.getResponseConfig(key)
+	var signature *SignatureResult
+	if verify := keyConfig.Verify; verify != nil {
+		signature = verify.verify(r.Header, string(body), a.now())
+		if !signature.Valid && verify.Reject {
+			cause := RejectSignature
+			if signature.Stale {
+				cause = RejectStale
+			}
+			a.rejectWebhook(w, r, key, string(body), rejection{status: http.StatusUnauthorized, cause: cause, reason: "invalid signature: " + signature.Error, record: verify.RecordRejected})
+			return
+		}
 	}
 
-	// Create JSON response
-	w.Header().Set("Content-Type", "application/json")
-	if config.StatusCode != 0 {
-		w.WriteHeader(config.StatusCode)
+	// Avro bodies are stored, validated, and evaluated as the JSON they decode to.
+	text := string(body)
+	decoded, avro := a.decodeAvro(key, keyConfig.Avro, body)
+	if avro != nil && avro.Error == "" {
+		text = decoded
 	}
-	if err := json.NewEncoder(w).Encode(config.Response); err != nil {
-		http.Error(w, "Error creating response", http.StatusInternalServerError)
+	// Plugins see and transform the body as it is stored.
+	text, plugins, refused := a.runPlugins(key, keyConfig.Plugins, r, text)
+	if refused != nil {
+		a.rejectWebhook(w, r, key, text, *refused)
+		return
 	}
+
+	a.recordArrival(key, a.now())
+	parsed := parseBody(text)
+	env := a.webhookEnv(r, key, parsed)
+	env["signature"] = signatureEnv(signature)
+	env["avro"] = avroEnv(avro)
+	token := a.decodeJWT(keyConfig.JWT, r.Header, parsed.value, a.now())
+	env["jwt"] = jwtEnv(token)
+	var openAPI *OpenAPIResult
+	if spec := a.getOpenAPISpec(key); spec != nil {
+		openAPI = spec.validate(r.Method, r.URL.Path, r.URL.Query(), r.Header, text)
+	}
+	env["openapi"] = openAPIEnv(openAPI)
+	env["plugins"] = pluginEnv(plugins)
+	eval := &ruleEvaluation{}
+	_, tagSpan := tracer.Start(r.Context(), "match tag rules")
+	tagStart := time.Now()
+	tags := a.matchTags(key, env, eval)
+	timePhase(r.Context(), PhaseRules, tagStart)
+	tagSpan.SetAttributes(attrTags.StringSlice(tags))
+	tagSpan.End()
+
+	_, storeSpan := tracer.Start(r.Context(), "store event")
+	event := a.storeEvent(r, key, parsed, tags...)
+	if signature != nil || openAPI != nil || avro != nil || token != nil || plugins != nil {
+		event.Signature = signature
+		event.OpenAPI = openAPI
+		event.Avro = avro
+		event.JWT = token
+		event.Plugins = plugins
+		a.saveEvent(event)
+	}
+	storeSpan.SetAttributes(attrEventID.Int(event.ID))
+	storeSpan.End()
+	span.SetAttributes(attrEventID.Int(event.ID))
+	timing.eventID = event.ID
+
+	// Answer Slack's URL verification instead of the key's configured response.
+	if challenge, ok := slackChallenge(text); ok {
+		a.announceEvent(key, event, eval)
+		setResponseStatus(r.Context(), http.StatusOK)
+		writeSlackChallenge(w, challenge)
+		return
+	}
+
+	if keyConfig.Redeliver != nil {
+		a.scheduleRedelivery(r.Context(), event, *keyConfig.Redeliver)
+	}
+
+	// Apply the key's simulated rate limit before any rule is considered
+	if rl := keyConfig.RateLimit; rl != nil {
+		now := a.now()
+		status := a.checkRateLimit(key, *rl, now)
+		setRateLimitHeaders(w, status, now)
+		if !status.allowed {
+			a.announceEvent(key, event, eval)
+			setResponseStatus(r.Context(), http.StatusTooManyRequests)
+			writeRateLimited(w)
+			return
+		}
+	}
+
+	// Try to match a rule first, then fall back to the method override or key
+	// config, whose transport settings apply to a rule's response too.
+	// The rule trace is recorded on the event before it is announced.
+	_, ruleSpan := tracer.Start(r.Context(), "evaluate rules")
+	ruleStart := time.Now()
+	ruleConfig := a.evaluateRulesEnv(key, env, eval)
+	timePhase(r.Context(), PhaseRules, ruleStart)
+	timing.matched = eval.matched
+	ruleSpan.SetAttributes(attrMatched.StringSlice(eval.matched))
+	ruleSpan.End()
+	a.announceEvent(key, event, eval)
+	if keyConfig.RuleHeader {
+		w.Header().Set("X-Hooklab-Rule", cmp.Or(strings.Join(eval.matched, ","), "none"))
+	}
+	config := keyConfig.forMethod(r.Method).pickVariant()
+	if ruleConfig != nil {
+		config = ruleConfig.withKeyTransport(config)
+	}
+
+	a.writeResponse(w, r, key, parsed, env, config)
 }
 
 // eventsHandler handles GET /api/events requests.
-// Returns all stored events, optionally filtered by the "key" query parameter.
+// Returns all stored events, optionally filtered by the "key" query parameter
+// and by a "tag" added by tag rules.
 func (a *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	key := r.URL.Query().Get("key")
-	if key == "" {
-		response := EventsResponse{Events: append([]Event(nil), a.events...)}
+	tag := r.URL.Query().Get("tag")
+	if key == "" && tag == "" {
+		response := EventsResponse{Events: append([]Event(nil), a.store.Events()...)}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			http.Error(w, "Error creating response", http.StatusInternalServerError)
@@ -70,9 +203,10 @@ func (a *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filtered := make([]Event, 0, len(a.events))
-	for _, event := range a.events {
-		if event.Key == key {
+	events := a.store.Events()
+	filtered := make([]Event, 0, len(events))
+	for _, event := range events {
+		if (key == "" || event.Key == key) && (tag == "" || slices.Contains(event.Tags, tag)) {
 			filtered = append(filtered, event)
 		}
 	}
@@ -83,20 +217,54 @@ func (a *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// responseHandler handles GET and POST requests to /api/response.
+// responseHandler handles GET, POST, and DELETE requests to /api/response.
 // GET returns the current response configuration for a key.
-// POST updates the response configuration for a key.
+// POST updates the response configuration for a key. A "location" template
+// sets the Location header, which together with a 3xx status simulates a redirect,
+// and "rateLimit" answers requests over the limit with 429 Too Many Requests.
+// DELETE removes the configuration for a key so it falls back to the default.
+// When a JSON Schema is attached to the key, POSTed responses must satisfy it.
+// "methods" holds per-HTTP-method overrides used when no rule matches, and
+// "variants" holds weighted alternatives picked at random per request.
+// "representations" maps media types to body templates negotiated via Accept.
+// "redeliver" sends duplicates of every received webhook to a target URL.
+// "cookies" lists cookies set on every response via Set-Cookie.
+// "graphql" maps GraphQL operation names to results for GraphQL request bodies.
+// "ruleHeader" reports the IDs of the matched rules in an X-Hooklab-Rule header,
+// and "ruleMatch" chooses whether the first, the last, or all matching rules
+// (merged) produce the response.
+// A "ttl" query parameter (e.g. ttl=10m) makes the update temporary: once it
+// expires, the previous configuration is restored.
 func (a *App) responseHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		key := responseKeyFromRequest(r)
 		config := a.getResponseConfig(key)
+		if !canSeeSecrets(r) {
+			config = config.redacted()
+		}
+		var expiresAt *time.Time
+		if expiry, ok := a.getOverrideExpiry(key); ok {
+			expiresAt = &expiry
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"response":   config.Response,
-			"statusCode": config.StatusCode,
-			"key":        key,
+			"response":        config.Response,
+			"statusCode":      config.StatusCode,
+			"statusCodeExpr":  config.StatusCodeExpr,
+			"location":        config.Location,
+			"rateLimit":       config.RateLimit,
+			"redeliver":       config.Redeliver,
+			"cookies":         config.Cookies,
+			"methods":         config.Methods,
+			"variants":        config.Variants,
+			"representations": config.Representations,
+			"graphql":         config.GraphQL,
+			"ruleHeader":      config.RuleHeader,
+			"ruleMatch":       config.RuleMatch,
+			"expiresAt":       expiresAt,
+			"key":             key,
 		}); err != nil {
 			http.Error(w, "Error creating response", http.StatusInternalServerError)
 		}
@@ -108,37 +276,104 @@ func (a *App) responseHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		defer r.Body.Close()
 
-		var payload map[string]interface{}
-		if err := json.Unmarshal(body, &payload); err != nil {
+		// Fields omitted from the payload keep their zero value, except the
+		// status code which is carried over from the current config.
+		key := responseKeyFromRequest(r)
+		config := ResponseConfig{StatusCode: a.getResponseConfig(key).StatusCode}
+		if err := json.Unmarshal(body, &config); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
+		config.ResponseRaw = string(body)
+		config.Methods = normalizeMethods(config.Methods)
 
-		responseData := payload["response"]
-		statusCodeValue, hasStatus := payload["statusCode"]
-		key := responseKeyFromRequest(r)
-		statusCode := a.getResponseConfig(key).StatusCode
-		if hasStatus {
-			if floatVal, ok := statusCodeValue.(float64); ok {
-				statusCode = int(floatVal)
+		if err := validateResponseConfig(config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, candidate := range config.candidates() {
+			if err := a.validateResponseBody(key, candidate.Response); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
 			}
 		}
 
-		a.setResponseConfig(key, ResponseConfig{
-			Response:    responseData,
-			ResponseRaw: string(body),
-			StatusCode:  statusCode,
-		})
+		ttl, err := parseTTL(r.URL.Query().Get("ttl"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ttl > 0 {
+			a.setTemporaryResponseConfig(key, config, ttl)
+		} else {
+			a.setResponseConfig(key, config)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
 			http.Error(w, "Error creating response", http.StatusInternalServerError)
 		}
+	case http.MethodDelete:
+		if !a.deleteResponseConfig(responseKeyFromRequest(r)) {
+			http.Error(w, "Response config not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// responsesHandler handles GET /api/responses requests.
+// Returns every stored response configuration keyed by webhook key.
+func (a *App) responsesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	configs := a.getResponseConfigs()
+	if !canSeeSecrets(r) {
+		for key, config := range configs {
+			configs[key] = config.redacted()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"responses": configs,
+	}); err != nil {
+		http.Error(w, "Error creating response", http.StatusInternalServerError)
+	}
+}
+
+// parseTTL parses the optional "ttl" query parameter of a response update.
+// An empty value means the update is permanent.
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, errors.New("ttl must be a positive duration such as 10m")
+	}
+	return ttl, nil
+}
+
+// normalizeMethods upper-cases the HTTP method names of per-method overrides.
+func normalizeMethods(methods map[string]ResponseConfig) map[string]ResponseConfig {
+	if len(methods) == 0 {
+		return nil
+	}
+	normalized := make(map[string]ResponseConfig, len(methods))
+	for method, config := range methods {
+		normalized[strings.ToUpper(method)] = config
+	}
+	return normalized
+}
+
 // webhookKeyFromPath extracts the webhook key from a URL path.
 // Returns "default" if no key is specified.
 func webhookKeyFromPath(path string) string {
@@ -176,8 +411,42 @@ func (a *App) keysHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// keyCopyHandler handles POST /api/keys/{src}/copy?to={dst} requests.
+// It duplicates the response configuration and rules of src into dst.
+func (a *App) keyCopyHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	src, ok := strings.CutSuffix(path, "/copy")
+	if !ok || src == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dst := r.URL.Query().Get("to")
+	if dst == "" {
+		http.Error(w, "Destination key required", http.StatusBadRequest)
+		return
+	}
+	if dst == src {
+		http.Error(w, "Destination key must differ from source", http.StatusBadRequest)
+		return
+	}
+
+	if !a.copyKey(src, dst) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "from": src, "to": dst})
+}
+
 // rulesHandler handles CRUD operations for conditional response rules at /api/rules.
-// Supports GET (list), POST (create), PUT (update), and DELETE operations.
+// Supports GET (list), POST (create), PUT (update one rule, or replace the whole
+// set when no ID is given), PATCH (partial update), and DELETE operations.
 // The "key" query parameter specifies which webhook key's rules to manage.
 func (a *App) rulesHandler(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("key")
@@ -192,6 +461,8 @@ func (a *App) rulesHandler(w http.ResponseWriter, r *http.Request) {
 		a.handleCreateRule(w, r, key)
 	case http.MethodPut:
 		a.handleUpdateRule(w, r, key)
+	case http.MethodPatch:
+		a.handlePatchRule(w, r, key)
 	case http.MethodDelete:
 		a.handleDeleteRule(w, r, key)
 	default:
@@ -199,6 +470,196 @@ func (a *App) rulesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rulesReorderHandler handles POST /api/rules/reorder?key={key} requests.
+// The body is {"ids": [...]}, every rule ID of the key in the desired evaluation
+// order; priorities are rewritten to match in a single step.
+func (a *App) rulesReorderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var order struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(body, &order); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.reorderRules(key, order.IDs); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	a.handleGetRules(w, key)
+}
+
+// ruleValidateRequest is the body of a POST /api/rules/validate request: a condition
+// and the request to try it on, either a sample or a captured event.
+type ruleValidateRequest struct {
+	Condition string              `json:"condition"`
+	Sample    json.RawMessage     `json:"sample,omitempty"`  // Sample body; a JSON string is used as the raw body
+	Method    string              `json:"method,omitempty"`  // Method of the sample (default POST)
+	Headers   map[string][]string `json:"headers,omitempty"` // Headers of the sample
+	EventID   int                 `json:"eventId,omitempty"` // Captured event to use instead of a sample
+}
+
+// rulesValidateHandler handles POST /api/rules/validate?key={key} requests.
+// Saving a rule only checks its condition against an empty request, so a condition
+// such as body.amount > 100 can still fail on real payloads. This endpoint compiles
+// and runs the condition against a sample payload or a captured event, reporting
+// {"valid": true, "result": ...} or {"valid": false, "error": ...}.
+func (a *App) rulesValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var req ruleValidateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Condition == "" {
+		http.Error(w, "Condition required", http.StatusBadRequest)
+		return
+	}
+
+	var env map[string]interface{}
+	if req.EventID != 0 {
+		event, ok := a.getEvent(req.EventID)
+		if !ok {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+		env = eventEnv(event)
+		a.addTrafficHelpers(env, event.Key, event.ID-1, event.Timestamp)
+	} else {
+		sample := string(req.Sample)
+		var raw string
+		if json.Unmarshal(req.Sample, &raw) == nil {
+			sample = raw
+		}
+		// Canonicalize header names as they are for real requests.
+		headers := make(http.Header, len(req.Headers))
+		for name, values := range req.Headers {
+			headers[http.CanonicalHeaderKey(name)] = values
+		}
+		env = expressionEnv(parseBody(sample), cmp.Or(req.Method, http.MethodPost), headers)
+		a.mu.Lock()
+		lastID := a.lastID
+		a.mu.Unlock()
+		a.addTrafficHelpers(env, key, lastID, a.now())
+	}
+
+	result := map[string]interface{}{"valid": true}
+	matched, err := conditionMatches(req.Condition, env)
+	if err != nil {
+		result = map[string]interface{}{"valid": false, "error": err.Error()}
+	} else {
+		result["result"] = matched
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// rulesExportHandler handles GET and PUT requests to /api/rules/export?key={key}&format={format}.
+// GET returns the key's rules as a {"rules": [...]} document; PUT replaces them with
+// the rules of such a document, assigning new IDs. The format is "json" (default)
+// or "yaml", so rule sets can be kept in version control and applied in CI.
+func (a *App) rulesExportHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "yaml" {
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		document := rulesDocument{Rules: a.getRules(key)}
+		if format == "yaml" {
+			out, err := yaml.Marshal(document)
+			if err != nil {
+				http.Error(w, "Error creating response", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(out)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(document)
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		var document rulesDocument
+		if format == "yaml" {
+			err = yaml.Unmarshal(body, &document)
+		} else {
+			err = json.Unmarshal(body, &document)
+		}
+		if err != nil {
+			http.Error(w, "Invalid "+strings.ToUpper(cmp.Or(format, "json")), http.StatusBadRequest)
+			return
+		}
+		for i := range document.Rules {
+			if err := validateRule(&document.Rules[i]); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "rules[" + strconv.Itoa(i) + "]: " + err.Error(),
+				})
+				return
+			}
+		}
+
+		a.replaceRules(key, document.Rules)
+		a.handleGetRules(w, key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rulesDocument is the import/export format of a key's rule set.
+type rulesDocument struct {
+	Rules []Rule `json:"rules"`
+}
+
 // handleGetRules returns all rules for the given webhook key.
 func (a *App) handleGetRules(w http.ResponseWriter, key string) {
 	rules := a.getRules(key)
@@ -213,10 +674,13 @@ func (a *App) handleGetRules(w http.ResponseWriter, key string) {
 
 // handleCreateRule creates a new rule for the given webhook key.
 func (a *App) handleCreateRule(w http.ResponseWriter, r *http.Request, key string) {
-	rule, ok := a.parseAndValidateRule(w, r)
+	rule, fields, ok := a.parseAndValidateRule(w, r)
 	if !ok {
 		return
 	}
+	if _, ok := fields["priority"]; !ok {
+		rule.Priority = a.nextPriority(key, rule.Group)
+	}
 
 	created := a.addRule(key, rule)
 	w.Header().Set("Content-Type", "application/json")
@@ -225,15 +689,101 @@ func (a *App) handleCreateRule(w http.ResponseWriter, r *http.Request, key strin
 }
 
 // handleUpdateRule updates an existing rule identified by the "id" query parameter.
+// Without an ID, the key's whole rule set is replaced (see handleReplaceRules).
 func (a *App) handleUpdateRule(w http.ResponseWriter, r *http.Request, key string) {
+	ruleID := r.URL.Query().Get("id")
+	if ruleID == "" {
+		a.handleReplaceRules(w, r, key)
+		return
+	}
+
+	rule, _, ok := a.parseAndValidateRule(w, r)
+	if !ok {
+		return
+	}
+
+	if a.updateRule(key, ruleID, rule) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	} else {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+	}
+}
+
+// handleReplaceRules handles PUT /api/rules?key={key} requests without a rule ID.
+// The body is the key's complete rule set as a JSON array, which atomically replaces
+// the current rules so declarative tooling can sync them in one call. Rules keep the
+// IDs they are sent with (see setRules). Nothing is replaced if any rule is invalid.
+func (a *App) handleReplaceRules(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var rules []Rule
+	if err := json.Unmarshal(body, &rules); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	for i := range rules {
+		if err := validateRule(&rules[i]); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "rules[" + strconv.Itoa(i) + "]: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if _, err := a.setRules(key, rules); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	a.handleGetRules(w, key)
+}
+
+// handlePatchRule handles PATCH /api/rules?key={key}&id={id} requests.
+// The body holds only the fields to change, e.g. {"enabled": false}; every other
+// field keeps its current value. The patched rule is validated like a full update.
+func (a *App) handlePatchRule(w http.ResponseWriter, r *http.Request, key string) {
 	ruleID := r.URL.Query().Get("id")
 	if ruleID == "" {
 		http.Error(w, "Rule ID required", http.StatusBadRequest)
 		return
 	}
 
-	rule, ok := a.parseAndValidateRule(w, r)
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	current, ok := a.getRule(key, ruleID)
 	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	rule, err := patchRule(current, patch)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateRule(&rule); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
@@ -245,6 +795,34 @@ func (a *App) handleUpdateRule(w http.ResponseWriter, r *http.Request, key strin
 	}
 }
 
+// patchRule returns rule with the top-level JSON fields in patch replaced.
+// Fields not in patch, and the rule ID, are left unchanged.
+func patchRule(rule Rule, patch map[string]json.RawMessage) (Rule, error) {
+	encoded, err := json.Marshal(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return Rule{}, err
+	}
+	for name, value := range patch {
+		if name != "id" {
+			fields[name] = value
+		}
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return Rule{}, err
+	}
+	var patched Rule
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		return Rule{}, err
+	}
+	return patched, nil
+}
+
 // handleDeleteRule removes a rule identified by the "id" query parameter.
 func (a *App) handleDeleteRule(w http.ResponseWriter, r *http.Request, key string) {
 	ruleID := r.URL.Query().Get("id")
@@ -261,38 +839,110 @@ func (a *App) handleDeleteRule(w http.ResponseWriter, r *http.Request, key strin
 	}
 }
 
+// validateRuleAction checks a rule's action and the parameters it requires.
+func validateRuleAction(rule Rule) error {
+	switch rule.Action {
+	case "", ActionRespond:
+	case ActionDelay:
+		if rule.Delay <= 0 {
+			return errors.New("delay must be positive")
+		}
+	case ActionDrop:
+	case ActionForward:
+		if rule.ForwardTo == "" {
+			return errors.New("forwardTo is required")
+		}
+	case ActionTag:
+		if len(rule.Tags) == 0 {
+			return errors.New("tags must not be empty")
+		}
+	default:
+		return errors.New("action must be one of: respond, delay, drop, forward, tag")
+	}
+	if rule.Action == ActionTag && rule.hasElse() {
+		return errors.New("an else response cannot be combined with the tag action")
+	}
+	if rule.Then != "" {
+		if rule.Action != "" && rule.Action != ActionRespond {
+			return errors.New("then cannot be combined with the " + rule.Action + " action")
+		}
+		if rule.Then == rule.Group {
+			return errors.New("then must name a different group")
+		}
+	}
+	return validateResponseConfig(rule.responseConfig())
+}
+
+// validateRule checks a rule's expressions, templates, action, and time window,
+// keeping the parsed schedule on the rule.
+func validateRule(rule *Rule) error {
+	if rule.Condition != "" {
+		if _, err := expr.Compile(rule.Condition, expr.Env(validationEnv()), expr.AsBool(), expr.MaxNodes(maxExpressionNodes)); err != nil {
+			return errors.New("Invalid expression: " + err.Error())
+		}
+	}
+	if rule.StatusCodeExpr != "" {
+		if err := validateStatusCodeExpr(rule.StatusCodeExpr); err != nil {
+			return errors.New("Invalid status code expression: " + err.Error())
+		}
+	}
+	if rule.Location != "" {
+		if _, err := parseTemplate(rule.Location); err != nil {
+			return errors.New("Invalid location template: " + err.Error())
+		}
+	}
+	if err := validateTemplates(rule.Response); err != nil {
+		return errors.New("Invalid response template: " + err.Error())
+	}
+	if err := validateTemplates(rule.ElseResponse); err != nil {
+		return errors.New("Invalid else response template: " + err.Error())
+	}
+	for name, capture := range rule.Captures {
+		if name == "" {
+			return errors.New("Invalid capture: name must not be empty")
+		}
+		if _, err := expr.Compile(capture, expr.Env(validationEnv()), expr.MaxNodes(maxExpressionNodes)); err != nil {
+			return errors.New("Invalid capture " + strconv.Quote(name) + ": " + err.Error())
+		}
+	}
+	if rule.NotifyURL != "" {
+		if err := validateTarget(rule.NotifyURL); err != nil {
+			return errors.New("Invalid notifyUrl: " + err.Error())
+		}
+	}
+	if err := validateRuleAction(*rule); err != nil {
+		return errors.New("Invalid action: " + err.Error())
+	}
+	if err := validateRuleWindow(rule); err != nil {
+		return errors.New("Invalid time window: " + err.Error())
+	}
+	return nil
+}
+
 // parseAndValidateRule reads and validates a rule from the request body.
 // It validates the expression syntax using the expr library.
 // Returns the parsed rule and true on success, or writes an error response and returns false.
-func (a *App) parseAndValidateRule(w http.ResponseWriter, r *http.Request) (Rule, bool) {
+func (a *App) parseAndValidateRule(w http.ResponseWriter, r *http.Request) (Rule, map[string]json.RawMessage, bool) {
 	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
 	if err != nil {
 		http.Error(w, "Error reading request body", http.StatusInternalServerError)
-		return Rule{}, false
+		return Rule{}, nil, false
 	}
 	defer r.Body.Close()
 
 	var rule Rule
-	if err := json.Unmarshal(body, &rule); err != nil {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &rule); err != nil || json.Unmarshal(body, &fields) != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return Rule{}, false
+		return Rule{}, nil, false
 	}
 
-	if rule.Condition != "" {
-		env := map[string]interface{}{
-			"body":    map[string]interface{}{},
-			"method":  "",
-			"headers": map[string][]string{},
-		}
-		if _, err := expr.Compile(rule.Condition, expr.Env(env), expr.AsBool()); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Invalid expression: " + err.Error(),
-			})
-			return Rule{}, false
-		}
+	if err := validateRule(&rule); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return Rule{}, nil, false
 	}
 
-	return rule, true
+	return rule, fields, true
 }
@@ -1,12 +1,15 @@
-package main
+package hooklab
 
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -14,7 +17,7 @@ import (
 
 func TestHandler(t *testing.T) {
 	defaultResponse := map[string]string{"result": "ok"}
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: defaultResponse, StatusCode: http.StatusOK})
 
 	req, err := http.NewRequest("GET", "/", nil)
@@ -52,7 +55,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	customResponse := map[string]string{"status": "pending"}
-	appWithCustomResponse := &App{}
+	appWithCustomResponse := New()
 	appWithCustomResponse.setResponseConfig("alpha", ResponseConfig{Response: customResponse, StatusCode: http.StatusOK})
 	req, err = http.NewRequest("POST", "/webhook/alpha", bytes.NewBuffer(jsonStr))
 	if err != nil {
@@ -103,7 +106,7 @@ func TestHandler(t *testing.T) {
 }
 
 func TestWebhookHandlerStatusCode(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"ok": "true"}, StatusCode: http.StatusAccepted})
 	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"ok":true}`))
 	res := httptest.NewRecorder()
@@ -116,7 +119,7 @@ func TestWebhookHandlerStatusCode(t *testing.T) {
 }
 
 func TestResponseHandler(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("alpha", ResponseConfig{Response: map[string]string{"hello": "world"}, StatusCode: http.StatusCreated})
 
 	getReq := httptest.NewRequest(http.MethodGet, "/api/response?key=alpha", nil)
@@ -151,10 +154,10 @@ func TestResponseHandler(t *testing.T) {
 }
 
 func TestEventsHandler(t *testing.T) {
-	app := &App{events: []Event{
+	app := New(WithStore(&memoryStore{events: []Event{
 		{ID: 1, Method: http.MethodPost, Path: "/webhook/alpha", Key: "alpha"},
 		{ID: 2, Method: http.MethodPost, Path: "/webhook/beta", Key: "beta"},
-	}}
+	}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
 	res := httptest.NewRecorder()
 	app.eventsHandler(res, req)
@@ -185,7 +188,7 @@ func TestEventsHandler(t *testing.T) {
 }
 
 func TestResponseHandlerErrors(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"ok": "true"}, StatusCode: http.StatusOK})
 
 	badBody := httptest.NewRequest(http.MethodPost, "/api/response", bytes.NewBufferString("{"))
@@ -204,7 +207,7 @@ func TestResponseHandlerErrors(t *testing.T) {
 }
 
 func TestEventsStreamHandlerUnsupported(t *testing.T) {
-	app := &App{}
+	app := New()
 	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
 	res := &noFlushWriter{}
 	app.eventsStreamHandler(res, req)
@@ -214,14 +217,14 @@ func TestEventsStreamHandlerUnsupported(t *testing.T) {
 }
 
 func TestCloseSubscribers(t *testing.T) {
-	app := &App{subscribers: make(map[chan Event]struct{})}
+	app := New()
 	ch := app.addSubscriber()
 	app.closeSubscribers()
 	app.removeSubscriber(ch)
 }
 
 func TestEventsStreamLoop(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil).WithContext(ctx)
@@ -267,7 +270,7 @@ func TestEventsStreamLoop(t *testing.T) {
 }
 
 func TestNewServer(t *testing.T) {
-	app := &App{}
+	app := New()
 	server, err := newServer(app, 9090)
 	if err != nil {
 		t.Fatalf("newServer returned error: %v", err)
@@ -280,14 +283,196 @@ func TestNewServer(t *testing.T) {
 	}
 }
 
+func TestNewSplitServers(t *testing.T) {
+	app := New()
+	app.setCredentials(credentials{"ada": {password: "a", role: RoleAdmin}})
+	capture, admin, err := newSplitServers(app, 8080, "127.0.0.1:9090")
+	if err != nil {
+		t.Fatalf("newSplitServers returned error: %v", err)
+	}
+	if capture.Addr != ":8080" || admin.Addr != "127.0.0.1:9090" {
+		t.Errorf("unexpected addresses %q and %q", capture.Addr, admin.Addr)
+	}
+
+	tests := []struct {
+		server *http.Server
+		method string
+		target string
+		want   int
+	}{
+		{capture, http.MethodPost, "/webhook/orders", http.StatusOK},
+		{capture, http.MethodPost, "/webhook", http.StatusOK},
+		{capture, http.MethodGet, "/api/events", http.StatusNotFound},
+		{capture, http.MethodGet, "/", http.StatusNotFound},
+		{admin, http.MethodGet, "/api/events", http.StatusUnauthorized},
+		{admin, http.MethodPost, "/webhook/orders", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.server.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{}`)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s on %s: expected status %d, got %d", tt.method, tt.target, tt.server.Addr, tt.want, w.Code)
+		}
+	}
+
+	for _, addr := range []string{"9090", "localhost:8080", ":8080"} {
+		if _, _, err := newSplitServers(app, 8080, addr); err == nil {
+			t.Errorf("%q: expected an error", addr)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	app := New(WithBasePath("/hooklab"))
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	request := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(`{}`)))
+		return w
+	}
+
+	if w := request(http.MethodPost, "/hooklab/webhook/orders"); w.Code != http.StatusOK {
+		t.Errorf("expected a prefixed webhook to be captured, got %d", w.Code)
+	}
+	if event, ok := app.getEvent(1); !ok || event.Key != "orders" {
+		t.Errorf("expected an event of key orders, got %+v", event)
+	}
+	if w := request(http.MethodGet, "/hooklab/api/events"); w.Code != http.StatusOK {
+		t.Errorf("expected the prefixed API, got %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/api/events"); w.Code != http.StatusOK {
+		t.Errorf("expected the API without the prefix a proxy stripped, got %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/hooklab?key=orders"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/hooklab/?key=orders" {
+		t.Errorf("expected a redirect to the prefix with a slash, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	for _, target := range []string{"/hooklab/", "/hooklab/rules.html"} {
+		if !embeddedUI {
+			break
+		}
+		if w := request(http.MethodGet, target); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<head>
+    <base href="/hooklab/" />`) {
+			t.Errorf("%s: expected a <base> element, got %d", target, w.Code)
+		}
+	}
+
+	app.setCredentials(credentials{"ada": {password: "a", role: RoleAdmin}})
+	if w := request(http.MethodGet, "/hooklab/api/events"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the prefixed API to require a login, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/hooklab/webhook"); w.Code != http.StatusOK {
+		t.Errorf("expected prefixed webhooks to stay open, got %d", w.Code)
+	}
+
+	server, _ = newServer(New(), 8080)
+	if w := request(http.MethodGet, "/"); strings.Contains(w.Body.String(), "<base href") {
+		t.Error("expected no <base> element without a base path")
+	}
+
+	for path, want := range map[string]string{"": "", "/": "", "/hooklab/": "/hooklab", "/tools/hooks": "/tools/hooks"} {
+		if got, err := parseBasePath(path); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", path, want, got, err)
+		}
+	}
+	for _, path := range []string{"hooklab", "/a//b", "/a/../b", "/hook lab", `/"><script>`} {
+		if _, err := parseBasePath(path); err == nil {
+			t.Errorf("%q: expected an error", path)
+		}
+	}
+}
+
+func TestMountHandler(t *testing.T) {
+	app := New(WithBasePath("/debug/hooks"))
+	handler, err := Handler(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mounted := range []http.Handler{handler, http.StripPrefix("/debug/hooks", handler)} {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/hooks/", mounted)
+		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+		request := func(method, target string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(`{}`)))
+			return w
+		}
+
+		if w := request(http.MethodPost, "/debug/hooks/webhook/orders"); w.Code != http.StatusOK {
+			t.Errorf("expected a webhook under the mount path to be captured, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/debug/hooks/api/events?key=orders"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"key":"orders"`) {
+			t.Errorf("expected the API under the mount path, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/debug/hooks/"); embeddedUI && !strings.Contains(w.Body.String(), `<base href="/debug/hooks/" />`) {
+			t.Errorf("expected the dashboard to point at the mount path, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/health"); w.Code != http.StatusNoContent {
+			t.Errorf("expected the host's own routes to be kept, got %d", w.Code)
+		}
+	}
+}
+
+func TestListenURL(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	plain, secure := &http.Server{}, &http.Server{TLSConfig: &tls.Config{}}
+	if got := listenURL(plain, ln, "", ""); got != "http://127.0.0.1:"+port+"/" {
+		t.Errorf("unexpected URL %q", got)
+	}
+	if got := listenURL(secure, ln, "hooks.example.com", "/hooklab"); got != "https://hooks.example.com:"+port+"/hooklab/" {
+		t.Errorf("unexpected URL %q", got)
+	}
+	for addr, want := range map[string]string{"[::]:8080": "http://localhost:8080/", "0.0.0.0:80": "http://localhost/", "[::1]:80": "http://[::1]/"} {
+		tcp, _ := net.ResolveTCPAddr("tcp", addr)
+		if got := listenURL(plain, fakeListener{tcp}, "", ""); got != want {
+			t.Errorf("%s: expected %q, got %q", addr, want, got)
+		}
+	}
+}
+
+// fakeListener is a listener that only has an address.
+type fakeListener struct{ addr net.Addr }
+
+func (l fakeListener) Accept() (net.Conn, error) { return nil, net.ErrClosed }
+func (l fakeListener) Close() error              { return nil }
+func (l fakeListener) Addr() net.Addr            { return l.addr }
+
+func TestNoUI(t *testing.T) {
+	app := New(WithoutUI())
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatalf("newServer returned error: %v", err)
+	}
+	for target, want := range map[string]int{"/": http.StatusNotFound, "/rules.html": http.StatusNotFound, "/api/keys": http.StatusOK} {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected %d without the dashboard, got %d", target, want, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected webhooks to be captured without the dashboard, got %d", w.Code)
+	}
+}
+
 func TestStoreEventMaxLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 	for i := 0; i < 60; i++ {
 		req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
-		app.storeEvent(req, "default", "body")
+		app.storeEvent(req, "default", parseBody("body"))
 	}
 	app.mu.Lock()
-	count := len(app.events)
+	count := len(app.store.Events())
 	app.mu.Unlock()
 	if count != 50 {
 		t.Errorf("storeEvent did not limit events: got %v want 50", count)
@@ -295,7 +480,7 @@ func TestStoreEventMaxLimit(t *testing.T) {
 }
 
 func TestGetResponseConfigFallbacks(t *testing.T) {
-	app := &App{}
+	app := New()
 	config := app.getResponseConfig("nonexistent")
 	if config.StatusCode != 200 {
 		t.Errorf("getResponseConfig fallback wrong status: got %v want 200", config.StatusCode)
@@ -315,7 +500,7 @@ func TestGetResponseConfigFallbacks(t *testing.T) {
 }
 
 func TestSetResponseConfigEmptyKey(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("", ResponseConfig{Response: "empty", StatusCode: 200})
 	config := app.getResponseConfig("default")
 	if config.Response != "empty" {
@@ -324,17 +509,17 @@ func TestSetResponseConfigEmptyKey(t *testing.T) {
 }
 
 func TestResponseHandlerMethodNotAllowed(t *testing.T) {
-	app := &App{}
-	req := httptest.NewRequest(http.MethodDelete, "/api/response", nil)
+	app := New()
+	req := httptest.NewRequest(http.MethodPut, "/api/response", nil)
 	res := httptest.NewRecorder()
 	app.responseHandler(res, req)
 	if status := res.Code; status != http.StatusMethodNotAllowed {
-		t.Errorf("response handler wrong status for DELETE: got %v want %v", status, http.StatusMethodNotAllowed)
+		t.Errorf("response handler wrong status for PUT: got %v want %v", status, http.StatusMethodNotAllowed)
 	}
 }
 
 func TestResponseHandlerPathKey(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("pathkey", ResponseConfig{Response: "pathkey", StatusCode: 203})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/response/pathkey", nil)
@@ -387,7 +572,7 @@ func TestResponseKeyFromRequest(t *testing.T) {
 }
 
 func TestWebhookHandlerNilBody(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: 200})
 	req := httptest.NewRequest(http.MethodGet, "/webhook", nil)
 	req.Body = nil
@@ -399,18 +584,18 @@ func TestWebhookHandlerNilBody(t *testing.T) {
 }
 
 func TestRemoveSubscriberNotExists(t *testing.T) {
-	app := &App{subscribers: make(map[chan Event]struct{})}
+	app := New()
 	ch := make(chan Event)
 	app.removeSubscriber(ch)
 }
 
 func TestBroadcastEventNoSubscribers(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.broadcastEvent(Event{ID: 1})
 }
 
 func TestResponseHandlerPostWithoutStatusCode(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "old", StatusCode: 201})
 
 	postBody := `{"response":"new"}`
@@ -428,7 +613,7 @@ func TestResponseHandlerPostWithoutStatusCode(t *testing.T) {
 }
 
 func TestRemoveSubscriberExists(t *testing.T) {
-	app := &App{subscribers: make(map[chan Event]struct{})}
+	app := New()
 	ch := app.addSubscriber()
 	app.removeSubscriber(ch)
 	app.mu.Lock()
@@ -440,7 +625,7 @@ func TestRemoveSubscriberExists(t *testing.T) {
 }
 
 func TestEventsStreamHandlerWithFlusher(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: 200})
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -469,7 +654,7 @@ func TestEventsStreamHandlerWithFlusher(t *testing.T) {
 }
 
 func TestEventsStreamLoopMarshalError(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil).WithContext(ctx)
@@ -527,21 +712,21 @@ func (ew *errorEventsWriter) Write(p []byte) (int, error) {
 func (ew *errorEventsWriter) WriteHeader(statusCode int) {}
 
 func TestEventsHandlerEncodeError(t *testing.T) {
-	app := &App{events: []Event{{ID: 1}}}
+	app := New(WithStore(&memoryStore{events: []Event{{ID: 1}}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
 	res := &errorEventsWriter{}
 	app.eventsHandler(res, req)
 }
 
 func TestEventsHandlerFilteredEncodeError(t *testing.T) {
-	app := &App{events: []Event{{ID: 1, Key: "alpha"}}}
+	app := New(WithStore(&memoryStore{events: []Event{{ID: 1, Key: "alpha"}}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events?key=alpha", nil)
 	res := &errorEventsWriter{}
 	app.eventsHandler(res, req)
 }
 
 func TestResponseHandlerGetEncodeError(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: 200})
 	req := httptest.NewRequest(http.MethodGet, "/api/response", nil)
 	res := &errorResponseWriter{}
@@ -549,7 +734,7 @@ func TestResponseHandlerGetEncodeError(t *testing.T) {
 }
 
 func TestResponseHandlerPostEncodeError(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: 200})
 	req := httptest.NewRequest(http.MethodPost, "/api/response", bytes.NewBufferString(`{"response":"new"}`))
 	res := &errorResponseWriter{}
@@ -557,7 +742,7 @@ func TestResponseHandlerPostEncodeError(t *testing.T) {
 }
 
 func TestWebhookHandlerZeroStatusCode(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: 0})
 	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{}`))
 	res := httptest.NewRecorder()
@@ -568,7 +753,7 @@ func TestWebhookHandlerZeroStatusCode(t *testing.T) {
 }
 
 func TestEventsHandlerNoEvents(t *testing.T) {
-	app := &App{events: []Event{}}
+	app := New(WithStore(&memoryStore{events: []Event{}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
 	res := httptest.NewRecorder()
 	app.eventsHandler(res, req)
@@ -581,7 +766,7 @@ func TestEventsHandlerNoEvents(t *testing.T) {
 }
 
 func TestEventsHandlerFilteredNoMatch(t *testing.T) {
-	app := &App{events: []Event{{ID: 1, Key: "alpha"}}}
+	app := New(WithStore(&memoryStore{events: []Event{{ID: 1, Key: "alpha"}}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events?key=beta", nil)
 	res := httptest.NewRecorder()
 	app.eventsHandler(res, req)
@@ -594,11 +779,11 @@ func TestEventsHandlerFilteredNoMatch(t *testing.T) {
 }
 
 func TestEventsHandlerMultipleFilteredEvents(t *testing.T) {
-	app := &App{events: []Event{
+	app := New(WithStore(&memoryStore{events: []Event{
 		{ID: 1, Key: "alpha"},
 		{ID: 2, Key: "beta"},
 		{ID: 3, Key: "alpha"},
-	}}
+	}}))
 	req := httptest.NewRequest(http.MethodGet, "/api/events?key=alpha", nil)
 	res := httptest.NewRecorder()
 	app.eventsHandler(res, req)
@@ -610,9 +795,41 @@ func TestEventsHandlerMultipleFilteredEvents(t *testing.T) {
 	}
 }
 
+func TestEventsHandlerTagFilter(t *testing.T) {
+	app := New(WithStore(&memoryStore{events: []Event{
+		{ID: 1, Key: "alpha", Tags: []string{"suspicious"}},
+		{ID: 2, Key: "beta", Tags: []string{"large", "suspicious"}},
+		{ID: 3, Key: "alpha"},
+		{ID: 4, Key: "alpha", Tags: []string{"large"}},
+	}}))
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"tag=suspicious", []int{1, 2}},
+		{"tag=suspicious&key=alpha", []int{1}},
+		{"tag=large&key=alpha", []int{4}},
+		{"tag=missing", []int{}},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		app.eventsHandler(res, httptest.NewRequest(http.MethodGet, "/api/events?"+tt.query, nil))
+
+		var payload EventsResponse
+		json.Unmarshal(res.Body.Bytes(), &payload)
+		ids := []int{}
+		for _, event := range payload.Events {
+			ids = append(ids, event.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: expected events %v, got %v", tt.query, tt.want, ids)
+		}
+	}
+}
+
 func TestEventsHandlerWriteError(t *testing.T) {
-	app := &App{}
-	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook", nil), "default", "test")
+	app := New()
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook", nil), "default", parseBody("test"))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
 	w := &errorResponseWriter{}
@@ -625,8 +842,8 @@ func TestEventsHandlerWriteError(t *testing.T) {
 }
 
 func TestEventsHandlerWithKeyWriteError(t *testing.T) {
-	app := &App{}
-	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/mykey", nil), "mykey", "test")
+	app := New()
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/mykey", nil), "mykey", parseBody("test"))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/events?key=mykey", nil)
 	w := &errorResponseWriter{}
@@ -639,7 +856,7 @@ func TestEventsHandlerWithKeyWriteError(t *testing.T) {
 }
 
 func TestKeysHandler(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
 	res := httptest.NewRecorder()
@@ -661,11 +878,11 @@ func TestKeysHandler(t *testing.T) {
 }
 
 func TestKeysHandlerWithMultipleKeys(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	app.setResponseConfig("key1", ResponseConfig{Response: map[string]string{"test": "1"}, StatusCode: 200})
 	app.setResponseConfig("key2", ResponseConfig{Response: map[string]string{"test": "2"}, StatusCode: 200})
-	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/key3", nil), "key3", "test")
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/key3", nil), "key3", parseBody("test"))
 	app.addRule("key4", Rule{Name: "test", Condition: "true", Enabled: true})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
@@ -702,7 +919,7 @@ func TestKeysHandlerWithMultipleKeys(t *testing.T) {
 }
 
 func TestKeysHandlerWriteError(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
 	w := &errorResponseWriter{}
@@ -717,7 +934,7 @@ func TestKeysHandlerWriteError(t *testing.T) {
 // ==================== Body Size Limit Tests ====================
 
 func TestWebhookHandlerBodySizeLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"result": "ok"}, StatusCode: 200})
 
 	// Create a body larger than maxBodySize (1MB)
@@ -734,16 +951,16 @@ func TestWebhookHandlerBodySizeLimit(t *testing.T) {
 	}
 
 	// Verify the stored event has truncated body
-	if len(app.events) != 1 {
-		t.Fatalf("expected 1 event, got %d", len(app.events))
+	if len(app.store.Events()) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(app.store.Events()))
 	}
-	if len(app.events[0].Body) != maxBodySize {
-		t.Errorf("expected body length %d, got %d", maxBodySize, len(app.events[0].Body))
+	if len(app.store.Events()[0].Body) != maxBodySize {
+		t.Errorf("expected body length %d, got %d", maxBodySize, len(app.store.Events()[0].Body))
 	}
 }
 
 func TestResponseHandlerBodySizeLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	// Create a body larger than maxBodySize (1MB)
 	largeBody := strings.Repeat("x", maxBodySize+1)
@@ -760,7 +977,7 @@ func TestResponseHandlerBodySizeLimit(t *testing.T) {
 }
 
 func TestRulesHandlerPostBodySizeLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	// Create a body larger than maxBodySize (1MB)
 	largeBody := strings.Repeat("x", maxBodySize+1)
@@ -777,7 +994,7 @@ func TestRulesHandlerPostBodySizeLimit(t *testing.T) {
 }
 
 func TestRulesHandlerPutBodySizeLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{Name: "Test", Condition: "true", Enabled: true})
 	rules := app.getRules("test")
 	ruleID := rules[0].ID
@@ -797,7 +1014,7 @@ func TestRulesHandlerPutBodySizeLimit(t *testing.T) {
 }
 
 func TestWebhookHandlerWithinBodySizeLimit(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"result": "ok"}, StatusCode: 200})
 
 	// Create a body exactly at maxBodySize
@@ -813,10 +1030,235 @@ func TestWebhookHandlerWithinBodySizeLimit(t *testing.T) {
 	}
 
 	// Verify the stored event has full body
-	if len(app.events) != 1 {
-		t.Fatalf("expected 1 event, got %d", len(app.events))
+	if len(app.store.Events()) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(app.store.Events()))
+	}
+	if len(app.store.Events()[0].Body) != maxBodySize {
+		t.Errorf("expected body length %d, got %d", maxBodySize, len(app.store.Events()[0].Body))
+	}
+}
+
+func TestWebhookHandlerRedirect(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{
+		StatusCode: http.StatusTemporaryRedirect,
+		Location:   "https://example.com/orders/{{.body.id}}",
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"id":"ord_1"}`))
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, req)
+
+	if res.Code != http.StatusTemporaryRedirect {
+		t.Errorf("webhook handler redirect wrong status: got %v want %v", res.Code, http.StatusTemporaryRedirect)
 	}
-	if len(app.events[0].Body) != maxBodySize {
-		t.Errorf("expected body length %d, got %d", maxBodySize, len(app.events[0].Body))
+	if got := res.Header().Get("Location"); got != "https://example.com/orders/ord_1" {
+		t.Errorf("webhook handler redirect wrong location: got %q", got)
+	}
+}
+
+func TestResponseHandlerPostLocation(t *testing.T) {
+	app := New()
+
+	postBody := `{"response":null,"statusCode":302,"location":"/next/{{.key}}"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/response?key=alpha", bytes.NewBufferString(postBody))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("response handler post wrong status: got %v want 200", res.Code)
+	}
+	if config := app.getResponseConfig("alpha"); config.Location != "/next/{{.key}}" || config.StatusCode != http.StatusFound {
+		t.Errorf("response handler did not store redirect: got %+v", config)
+	}
+
+	badBody := `{"statusCode":302,"location":"/next/{{.key"}`
+	req = httptest.NewRequest(http.MethodPost, "/api/response?key=alpha", bytes.NewBufferString(badBody))
+	res = httptest.NewRecorder()
+	app.responseHandler(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("response handler wrong status for invalid location: got %v want 400", res.Code)
+	}
+}
+
+func TestResponseHandlerDelete(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: "default", StatusCode: http.StatusOK})
+	app.setResponseConfig("alpha", ResponseConfig{Response: "alpha", StatusCode: http.StatusCreated})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/response/alpha", nil)
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Errorf("response handler delete wrong status: got %v want 200", res.Code)
+	}
+	if config := app.getResponseConfig("alpha"); config.Response != "default" {
+		t.Errorf("deleted key should fall back to default: got %v", config.Response)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/response?key=alpha", nil)
+	res = httptest.NewRecorder()
+	app.responseHandler(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Errorf("response handler delete missing key wrong status: got %v want 404", res.Code)
+	}
+}
+
+func TestResponsesHandler(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: map[string]string{"result": "ok"}, StatusCode: http.StatusOK})
+	app.setResponseConfig("slow", ResponseConfig{Response: "slow", StatusCode: http.StatusAccepted, BytesPerSecond: 10})
+
+	res := httptest.NewRecorder()
+	app.responsesHandler(res, httptest.NewRequest(http.MethodGet, "/api/responses", nil))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("responses handler wrong status: got %v want 200", res.Code)
+	}
+
+	var payload struct {
+		Responses map[string]ResponseConfig `json:"responses"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to parse responses payload: %v", err)
+	}
+	if len(payload.Responses) != 2 {
+		t.Errorf("responses handler returned %d configs, want 2", len(payload.Responses))
+	}
+	if slow := payload.Responses["slow"]; slow.StatusCode != http.StatusAccepted || slow.BytesPerSecond != 10 {
+		t.Errorf("responses handler returned wrong config for slow: %+v", slow)
+	}
+}
+
+func TestResponsesHandlerMethodNotAllowed(t *testing.T) {
+	app := New()
+	res := httptest.NewRecorder()
+	app.responsesHandler(res, httptest.NewRequest(http.MethodPost, "/api/responses", nil))
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("responses handler wrong status for POST: got %v want 405", res.Code)
+	}
+}
+
+func TestWebhookHandlerMethodOverride(t *testing.T) {
+	app := New()
+	postBody := `{
+		"response": {"received": true},
+		"statusCode": 200,
+		"methods": {"get": {"response": {"challenge": "verify"}, "statusCode": 202}}
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/api/response?key=hub", bytes.NewBufferString(postBody))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("response handler post wrong status: got %v want 200", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	app.webhookHandler(res, httptest.NewRequest(http.MethodGet, "/webhook/hub", nil))
+	if res.Code != http.StatusAccepted || strings.TrimSpace(res.Body.String()) != `{"challenge":"verify"}` {
+		t.Errorf("GET should use method override: got %v %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook/hub", nil))
+	if res.Code != http.StatusOK || strings.TrimSpace(res.Body.String()) != `{"received":true}` {
+		t.Errorf("POST should use key config: got %v %s", res.Code, res.Body.String())
+	}
+
+	app.addRule("hub", Rule{Condition: `method == "GET"`, Response: "rule", StatusCode: http.StatusTeapot, Enabled: true})
+	res = httptest.NewRecorder()
+	app.webhookHandler(res, httptest.NewRequest(http.MethodGet, "/webhook/hub", nil))
+	if res.Code != http.StatusTeapot {
+		t.Errorf("matching rule should take precedence over method override: got %v", res.Code)
+	}
+}
+
+func TestResponseHandlerPostInvalidMethodOverride(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"methods":{"GET":{"drop":"sometimes"}}}`,
+		`{"methods":{"GET":{"methods":{"GET":{}}}}}`,
+		`{"methods":{"GET":{"rateLimit":{"limit":1,"window":"1m"}}}}`,
+	} {
+		res := httptest.NewRecorder()
+		app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response", bytes.NewBufferString(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("response handler wrong status for %s: got %v want 400", body, res.Code)
+		}
+	}
+}
+
+func TestResponseHandlerPostTTLRestoresPrevious(t *testing.T) {
+	app := New()
+	app.setResponseConfig("flaky", ResponseConfig{Response: "stable", StatusCode: http.StatusOK})
+
+	postBody := `{"response":"failing","statusCode":500}`
+	req := httptest.NewRequest(http.MethodPost, "/api/response?key=flaky&ttl=50ms", bytes.NewBufferString(postBody))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("response handler post wrong status: got %v want 200", res.Code)
+	}
+
+	if config := app.getResponseConfig("flaky"); config.StatusCode != http.StatusInternalServerError {
+		t.Errorf("temporary config should be active: got %v", config.StatusCode)
+	}
+
+	getRes := httptest.NewRecorder()
+	app.responseHandler(getRes, httptest.NewRequest(http.MethodGet, "/api/response?key=flaky", nil))
+	var payload map[string]interface{}
+	json.Unmarshal(getRes.Body.Bytes(), &payload)
+	if payload["expiresAt"] == nil {
+		t.Error("response handler get should report when the override expires")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if config := app.getResponseConfig("flaky"); config.Response != "stable" {
+		t.Errorf("previous config should be restored after ttl: got %v", config.Response)
+	}
+}
+
+func TestTemporaryResponseConfigWithoutPrevious(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: "default", StatusCode: http.StatusOK})
+
+	app.setTemporaryResponseConfig("fresh", ResponseConfig{Response: "first", StatusCode: http.StatusOK}, 50*time.Millisecond)
+	app.setTemporaryResponseConfig("fresh", ResponseConfig{Response: "second", StatusCode: http.StatusOK}, 50*time.Millisecond)
+	if config := app.getResponseConfig("fresh"); config.Response != "second" {
+		t.Errorf("latest override should be active: got %v", config.Response)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if config := app.getResponseConfig("fresh"); config.Response != "default" {
+		t.Errorf("key without config should fall back to default after ttl: got %v", config.Response)
+	}
+}
+
+func TestSetResponseConfigCancelsOverride(t *testing.T) {
+	app := New()
+	app.setTemporaryResponseConfig("alpha", ResponseConfig{Response: "temporary"}, 50*time.Millisecond)
+	app.setResponseConfig("alpha", ResponseConfig{Response: "permanent"})
+
+	time.Sleep(100 * time.Millisecond)
+	if config := app.getResponseConfig("alpha"); config.Response != "permanent" {
+		t.Errorf("permanent update should cancel the pending restore: got %v", config.Response)
+	}
+	if _, ok := app.getOverrideExpiry("alpha"); ok {
+		t.Error("override should be cleared")
+	}
+}
+
+func TestResponseHandlerPostInvalidTTL(t *testing.T) {
+	app := New()
+	for _, ttl := range []string{"soon", "-5m", "0s"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response?ttl="+ttl, bytes.NewBufferString(`{"response":"x"}`))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("response handler wrong status for ttl %q: got %v want 400", ttl, res.Code)
+		}
 	}
 }
@@ -0,0 +1,230 @@
+package hooklab
+
+// This file contains rule change history: every version a rule is saved with is
+// kept so rule edits made while debugging can be compared and reverted.
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxRuleVersions bounds the history kept per rule; older versions are dropped.
+const maxRuleVersions = 20
+
+// RuleVersion is a saved version of a rule.
+type RuleVersion struct {
+	Version   int       `json:"version"`   // Increments with every save, starting at 1
+	Timestamp time.Time `json:"timestamp"` // When the version was saved
+	Rule      Rule      `json:"rule"`
+}
+
+// RuleChange is a field that differs between two versions of a rule.
+type RuleChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// recordRuleVersionLocked saves rule as its newest version.
+// The caller must hold a.mu.
+func (a *App) recordRuleVersionLocked(rule Rule, now time.Time) {
+	versions := a.ruleHistory[rule.ID]
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+	if len(versions) >= maxRuleVersions {
+		versions = versions[len(versions)-maxRuleVersions+1:]
+	}
+	a.ruleHistory[rule.ID] = append(versions, RuleVersion{Version: next, Timestamp: now, Rule: rule})
+}
+
+// ruleExistsLocked reports whether key has a rule with the given ID.
+// The caller must hold a.mu.
+func (a *App) ruleExistsLocked(key, ruleID string) bool {
+	for _, rule := range a.rules[key] {
+		if rule.ID == ruleID {
+			return true
+		}
+	}
+	return false
+}
+
+// getRuleHistory returns the saved versions of a rule of key, oldest first.
+// Returns false if key has no such rule.
+func (a *App) getRuleHistory(key, ruleID string) ([]RuleVersion, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.ruleExistsLocked(key, ruleID) {
+		return nil, false
+	}
+	return append([]RuleVersion(nil), a.ruleHistory[ruleID]...), true
+}
+
+// findRuleVersion returns the given version of a rule from its history.
+func findRuleVersion(versions []RuleVersion, version int) (RuleVersion, bool) {
+	for _, v := range versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return RuleVersion{}, false
+}
+
+// diffRules lists the fields that differ between two rules, by JSON field name.
+func diffRules(from, to Rule) []RuleChange {
+	fromFields, toFields := ruleFields(from), ruleFields(to)
+	names := make(map[string]struct{})
+	for name := range fromFields {
+		names[name] = struct{}{}
+	}
+	for name := range toFields {
+		names[name] = struct{}{}
+	}
+
+	changes := []RuleChange{}
+	for name := range names {
+		if !reflect.DeepEqual(fromFields[name], toFields[name]) {
+			changes = append(changes, RuleChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// ruleFields returns a rule's fields as they appear in JSON.
+func ruleFields(rule Rule) map[string]interface{} {
+	encoded, _ := json.Marshal(rule)
+	var fields map[string]interface{}
+	json.Unmarshal(encoded, &fields)
+	return fields
+}
+
+// ruleHistoryHandler handles GET requests to /api/rules/history?key={key}&id={id},
+// listing the saved versions of a rule, oldest first.
+func (a *App) ruleHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ruleID, ok := ruleFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	versions, ok := a.getRuleHistory(key, ruleID)
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"versions": versions})
+}
+
+// ruleDiffHandler handles GET requests to /api/rules/diff?key={key}&id={id}&from={n}[&to={m}],
+// listing the fields that changed between two versions of a rule. "to" defaults
+// to the current version.
+func (a *App) ruleDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ruleID, ok := ruleFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	versions, ok := a.getRuleHistory(key, ruleID)
+	if !ok || len(versions) == 0 {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	from, ok := versionFromQuery(w, r, "from", versions, 0)
+	if !ok {
+		return
+	}
+	to, ok := versionFromQuery(w, r, "to", versions, versions[len(versions)-1].Version)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from.Version,
+		"to":      to.Version,
+		"changes": diffRules(from.Rule, to.Rule),
+	})
+}
+
+// ruleRestoreHandler handles POST requests to /api/rules/restore?key={key}&id={id}&version={n},
+// saving the given version of a rule as its newest version.
+func (a *App) ruleRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ruleID, ok := ruleFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	versions, ok := a.getRuleHistory(key, ruleID)
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	version, ok := versionFromQuery(w, r, "version", versions, 0)
+	if !ok {
+		return
+	}
+	if !a.updateRule(key, ruleID, version.Rule) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	a.handleGetRules(w, key)
+}
+
+// ruleFromQuery reads the "key" (default "default") and required "id" query
+// parameters. It writes an error response and returns false if the ID is missing.
+func ruleFromQuery(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+	ruleID := r.URL.Query().Get("id")
+	if ruleID == "" {
+		http.Error(w, "Rule ID required", http.StatusBadRequest)
+		return "", "", false
+	}
+	return key, ruleID, true
+}
+
+// versionFromQuery looks up the version named by a query parameter. An absent
+// parameter selects fallback, where 0 means the parameter is required. It writes
+// an error response and returns false if the version is invalid or unknown.
+func versionFromQuery(w http.ResponseWriter, r *http.Request, param string, versions []RuleVersion, fallback int) (RuleVersion, bool) {
+	number := fallback
+	if value := r.URL.Query().Get(param); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return RuleVersion{}, false
+		}
+		number = n
+	} else if fallback == 0 {
+		http.Error(w, "Version required", http.StatusBadRequest)
+		return RuleVersion{}, false
+	}
+
+	version, ok := findRuleVersion(versions, number)
+	if !ok {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return RuleVersion{}, false
+	}
+	return version, true
+}
@@ -0,0 +1,110 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleHistory(t *testing.T) {
+	app := New()
+	rule := app.addRule("payments", Rule{Name: "Large", Condition: "body.amount > 100", StatusCode: 200, Enabled: true})
+	app.updateRule("payments", rule.ID, Rule{Name: "Large", Condition: "body.amount > 500", StatusCode: 402, Enabled: true})
+	app.updateRule("payments", rule.ID, Rule{Name: "Large", Condition: "body.amount > 500", StatusCode: 402, Enabled: false})
+
+	w := httptest.NewRecorder()
+	app.ruleHistoryHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/history?key=payments&id="+rule.ID, nil))
+	var history struct {
+		Versions []RuleVersion `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	if len(history.Versions) != 3 || history.Versions[0].Version != 1 || history.Versions[2].Version != 3 {
+		t.Fatalf("expected versions 1 to 3, got %+v", history.Versions)
+	}
+	if history.Versions[0].Rule.Condition != "body.amount > 100" || history.Versions[0].Timestamp.IsZero() {
+		t.Errorf("unexpected first version %+v", history.Versions[0])
+	}
+
+	// Diff against the current version by default.
+	w = httptest.NewRecorder()
+	app.ruleDiffHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/diff?key=payments&id="+rule.ID+"&from=1", nil))
+	var diff struct {
+		From    int          `json:"from"`
+		To      int          `json:"to"`
+		Changes []RuleChange `json:"changes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("failed to decode diff: %v", err)
+	}
+	fields := make([]string, len(diff.Changes))
+	for i, change := range diff.Changes {
+		fields[i] = change.Field
+	}
+	if diff.From != 1 || diff.To != 3 || strings.Join(fields, ",") != "condition,enabled,statusCode" {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	// Restoring saves the old version as the newest one.
+	w = httptest.NewRecorder()
+	app.ruleRestoreHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules/restore?key=payments&id="+rule.ID+"&version=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	rules := app.getRules("payments")
+	if rules[0].Condition != "body.amount > 100" || !rules[0].Enabled {
+		t.Errorf("expected version 1 to be restored, got %+v", rules[0])
+	}
+	if versions, _ := app.getRuleHistory("payments", rule.ID); len(versions) != 4 {
+		t.Errorf("expected restore to add version 4, got %d versions", len(versions))
+	}
+
+	// Deleting a rule drops its history.
+	app.deleteRule("payments", rule.ID)
+	if _, ok := app.ruleHistory[rule.ID]; ok {
+		t.Error("expected history to be removed with the rule")
+	}
+}
+
+func TestRuleHistoryLimit(t *testing.T) {
+	app := New()
+	rule := app.addRule("payments", Rule{Condition: "true", Enabled: true})
+	for i := 0; i < maxRuleVersions+5; i++ {
+		app.updateRule("payments", rule.ID, Rule{Condition: "true", Priority: i, Enabled: true})
+	}
+	versions, _ := app.getRuleHistory("payments", rule.ID)
+	if len(versions) != maxRuleVersions || versions[len(versions)-1].Version != maxRuleVersions+6 {
+		t.Errorf("expected the last %d versions, got %d ending at %d", maxRuleVersions, len(versions), versions[len(versions)-1].Version)
+	}
+}
+
+func TestRuleHistoryErrors(t *testing.T) {
+	app := New()
+	rule := app.addRule("payments", Rule{Condition: "true", Enabled: true})
+
+	tests := []struct {
+		handler http.HandlerFunc
+		method  string
+		url     string
+		want    int
+	}{
+		{app.ruleHistoryHandler, http.MethodGet, "/api/rules/history?key=payments", http.StatusBadRequest},
+		{app.ruleHistoryHandler, http.MethodGet, "/api/rules/history?key=orders&id=" + rule.ID, http.StatusNotFound},
+		{app.ruleHistoryHandler, http.MethodPost, "/api/rules/history?key=payments&id=" + rule.ID, http.StatusMethodNotAllowed},
+		{app.ruleDiffHandler, http.MethodGet, "/api/rules/diff?key=payments&id=" + rule.ID, http.StatusBadRequest},
+		{app.ruleDiffHandler, http.MethodGet, "/api/rules/diff?key=payments&id=" + rule.ID + "&from=x", http.StatusBadRequest},
+		{app.ruleDiffHandler, http.MethodGet, "/api/rules/diff?key=payments&id=" + rule.ID + "&from=7", http.StatusNotFound},
+		{app.ruleRestoreHandler, http.MethodPost, "/api/rules/restore?key=payments&id=" + rule.ID, http.StatusBadRequest},
+		{app.ruleRestoreHandler, http.MethodGet, "/api/rules/restore?key=payments&id=" + rule.ID + "&version=1", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(tt.method, tt.url, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.url, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package hooklabtest starts a hooklab instance for a Go test, so tests can
+// point the service under test at it and assert that it delivered the
+// webhooks it should have:
+//
+//	func TestOrderWebhook(t *testing.T) {
+//		hooks := hooklabtest.Start(t)
+//		hooks.SetResponse(t, "orders", http.StatusAccepted, map[string]any{"ok": true})
+//
+//		placeOrder(t, hooks.WebhookURL("orders"))
+//
+//		event := hooks.WaitForEvent(t, hooklabtest.Key("orders"), 5*time.Second)
+//		if !strings.Contains(event.Body, `"total":42`) { ... }
+//	}
+//
+// Each instance is a hooklab.App served in-process by an httptest.Server on
+// a free port, and is closed when the test ends. The events it captures are
+// recorded by an OnEvent callback, so waiting for one doesn't poll.
+package hooklabtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+)
+
+// Event is a webhook hooklab captured.
+type Event struct {
+	hooklab.Event
+}
+
+// Header returns the first value of the event's header name, ignoring case.
+func (e Event) Header(name string) string {
+	return http.Header(e.Headers).Get(name)
+}
+
+// Decode unmarshals the event's JSON body into v.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal([]byte(e.Body), v)
+}
+
+// Matcher picks the events WaitForEvent waits for.
+type Matcher func(Event) bool
+
+// Key matches the events sent to the webhook key.
+func Key(key string) Matcher {
+	return func(e Event) bool { return e.Key == key }
+}
+
+// Header matches the events whose header name has value.
+func Header(name, value string) Matcher {
+	return func(e Event) bool { return e.Header(name) == value }
+}
+
+// BodyContains matches the events whose body contains s.
+func BodyContains(s string) Matcher {
+	return func(e Event) bool { return strings.Contains(e.Body, s) }
+}
+
+// All matches the events every one of matchers matches.
+func All(matchers ...Matcher) Matcher {
+	return func(e Event) bool {
+		for _, match := range matchers {
+			if !match(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Server is a running hooklab instance.
+type Server struct {
+	URL string       // Where the instance is reached, e.g. http://127.0.0.1:40253/
+	App *hooklab.App // The instance, for registering further callbacks
+
+	server  *httptest.Server
+	mu      sync.Mutex
+	events  []Event       // every event captured, oldest first
+	arrived chan struct{} // closed and replaced whenever an event is captured
+}
+
+// Start starts a hooklab instance built with options, such as
+// hooklab.WithMaxEvents, for the test and closes it when the test ends.
+func Start(t testing.TB, options ...hooklab.Option) *Server {
+	t.Helper()
+	s := &Server{App: hooklab.New(options...), arrived: make(chan struct{})}
+	s.App.OnEvent(s.record)
+	handler, err := hooklab.Handler(s.App)
+	if err != nil {
+		t.Fatalf("hooklabtest: %v", err)
+	}
+	s.server = httptest.NewServer(handler)
+	s.URL = s.server.URL + "/"
+	t.Cleanup(func() {
+		// Ending open connections ends live streams, which Close waits for.
+		s.server.CloseClientConnections()
+		s.server.Close()
+	})
+	return s
+}
+
+// record stores event and wakes the WaitForEvent calls.
+func (s *Server) record(event hooklab.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, Event{event})
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+}
+
+// WebhookURL returns the URL webhooks to key are sent to.
+func (s *Server) WebhookURL(key string) string {
+	return s.URL + "webhook/" + url.PathEscape(key)
+}
+
+// SetResponse makes hooklab answer the webhooks to key with statusCode and
+// the JSON encoding of response.
+func (s *Server) SetResponse(t testing.TB, key string, statusCode int, response any) {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"response": response, "statusCode": statusCode})
+	if err != nil {
+		t.Fatalf("hooklabtest: %v", err)
+	}
+	resp, err := s.server.Client().Post(s.URL+"api/response?key="+url.QueryEscape(key), "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("hooklabtest: setting the response of %q: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		t.Fatalf("hooklabtest: setting the response of %q: %s: %s", key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// Events returns the events captured since Start, oldest first.
+func (s *Server) Events(t testing.TB) []Event {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// WaitForEvent waits until hooklab has captured an event match matches and
+// returns the first such, failing the test if none arrives within timeout.
+func (s *Server) WaitForEvent(t testing.TB, match Matcher, timeout time.Duration) Event {
+	t.Helper()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for seen := 0; ; {
+		s.mu.Lock()
+		events, arrived := s.events, s.arrived
+		s.mu.Unlock()
+		for _, event := range events[seen:] {
+			if match(event) {
+				return event
+			}
+		}
+		seen = len(events)
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			t.Fatalf("hooklabtest: no matching event within %v; got %d other events", timeout, seen)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package hooklabtest
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+)
+
+func TestServer(t *testing.T) {
+	hooks := Start(t, hooklab.WithMaxEvents(1))
+	if !strings.HasPrefix(hooks.URL, "http://127.0.0.1:") || strings.HasSuffix(hooks.URL, ":0/") {
+		t.Fatalf("expected the URL with the port picked, got %q", hooks.URL)
+	}
+	hooks.SetResponse(t, "orders", http.StatusAccepted, map[string]any{"ok": true})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for _, body := range []string{`{"id":1}`, `{"id":2,"total":42}`} {
+			req, _ := http.NewRequest(http.MethodPost, hooks.WebhookURL("orders"), strings.NewReader(body))
+			req.Header.Set("X-Event", "order.created")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("expected the configured status, got %d", resp.StatusCode)
+			}
+		}
+	}()
+
+	event := hooks.WaitForEvent(t, All(Key("orders"), Header("x-event", "order.created"), BodyContains(`"total"`)), 5*time.Second)
+	var order struct{ ID, Total int }
+	if err := event.Decode(&order); err != nil || order.ID != 2 || order.Total != 42 {
+		t.Errorf("unexpected order %+v, %v", order, err)
+	}
+	// Every event is recorded, even past the app's limit.
+	if events := hooks.Events(t); len(events) != 2 || events[0].Body != `{"id":1}` {
+		t.Errorf("expected both events, oldest first, got %+v", events)
+	}
+}
+
+func TestWaitForEventTimeout(t *testing.T) {
+	hooks := Start(t)
+	failing := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hooks.WaitForEvent(failing, Key("missing"), 50*time.Millisecond)
+	}()
+	<-done
+	if !strings.Contains(failing.message, "no matching event within 50ms") {
+		t.Errorf("expected the wait to fail, got %q", failing.message)
+	}
+}
+
+// fatalRecorder records a Fatalf instead of failing the test.
+type fatalRecorder struct {
+	testing.TB
+	message string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.message = fmt.Sprintf(format, args...)
+	// End the goroutine like the real Fatalf.
+	runtime.Goexit()
+}
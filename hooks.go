@@ -0,0 +1,98 @@
+package hooklab
+
+// This file contains callbacks Go code embedding the app registers to process
+// captured events, rule matches, and config changes its own way, without
+// going through the HTTP API or an event sink.
+
+// ConfigChange describes a change to the response config or rules of a key,
+// as passed to OnConfigChange callbacks.
+type ConfigChange struct {
+	Kind     string          // NoticeConfig or NoticeRules
+	Key      string          // Webhook key, or globalRuleKey for global rules
+	Response *ResponseConfig // The key's response config after the change; nil if it has none, or for NoticeRules
+	Rules    []Rule          // The key's rules after the change, for NoticeRules
+}
+
+// OnEvent registers f to be called with every captured event once its rules
+// are evaluated. Callbacks run in registration order on the goroutine handling
+// the webhook, before it is answered, so a slow one delays the response.
+func (a *App) OnEvent(f func(Event)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventHooks = append(a.eventHooks, f)
+}
+
+// OnRuleMatch registers f to be called for every rule whose condition matched
+// a captured event, with the event and the rule's trace. Callbacks run like
+// OnEvent ones, before them.
+func (a *App) OnRuleMatch(f func(Event, RuleTrace)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.matchHooks = append(a.matchHooks, f)
+}
+
+// OnConfigChange registers f to be called after every change to a key's
+// response config or rules, whether made through the API, a config reload, or
+// a Go method. Changes are passed in the order they were made, on a goroutine
+// of their own, so callbacks may call back into the app.
+func (a *App) OnConfigChange(f func(ConfigChange)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.configHooks = append(a.configHooks, f)
+}
+
+// runEventHooks calls the OnRuleMatch callbacks for every rule that matched
+// while evaluating event, then the OnEvent callbacks.
+func (a *App) runEventHooks(event Event, eval *ruleEvaluation) {
+	a.mu.Lock()
+	eventHooks, matchHooks := a.eventHooks, a.matchHooks
+	a.mu.Unlock()
+
+	for _, trace := range eval.trace {
+		if !trace.Matched {
+			continue
+		}
+		for _, hook := range matchHooks {
+			hook(event, trace)
+		}
+	}
+	for _, hook := range eventHooks {
+		hook(event)
+	}
+}
+
+// queueConfigChangeLocked queues change for the OnConfigChange callbacks,
+// starting a goroutine to run them unless one already is. The caller must
+// hold a.mu.
+func (a *App) queueConfigChangeLocked(change ConfigChange) {
+	if len(a.configHooks) == 0 {
+		return
+	}
+	a.configQueue = append(a.configQueue, change)
+	if !a.configHooksRun {
+		a.configHooksRun = true
+		go a.runConfigHooks()
+	}
+}
+
+// runConfigHooks passes the queued config changes to the OnConfigChange
+// callbacks until the queue is empty.
+func (a *App) runConfigHooks() {
+	for {
+		a.mu.Lock()
+		changes, hooks := a.configQueue, a.configHooks
+		a.configQueue = nil
+		if len(changes) == 0 {
+			a.configHooksRun = false
+			a.mu.Unlock()
+			return
+		}
+		a.mu.Unlock()
+
+		for _, change := range changes {
+			for _, hook := range hooks {
+				hook(change)
+			}
+		}
+	}
+}
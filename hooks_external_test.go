@@ -0,0 +1,87 @@
+package hooklab_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+)
+
+// TestHooksPublicAPI registers the callbacks the way an embedding service
+// does, on an app served by Handler and configured through the HTTP API.
+func TestHooksPublicAPI(t *testing.T) {
+	app := hooklab.New()
+	var mu sync.Mutex
+	var calls []string
+	app.OnRuleMatch(func(event hooklab.Event, trace hooklab.RuleTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, "match "+trace.RuleID+" on "+event.Key)
+	})
+	app.OnEvent(func(event hooklab.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, "event "+event.Key+" "+strings.Join(event.MatchedRules, ","))
+	})
+	changes := make(chan hooklab.ConfigChange, 10)
+	app.OnConfigChange(func(change hooklab.ConfigChange) { changes <- change })
+
+	handler, err := hooklab.Handler(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	send := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := send(http.MethodPost, "/api/response?key=orders", `{"response":{"ok":true},"statusCode":202}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setting the response: %s", resp.Status)
+	}
+	resp := send(http.MethodPost, "/api/rules?key=orders", `{"condition":"body.total > 100","statusCode":402,"enabled":true}`)
+	var rule hooklab.Rule
+	if err := json.NewDecoder(resp.Body).Decode(&rule); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating the rule: %s, %v", resp.Status, err)
+	}
+	send(http.MethodDelete, "/api/response?key=orders", "")
+
+	for i, want := range []struct {
+		kind     string
+		response bool
+		rules    int
+	}{{hooklab.NoticeConfig, true, 0}, {hooklab.NoticeRules, false, 1}, {hooklab.NoticeConfig, false, 0}} {
+		select {
+		case change := <-changes:
+			if change.Kind != want.kind || change.Key != "orders" || (change.Response != nil) != want.response || len(change.Rules) != want.rules {
+				t.Errorf("change %d: expected a %s change of orders, got %+v", i, want.kind, change)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("change %d: no config change passed to the callback", i)
+		}
+	}
+
+	if resp := send(http.MethodPost, "/webhook/orders", `{"total": 250}`); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("expected the rule's status, got %s", resp.Status)
+	}
+	send(http.MethodPost, "/webhook/orders", `{"total": 5}`)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"match " + rule.ID + " on orders", "event orders " + rule.ID, "event orders "}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Errorf("expected callbacks %q, got %q", want, calls)
+	}
+}
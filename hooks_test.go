@@ -0,0 +1,52 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	app := New()
+	var calls []string
+	app.OnRuleMatch(func(event Event, trace RuleTrace) {
+		calls = append(calls, "match "+trace.RuleID+" on "+event.Key)
+	})
+	app.OnEvent(func(event Event) {
+		calls = append(calls, "event "+event.Key+" "+strings.Join(event.MatchedRules, ","))
+	})
+	changes := make(chan ConfigChange, 10)
+	app.OnConfigChange(func(change ConfigChange) {
+		// Callbacks run outside the app's lock, so may call into it.
+		app.keyRules(change.Key)
+		changes <- change
+	})
+
+	app.setResponseConfig("orders", ResponseConfig{Response: map[string]any{"ok": true}, StatusCode: http.StatusAccepted})
+	rule := app.addRule("orders", Rule{Condition: `body.total > 100`, StatusCode: http.StatusPaymentRequired, Enabled: true})
+	app.deleteResponseConfig("orders")
+
+	for i, want := range []struct {
+		kind     string
+		response bool
+		rules    int
+	}{{NoticeConfig, true, 0}, {NoticeRules, false, 1}, {NoticeConfig, false, 0}} {
+		select {
+		case change := <-changes:
+			if change.Kind != want.kind || change.Key != "orders" || (change.Response != nil) != want.response || len(change.Rules) != want.rules {
+				t.Errorf("change %d: expected a %s change of orders, got %+v", i, want.kind, change)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("change %d: no config change passed to the callback", i)
+		}
+	}
+
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"total": 250}`)))
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"total": 5}`)))
+	want := []string{"match " + rule.ID + " on orders", "event orders " + rule.ID, "event orders "}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Errorf("expected callbacks %q, got %q", want, calls)
+	}
+}
@@ -0,0 +1,140 @@
+package hooklab
+
+// This file contains the /api/info endpoint, describing the running instance —
+// its build, uptime, memory, limits, and where events go — for support requests
+// and the dashboard's About panel.
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// version is the release hooklab was built as, set with
+// -ldflags "-X github.com/essajiwa/hooklab.version=v1.2.3"; otherwise the module version, if any.
+var version = ""
+
+// Info describes the running instance.
+type Info struct {
+	Version    string      `json:"version"`
+	Commit     string      `json:"commit,omitempty"`   // VCS revision the binary was built from
+	Modified   bool        `json:"modified,omitempty"` // The working tree had uncommitted changes
+	GoVersion  string      `json:"goVersion"`
+	StartedAt  time.Time   `json:"startedAt,omitzero"`
+	URL        string      `json:"url,omitempty"`      // Where the server is reached, with the port picked for -port 0
+	AdminURL   string      `json:"adminUrl,omitempty"` // Where the -admin-addr server is reached
+	Uptime     Duration    `json:"uptime"`
+	Goroutines int         `json:"goroutines"`
+	Memory     MemoryStats `json:"memory"`
+	Limits     InfoLimits  `json:"limits"`
+	Storage    InfoStorage `json:"storage"`
+}
+
+// MemoryStats is a summary of runtime.MemStats, in bytes.
+type MemoryStats struct {
+	HeapAlloc  uint64 `json:"heapAlloc"`  // Live heap objects
+	HeapSys    uint64 `json:"heapSys"`    // Heap memory obtained from the OS
+	Sys        uint64 `json:"sys"`        // All memory obtained from the OS
+	TotalAlloc uint64 `json:"totalAlloc"` // Allocated since startup, including freed objects
+	NumGC      uint32 `json:"numGC"`      // Completed garbage collections
+}
+
+// InfoLimits are the configured limits of the instance.
+type InfoLimits struct {
+	MaxBodyBytes          int     `json:"maxBodyBytes"`          // Largest webhook body read
+	MaxEvents             int     `json:"maxEvents"`             // Captured events kept
+	MaxRuleVersions       int     `json:"maxRuleVersions"`       // Versions kept per rule
+	MaxNotifierDeliveries int     `json:"maxNotifierDeliveries"` // Delivery attempts kept per notifier
+	StreamBuffer          int     `json:"streamBuffer"`          // Messages an SSE client can fall behind by
+	CaptureRate           float64 `json:"captureRate"`           // Webhooks per second per client and key; 0 is unlimited
+	CaptureBurst          int     `json:"captureBurst"`
+}
+
+// InfoStorage describes where captured events are kept and sent.
+type InfoStorage struct {
+	Events       string   `json:"events"`                 // Where captured events are kept: memory, or the EventStore's name
+	Sinks        []string `json:"sinks"`                  // Systems captured events are published to, e.g. Kafka
+	SharedStream string   `json:"sharedStream,omitempty"` // What the live stream is shared with other instances through, e.g. Redis
+}
+
+// buildInfo returns the version and VCS revision embedded in the binary.
+func buildInfo() (ver, commit string, modified bool) {
+	ver = version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return cmp.Or(ver, "dev"), "", false
+	}
+	if ver == "" && info.Main.Version != "(devel)" {
+		ver = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			commit = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	return cmp.Or(ver, "dev"), commit, modified
+}
+
+// info returns the current instance information at now.
+func (a *App) info(now time.Time) Info {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	ver, commit, modified := buildInfo()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info := Info{
+		Version:    ver,
+		Commit:     commit,
+		Modified:   modified,
+		GoVersion:  runtime.Version(),
+		StartedAt:  a.startedAt,
+		URL:        a.url,
+		AdminURL:   a.adminURL,
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			HeapAlloc:  mem.HeapAlloc,
+			HeapSys:    mem.HeapSys,
+			Sys:        mem.Sys,
+			TotalAlloc: mem.TotalAlloc,
+			NumGC:      mem.NumGC,
+		},
+		Limits: InfoLimits{
+			MaxBodyBytes:          maxBodySize,
+			MaxEvents:             a.maxEventsLocked(),
+			MaxRuleVersions:       maxRuleVersions,
+			MaxNotifierDeliveries: maxNotifierDeliveries,
+			StreamBuffer:          cmp.Or(a.streamBuffer, defaultStreamBuffer),
+			CaptureRate:           a.captureLimit.Rate,
+			CaptureBurst:          a.captureLimit.Burst,
+		},
+		Storage: InfoStorage{Events: a.store.Name(), Sinks: []string{}},
+	}
+	if !a.startedAt.IsZero() {
+		info.Uptime = Duration(now.Sub(a.startedAt).Truncate(time.Second))
+	}
+	for _, sink := range a.sinks {
+		info.Storage.Sinks = append(info.Storage.Sinks, sink.Name())
+	}
+	if a.bridge != nil {
+		info.Storage.SharedStream = a.bridge.Name()
+	}
+	return info
+}
+
+// infoHandler handles GET /api/info requests.
+func (a *App) infoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.info(a.now()))
+}
@@ -0,0 +1,57 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestInfoHandler(t *testing.T) {
+	started := time.Now().Add(-90 * time.Minute)
+	app := New(WithStreamBuffer(4))
+	app.startedAt = started
+	app.setCaptureLimit(CaptureLimit{Rate: 5, Burst: 10})
+	app.addSink(&countingSink{})
+	app.setListenURLs("http://localhost:41234/", "")
+
+	w := httptest.NewRecorder()
+	app.infoHandler(w, httptest.NewRequest(http.MethodGet, "/api/info", nil))
+	var info Info
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version == "" || info.GoVersion != runtime.Version() || info.Goroutines < 1 || info.Memory.Sys == 0 {
+		t.Errorf("unexpected runtime info %+v", info)
+	}
+	if !info.StartedAt.Equal(started) || time.Duration(info.Uptime) < 90*time.Minute || time.Duration(info.Uptime) > 91*time.Minute {
+		t.Errorf("unexpected uptime %v since %v", time.Duration(info.Uptime), info.StartedAt)
+	}
+	if info.URL != "http://localhost:41234/" || info.AdminURL != "" {
+		t.Errorf("unexpected URLs %q and %q", info.URL, info.AdminURL)
+	}
+	want := InfoLimits{
+		MaxBodyBytes:          maxBodySize,
+		MaxEvents:             maxEvents,
+		MaxRuleVersions:       maxRuleVersions,
+		MaxNotifierDeliveries: maxNotifierDeliveries,
+		StreamBuffer:          4,
+		CaptureRate:           5,
+		CaptureBurst:          10,
+	}
+	if info.Limits != want {
+		t.Errorf("expected limits %+v, got %+v", want, info.Limits)
+	}
+	if info.Storage.Events != "memory" || !slices.Equal(info.Storage.Sinks, []string{"counting"}) || info.Storage.SharedStream != "" {
+		t.Errorf("unexpected storage %+v", info.Storage)
+	}
+
+	w = httptest.NewRecorder()
+	app.infoHandler(w, httptest.NewRequest(http.MethodPost, "/api/info", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,36 @@
+// Package command connects the hooklab command in cmd/hooklab to the
+// subcommands package hooklab implements. They need the App's internals, and
+// the library exports only New, Handler, and the options, so package hooklab
+// hands them over here when it is initialized.
+package command
+
+import (
+	"context"
+	"flag"
+	"io"
+)
+
+// The subcommands besides serve, writing their output to out.
+var (
+	Export  func(args []string, out io.Writer) error
+	Replay  func(args []string, out io.Writer) error
+	Tail    func(ctx context.Context, args []string, out io.Writer) error
+	Version func(args []string, out io.Writer) error
+)
+
+// serve is the serve subcommand, as passed to SetServe.
+var serve any
+
+// SetServe sets the serve subcommand. O is hooklab.Option, which this package
+// can't name: package hooklab imports it.
+func SetServe[O any](f func(ctx context.Context, fs *flag.FlagSet, args []string, options func() ([]O, error)) error) {
+	serve = f
+}
+
+// Serve runs the webhook server with the flags in args until ctx is done. fs
+// holds the command's own flags, such as the sinks'; once they are parsed and
+// merged with the -config file, options returns the options the server's App
+// is built with besides those of its flags.
+func Serve[O any](ctx context.Context, fs *flag.FlagSet, args []string, options func() ([]O, error)) error {
+	return serve.(func(context.Context, *flag.FlagSet, []string, func() ([]O, error)) error)(ctx, fs, args, options)
+}
@@ -0,0 +1,43 @@
+// Package destination parses the templates the sinks render, for every
+// captured event, where it is published: a NATS subject, a Kafka topic, or an
+// MQTT topic. Templates can reference:
+//   - .key: webhook key
+//   - .method: HTTP method
+package destination
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/essajiwa/hooklab"
+)
+
+// Template is a parsed destination template.
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse parses a destination template such as "hooklab.{{.key}}".
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("destination").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Render returns the destination for event.
+func (d *Template) Render(event hooklab.Event) (string, error) {
+	var buf bytes.Buffer
+	data := map[string]interface{}{"key": event.Key, "method": event.Method}
+	if err := d.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	destination := strings.TrimSpace(buf.String())
+	if destination == "" {
+		return "", fmt.Errorf("template rendered an empty destination")
+	}
+	return destination, nil
+}
@@ -0,0 +1,27 @@
+package destination
+
+import (
+	"testing"
+
+	"github.com/essajiwa/hooklab"
+)
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{"hooklab.{{.key", "hooklab.{{.unknown}}"} {
+		destination, err := Parse(text)
+		if err == nil {
+			_, err = destination.Render(hooklab.Event{Key: "payments"})
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+	destination, _ := Parse("{{if eq .key \"default\"}}{{end}}")
+	if _, err := destination.Render(hooklab.Event{Key: "default"}); err == nil {
+		t.Error("expected an error for an empty destination")
+	}
+	destination, _ = Parse("hooks.{{.key}}.{{.method}}")
+	if got, err := destination.Render(hooklab.Event{Key: "payments", Method: "POST"}); err != nil || got != "hooks.payments.POST" {
+		t.Errorf("expected hooks.payments.POST, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,18 @@
+// Package instance names this process among the hooklab instances sharing a
+// broker, such as the Redis channel of a shared stream.
+package instance
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+)
+
+// Name identifies this process, e.g. "hooklab-7d9f-abcde-1" for a pod.
+func Name() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Sprintf("%016x", rand.Uint64())
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,137 @@
+package hooklab
+
+// This file contains IP filters: CIDR allow and deny lists, set globally by flag
+// and per key, that decide which addresses may deliver webhooks before anything
+// is stored.
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPFilter limits the addresses webhooks are accepted from. Entries are CIDR
+// prefixes such as "192.30.252.0/22" or single addresses. Denied addresses are
+// always refused; with an allow list, only addresses on it are accepted.
+type IPFilter struct {
+	Allow []string `json:"allow,omitempty"` // Only accept webhooks from these prefixes
+	Deny  []string `json:"deny,omitempty"`  // Refuse webhooks from these prefixes
+
+	allow, deny []netip.Prefix // Allow and Deny as parsed by validate
+	parsed      bool
+}
+
+// parseIPList splits a comma-separated list of prefixes, as given by flag.
+func parseIPList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parsePrefix parses a CIDR prefix or a single address, which matches only itself.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// validate checks that every entry is a prefix or address, and keeps the
+// parsed prefixes on the filter.
+func (f *IPFilter) validate() error {
+	allow, err := parsePrefixes(f.Allow)
+	if err != nil {
+		return errors.New("ipFilter.allow: " + err.Error())
+	}
+	deny, err := parsePrefixes(f.Deny)
+	if err != nil {
+		return errors.New("ipFilter.deny: " + err.Error())
+	}
+	f.allow, f.deny, f.parsed = allow, deny, true
+	return nil
+}
+
+// parsePrefixes parses a list of prefixes or addresses.
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, errors.New("invalid prefix " + entry)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// allows reports whether webhooks from addr are accepted. Filters that weren't
+// validated have their entries parsed here, and invalid ones never match.
+func (f IPFilter) allows(addr netip.Addr) bool {
+	if !f.parsed {
+		f.allow, f.deny = parseValidPrefixes(f.Allow), parseValidPrefixes(f.Deny)
+	}
+	if matchesAny(f.deny, addr) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchesAny(f.allow, addr)
+}
+
+// parseValidPrefixes parses the valid prefixes among entries.
+func parseValidPrefixes(entries []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if prefix, err := parsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// matchesAny reports whether addr is in any of the prefixes.
+func matchesAny(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address r was received from. Unparseable addresses are
+// returned as the zero Addr, which no prefix contains.
+func clientAddr(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		addr, _ := netip.ParseAddr(r.RemoteAddr)
+		return addr.Unmap()
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// setIPFilter sets the filter applied to webhooks of every key.
+func (a *App) setIPFilter(filter IPFilter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ipFilter = filter
+}
+
+// allowsAddr reports whether the global filter and the key's filter both accept
+// webhooks from addr.
+func (a *App) allowsAddr(keyFilter *IPFilter, addr netip.Addr) bool {
+	a.mu.Lock()
+	global := a.ipFilter
+	a.mu.Unlock()
+
+	return global.allows(addr) && (keyFilter == nil || keyFilter.allows(addr))
+}
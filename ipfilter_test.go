@@ -0,0 +1,133 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIPFilterAllows(t *testing.T) {
+	filter := IPFilter{Allow: []string{"192.30.252.0/22", "2001:db8::/32", "10.0.0.7"}, Deny: []string{"192.30.253.9"}}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"192.30.252.1", true},
+		{"192.30.255.255", true},
+		{"192.30.253.9", false},
+		{"192.31.0.1", false},
+		{"10.0.0.7", true},
+		{"10.0.0.8", false},
+		{"2001:db8::1", true},
+		{"::ffff:192.30.252.1", true},
+	}
+	for _, tt := range tests {
+		if got := filter.allows(netip.MustParseAddr(tt.addr).Unmap()); got != tt.want {
+			t.Errorf("allows(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	denyOnly := IPFilter{Deny: []string{"203.0.113.0/24"}}
+	if !denyOnly.allows(netip.MustParseAddr("198.51.100.1")) || denyOnly.allows(netip.MustParseAddr("203.0.113.5")) {
+		t.Error("expected a deny list alone to accept everything else")
+	}
+	if !(IPFilter{}).allows(netip.Addr{}) || (IPFilter{Allow: []string{"0.0.0.0/0"}}).allows(netip.Addr{}) {
+		t.Error("expected unknown addresses to be refused only with an allow list")
+	}
+}
+
+func TestIPFilterValidate(t *testing.T) {
+	valid := IPFilter{Allow: []string{"10.0.0.0/8", "::1"}, Deny: []string{"10.1.0.0/16"}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(valid.allow) != 2 || len(valid.deny) != 1 || !valid.allows(netip.MustParseAddr("10.2.0.1")) || valid.allows(netip.MustParseAddr("10.1.0.1")) {
+		t.Errorf("expected the prefixes parsed once and applied, got %+v", valid)
+	}
+	for _, filter := range []IPFilter{
+		{Allow: []string{"10.0.0.0/33"}},
+		{Deny: []string{"example.com"}},
+	} {
+		if err := filter.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", filter)
+		}
+	}
+	if got := parseIPList(" 10.0.0.0/8, ,::1 "); len(got) != 2 || got[0] != "10.0.0.0/8" || got[1] != "::1" {
+		t.Errorf("unexpected list %q", got)
+	}
+}
+
+func TestWebhookHandlerIPFilter(t *testing.T) {
+	app := New()
+	app.setIPFilter(IPFilter{Deny: []string{"203.0.113.0/24"}})
+	app.setResponseConfig("payments", ResponseConfig{StatusCode: http.StatusOK, IPFilter: &IPFilter{Allow: []string{"192.30.252.0/22"}}})
+
+	tests := []struct {
+		key, remote string
+		want        int
+	}{
+		{"payments", "192.30.252.10:4000", http.StatusOK},
+		{"payments", "198.51.100.1:4000", http.StatusForbidden},
+		{"orders", "198.51.100.1:4000", http.StatusOK},
+		{"orders", "203.0.113.5:4000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/"+tt.key, strings.NewReader(`{}`))
+		req.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s from %s: expected status %d, got %d", tt.key, tt.remote, tt.want, w.Code)
+		}
+		if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "address not allowed") {
+			t.Errorf("%s from %s: unexpected body %s", tt.key, tt.remote, w.Body.String())
+		}
+	}
+	if len(app.store.Events()) != 2 {
+		t.Errorf("expected only allowed webhooks to be stored, got %d events", len(app.store.Events()))
+	}
+
+	w := httptest.NewRecorder()
+	app.statsHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var got struct {
+		Rejected RejectionStats `json:"rejected"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if r := got.Rejected; r.Total != 2 || r.Causes[RejectIP] != 2 || r.Keys["payments"] != 1 || r.Keys["orders"] != 1 {
+		t.Errorf("unexpected rejection stats %+v", r)
+	}
+}
+
+func TestResponseHandlerValidatesIPFilter(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"response":{},"statusCode":200,"ipFilter":{"allow":["nope"]}}`,
+		`{"response":{},"statusCode":200,"methods":{"GET":{"ipFilter":{"deny":["10.0.0.1"]}}}}`,
+	} {
+		w := httptest.NewRecorder()
+		app.responseHandler(w, httptest.NewRequest(http.MethodPost, "/api/response?key=payments", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "ipFilter") {
+			t.Errorf("%s: expected an ipFilter error, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRejectionKeysCapped(t *testing.T) {
+	app := New()
+	app.setIPFilter(IPFilter{Deny: []string{"203.0.113.0/24"}})
+	for i := range maxRejectionKeys + 50 {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/scan-"+strconv.Itoa(i), strings.NewReader(`{}`))
+		req.RemoteAddr = "203.0.113.5:4000"
+		app.webhookHandler(httptest.NewRecorder(), req)
+	}
+	stats := app.rejectionStats()
+	if stats.Total != maxRejectionKeys+50 || len(stats.Keys) != maxRejectionKeys+1 || stats.Keys[rejectionOtherKeys] != 50 || stats.Keys["scan-0"] != 1 {
+		t.Errorf("expected refusals past %d keys counted under %q, got %d keys and %d others", maxRejectionKeys, rejectionOtherKeys, len(stats.Keys), stats.Keys[rejectionOtherKeys])
+	}
+}
@@ -0,0 +1,282 @@
+package hooklab
+
+// This file contains JWT decoding: bearer tokens carried by webhooks, in the
+// Authorization header or a configured header or body field, are decoded so the
+// event shows their header and claims and rules can check them as the jwt
+// variable. A key can give an HMAC secret or a JWKS URL to verify the tokens too.
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// jwksTimeout bounds how long fetching a JWKS may take.
+	jwksTimeout = 5 * time.Second
+	// jwksTTL is how long a fetched JWKS is used before it is fetched again.
+	jwksTTL = 5 * time.Minute
+)
+
+// jwksClient fetches JWKS documents.
+var jwksClient = &http.Client{Timeout: jwksTimeout}
+
+// hmacHashes are the hashes of the algorithms a JWT secret verifies.
+var hmacHashes = map[string]func() hash.Hash{"HS256": sha256.New, "HS384": sha512.New384, "HS512": sha512.New}
+
+// publicKeyAlgorithms are the algorithms a JWKS verifies.
+var publicKeyAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWTConfig says where a key's webhooks carry a JWT and how to verify it.
+// Without one, a JWT in the Authorization header is decoded but not verified.
+type JWTConfig struct {
+	Header    string `json:"header,omitempty"`    // Header carrying the token, with or without "Bearer " (default: Authorization)
+	BodyField string `json:"bodyField,omitempty"` // JSONPath of the body field carrying the token instead, e.g. "$.token"
+	Secret    string `json:"secret,omitempty"`    // HMAC secret verifying HS256, HS384, and HS512 tokens
+	JWKSURL   string `json:"jwksUrl,omitempty"`   // JWKS endpoint verifying RSA, ECDSA, and EdDSA tokens
+}
+
+// JWTResult is a decoded JWT, stored on the event.
+type JWTResult struct {
+	Source   string                 `json:"source"`           // Where the token was found, e.g. "header Authorization" or "body $.token"
+	Header   map[string]interface{} `json:"header,omitempty"` // JOSE header, e.g. alg and kid
+	Claims   map[string]interface{} `json:"claims,omitempty"` // Claims, as sent
+	Verified bool                   `json:"verified"`         // The signature matched the key's secret or JWKS
+	Expired  bool                   `json:"expired"`          // The exp claim is in the past
+	Error    string                 `json:"error,omitempty"`  // Why the token couldn't be decoded or verified
+}
+
+// validate checks the body field's JSONPath and the JWKS URL.
+func (c JWTConfig) validate() error {
+	if c.Header != "" && c.BodyField != "" {
+		return errors.New("jwt: set header or bodyField, not both")
+	}
+	if c.BodyField != "" {
+		if _, err := parseJSONPath(c.BodyField); err != nil {
+			return errors.New("jwt.bodyField: " + err.Error())
+		}
+	}
+	if c.JWKSURL != "" {
+		u, err := url.Parse(c.JWKSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("jwt.jwksUrl must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// source returns where the token is read from.
+func (c JWTConfig) source() string {
+	if c.BodyField != "" {
+		return "body " + c.BodyField
+	}
+	if c.Header != "" {
+		return "header " + http.CanonicalHeaderKey(c.Header)
+	}
+	return "header Authorization"
+}
+
+// token returns the token the webhook carries where c says, or "".
+func (c JWTConfig) token(headers http.Header, body interface{}) string {
+	if c.BodyField != "" {
+		value, _ := jsonPath(c.BodyField, body)
+		token, _ := value.(string)
+		return strings.TrimSpace(token)
+	}
+	value := strings.TrimSpace(headers.Get(cmp.Or(c.Header, "Authorization")))
+	if scheme, rest, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		value = strings.TrimSpace(rest)
+	}
+	return value
+}
+
+// decodeJWT decodes the JWT a webhook carries, verifying it when config gives
+// a secret or JWKS. Without config, only a JWT in the Authorization header is
+// looked for, and nil is returned when there is none; with it, a missing token
+// is reported. body is the webhook body as rules see it.
+func (a *App) decodeJWT(config *JWTConfig, headers http.Header, body interface{}, now time.Time) *JWTResult {
+	c := JWTConfig{}
+	if config != nil {
+		c = *config
+	}
+	token := c.token(headers, body)
+	if config == nil && strings.Count(token, ".") != 2 {
+		return nil
+	}
+
+	result := &JWTResult{Source: c.source()}
+	if token == "" {
+		result.Error = "missing token"
+		return result
+	}
+	header, claims, err := decodeJWTParts(token)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Header, result.Claims = header, claims
+	if exp, ok := toFloat(claims["exp"]); ok {
+		result.Expired = now.After(time.Unix(int64(exp), 0))
+	}
+
+	if c.Secret == "" && c.JWKSURL == "" {
+		return result
+	}
+	alg, _ := header["alg"].(string)
+	if err := a.verifyJWT(c, token, alg); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Verified = true
+	return result
+}
+
+// decodeJWTParts decodes the header and claims of a compact JWT without
+// verifying it.
+func decodeJWTParts(token string) (map[string]interface{}, map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("not a JWT: want three dot-separated parts")
+	}
+	var header, claims map[string]interface{}
+	for i, dest := range []*map[string]interface{}{&header, &claims} {
+		name := []string{"header", "claims"}[i]
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s is not base64url: %w", name, err)
+		}
+		if err := json.Unmarshal(raw, dest); err != nil {
+			return nil, nil, fmt.Errorf("%s is not a JSON object: %w", name, err)
+		}
+	}
+	return header, claims, nil
+}
+
+// verifyJWT checks the token's signature against the secret for HMAC
+// algorithms or the JWKS for public key algorithms, so a JWKS's public keys are
+// never used as HMAC secrets.
+func (a *App) verifyJWT(c JWTConfig, token string, alg string) error {
+	if hash, ok := hmacHashes[alg]; ok {
+		if c.Secret == "" {
+			return fmt.Errorf("no secret to verify %s tokens", alg)
+		}
+		dot := strings.LastIndex(token, ".")
+		signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token[dot+1:], "="))
+		if err != nil {
+			return errors.New("signature is not base64url")
+		}
+		mac := hmac.New(hash, []byte(c.Secret))
+		mac.Write([]byte(token[:dot]))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+
+	if c.JWKSURL == "" {
+		return fmt.Errorf("no JWKS to verify %s tokens", alg)
+	}
+	parsed, err := jwt.ParseSigned(token, publicKeyAlgorithms)
+	if err != nil {
+		return err
+	}
+	keys, err := a.jwks(c.JWKSURL)
+	if err != nil {
+		return err
+	}
+	// Tokens without a kid are tried against every key.
+	candidates := keys.Keys
+	if kid := parsed.Headers[0].KeyID; kid != "" {
+		if candidates = keys.Key(kid); len(candidates) == 0 {
+			return fmt.Errorf("no key %q in the JWKS", kid)
+		}
+	}
+	for _, key := range candidates {
+		if parsed.Claims(key.Public().Key) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// jwksEntry is a fetched JWKS.
+type jwksEntry struct {
+	keys    *jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// jwks returns the key set at jwksURL, fetching it again once it is older than jwksTTL.
+func (a *App) jwks(jwksURL string) (*jose.JSONWebKeySet, error) {
+	a.mu.Lock()
+	entry, ok := a.jwksSets[jwksURL]
+	a.mu.Unlock()
+	if ok && time.Since(entry.fetched) < jwksTTL {
+		return entry.keys, nil
+	}
+
+	resp, err := jwksClient.Get(jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: %s", resp.Status)
+	}
+	keys := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(body, keys); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	a.mu.Lock()
+	a.jwksSets[jwksURL] = jwksEntry{keys: keys, fetched: time.Now()}
+	a.mu.Unlock()
+	return keys, nil
+}
+
+// jwtEnv returns the jwt expression variable for result: present, source,
+// header, claims, verified, expired, and error. Without a token, present is
+// false and header and claims are empty.
+func jwtEnv(result *JWTResult) map[string]interface{} {
+	if result == nil {
+		result = &JWTResult{}
+	}
+	header, claims := result.Header, result.Claims
+	if header == nil {
+		header = map[string]interface{}{}
+	}
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"present":  result.Claims != nil,
+		"source":   result.Source,
+		"header":   header,
+		"claims":   claims,
+		"verified": result.Verified,
+		"expired":  result.Expired,
+		"error":    result.Error,
+	}
+}
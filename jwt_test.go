@@ -0,0 +1,197 @@
+package hooklab
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// signJWT returns a compact JWT of claims signed with key. HMAC tokens are
+// signed by hand, since go-jose refuses secrets shorter than the hash.
+func signJWT(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	if alg == jose.HS256 {
+		header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	options := (&jose.SignerOptions{}).WithType("JWT")
+	if kid != "" {
+		options = options.WithHeader(jose.HeaderKey("kid"), kid)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDecodeJWTSecret(t *testing.T) {
+	app := New()
+	now := time.Now()
+	token := signJWT(t, jose.HS256, []byte("s3cret"), "", map[string]interface{}{"sub": "svc-payments", "exp": now.Add(time.Hour).Unix()})
+
+	headers := http.Header{"Authorization": {"Bearer " + token}}
+	result := app.decodeJWT(&JWTConfig{Secret: "s3cret"}, headers, "", now)
+	if !result.Verified || result.Expired || result.Error != "" || result.Claims["sub"] != "svc-payments" || result.Header["alg"] != "HS256" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.Source != "header Authorization" {
+		t.Errorf("unexpected source %q", result.Source)
+	}
+
+	result = app.decodeJWT(&JWTConfig{Secret: "other"}, headers, "", now)
+	if result.Verified || result.Error != "signature mismatch" || result.Claims["sub"] != "svc-payments" {
+		t.Errorf("expected decoded but unverified token, got %+v", result)
+	}
+
+	result = app.decodeJWT(&JWTConfig{Secret: "s3cret"}, headers, "", now.Add(2*time.Hour))
+	if !result.Verified || !result.Expired {
+		t.Errorf("expected verified, expired token, got %+v", result)
+	}
+
+	result = app.decodeJWT(&JWTConfig{Secret: "s3cret"}, http.Header{}, "", now)
+	if result == nil || result.Error != "missing token" {
+		t.Errorf("expected missing token, got %+v", result)
+	}
+}
+
+func TestDecodeJWTWithoutConfig(t *testing.T) {
+	app := New()
+	token := signJWT(t, jose.HS256, []byte("s3cret"), "", map[string]interface{}{"iss": "acme"})
+
+	result := app.decodeJWT(nil, http.Header{"Authorization": {"bearer " + token}}, "", time.Now())
+	if result == nil || result.Verified || result.Error != "" || result.Claims["iss"] != "acme" {
+		t.Errorf("expected decoded, unverified token, got %+v", result)
+	}
+	for _, value := range []string{"", "Basic dXNlcjpwYXNz", "Bearer opaque-token"} {
+		if result := app.decodeJWT(nil, http.Header{"Authorization": {value}}, "", time.Now()); result != nil {
+			t.Errorf("%q: expected no token, got %+v", value, result)
+		}
+	}
+	if result := app.decodeJWT(nil, http.Header{"Authorization": {"Bearer a.b.c"}}, "", time.Now()); result == nil || !strings.Contains(result.Error, "base64url") {
+		t.Errorf("expected malformed token error, got %+v", result)
+	}
+}
+
+func TestDecodeJWTBodyFieldAndHeader(t *testing.T) {
+	app := New()
+	token := signJWT(t, jose.HS256, []byte("s3cret"), "", map[string]interface{}{"event": "paid"})
+
+	result := app.decodeJWT(&JWTConfig{BodyField: "$.auth.token", Secret: "s3cret"}, http.Header{}, `{"auth":{"token":"`+token+`"}}`, time.Now())
+	if !result.Verified || result.Source != "body $.auth.token" || result.Claims["event"] != "paid" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	result = app.decodeJWT(&JWTConfig{Header: "x-webhook-token"}, http.Header{"X-Webhook-Token": {token}}, "", time.Now())
+	if result.Source != "header X-Webhook-Token" || result.Claims["event"] != "paid" || result.Verified {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestDecodeJWTJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "k1", Algorithm: string(jose.ES256), Use: "sig"}}})
+	}))
+	defer server.Close()
+
+	app := New()
+	config := &JWTConfig{JWKSURL: server.URL}
+	for _, kid := range []string{"k1", ""} {
+		token := signJWT(t, jose.ES256, key, kid, map[string]interface{}{"sub": "producer"})
+		result := app.decodeJWT(config, http.Header{"Authorization": {"Bearer " + token}}, "", time.Now())
+		if !result.Verified || result.Error != "" {
+			t.Errorf("kid %q: expected verified token, got %+v", kid, result)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("expected the JWKS to be fetched once, got %d", got)
+	}
+
+	token := signJWT(t, jose.ES256, key, "k2", map[string]interface{}{"sub": "producer"})
+	if result := app.decodeJWT(config, http.Header{"Authorization": {"Bearer " + token}}, "", time.Now()); result.Verified || !strings.Contains(result.Error, `no key "k2"`) {
+		t.Errorf("expected unknown kid error, got %+v", result)
+	}
+
+	// A JWKS doesn't verify HMAC tokens, so its public keys can't be used as secrets.
+	token = signJWT(t, jose.HS256, []byte("s3cret"), "k1", map[string]interface{}{"sub": "producer"})
+	if result := app.decodeJWT(config, http.Header{"Authorization": {"Bearer " + token}}, "", time.Now()); result.Verified || result.Error == "" {
+		t.Errorf("expected HS256 token to be refused, got %+v", result)
+	}
+}
+
+func TestJWTConfigValidate(t *testing.T) {
+	tests := []struct {
+		config JWTConfig
+		want   string
+	}{
+		{JWTConfig{Secret: "s"}, ""},
+		{JWTConfig{Header: "X-Token", BodyField: "$.token"}, "not both"},
+		{JWTConfig{BodyField: "token"}, "jwt.bodyField"},
+		{JWTConfig{JWKSURL: "example.com/jwks"}, "jwt.jwksUrl"},
+	}
+	for _, tt := range tests {
+		err := tt.config.validate()
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.config, tt.want, err)
+		}
+	}
+
+	if err := validateResponseConfig(ResponseConfig{StatusCode: 200, Methods: map[string]ResponseConfig{"POST": {StatusCode: 200, JWT: &JWTConfig{}}}}); err == nil || !strings.Contains(err.Error(), "jwt applies to the whole key") {
+		t.Errorf("expected per-method jwt to be rejected, got %v", err)
+	}
+}
+
+func TestWebhookHandlerJWTRules(t *testing.T) {
+	app := New()
+	app.setResponseConfig("payments", ResponseConfig{StatusCode: http.StatusOK, JWT: &JWTConfig{Secret: "s3cret"}})
+	app.addRule("payments", Rule{Condition: `!jwt.verified || jwt.claims.scope != "webhooks"`, StatusCode: http.StatusUnauthorized, Enabled: true})
+
+	tests := []struct {
+		secret, scope string
+		want          int
+	}{
+		{"s3cret", "webhooks", http.StatusOK},
+		{"s3cret", "admin", http.StatusUnauthorized},
+		{"wrong", "webhooks", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		token := signJWT(t, jose.HS256, []byte(tt.secret), "", map[string]interface{}{"scope": tt.scope})
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s/%s: expected status %d, got %d", tt.secret, tt.scope, tt.want, w.Code)
+		}
+	}
+	if event := app.store.Events()[0]; event.JWT == nil || event.JWT.Claims["scope"] != "webhooks" || event.JWT.Verified {
+		t.Errorf("unexpected stored token %+v", event.JWT)
+	}
+}
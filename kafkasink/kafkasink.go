@@ -0,0 +1,106 @@
+// Package kafkasink is the Kafka sink, which publishes every webhook hooklab
+// captures as JSON to a topic, keyed by webhook key so each key's events stay
+// in order on one partition:
+//
+//	sink, err := kafkasink.New(kafkasink.Config{Brokers: []string{"localhost:9092"}, Topic: kafkasink.DefaultTopic, ...})
+//	...
+//	app := hooklab.New(hooklab.WithSink(sink))
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/internal/destination"
+	"github.com/segmentio/kafka-go"
+)
+
+// Defaults for the Kafka flags.
+const (
+	DefaultTopic        = "hooklab-events"
+	DefaultBatchSize    = 100
+	DefaultBatchTimeout = 100 * time.Millisecond
+	DefaultRetries      = 10
+)
+
+// writer is the part of *kafka.Writer the sink uses, so tests can fake it.
+type writer interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// Sink publishes events to Kafka topics rendered from a template.
+type Sink struct {
+	writer writer
+	topic  *destination.Template
+}
+
+// Config configures the Kafka sink.
+type Config struct {
+	Brokers      []string      // Bootstrap brokers, host:port
+	Topic        string        // Topic template, e.g. "hooklab-events" or "webhooks.{{.key}}"; can reference .key and .method
+	BatchSize    int           // Messages buffered per partition before a batch is sent
+	BatchTimeout time.Duration // How long an incomplete batch waits before it is sent
+	Retries      int           // Attempts to deliver a batch before its messages are dropped
+}
+
+// New returns a sink writing to the brokers of config. Messages are written
+// asynchronously in batches and retried with backoff; batches that still fail
+// are logged and dropped.
+func New(config Config) (*Sink, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("no brokers")
+	}
+	topic, err := destination.Parse(config.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic template: %w", err)
+	}
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(config.Brokers...),
+		Balancer:               &kafka.Murmur2Balancer{}, // same partitioning as the Java client
+		BatchSize:              config.BatchSize,
+		BatchTimeout:           config.BatchTimeout,
+		MaxAttempts:            config.Retries,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		Async:                  true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				log.Printf("Publishing %d events to Kafka failed: %v", len(messages), err)
+			}
+		},
+	}
+	return &Sink{writer: writer, topic: topic}, nil
+}
+
+// Name returns "Kafka".
+func (s *Sink) Name() string { return "Kafka" }
+
+// Publish queues event as a JSON message keyed by its webhook key. The writer is
+// asynchronous, so this doesn't wait for the brokers.
+func (s *Sink) Publish(event hooklab.Event) error {
+	topic, err := s.topic.Render(event)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(context.Background(), kafka.Message{
+		Topic:   topic,
+		Key:     []byte(event.Key),
+		Value:   data,
+		Time:    event.Timestamp,
+		Headers: []kafka.Header{{Key: "Content-Type", Value: []byte("application/json")}},
+	})
+}
+
+// Close sends buffered batches and closes the writer.
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
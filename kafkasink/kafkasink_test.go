@@ -0,0 +1,89 @@
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/hooklabtest"
+	"github.com/essajiwa/hooklab/internal/destination"
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeKafka struct {
+	messages []kafka.Message
+	closed   bool
+}
+
+func (f *fakeKafka) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	f.messages = append(f.messages, messages...)
+	return nil
+}
+
+func (f *fakeKafka) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestSinkPublishesWebhooks(t *testing.T) {
+	topic, err := destination.Parse(DefaultTopic)
+	if err != nil {
+		t.Fatalf("failed to parse topic: %v", err)
+	}
+	writer := &fakeKafka{}
+	sink := &Sink{writer: writer, topic: topic}
+	hooks := hooklabtest.Start(t, hooklab.WithSink(sink))
+
+	for _, url := range []string{hooks.WebhookURL("payments"), hooks.URL + "webhook"} {
+		resp, err := http.Post(url, "application/json", strings.NewReader(`{"amount":500}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The event hooks run after the sinks.
+	hooks.WaitForEvent(t, hooklabtest.Key("default"), time.Second)
+
+	if len(writer.messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(writer.messages))
+	}
+	for i, key := range []string{"payments", "default"} {
+		message := writer.messages[i]
+		var event hooklab.Event
+		if err := json.Unmarshal(message.Value, &event); err != nil {
+			t.Fatalf("failed to decode message: %v", err)
+		}
+		if message.Topic != DefaultTopic || string(message.Key) != key || event.Key != key || !message.Time.Equal(event.Timestamp) {
+			t.Errorf("unexpected message for %s: topic %s key %s event %+v", key, message.Topic, message.Key, event)
+		}
+	}
+
+	sink.Close()
+	if !writer.closed {
+		t.Error("expected closing the sink to close the writer")
+	}
+}
+
+func TestNew(t *testing.T) {
+	config := Config{Brokers: []string{"kafka1:9092", "kafka2:9092"}, Topic: "webhooks.{{.key}}", BatchSize: 10, BatchTimeout: DefaultBatchTimeout, Retries: 3}
+	sink, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	writer := sink.writer.(*kafka.Writer)
+	if writer.BatchSize != 10 || writer.MaxAttempts != 3 || !writer.Async {
+		t.Errorf("unexpected writer config %+v", writer)
+	}
+	writer.Close()
+
+	if _, err := New(Config{Topic: DefaultTopic}); err == nil {
+		t.Error("expected an error without brokers")
+	}
+	if _, err := New(Config{Brokers: config.Brokers, Topic: "{{.key"}); err == nil {
+		t.Error("expected an error for an invalid topic template")
+	}
+}
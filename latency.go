@@ -0,0 +1,238 @@
+package hooklab
+
+// This file contains webhook latency histograms: how long answering each
+// captured webhook took, in total and split into rule evaluation, response
+// rendering, and configured delays, per key. Webhooks whose own processing,
+// not counting configured delays, exceeds -slow-request are logged, to catch
+// pathological rules or templates.
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Latency phases of answering a webhook.
+const (
+	PhaseTotal  = "total"  // From arrival until the handler returned
+	PhaseRules  = "rules"  // Matching tag rules and evaluating response rules
+	PhaseRender = "render" // Evaluating status code expressions and rendering templates
+	PhaseDelay  = "delay"  // Configured delays, holds, chunk pauses, and bandwidth caps
+)
+
+// latencyPhases lists the phases in reporting order.
+var latencyPhases = []string{PhaseTotal, PhaseRules, PhaseRender, PhaseDelay}
+
+// latencyBounds are the upper bounds of the histogram buckets; a last bucket
+// holds everything slower.
+var latencyBounds = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+}
+
+// latencyHistogram counts durations into the latencyBounds buckets.
+type latencyHistogram struct {
+	counts []int // Per bucket, not cumulative; the last is above every bound
+	count  int
+	sum    time.Duration
+	max    time.Duration
+}
+
+// phaseHistograms are a key's latency histograms by phase.
+type phaseHistograms map[string]*latencyHistogram
+
+// LatencyHistogram is a latency histogram as reported by /api/latency.
+type LatencyHistogram struct {
+	Count   int             `json:"count"`
+	AvgMs   float64         `json:"avgMs"`
+	MaxMs   float64         `json:"maxMs"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the durations up to LeMs milliseconds, cumulatively
+// like a Prometheus histogram. The last bucket has no LeMs and counts them all.
+type LatencyBucket struct {
+	LeMs  float64 `json:"leMs,omitempty"`
+	Count int     `json:"count"`
+}
+
+// Latency reports a key's webhook latencies per phase.
+type Latency struct {
+	Key    string                      `json:"key"`
+	Phases map[string]LatencyHistogram `json:"phases"`
+	Slow   int                         `json:"slow"` // Webhooks logged as slow
+}
+
+// webhookTiming accumulates how long each phase of answering a webhook took.
+type webhookTiming struct {
+	phases  map[string]time.Duration
+	eventID int      // Stored event, once there is one
+	matched []string // Rules that matched, for the slow request log
+}
+
+// webhookTimingKey is the context key of a webhook's timing.
+type webhookTimingKey struct{}
+
+// withWebhookTiming returns r with a timing in its context, and that timing.
+func withWebhookTiming(r *http.Request) (*http.Request, *webhookTiming) {
+	timing := &webhookTiming{phases: make(map[string]time.Duration)}
+	return r.WithContext(context.WithValue(r.Context(), webhookTimingKey{}, timing)), timing
+}
+
+// timePhase adds the time since start to phase of the webhook being answered
+// with ctx, if any.
+func timePhase(ctx context.Context, phase string, start time.Time) {
+	if timing, ok := ctx.Value(webhookTimingKey{}).(*webhookTiming); ok {
+		timing.phases[phase] += time.Since(start)
+	}
+}
+
+// injectDelay pauses for a configured delay d like sleepContext, counting it
+// as the webhook's delay phase.
+func injectDelay(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	defer timePhase(ctx, PhaseDelay, time.Now())
+	return sleepContext(ctx, d)
+}
+
+// observe counts d into the histogram.
+func (h *latencyHistogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int, len(latencyBounds)+1)
+	}
+	h.counts[sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// report returns the histogram with cumulative buckets in milliseconds.
+func (h *latencyHistogram) report() LatencyHistogram {
+	report := LatencyHistogram{
+		Count:   h.count,
+		AvgMs:   averageMs(h.sum, h.count),
+		MaxMs:   float64(h.max) / float64(time.Millisecond),
+		Buckets: make([]LatencyBucket, 0, len(latencyBounds)+1),
+	}
+	cumulative := 0
+	for i := range len(latencyBounds) + 1 {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		bucket := LatencyBucket{Count: cumulative}
+		if i < len(latencyBounds) {
+			bucket.LeMs = float64(latencyBounds[i]) / float64(time.Millisecond)
+		}
+		report.Buckets = append(report.Buckets, bucket)
+	}
+	return report
+}
+
+// setSlowRequest sets how long a webhook's processing, not counting configured
+// delays, may take before it is logged as slow; 0 disables the log.
+func (a *App) setSlowRequest(threshold time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.slowRequest = threshold
+}
+
+// recordLatency counts an answered webhook of key into its histograms and
+// logs it if it was slow.
+func (a *App) recordLatency(r *http.Request, key string, timing *webhookTiming, elapsed time.Duration) {
+	a.mu.Lock()
+	phases := a.latency[key]
+	if phases == nil {
+		phases = make(phaseHistograms)
+		for _, phase := range latencyPhases {
+			phases[phase] = &latencyHistogram{}
+		}
+		a.latency[key] = phases
+	}
+	phases[PhaseTotal].observe(elapsed)
+	for _, phase := range latencyPhases[1:] {
+		phases[phase].observe(timing.phases[phase])
+	}
+	delay := timing.phases[PhaseDelay]
+	slow := a.slowRequest > 0 && elapsed-delay > a.slowRequest
+	if slow {
+		a.slowRequests[key]++
+	}
+	a.mu.Unlock()
+
+	if slow {
+		log.Printf("Slow webhook %s %s on key %q (event %d): %v, of which rules %v, render %v, delays %v; matched rules: %s",
+			r.Method, r.URL.Path, key, timing.eventID, elapsed, timing.phases[PhaseRules], timing.phases[PhaseRender], delay,
+			cmp.Or(strings.Join(timing.matched, ","), "none"))
+	}
+}
+
+// latencyReport returns key's latency histograms.
+func (a *App) latencyReport(key string) Latency {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := Latency{Key: key, Phases: make(map[string]LatencyHistogram), Slow: a.slowRequests[key]}
+	for _, phase := range latencyPhases {
+		h := a.latency[key][phase]
+		if h == nil {
+			h = &latencyHistogram{}
+		}
+		report.Phases[phase] = h.report()
+	}
+	return report
+}
+
+// writeLatencyMetrics writes every key's latency histograms and slow webhook
+// counts in the Prometheus text format.
+func (a *App) writeLatencyMetrics(w io.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys := make([]string, 0, len(a.latency))
+	for key := range a.latency {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	const name = "hooklab_webhook_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time spent answering webhooks by key and phase.\n# TYPE %s histogram\n", name, name)
+	for _, key := range keys {
+		for _, phase := range latencyPhases {
+			h := a.latency[key][phase]
+			labels := fmt.Sprintf(`key="%s",phase="%s"`, escapeLabel(key), phase)
+			cumulative := 0
+			for i, bound := range latencyBounds {
+				if h.counts != nil {
+					cumulative += h.counts[i]
+				}
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, labels, bound.Seconds(), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum.Seconds())
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+		}
+	}
+	metric(w, "hooklab_slow_webhooks_total", "counter", "Webhooks logged as slow by webhook key.", "key", a.slowRequests)
+}
+
+// latencyHandler handles GET /api/latency requests, returning the latency
+// histograms of the webhook key in the "key" query parameter.
+func (a *App) latencyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := cmp.Or(r.URL.Query().Get("key"), "default")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.latencyReport(key))
+}
@@ -0,0 +1,112 @@
+package hooklab
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	for _, d := range []time.Duration{500 * time.Microsecond, time.Millisecond, 7 * time.Millisecond, 2 * time.Minute} {
+		h.observe(d)
+	}
+	report := h.report()
+	if report.Count != 4 || report.MaxMs != 120000 {
+		t.Errorf("unexpected histogram %+v", report)
+	}
+	if len(report.Buckets) != len(latencyBounds)+1 {
+		t.Fatalf("expected %d buckets, got %d", len(latencyBounds)+1, len(report.Buckets))
+	}
+	want := map[float64]int{1: 2, 5: 2, 10: 3, 30000: 3, 0: 4}
+	for _, bucket := range report.Buckets {
+		if count, ok := want[bucket.LeMs]; ok && bucket.Count != count {
+			t.Errorf("bucket le %vms: expected %d, got %d", bucket.LeMs, count, bucket.Count)
+		}
+	}
+
+	if empty := (&latencyHistogram{}).report(); empty.Count != 0 || empty.Buckets[len(empty.Buckets)-1].Count != 0 {
+		t.Errorf("unexpected empty histogram %+v", empty)
+	}
+}
+
+func TestWebhookLatencyPhases(t *testing.T) {
+	app := New()
+	app.setResponseConfig("slow", ResponseConfig{StatusCode: http.StatusOK, Response: map[string]string{"ok": "{{.key}}"}, Delay: Duration(30 * time.Millisecond)})
+	app.addRule("slow", Rule{Name: "Big", Condition: "body.amount > 100", Response: map[string]string{"big": "yes"}, Delay: Duration(20 * time.Millisecond), Action: ActionDelay, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/slow", strings.NewReader(`{"amount":5}`)))
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/slow", strings.NewReader(`{"amount":500}`)))
+
+	report := app.latencyReport("slow")
+	for _, phase := range latencyPhases {
+		if report.Phases[phase].Count != 2 {
+			t.Errorf("%s: expected 2 webhooks, got %d", phase, report.Phases[phase].Count)
+		}
+	}
+	delay := report.Phases[PhaseDelay]
+	if delay.MaxMs < 30 || delay.AvgMs < 20 {
+		t.Errorf("expected the configured delays to be measured, got %+v", delay)
+	}
+	if total := report.Phases[PhaseTotal]; total.MaxMs < delay.MaxMs {
+		t.Errorf("expected the total to include the delay, got %+v", total)
+	}
+	if report.Slow != 0 {
+		t.Errorf("expected no slow webhooks without a threshold, got %d", report.Slow)
+	}
+
+	w = httptest.NewRecorder()
+	app.latencyHandler(w, httptest.NewRequest(http.MethodGet, "/api/latency?key=slow", nil))
+	var decoded Latency
+	if err := json.NewDecoder(w.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Key != "slow" || decoded.Phases[PhaseRules].Count != 2 {
+		t.Errorf("unexpected latency response %+v", decoded)
+	}
+
+	w = httptest.NewRecorder()
+	app.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		"# TYPE hooklab_webhook_duration_seconds histogram\n",
+		`hooklab_webhook_duration_seconds_bucket{key="slow",phase="delay",le="0.001"} 0` + "\n",
+		`hooklab_webhook_duration_seconds_bucket{key="slow",phase="delay",le="+Inf"} 2` + "\n",
+		`hooklab_webhook_duration_seconds_count{key="slow",phase="total"} 2` + "\n",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(io.Discard)
+
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{StatusCode: http.StatusOK, Response: map[string]string{"ok": "yes"}, Delay: Duration(50 * time.Millisecond)})
+
+	// Configured delays don't make a webhook slow.
+	app.setSlowRequest(40 * time.Millisecond)
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{}`)))
+	if out.Len() != 0 || app.latencyReport("default").Slow != 0 {
+		t.Errorf("expected a delayed webhook not to be logged as slow, got %q", out.String())
+	}
+
+	app.setSlowRequest(time.Nanosecond)
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{}`)))
+	if line := out.String(); !strings.Contains(line, `Slow webhook POST /webhook on key "default" (event 2)`) || !strings.Contains(line, "matched rules: none") {
+		t.Errorf("unexpected slow request log %q", line)
+	}
+	if slow := app.latencyReport("default").Slow; slow != 1 {
+		t.Errorf("expected 1 slow webhook, got %d", slow)
+	}
+}
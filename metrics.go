@@ -0,0 +1,67 @@
+package hooklab
+
+// This file contains the /metrics endpoint, exposing the /api/stats counters
+// in the Prometheus text format so dashboards missing events or refused
+// webhooks can be alerted on.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// metric writes a metric family: its help and type lines, then a sample per
+// value, labeled with label and the value's key. Without a label, the value
+// keyed "" is the only sample.
+func metric(w io.Writer, name, kind, help, label string, values map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	if label == "" {
+		fmt.Fprintf(w, "%s %d\n", name, values[""])
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(key), values[key])
+	}
+}
+
+// escapeLabel escapes a label value for the Prometheus text format.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// metricsHandler handles GET /metrics requests.
+func (a *App) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stream := a.streamStats()
+	rejected := a.rejectionStats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metric(w, "hooklab_stream_subscribers", "gauge", "Open SSE streams.", "", map[string]int{"": stream.Subscribers})
+	metric(w, "hooklab_stream_lagging_subscribers", "gauge", "Open SSE streams that have had messages dropped.", "", map[string]int{"": stream.Lagging})
+	metric(w, "hooklab_stream_pending_messages", "gauge", "Messages waiting to be sent to the most backed-up SSE stream.", "", map[string]int{"": maxPending(stream)})
+	metric(w, "hooklab_stream_broadcasts_total", "counter", "Events and notices broadcast to SSE streams.", "", map[string]int{"": stream.Broadcasts})
+	metric(w, "hooklab_stream_delivered_total", "counter", "Messages queued for SSE streams.", "", map[string]int{"": stream.Delivered})
+	metric(w, "hooklab_stream_dropped_total", "counter", "Messages dropped because an SSE stream fell behind.", "", map[string]int{"": stream.Dropped})
+	metric(w, "hooklab_rejected_webhooks_total", "counter", "Refused webhooks by cause.", "cause", rejected.Causes)
+	metric(w, "hooklab_rejected_webhooks_by_key_total", "counter", "Refused webhooks by webhook key.", "key", rejected.Keys)
+	a.writeLatencyMetrics(w)
+}
+
+// maxPending returns the most messages any stream is waiting to be sent.
+func maxPending(stats StreamStats) int {
+	pending := 0
+	for _, stream := range stats.Streams {
+		pending = max(pending, stream.Pending)
+	}
+	return pending
+}
@@ -0,0 +1,44 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	app := New(WithStreamBuffer(1))
+	subscriber := app.addSubscriber()
+	defer app.removeSubscriber(subscriber)
+	app.broadcastEvent(Event{ID: 1, Key: "github"})
+	app.broadcastEvent(Event{ID: 2, Key: "github"})
+	app.countRejection(`pay"ments`, RejectIP)
+
+	w := httptest.NewRecorder()
+	app.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE hooklab_stream_subscribers gauge\nhooklab_stream_subscribers 1\n",
+		"hooklab_stream_lagging_subscribers 1\n",
+		"hooklab_stream_pending_messages 1\n",
+		"# TYPE hooklab_stream_broadcasts_total counter\nhooklab_stream_broadcasts_total 2\n",
+		"hooklab_stream_delivered_total 1\n",
+		"hooklab_stream_dropped_total 1\n",
+		`hooklab_rejected_webhooks_total{cause="ip"} 1` + "\n",
+		`hooklab_rejected_webhooks_by_key_total{key="pay\"ments"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.metricsHandler(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package mqttsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/hooklabtest"
+	"github.com/essajiwa/hooklab/internal/destination"
+)
+
+// doneToken is an mqtt.Token that has already completed.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (doneToken) Error() error { return nil }
+
+type fakeMQTT struct {
+	topics       []string
+	qos          []byte
+	payloads     [][]byte
+	disconnected bool
+}
+
+func (f *fakeMQTT) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	f.topics = append(f.topics, topic)
+	f.qos = append(f.qos, qos)
+	f.payloads = append(f.payloads, payload.([]byte))
+	return doneToken{}
+}
+
+func (f *fakeMQTT) Disconnect(quiesce uint) {
+	f.disconnected = true
+}
+
+func TestSinkPublishesWebhooks(t *testing.T) {
+	topic, err := destination.Parse(DefaultTopic)
+	if err != nil {
+		t.Fatalf("failed to parse topic: %v", err)
+	}
+	client := &fakeMQTT{}
+	sink := &Sink{client: client, topic: topic, qos: 1}
+	hooks := hooklabtest.Start(t, hooklab.WithSink(sink))
+
+	for _, key := range []string{"doorbell", "a+b#c"} {
+		resp, err := http.Post(hooks.WebhookURL(key), "application/json", strings.NewReader(`{"pressed":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The event hooks run after the sinks.
+	hooks.WaitForEvent(t, hooklabtest.Key("a+b#c"), time.Second)
+
+	if got := strings.Join(client.topics, ","); got != "hooklab/doorbell,hooklab/a_b_c" {
+		t.Fatalf("unexpected topics %s", got)
+	}
+	var event hooklab.Event
+	if err := json.Unmarshal(client.payloads[0], &event); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if event.Key != "doorbell" || event.Body != `{"pressed":true}` || client.qos[0] != 1 {
+		t.Errorf("unexpected message: qos %d event %+v", client.qos[0], event)
+	}
+
+	sink.Close()
+	if !client.disconnected {
+		t.Error("expected closing the sink to disconnect")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for _, qos := range []int{-1, 3} {
+		if _, err := New("tcp://localhost:1883", DefaultTopic, qos); err == nil || !strings.Contains(err.Error(), "QoS") {
+			t.Errorf("QoS %d: expected a QoS error, got %v", qos, err)
+		}
+	}
+	if _, err := New("tcp://localhost:1883", "hooklab/{{.key", DefaultQoS); err == nil || !strings.Contains(err.Error(), "topic") {
+		t.Errorf("expected a topic template error, got %v", err)
+	}
+}
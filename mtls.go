@@ -0,0 +1,183 @@
+package hooklab
+
+// This file contains mutual TLS: the HTTPS listener can request or require client
+// certificates, verified against -client-ca, for testing mTLS-secured webhook
+// producers. The presented chain is stored on each event and exposed to rules as
+// the cert variable.
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Client certificate modes of -client-auth.
+const (
+	ClientAuthNone             = "none"               // Don't ask for a certificate (default)
+	ClientAuthRequest          = "request"            // Ask for a certificate, accept any or none
+	ClientAuthRequire          = "require"            // Require a certificate, without verifying it
+	ClientAuthVerifyIfGiven    = "verify-if-given"    // Verify a certificate if one is presented
+	ClientAuthRequireAndVerify = "require-and-verify" // Require a certificate signed by -client-ca
+)
+
+// clientAuthTypes maps -client-auth modes to their TLS client auth policy.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:             tls.NoClientCert,
+	ClientAuthRequest:          tls.RequestClientCert,
+	ClientAuthRequire:          tls.RequireAnyClientCert,
+	ClientAuthVerifyIfGiven:    tls.VerifyClientCertIfGiven,
+	ClientAuthRequireAndVerify: tls.RequireAndVerifyClientCert,
+}
+
+// ClientCert describes one certificate of a client's chain.
+type ClientCert struct {
+	Subject        string    `json:"subject"`                  // Distinguished name, e.g. "CN=billing,O=Acme"
+	CommonName     string    `json:"commonName,omitempty"`     // Subject common name
+	Issuer         string    `json:"issuer"`                   // Issuer distinguished name
+	SerialNumber   string    `json:"serialNumber"`             // Serial number in hex
+	DNSNames       []string  `json:"dnsNames,omitempty"`       // DNS subject alternative names
+	EmailAddresses []string  `json:"emailAddresses,omitempty"` // Email subject alternative names
+	URIs           []string  `json:"uris,omitempty"`           // URI subject alternative names, e.g. SPIFFE IDs
+	NotBefore      time.Time `json:"notBefore"`
+	NotAfter       time.Time `json:"notAfter"`
+	Fingerprint    string    `json:"fingerprint"` // Hex SHA-256 of the DER certificate
+}
+
+// ClientCertInfo is the certificate chain a client presented, leaf first.
+type ClientCertInfo struct {
+	Verified bool         `json:"verified"` // Whether the chain was verified against -client-ca
+	Chain    []ClientCert `json:"chain"`
+}
+
+// applyClientAuth makes the listener with config ask for client certificates as
+// mode says, verifying them against the PEM certificates in caFile. Verifying
+// modes require caFile.
+func applyClientAuth(config *tls.Config, mode, caFile string) error {
+	authType, ok := clientAuthTypes[mode]
+	if !ok {
+		return fmt.Errorf("unknown -client-auth %q, want none, request, require, verify-if-given, or require-and-verify", mode)
+	}
+	if authType == tls.NoClientCert {
+		if caFile != "" {
+			return errors.New("-client-ca needs a -client-auth mode")
+		}
+		return nil
+	}
+	if config == nil {
+		return errors.New("-client-auth needs HTTPS: set -tls-cert and -tls-key, or -domain")
+	}
+	if caFile == "" && (authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert) {
+		return errors.New("-client-auth " + mode + " needs -client-ca")
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New(caFile + ": no PEM certificates")
+		}
+		config.ClientCAs = pool
+	}
+	config.ClientAuth = authType
+
+	// ACME TLS-ALPN-01 validation connects without a client certificate.
+	if slices.Contains(config.NextProtos, acme.ALPNProto) {
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if !slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+				return nil, nil
+			}
+			challenge := config.Clone()
+			challenge.ClientAuth = tls.NoClientCert
+			challenge.GetConfigForClient = nil
+			return challenge, nil
+		}
+	}
+	return nil
+}
+
+// clientCertInfo returns the client certificate chain of a connection, or nil if
+// the client presented none.
+func clientCertInfo(state *tls.ConnectionState) *ClientCertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	info := &ClientCertInfo{Verified: len(state.VerifiedChains) > 0}
+	for _, cert := range state.PeerCertificates {
+		fingerprint := sha256.Sum256(cert.Raw)
+		uris := make([]string, 0, len(cert.URIs))
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		info.Chain = append(info.Chain, ClientCert{
+			Subject:        cert.Subject.String(),
+			CommonName:     cert.Subject.CommonName,
+			Issuer:         cert.Issuer.String(),
+			SerialNumber:   cert.SerialNumber.Text(16),
+			DNSNames:       cert.DNSNames,
+			EmailAddresses: cert.EmailAddresses,
+			URIs:           uris,
+			NotBefore:      cert.NotBefore,
+			NotAfter:       cert.NotAfter,
+			Fingerprint:    hex.EncodeToString(fingerprint[:]),
+		})
+	}
+	return info
+}
+
+// clientCertEnv returns the cert expression variable for info: whether a
+// certificate was presented and verified, the leaf's fields, and the whole chain.
+// Without a certificate, present is false and the fields are empty.
+func clientCertEnv(info *ClientCertInfo) map[string]interface{} {
+	env := certFieldsEnv(ClientCert{})
+	env["present"] = false
+	env["verified"] = false
+	env["chain"] = []interface{}{}
+	if info == nil || len(info.Chain) == 0 {
+		return env
+	}
+
+	env = certFieldsEnv(info.Chain[0])
+	env["present"] = true
+	env["verified"] = info.Verified
+	chain := make([]interface{}, 0, len(info.Chain))
+	for _, cert := range info.Chain {
+		chain = append(chain, certFieldsEnv(cert))
+	}
+	env["chain"] = chain
+	return env
+}
+
+// certFieldsEnv returns the expression fields of one certificate.
+func certFieldsEnv(cert ClientCert) map[string]interface{} {
+	return map[string]interface{}{
+		"subject":        cert.Subject,
+		"commonName":     cert.CommonName,
+		"issuer":         cert.Issuer,
+		"serialNumber":   cert.SerialNumber,
+		"dnsNames":       stringsOrEmpty(cert.DNSNames),
+		"emailAddresses": stringsOrEmpty(cert.EmailAddresses),
+		"uris":           stringsOrEmpty(cert.URIs),
+		"notBefore":      cert.NotBefore,
+		"notAfter":       cert.NotAfter,
+		"fingerprint":    cert.Fingerprint,
+	}
+}
+
+// stringsOrEmpty returns values, or an empty slice for nil so expressions such
+// as `"a" in cert.dnsNames` work without a certificate.
+func stringsOrEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,206 @@
+package hooklab
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClientCA is a CA issuing client certificates in tests.
+type testClientCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestClientCA creates a CA and writes its certificate to dir, returning the
+// CA and the file's path.
+func newTestClientCA(t *testing.T, dir string) (*testClientCA, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "hooklab test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testClientCA{cert: cert, key: key}, caFile
+}
+
+// issue returns a client certificate for commonName signed by the CA.
+func (ca *testClientCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0xbeef),
+		Subject:        pkix.Name{CommonName: commonName, Organization: []string{"Acme"}},
+		EmailAddresses: []string{"billing@example.com"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}
+}
+
+func TestApplyClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	_, caFile := newTestClientCA(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyClientAuth(nil, ClientAuthNone, ""); err != nil {
+		t.Errorf("expected no client auth to need nothing, got %v", err)
+	}
+	tests := []struct {
+		name   string
+		config *tls.Config
+		mode   string
+		caFile string
+	}{
+		{"unknown mode", &tls.Config{}, "always", ""},
+		{"plain HTTP", nil, ClientAuthRequire, ""},
+		{"CA without mode", &tls.Config{}, ClientAuthNone, caFile},
+		{"verify without CA", &tls.Config{}, ClientAuthRequireAndVerify, ""},
+		{"missing CA", &tls.Config{}, ClientAuthVerifyIfGiven, filepath.Join(dir, "missing.pem")},
+		{"CA without certificates", &tls.Config{}, ClientAuthRequireAndVerify, notPEM},
+	}
+	for _, tt := range tests {
+		if err := applyClientAuth(tt.config, tt.mode, tt.caFile); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	config := &tls.Config{}
+	if err := applyClientAuth(config, ClientAuthRequireAndVerify, caFile); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil || config.GetConfigForClient != nil {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestApplyClientAuthACMEChallenge(t *testing.T) {
+	_, caFile := newTestClientCA(t, t.TempDir())
+	manager, err := newACMEManager([]string{"hooks.example.com"}, t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := acmeTLSConfig(manager)
+	if err := applyClientAuth(config, ClientAuthRequireAndVerify, caFile); err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := config.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{"acme-tls/1"}})
+	if err != nil || challenge == nil || challenge.ClientAuth != tls.NoClientCert {
+		t.Errorf("expected ACME challenges to skip client certificates, got %+v, %v", challenge, err)
+	}
+	if other, err := config.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{"h2"}}); other != nil || err != nil {
+		t.Errorf("expected other clients to keep the config, got %+v, %v", other, err)
+	}
+}
+
+func TestWebhookHandlerClientCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, serverCert := writeTestCert(t, dir)
+	ca, caFile := newTestClientCA(t, dir)
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyClientAuth(config, ClientAuthRequireAndVerify, caFile); err != nil {
+		t.Fatal(err)
+	}
+
+	app := New()
+	app.addRule("billing", Rule{Condition: `cert.verified && cert.commonName == "billing" && "billing@example.com" in cert.emailAddresses && len(cert.chain) == 2`, Action: ActionTag, Tags: []string{"trusted"}, Enabled: true})
+	server, err := newServer(app, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TLSConfig = config
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+	post := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		return client.Post("https://"+listener.Addr().String()+"/webhook/billing", "application/json", nil)
+	}
+
+	if resp, err := post(); err == nil {
+		resp.Body.Close()
+		t.Error("expected a client without a certificate to be refused")
+	}
+
+	resp, err := post(ca.issue(t, "billing"))
+	if err != nil {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+	resp.Body.Close()
+	event, ok := app.getEvent(1)
+	if !ok || event.ClientCert == nil {
+		t.Fatalf("expected the client certificate on the event, got %+v", event)
+	}
+	leaf := event.ClientCert.Chain[0]
+	if !event.ClientCert.Verified || len(event.ClientCert.Chain) != 2 || leaf.CommonName != "billing" || leaf.SerialNumber != "beef" || len(leaf.Fingerprint) != 64 {
+		t.Errorf("unexpected client certificate %+v", event.ClientCert)
+	}
+	if len(event.Tags) != 1 || event.Tags[0] != "trusted" {
+		t.Errorf("expected rules to see the certificate, got tags %v", event.Tags)
+	}
+	if env := eventEnv(event); env["cert"].(map[string]interface{})["subject"] != "CN=billing,O=Acme" {
+		t.Errorf("expected stored events to expose the certificate, got %v", env["cert"])
+	}
+}
+
+func TestClientCertEnvWithoutCert(t *testing.T) {
+	env := validationEnv()
+	for _, condition := range []string{`!cert.present`, `!cert.verified && cert.commonName == ""`, `!("a" in cert.dnsNames) && len(cert.chain) == 0`} {
+		if matched, err := conditionMatches(condition, env); err != nil || !matched {
+			t.Errorf("%s: expected true without a certificate, got %v, %v", condition, matched, err)
+		}
+	}
+}
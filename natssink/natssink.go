@@ -0,0 +1,81 @@
+// Package natssink is the NATS sink, which publishes every webhook hooklab
+// captures as JSON to a subject derived from its key, e.g. "hooklab.payments":
+//
+//	sink, err := natssink.New("nats://localhost:4222", natssink.DefaultSubject)
+//	...
+//	app := hooklab.New(hooklab.WithSink(sink))
+package natssink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/internal/destination"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubject is the subject template used when -nats-subject is not set.
+const DefaultSubject = "hooklab.{{.key}}"
+
+// publisher is the part of *nats.Conn the sink uses, so tests can fake it.
+type publisher interface {
+	Publish(subject string, data []byte) error
+	Drain() error
+}
+
+// Sink publishes events to NATS subjects rendered from a template.
+type Sink struct {
+	conn    publisher
+	subject *destination.Template
+}
+
+// New connects to the NATS server at url and returns a sink publishing to
+// subjects rendered from subjectTemplate, which can reference .key and
+// .method. The client reconnects on its own when the connection drops.
+func New(url, subjectTemplate string) (*Sink, error) {
+	subject, err := destination.Parse(subjectTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	conn, err := nats.Connect(url, nats.Name("hooklab"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{conn: conn, subject: subject}, nil
+}
+
+// Name returns "NATS".
+func (s *Sink) Name() string { return "NATS" }
+
+// Publish sends event as JSON. NATS buffers outgoing messages, so this doesn't
+// wait for the server.
+func (s *Sink) Publish(event hooklab.Event) error {
+	subject, err := s.subject.Render(event)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.conn.Publish(safeSubject(subject), data)
+}
+
+// Close flushes buffered messages and closes the connection.
+func (s *Sink) Close() error {
+	return s.conn.Drain()
+}
+
+// safeSubject makes subject valid for publishing: whitespace, which NATS does
+// not allow, and the wildcard tokens "*" and ">" are replaced with "_".
+func safeSubject(subject string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '*', '>':
+			return '_'
+		}
+		return r
+	}, subject)
+}
@@ -0,0 +1,82 @@
+package natssink
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/hooklabtest"
+	"github.com/essajiwa/hooklab/internal/destination"
+)
+
+type fakeNATS struct {
+	subjects []string
+	events   []hooklab.Event
+	drained  bool
+}
+
+func (f *fakeNATS) Publish(subject string, data []byte) error {
+	var event hooklab.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	f.subjects = append(f.subjects, subject)
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeNATS) Drain() error {
+	f.drained = true
+	return nil
+}
+
+func TestSinkPublishesWebhooks(t *testing.T) {
+	subject, err := destination.Parse("hooks.{{.key}}.{{.method}}")
+	if err != nil {
+		t.Fatalf("failed to parse subject: %v", err)
+	}
+	conn := &fakeNATS{}
+	sink := &Sink{conn: conn, subject: subject}
+	hooks := hooklabtest.Start(t, hooklab.WithSink(sink))
+	send := func(method, url, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	var rule hooklab.Rule
+	resp := send(http.MethodPost, hooks.URL+"api/rules?key=payments", `{"condition":"body.amount > 100","statusCode":202,"enabled":true}`)
+	if err := json.NewDecoder(resp.Body).Decode(&rule); err != nil {
+		t.Fatalf("creating the rule: %s, %v", resp.Status, err)
+	}
+
+	send(http.MethodPost, hooks.WebhookURL("payments"), `{"amount":500}`)
+	send(http.MethodPut, hooks.WebhookURL("my orders"), `{}`)
+	// The event hooks run after the sinks.
+	hooks.WaitForEvent(t, hooklabtest.Key("my orders"), time.Second)
+
+	if got := strings.Join(conn.subjects, ","); got != "hooks.payments.POST,hooks.my_orders.PUT" {
+		t.Fatalf("unexpected subjects %s", got)
+	}
+	if event := conn.events[0]; event.ID != 1 || event.Body != `{"amount":500}` || len(event.MatchedRules) != 1 || event.MatchedRules[0] != rule.ID {
+		t.Errorf("expected the published event to include the rule outcome, got %+v", event)
+	}
+
+	sink.Close()
+	if !conn.drained {
+		t.Error("expected closing the sink to drain the connection")
+	}
+}
+
+func TestNewInvalidSubject(t *testing.T) {
+	if _, err := New("nats://localhost:4222", "hooklab.{{.key"); err == nil || !strings.Contains(err.Error(), "subject") {
+		t.Errorf("expected a subject template error, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package hooklab
+
+// This file contains Accept header parsing for content negotiation between the
+// representations configured for a webhook key.
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a single media range from an Accept header with its quality.
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept parses an Accept header into media ranges ordered by preference:
+// higher quality first, then more specific ranges, then header order.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+	return ranges
+}
+
+// specificity ranks media ranges: "type/subtype" over "type/*" over "*/*".
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// negotiateMediaType picks the configured representation that best matches the
+// Accept header. It returns "" when JSON should be used: the header is empty,
+// prefers application/json, or matches no representation.
+func negotiateMediaType(accept string, representations map[string]string) string {
+	if accept == "" {
+		return ""
+	}
+
+	available := make([]string, 0, len(representations))
+	for mediaType := range representations {
+		available = append(available, mediaType)
+	}
+	sort.Strings(available)
+
+	for _, r := range parseAccept(accept) {
+		if matchesMediaRange(r.mediaType, "application/json") {
+			return ""
+		}
+		for _, mediaType := range available {
+			base, _, err := mime.ParseMediaType(mediaType)
+			if err == nil && matchesMediaRange(r.mediaType, base) {
+				return mediaType
+			}
+		}
+	}
+	return ""
+}
+
+// matchesMediaRange reports whether mediaType falls within the media range.
+func matchesMediaRange(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
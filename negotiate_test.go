@@ -0,0 +1,88 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	representations := map[string]string{
+		"application/xml":           "<ok/>",
+		"text/plain; charset=utf-8": "ok",
+	}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"*/*", ""},
+		{"application/json", ""},
+		{"application/xml", "application/xml"},
+		{"text/*", "text/plain; charset=utf-8"},
+		{"application/json;q=0.5, application/xml", "application/xml"},
+		{"application/xml;q=0.2, application/json;q=0.8", ""},
+		{"application/xml;q=0, text/plain", "text/plain; charset=utf-8"},
+		{"image/png", ""},
+		{"not a media type, application/xml", "application/xml"},
+	}
+	for _, tt := range tests {
+		if got := negotiateMediaType(tt.accept, representations); got != tt.want {
+			t.Errorf("negotiateMediaType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookHandlerContentNegotiation(t *testing.T) {
+	app := New()
+	app.setResponseConfig("legacy", ResponseConfig{
+		Response:   map[string]interface{}{"status": "{{.body.id}}"},
+		StatusCode: http.StatusOK,
+		Representations: map[string]string{
+			"application/xml": "<status>{{.body.id}}</status>",
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/legacy", strings.NewReader(`{"id":"ok"}`))
+	req.Header.Set("Accept", "application/xml")
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, req)
+
+	if ct := res.Header().Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("expected XML content type, got %q", ct)
+	}
+	if res.Header().Get("Vary") != "Accept" {
+		t.Errorf("expected Vary: Accept, got %q", res.Header().Get("Vary"))
+	}
+	if res.Body.String() != "<status>ok</status>" {
+		t.Errorf("unexpected XML body: %q", res.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhook/legacy", strings.NewReader(`{"id":"ok"}`))
+	res = httptest.NewRecorder()
+	app.webhookHandler(res, req)
+
+	if ct := res.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON by default, got %q", ct)
+	}
+	if strings.TrimSpace(res.Body.String()) != `{"status":"ok"}` {
+		t.Errorf("unexpected JSON body: %q", res.Body.String())
+	}
+}
+
+func TestResponseHandlerPostInvalidRepresentation(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"representations":{"text/*":"ok"}}`,
+		`{"representations":{"application/xml":"{{.body"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, res.Code)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package hooklab
+
+// This file contains notifiers: URLs registered through the API that receive a
+// POST whenever a webhook is captured, optionally only for one key or for events
+// matching a condition. Failed deliveries are retried with backoff, and every
+// attempt is kept in a per-notifier delivery log.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Notifier delivery limits.
+const (
+	defaultNotifierAttempts = 3
+	maxNotifierAttempts     = 10
+	maxNotifierDeliveries   = 50 // delivery log entries kept per notifier
+)
+
+// notifierRetryDelay is the wait before the first retry; it doubles after each
+// further failure.
+var notifierRetryDelay = time.Second
+
+// Notifier POSTs captured events to URL.
+type Notifier struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	URL       string    `json:"url"`                 // Absolute http(s) URL receiving the events
+	Key       string    `json:"key,omitempty"`       // Only events of this webhook key; empty for every key
+	Condition string    `json:"condition,omitempty"` // Only events for which this rule expression is true
+	Attempts  int       `json:"attempts,omitempty"`  // Delivery attempts before giving up (default 3)
+	Format    string    `json:"format,omitempty"`    // Body format: json (default), slack, or discord
+	Fields    []string  `json:"fields,omitempty"`    // Expressions shown in slack and discord messages, e.g. "body.amount"
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NotifierPayload is the JSON body POSTed to a notifier with the json format.
+type NotifierPayload struct {
+	NotifierID string `json:"notifierId"`
+	Event      Event  `json:"event"`
+}
+
+// NotifierDelivery records one attempt to deliver an event or alert to a notifier.
+type NotifierDelivery struct {
+	EventID    int       `json:"eventId,omitempty"`
+	AlertID    string    `json:"alertId,omitempty"` // Alert rule whose state change was delivered, instead of an event
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"` // Response status, if any
+	Error      string    `json:"error,omitempty"`
+	Duration   Duration  `json:"duration"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// validate checks the notifier URL, condition, attempts, and format.
+func (n Notifier) validate() error {
+	if err := validateTarget(n.URL); err != nil {
+		return errors.New("url: " + err.Error())
+	}
+	if n.Condition != "" {
+		if _, err := compileExpression(n.Condition, validationEnv(), true); err != nil {
+			return fmt.Errorf("condition: %w", err)
+		}
+	}
+	if n.Attempts < 0 || n.Attempts > maxNotifierAttempts {
+		return errors.New("attempts: must be between 0 (default " + strconv.Itoa(defaultNotifierAttempts) + ") and " + strconv.Itoa(maxNotifierAttempts))
+	}
+	return n.validateFormat()
+}
+
+// matches reports whether event should be delivered to the notifier.
+func (n Notifier) matches(event Event) bool {
+	if !n.Enabled || (n.Key != "" && n.Key != event.Key) {
+		return false
+	}
+	if n.Condition == "" {
+		return true
+	}
+	matched, err := conditionMatches(n.Condition, eventEnv(event))
+	return err == nil && matched
+}
+
+// addNotifier stores a new notifier and returns it with its ID.
+func (a *App) addNotifier(notifier Notifier) Notifier {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.notifierLastID++
+	notifier.ID = fmt.Sprintf("notifier_%d", a.notifierLastID)
+	notifier.CreatedAt = a.now()
+	a.notifiers = append(a.notifiers, notifier)
+	return notifier
+}
+
+// getNotifiers returns every notifier in creation order.
+func (a *App) getNotifiers() []Notifier {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Notifier{}, a.notifiers...)
+}
+
+// deleteNotifier removes a notifier and its delivery log, reporting whether it existed.
+func (a *App) deleteNotifier(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, notifier := range a.notifiers {
+		if notifier.ID == id {
+			a.notifiers = append(a.notifiers[:i], a.notifiers[i+1:]...)
+			delete(a.deliveries, id)
+			return true
+		}
+	}
+	return false
+}
+
+// notifierDeliveries returns the delivery log of a notifier, newest first, and
+// whether the notifier exists.
+func (a *App) notifierDeliveries(id string) ([]NotifierDelivery, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, notifier := range a.notifiers {
+		if notifier.ID == id {
+			return append([]NotifierDelivery{}, a.deliveries[id]...), true
+		}
+	}
+	return nil, false
+}
+
+// recordDelivery adds an attempt to the front of a notifier's delivery log,
+// keeping the newest maxNotifierDeliveries.
+func (a *App) recordDelivery(id string, delivery NotifierDelivery) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := append([]NotifierDelivery{delivery}, a.deliveries[id]...)
+	if len(entries) > maxNotifierDeliveries {
+		entries = entries[:maxNotifierDeliveries]
+	}
+	a.deliveries[id] = entries
+}
+
+// dispatchNotifiers delivers event in the background to every notifier it matches.
+func (a *App) dispatchNotifiers(event Event) {
+	for _, notifier := range a.getNotifiers() {
+		if notifier.matches(event) {
+			a.deliverToNotifier(notifier, event)
+		}
+	}
+}
+
+// deliverToNotifier POSTs event to notifier in the background.
+func (a *App) deliverToNotifier(notifier Notifier, event Event) {
+	body, err := notifier.payload(event)
+	if err != nil {
+		return
+	}
+	a.postToNotifier(notifier, body, NotifierDelivery{EventID: event.ID})
+}
+
+// postToNotifier POSTs body to notifier in the background, retrying network
+// errors, 429s, and 5xx responses with exponential backoff until the notifier's
+// attempts run out or the server shuts down. Each attempt is logged as a copy
+// of base, which says what was delivered.
+func (a *App) postToNotifier(notifier Notifier, body []byte, base NotifierDelivery) {
+	attempts := notifier.Attempts
+	if attempts == 0 {
+		attempts = defaultNotifierAttempts
+	}
+	shutdown := a.shutdownSignal()
+	done := a.startForward()
+
+	go func() {
+		defer done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		delay := notifierRetryDelay
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if attempt > 1 {
+				if !sleepContext(ctx, delay) {
+					return
+				}
+				delay *= 2
+			}
+			delivery := postNotification(ctx, notifier.URL, body, base, attempt)
+			a.recordDelivery(notifier.ID, delivery)
+			if !delivery.retryable() {
+				return
+			}
+		}
+	}()
+}
+
+// postNotification makes one delivery attempt and records its outcome on a
+// copy of base.
+func postNotification(ctx context.Context, target string, body []byte, base NotifierDelivery, attempt int) (delivery NotifierDelivery) {
+	delivery = base
+	delivery.Attempt, delivery.Timestamp = attempt, time.Now()
+	defer func() { delivery.Duration = Duration(time.Since(delivery.Timestamp)) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if delivery.AlertID != "" {
+		req.Header.Set("X-Hooklab-Alert-Id", delivery.AlertID)
+	} else {
+		req.Header.Set("X-Hooklab-Event-Id", strconv.Itoa(delivery.EventID))
+	}
+	req.Header.Set("X-Hooklab-Delivery-Attempt", strconv.Itoa(attempt))
+
+	resp, err := forwardClient.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		delivery.Error = "status " + strconv.Itoa(resp.StatusCode)
+	}
+	return delivery
+}
+
+// retryable reports whether a failed attempt is worth retrying: the request
+// failed without a response, or the response was a 429 or 5xx.
+func (d NotifierDelivery) retryable() bool {
+	if d.StatusCode == 0 {
+		return d.Error != ""
+	}
+	return d.StatusCode == http.StatusTooManyRequests || d.StatusCode >= http.StatusInternalServerError
+}
+
+// notifiersHandler handles /api/notifiers requests:
+//   - GET: list notifiers
+//   - POST: register a notifier; returns it with its ID (201)
+//   - DELETE ?id={id}: remove a notifier
+func (a *App) notifiersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		notifiers := a.getNotifiers()
+		// Only admins, who manage notifiers, see their full URLs.
+		if !hasRole(r, RoleAdmin) {
+			for i, notifier := range notifiers {
+				notifiers[i] = notifier.redacted()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"notifiers": notifiers,
+		}); err != nil {
+			http.Error(w, "Error creating response", http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		// Notifiers are enabled unless the request says otherwise.
+		notifier := Notifier{Enabled: true}
+		if err := json.Unmarshal(body, &notifier); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := notifier.validate(); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		notifier = a.addNotifier(notifier)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(notifier)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Notifier ID required", http.StatusBadRequest)
+			return
+		}
+		if !a.deleteNotifier(id) {
+			http.Error(w, "Notifier not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// notifierDeliveriesHandler handles GET /api/notifiers/deliveries?id={id},
+// returning the notifier's recent delivery attempts, newest first.
+func (a *App) notifierDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	deliveries, ok := a.notifierDeliveries(id)
+	if !ok {
+		http.Error(w, "Notifier not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         id,
+		"deliveries": deliveries,
+	}); err != nil {
+		http.Error(w, "Error creating response", http.StatusInternalServerError)
+	}
+}
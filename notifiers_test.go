@@ -0,0 +1,151 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotifiersHandler(t *testing.T) {
+	app := New()
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.notifiersHandler(w, httptest.NewRequest(http.MethodPost, "/api/notifiers", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"url":"https://ci.example.com/hooks","key":"payments","condition":"body.amount > 100"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var notifier Notifier
+	if err := json.Unmarshal(w.Body.Bytes(), &notifier); err != nil {
+		t.Fatalf("failed to decode notifier: %v", err)
+	}
+	if notifier.ID != "notifier_1" || !notifier.Enabled || notifier.Key != "payments" || notifier.CreatedAt.IsZero() {
+		t.Errorf("unexpected notifier %+v", notifier)
+	}
+
+	for body, field := range map[string]string{
+		`{"url":"ftp://example.com"}`:                         "url",
+		`{"url":"https://example.com","condition":"body. >"}`: "condition",
+		`{"url":"https://example.com","attempts":11}`:         "attempts",
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"error":"`+field) {
+			t.Errorf("%s: expected a %s error, got %d %s", body, field, w.Code, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.notifiersHandler(w, httptest.NewRequest(http.MethodGet, "/api/notifiers", nil))
+	var list struct {
+		Notifiers []Notifier `json:"notifiers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Notifiers) != 1 {
+		t.Fatalf("expected 1 notifier, got %s", w.Body.String())
+	}
+
+	for target, want := range map[string]int{
+		"/api/notifiers":               http.StatusBadRequest,
+		"/api/notifiers?id=notifier_9": http.StatusNotFound,
+		"/api/notifiers?id=notifier_1": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		app.notifiersHandler(w, httptest.NewRequest(http.MethodDelete, target, nil))
+		if w.Code != want {
+			t.Errorf("DELETE %s: expected status %d, got %d", target, want, w.Code)
+		}
+	}
+	if notifiers := app.getNotifiers(); len(notifiers) != 0 {
+		t.Errorf("expected the notifier to be deleted, got %+v", notifiers)
+	}
+}
+
+func TestNotifierDeliveryRetries(t *testing.T) {
+	defer func(delay time.Duration) { notifierRetryDelay = delay }(notifierRetryDelay)
+	notifierRetryDelay = 10 * time.Millisecond
+
+	var calls atomic.Int32
+	payloads := make(chan NotifierPayload, 8)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload NotifierPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	app := New()
+	notifier := app.addNotifier(Notifier{URL: flaky.URL, Key: "payments", Condition: "body.amount > 100", Enabled: true})
+	rejected := app.addNotifier(Notifier{URL: rejecting.URL, Attempts: 5, Enabled: true})
+	app.addNotifier(Notifier{URL: flaky.URL, Enabled: false})
+
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":500}`)))
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":5}`)))
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":500}`)))
+
+	for range 3 {
+		select {
+		case payload := <-payloads:
+			if payload.NotifierID != notifier.ID || payload.Event.ID != 3 || payload.Event.Body != `{"amount":500}` {
+				t.Errorf("unexpected payload %+v", payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for deliveries")
+		}
+	}
+
+	deliveries := waitForDeliveries(t, app, notifier.ID, 3)
+	for i, want := range []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		if d := deliveries[i]; d.Attempt != 3-i || d.StatusCode != want || d.EventID != 3 {
+			t.Errorf("delivery %d: expected attempt %d with status %d, got %+v", i, 3-i, want, d)
+		}
+	}
+	if deliveries[1].Error != "status 503" || deliveries[0].Error != "" {
+		t.Errorf("unexpected delivery errors %+v", deliveries)
+	}
+
+	// Client errors aren't retried.
+	waitForDeliveries(t, app, rejected.ID, 3)
+	time.Sleep(50 * time.Millisecond)
+	if deliveries, _ := app.notifierDeliveries(rejected.ID); len(deliveries) != 3 {
+		t.Errorf("expected one attempt per event for a 400, got %+v", deliveries)
+	}
+
+	w := httptest.NewRecorder()
+	app.notifierDeliveriesHandler(w, httptest.NewRequest(http.MethodGet, "/api/notifiers/deliveries?id="+notifier.ID, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"attempt":3`) {
+		t.Errorf("unexpected deliveries response %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	app.notifierDeliveriesHandler(w, httptest.NewRequest(http.MethodGet, "/api/notifiers/deliveries?id=notifier_9", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown notifier, got %d", w.Code)
+	}
+}
+
+// waitForDeliveries waits until the notifier has logged n delivery attempts.
+func waitForDeliveries(t *testing.T, app *App, id string, n int) []NotifierDelivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		deliveries, _ := app.notifierDeliveries(id)
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d deliveries, got %+v", n, deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
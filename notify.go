@@ -0,0 +1,70 @@
+package hooklab
+
+// This file contains rule match notifications: a rule with a notifyUrl POSTs a
+// small JSON summary of each match to an external system, such as a CI job or a
+// Slack incoming webhook, for lightweight alerting on specific payloads.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RuleNotification is the JSON body POSTed to a rule's notifyUrl when it matches.
+type RuleNotification struct {
+	EventID   int       `json:"eventId"`
+	Key       string    `json:"key"`
+	RuleID    string    `json:"ruleId"`
+	Rule      string    `json:"rule,omitempty"` // Rule name
+	Timestamp time.Time `json:"timestamp"`      // When the event was received
+}
+
+// notifyRuleMatches announces every rule whose condition matched while evaluating
+// event on the SSE stream and, for rules of key with a notifyUrl, sends a
+// notification in the background.
+func (a *App) notifyRuleMatches(key string, event Event, eval *ruleEvaluation) {
+	targets := make(map[string]string) // rule ID -> notifyUrl
+	for _, rule := range a.keyRules(key) {
+		if rule.NotifyURL != "" {
+			targets[rule.ID] = rule.NotifyURL
+		}
+	}
+
+	for _, trace := range eval.trace {
+		if !trace.Matched {
+			continue
+		}
+		notification := RuleNotification{
+			EventID:   event.ID,
+			Key:       key,
+			RuleID:    trace.RuleID,
+			Rule:      trace.Rule,
+			Timestamp: event.Timestamp,
+		}
+		a.broadcastNotice(NoticeMatch, key, notification)
+		if target, ok := targets[trace.RuleID]; ok {
+			go sendNotification(target, notification)
+		}
+	}
+}
+
+// sendNotification POSTs notification to target, logging failures.
+func sendNotification(target string, notification RuleNotification) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+	resp, err := forwardClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Notifying %s of rule %s matching event %d failed: %v", target, notification.RuleID, notification.EventID, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Printf("Notifying %s of rule %s matching event %d failed: status %d", target, notification.RuleID, notification.EventID, resp.StatusCode)
+	}
+}
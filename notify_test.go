@@ -0,0 +1,73 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandlerNotifiesRuleMatches(t *testing.T) {
+	received := make(chan RuleNotification, 4)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification RuleNotification
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected notification request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&notification)
+		received <- notification
+	}))
+	defer target.Close()
+
+	app := New()
+	tag := app.addRule("payments", Rule{Name: "Suspicious", Condition: `header("X-Signature") == ""`, Action: ActionTag, Tags: []string{"suspicious"}, NotifyURL: target.URL, Enabled: true})
+	large := app.addRule("payments", Rule{Name: "Large", Condition: "body.amount > 100", StatusCode: http.StatusAccepted, NotifyURL: target.URL, Enabled: true})
+	app.addRule("payments", Rule{Name: "Quiet", Condition: "true", StatusCode: http.StatusOK, Priority: 1, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":500}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+
+	got := map[string]RuleNotification{}
+	for range 2 {
+		select {
+		case notification := <-received:
+			got[notification.RuleID] = notification
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for notifications, got %+v", got)
+		}
+	}
+	event := app.store.Events()[0]
+	for _, rule := range []Rule{tag, large} {
+		notification := got[rule.ID]
+		if notification.EventID != event.ID || notification.Key != "payments" || notification.Rule != rule.Name || !notification.Timestamp.Equal(event.Timestamp) {
+			t.Errorf("unexpected notification for %s: %+v", rule.ID, notification)
+		}
+	}
+
+	// Rules whose condition doesn't match don't notify.
+	req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount":5}`))
+	req.Header.Set("X-Signature", "abc")
+	app.webhookHandler(httptest.NewRecorder(), req)
+	select {
+	case notification := <-received:
+		t.Errorf("unexpected notification %+v", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRulesHandlerPostInvalidNotifyURL(t *testing.T) {
+	app := New()
+	for _, url := range []string{"not-a-url", "ftp://example.com/hook", "/relative"} {
+		body := `{"condition":"true","notifyUrl":"` + url + `"}`
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=payments", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "notifyUrl") {
+			t.Errorf("%s: expected a notifyUrl error, got %d %s", url, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package hooklab
+
+// This file contains OpenAPI request validation: a key can be given a provider's
+// published OpenAPI document, and every webhook is checked against the matching
+// operation's parameters and request body. Violations are stored on the event and
+// exposed to rules as the openapi variable, to check a provider honors its spec.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"sigs.k8s.io/yaml"
+)
+
+// openAPIMethods are the operation fields of an OpenAPI path item, in the order
+// they are read.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// schemaPrinter formats schema violations.
+var schemaPrinter = message.NewPrinter(language.English)
+
+// OpenAPIResult is the outcome of validating a webhook against a key's OpenAPI
+// document.
+type OpenAPIResult struct {
+	Operation  string   `json:"operation,omitempty"`  // Operation the webhook was checked against, e.g. "createPayment" or "POST /payments"
+	Valid      bool     `json:"valid"`                // Whether the webhook matched the operation
+	Violations []string `json:"violations,omitempty"` // How it didn't, e.g. "header X-Signature: missing"
+}
+
+// openAPISpec is an OpenAPI document attached to a webhook key, with its
+// operations compiled for validation.
+type openAPISpec struct {
+	raw        json.RawMessage
+	operation  string // operationId every webhook is checked against; empty to match by method and path
+	operations []openAPIOperation
+}
+
+// openAPIOperation is one operation of an OpenAPI document, from paths or, in
+// OpenAPI 3.1, webhooks.
+type openAPIOperation struct {
+	id     string // operationId, if any
+	method string // Upper-case HTTP method
+	path   string // Path template, e.g. "/payments/{id}"; empty for webhooks
+	name   string // Webhook name, for webhooks
+	params []openAPIParam
+	body   *openAPIBody
+}
+
+// openAPIParam is a header or query parameter of an operation.
+type openAPIParam struct {
+	name     string
+	in       string // "header" or "query"
+	required bool
+	schema   *jsonschema.Schema // nil accepts any value
+}
+
+// openAPIBody is the request body of an operation.
+type openAPIBody struct {
+	required bool
+	content  map[string]*jsonschema.Schema // Schema per media type, e.g. "application/json"; nil accepts any body
+}
+
+// label names the operation in results.
+func (op openAPIOperation) label() string {
+	switch {
+	case op.id != "":
+		return op.id
+	case op.name != "":
+		return op.method + " webhook " + op.name
+	default:
+		return op.method + " " + op.path
+	}
+}
+
+// compileOpenAPI parses an OpenAPI 3.0 or 3.1 document in JSON or YAML and
+// compiles the schemas of its operations. operation, if set, is the operationId
+// every webhook is checked against.
+func compileOpenAPI(raw []byte, operation string) (*openAPISpec, error) {
+	encoded, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("document must be an object")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	version, _ := root["openapi"].(string)
+	switch {
+	case strings.HasPrefix(version, "3.0."):
+		// OpenAPI 3.0 schemas are a draft 4 dialect with nullable.
+		compiler.DefaultDraft(jsonschema.Draft4)
+		expandNullable(root)
+	case strings.HasPrefix(version, "3.1."):
+		compiler.DefaultDraft(jsonschema.Draft2020)
+	default:
+		return nil, errors.New("openapi: want version 3.0.x or 3.1.x")
+	}
+	if err := compiler.AddResource("openapi.json", root); err != nil {
+		return nil, err
+	}
+
+	c := openAPICompiler{root: root, compiler: compiler}
+	spec := &openAPISpec{raw: json.RawMessage(encoded), operation: operation}
+	for _, section := range []string{"paths", "webhooks"} {
+		items, _ := root[section].(map[string]interface{})
+		for _, name := range sortedKeys(items) {
+			ops, err := c.pathItem("/"+section+"/"+pointerToken(name), items[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", section, name, err)
+			}
+			for _, op := range ops {
+				if section == "paths" {
+					op.path = name
+				} else {
+					op.name = name
+				}
+				spec.operations = append(spec.operations, op)
+			}
+		}
+	}
+	if len(spec.operations) == 0 {
+		return nil, errors.New("document has no operations in paths or webhooks")
+	}
+	if operation != "" && spec.find(operation) == nil {
+		return nil, fmt.Errorf("operation %q not found", operation)
+	}
+	return spec, nil
+}
+
+// openAPICompiler compiles the operations of a document.
+type openAPICompiler struct {
+	root     map[string]interface{}
+	compiler *jsonschema.Compiler
+}
+
+// resolve follows a local $ref on node at pointer, returning the referenced
+// object and its pointer.
+func (c openAPICompiler) resolve(pointer string, node interface{}) (map[string]interface{}, string, error) {
+	for range 10 {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, "", errors.New(pointer + ": not an object")
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return object, pointer, nil
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, "", errors.New(pointer + ": only local $refs are supported, got " + ref)
+		}
+		pointer = strings.TrimPrefix(ref, "#")
+		node = c.lookup(pointer)
+		if node == nil {
+			return nil, "", errors.New("unresolved $ref " + ref)
+		}
+	}
+	return nil, "", errors.New(pointer + ": $ref chain too long")
+}
+
+// lookup returns the value at a JSON pointer, or nil.
+func (c openAPICompiler) lookup(pointer string) interface{} {
+	var node interface{} = c.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if node, ok = object[token]; !ok {
+			return nil
+		}
+	}
+	return node
+}
+
+// schema compiles the schema at pointer.
+func (c openAPICompiler) schema(pointer string) (*jsonschema.Schema, error) {
+	return c.compiler.Compile("openapi.json#" + (&url.URL{Fragment: pointer}).EscapedFragment())
+}
+
+// pathItem compiles the operations of the path item at pointer.
+func (c openAPICompiler) pathItem(pointer string, node interface{}) ([]openAPIOperation, error) {
+	item, pointer, err := c.resolve(pointer, node)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := c.params(pointer+"/parameters", item["parameters"])
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []openAPIOperation
+	for _, method := range openAPIMethods {
+		raw, ok := item[method].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		opPointer := pointer + "/" + method
+		own, err := c.params(opPointer+"/parameters", raw["parameters"])
+		if err != nil {
+			return nil, err
+		}
+		op := openAPIOperation{method: strings.ToUpper(method), params: mergeParams(shared, own)}
+		op.id, _ = raw["operationId"].(string)
+		if raw["requestBody"] != nil {
+			if op.body, err = c.body(opPointer+"/requestBody", raw["requestBody"]); err != nil {
+				return nil, err
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// params compiles the header and query parameters in the list at pointer.
+// Path and cookie parameters aren't checked.
+func (c openAPICompiler) params(pointer string, node interface{}) ([]openAPIParam, error) {
+	list, _ := node.([]interface{})
+	var params []openAPIParam
+	for i, entry := range list {
+		raw, paramPointer, err := c.resolve(fmt.Sprintf("%s/%d", pointer, i), entry)
+		if err != nil {
+			return nil, err
+		}
+		param := openAPIParam{}
+		param.name, _ = raw["name"].(string)
+		param.in, _ = raw["in"].(string)
+		param.required, _ = raw["required"].(bool)
+		if param.in != "header" && param.in != "query" {
+			continue
+		}
+		if raw["schema"] != nil {
+			if param.schema, err = c.schema(paramPointer + "/schema"); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// body compiles the request body at pointer.
+func (c openAPICompiler) body(pointer string, node interface{}) (*openAPIBody, error) {
+	raw, pointer, err := c.resolve(pointer, node)
+	if err != nil {
+		return nil, err
+	}
+	body := &openAPIBody{content: make(map[string]*jsonschema.Schema)}
+	body.required, _ = raw["required"].(bool)
+	content, _ := raw["content"].(map[string]interface{})
+	for _, mt := range sortedKeys(content) {
+		media, _ := content[mt].(map[string]interface{})
+		var schema *jsonschema.Schema
+		if media["schema"] != nil {
+			if schema, err = c.schema(pointer + "/content/" + pointerToken(mt) + "/schema"); err != nil {
+				return nil, err
+			}
+		}
+		body.content[strings.ToLower(mt)] = schema
+	}
+	return body, nil
+}
+
+// mergeParams returns the path item's parameters overridden by the
+// operation's, which replace those with the same name and location.
+func mergeParams(shared, own []openAPIParam) []openAPIParam {
+	merged := append([]openAPIParam{}, own...)
+	for _, param := range shared {
+		overridden := false
+		for _, o := range own {
+			if o.in == param.in && strings.EqualFold(o.name, param.name) {
+				overridden = true
+			}
+		}
+		if !overridden {
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// expandNullable rewrites OpenAPI 3.0 "nullable": true schemas to also accept null.
+func expandNullable(node interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if nullable, _ := v["nullable"].(bool); nullable {
+			if t, ok := v["type"].(string); ok {
+				v["type"] = []interface{}{t, "null"}
+			}
+		}
+		for _, child := range v {
+			expandNullable(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			expandNullable(child)
+		}
+	}
+}
+
+// pointerToken escapes a JSON pointer token.
+func pointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// find returns the operation with the given operationId, or nil.
+func (s *openAPISpec) find(id string) *openAPIOperation {
+	for i := range s.operations {
+		if s.operations[i].id == id {
+			return &s.operations[i]
+		}
+	}
+	return nil
+}
+
+// candidates returns the operations a webhook with method and path may be
+// meant for: the pinned operation, else those with the method whose path
+// template matches the request path (with or without the /webhook prefix), else
+// every operation with the method, since providers' specs rarely use hooklab's
+// URLs.
+func (s *openAPISpec) candidates(method, path string) []openAPIOperation {
+	if s.operation != "" {
+		return []openAPIOperation{*s.find(s.operation)}
+	}
+	var byMethod, byPath []openAPIOperation
+	for _, op := range s.operations {
+		if op.method != method {
+			continue
+		}
+		byMethod = append(byMethod, op)
+		if op.path != "" && (pathMatches(op.path, path) || pathMatches(op.path, strings.TrimPrefix(path, "/webhook"))) {
+			byPath = append(byPath, op)
+		}
+	}
+	if len(byPath) > 0 {
+		return byPath
+	}
+	return byMethod
+}
+
+// pathMatches reports whether path matches an OpenAPI path template, where
+// "{name}" matches any one segment.
+func pathMatches(template, path string) bool {
+	want := strings.Split(strings.Trim(template, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			if got[i] == "" {
+				return false
+			}
+		} else if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks a webhook against the operation it matches best: the
+// candidate with the fewest violations, the first on ties.
+func (s *openAPISpec) validate(method, path string, query url.Values, headers http.Header, body string) *OpenAPIResult {
+	candidates := s.candidates(method, path)
+	if len(candidates) == 0 {
+		return &OpenAPIResult{Violations: []string{"no operation for " + method}}
+	}
+	var best *OpenAPIResult
+	for _, op := range candidates {
+		violations := op.check(query, headers, body)
+		if op.method != method {
+			// Only a pinned operation can have another method.
+			violations = append([]string{"method: " + method + ", want " + op.method}, violations...)
+		}
+		if best == nil || len(violations) < len(best.Violations) {
+			best = &OpenAPIResult{Operation: op.label(), Valid: len(violations) == 0, Violations: violations}
+		}
+	}
+	return best
+}
+
+// check returns how a webhook violates the operation's parameters and body.
+func (op openAPIOperation) check(query url.Values, headers http.Header, body string) []string {
+	var violations []string
+	for _, param := range op.params {
+		var value string
+		var present bool
+		if param.in == "header" {
+			_, present = headers[http.CanonicalHeaderKey(param.name)]
+			value = headerValue(headers, param.name)
+		} else {
+			present = query.Has(param.name)
+			value = query.Get(param.name)
+		}
+		label := param.in + " " + param.name
+		if !present {
+			if param.required {
+				violations = append(violations, label+": missing")
+			}
+			continue
+		}
+		if param.schema != nil {
+			violations = append(violations, paramViolations(label, param.schema, value)...)
+		}
+	}
+	if op.body != nil {
+		violations = append(violations, op.body.check(headerValue(headers, "Content-Type"), body)...)
+	}
+	return violations
+}
+
+// paramViolations validates a parameter value, first as a string and then, for
+// schemas such as integers and booleans, as the JSON value it spells. Values that
+// spell a number or boolean report that value's violations.
+func paramViolations(label string, schema *jsonschema.Schema, value string) []string {
+	err := schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+	if decoded, decodeErr := jsonschema.UnmarshalJSON(strings.NewReader(value)); decodeErr == nil {
+		if _, isString := decoded.(string); !isString {
+			err = schema.Validate(decoded)
+		}
+	}
+	return schemaViolations(label, err)
+}
+
+// check returns how a body with contentType violates the request body.
+func (b *openAPIBody) check(contentType, body string) []string {
+	if body == "" {
+		if b.required {
+			return []string{"body: missing"}
+		}
+		return nil
+	}
+	if len(b.content) == 0 {
+		return nil
+	}
+
+	mt := mediaType(contentType)
+	schema, ok := b.content[mt]
+	if !ok {
+		if schema, ok = b.content[strings.SplitN(mt, "/", 2)[0]+"/*"]; !ok {
+			if schema, ok = b.content["*/*"]; !ok {
+				types := make([]string, 0, len(b.content))
+				for t := range b.content {
+					types = append(types, t)
+				}
+				sort.Strings(types)
+				return []string{fmt.Sprintf("body: content type %q not in the spec (%s)", mt, strings.Join(types, ", "))}
+			}
+		}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	var instance interface{} = body
+	switch {
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		decoded, err := jsonschema.UnmarshalJSON(strings.NewReader(body))
+		if err != nil {
+			return []string{"body: invalid JSON"}
+		}
+		instance = decoded
+	case mt == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return []string{"body: invalid form data"}
+		}
+		form := make(map[string]interface{}, len(values))
+		for name := range values {
+			form[name] = values.Get(name)
+		}
+		instance = form
+	}
+	return schemaViolations("body", schema.Validate(instance))
+}
+
+// schemaViolations lists the leaf errors of a schema validation error, each
+// prefixed with label and the location of the offending value.
+func schemaViolations(label string, err error) []string {
+	if err == nil {
+		return nil
+	}
+	var validation *jsonschema.ValidationError
+	if !errors.As(err, &validation) {
+		return []string{label + ": " + err.Error()}
+	}
+	var violations []string
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := label
+			if len(e.InstanceLocation) > 0 {
+				location += " /" + strings.Join(e.InstanceLocation, "/")
+			}
+			violations = append(violations, location+": "+e.ErrorKind.LocalizedString(schemaPrinter))
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(validation)
+	return violations
+}
+
+// openAPIEnv returns the openapi expression variable for result: operation,
+// valid, and violations. Without a document, operation is "" and valid is false.
+func openAPIEnv(result *OpenAPIResult) map[string]interface{} {
+	if result == nil {
+		result = &OpenAPIResult{}
+	}
+	violations := result.Violations
+	if violations == nil {
+		violations = []string{}
+	}
+	return map[string]interface{}{
+		"operation":  result.Operation,
+		"valid":      result.Valid,
+		"violations": violations,
+	}
+}
+
+// getOpenAPISpec returns the OpenAPI document attached to the given webhook key, or nil.
+func (a *App) getOpenAPISpec(key string) *openAPISpec {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.openAPISpecs[key]
+}
+
+// setOpenAPISpec attaches an OpenAPI document to the given webhook key.
+func (a *App) setOpenAPISpec(key string, spec *openAPISpec) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.openAPISpecs[key] = spec
+}
+
+// deleteOpenAPISpec detaches the OpenAPI document from the given webhook key.
+// Returns true if a document was removed.
+func (a *App) deleteOpenAPISpec(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.openAPISpecs[key]; !ok {
+		return false
+	}
+	delete(a.openAPISpecs, key)
+	return true
+}
+
+// openAPIHandler handles GET, PUT, and DELETE requests to /api/openapi.
+// The "key" query parameter selects the webhook key whose OpenAPI document is
+// managed. PUT takes the document as JSON or YAML, and an optional "operation"
+// query parameter naming the operationId every webhook is checked against.
+func (a *App) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		spec := a.getOpenAPISpec(key)
+		if spec == nil {
+			http.Error(w, "OpenAPI document not found", http.StatusNotFound)
+			return
+		}
+		operations := make([]string, 0, len(spec.operations))
+		for _, op := range spec.operations {
+			operations = append(operations, op.label())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":        key,
+			"operation":  spec.operation,
+			"operations": operations,
+			"document":   spec.raw,
+		})
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		spec, err := compileOpenAPI(body, r.URL.Query().Get("operation"))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid OpenAPI document: " + err.Error(),
+			})
+			return
+		}
+		a.setOpenAPISpec(key, spec)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	case http.MethodDelete:
+		if !a.deleteOpenAPISpec(key) {
+			http.Error(w, "OpenAPI document not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,185 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const paymentsSpec = `
+openapi: 3.0.3
+info: {title: Payments, version: "1"}
+paths:
+  /payments/{id}:
+    parameters:
+      - $ref: '#/components/parameters/Signature'
+    post:
+      operationId: updatePayment
+      parameters:
+        - {name: attempt, in: query, schema: {type: integer, minimum: 1}}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Payment'}
+  /refunds:
+    post:
+      operationId: createRefund
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [refund]
+components:
+  parameters:
+    Signature: {name: X-Signature, in: header, required: true, schema: {type: string, pattern: '^v1='}}
+  schemas:
+    Payment:
+      type: object
+      required: [id, amount]
+      properties:
+        id: {type: string}
+        amount: {type: integer, minimum: 0}
+        note: {type: string, nullable: true}
+`
+
+func TestCompileOpenAPI(t *testing.T) {
+	spec, err := compileOpenAPI([]byte(paymentsSpec), "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(spec.operations) != 2 || spec.operations[0].label() != "updatePayment" || len(spec.operations[0].params) != 2 {
+		t.Errorf("unexpected operations %+v", spec.operations)
+	}
+
+	for _, doc := range []string{
+		`{"swagger":"2.0","paths":{}}`,
+		`{"openapi":"3.0.3","paths":{}}`,
+		`{"openapi":"3.0.3","paths":{"/x":{"post":{"requestBody":{"$ref":"#/components/requestBodies/Missing"}}}}}`,
+		`{"openapi":"3.0.3","paths":{"/x":{"post":{"requestBody":{"$ref":"other.yaml#/Body"}}}}}`,
+		`not: [valid`,
+	} {
+		if _, err := compileOpenAPI([]byte(doc), ""); err == nil {
+			t.Errorf("%s: expected an error", doc)
+		}
+	}
+	if _, err := compileOpenAPI([]byte(paymentsSpec), "deletePayment"); err == nil {
+		t.Error("expected an error for an unknown operation")
+	}
+}
+
+func TestOpenAPIValidate(t *testing.T) {
+	spec, err := compileOpenAPI([]byte(paymentsSpec), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := func(pairs ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name, method, path, query string
+		headers                   http.Header
+		body                      string
+		operation                 string
+		violations                []string
+	}{
+		{"valid", "POST", "/webhook/payments/p_1", "attempt=2", headers("X-Signature", "v1=abc", "Content-Type", "application/json"), `{"id":"p_1","amount":500,"note":null}`, "updatePayment", nil},
+		{"bad parameters", "POST", "/payments/p_1", "attempt=0", headers("Content-Type", "application/json"), `{"id":"p_1","amount":5}`, "updatePayment", []string{"query attempt: minimum: got 0, want 1", "header X-Signature: missing"}},
+		{"bad parameter type", "POST", "/payments/p_1", "attempt=first", headers("X-Signature", "v1=abc", "Content-Type", "application/json"), `{"id":"p_1","amount":5}`, "updatePayment", []string{"query attempt: got string, want integer"}},
+		{"bad body", "POST", "/payments/p_1", "", headers("X-Signature", "v1=abc", "Content-Type", "application/json"), `{"amount":-1}`, "updatePayment", []string{"body: missing property 'id'", "body /amount: minimum: got -1, want 0"}},
+		{"missing body", "POST", "/payments/p_1", "", headers("X-Signature", "v1=abc"), "", "updatePayment", []string{"body: missing"}},
+		{"wrong content type", "POST", "/payments/p_1", "", headers("X-Signature", "v1=abc", "Content-Type", "text/plain"), "hi", "updatePayment", []string{`body: content type "text/plain" not in the spec (application/json)`}},
+		{"best match", "POST", "/webhook/billing", "", headers("Content-Type", "application/json"), `{"refund":{}}`, "createRefund", nil},
+		{"no operation", "GET", "/webhook/billing", "", headers(), "", "", []string{"no operation for GET"}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		result := spec.validate(tt.method, tt.path, query, tt.headers, tt.body)
+		if result.Operation != tt.operation || result.Valid != (len(tt.violations) == 0 && tt.operation != "") || strings.Join(result.Violations, "\n") != strings.Join(tt.violations, "\n") {
+			t.Errorf("%s: unexpected result %+v", tt.name, result)
+		}
+	}
+
+	pinned, err := compileOpenAPI([]byte(paymentsSpec), "createRefund")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := pinned.validate("PUT", "/webhook/billing", nil, headers(), "")
+	if result.Operation != "createRefund" || len(result.Violations) != 1 || result.Violations[0] != "method: PUT, want POST" {
+		t.Errorf("unexpected pinned result %+v", result)
+	}
+}
+
+func TestOpenAPIWebhooks(t *testing.T) {
+	spec, err := compileOpenAPI([]byte(`{
+		"openapi": "3.1.0",
+		"webhooks": {
+			"pet.created": {"post": {"requestBody": {"content": {"application/json": {"schema": {"type": "object", "required": ["pet"], "properties": {"pet": {"type": ["object", "null"]}}}}}}}},
+			"pet.deleted": {"post": {"requestBody": {"content": {"application/json": {"schema": {"type": "object", "required": ["petId"]}}}}}}
+		}
+	}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := spec.validate("POST", "/webhook/pets", nil, http.Header{"Content-Type": {"application/json"}}, `{"petId":7}`)
+	if !result.Valid || result.Operation != "POST webhook pet.deleted" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestWebhookHandlerValidatesOpenAPI(t *testing.T) {
+	app := New()
+	server, err := newServer(app, 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/openapi?key=payments&operation=updatePayment", strings.NewReader(paymentsSpec)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the document to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+	app.addRule("payments", Rule{Condition: "!openapi.valid", StatusCode: http.StatusUnprocessableEntity, Response: map[string]string{"error": "off spec"}, Enabled: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"id":"p_1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected rules to see the violations, got %d", w.Code)
+	}
+	result := app.store.Events()[0].OpenAPI
+	if result == nil || result.Valid || result.Operation != "updatePayment" || len(result.Violations) != 2 {
+		t.Errorf("unexpected stored result %+v", result)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi?key=payments", nil))
+	var got struct {
+		Operation  string          `json:"operation"`
+		Operations []string        `json:"operations"`
+		Document   json.RawMessage `json:"document"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Operation != "updatePayment" || len(got.Operations) != 2 || !strings.Contains(string(got.Document), `"openapi":"3.0.3"`) {
+		t.Errorf("unexpected document response %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/openapi?key=payments", strings.NewReader(`{"openapi":"2.0"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid document to be refused, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/openapi?key=payments", nil))
+	if w.Code != http.StatusOK || app.getOpenAPISpec("payments") != nil {
+		t.Errorf("expected the document to be removed, got %d", w.Code)
+	}
+}
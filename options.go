@@ -0,0 +1,117 @@
+package hooklab
+
+// This file contains New, which builds an App from functional options, so code
+// setting one up outside serve's flags, such as tests, says what it changes
+// from the defaults.
+
+import "time"
+
+// Clock tells the time events are stamped with and rules, signatures, and
+// tokens expire by. Latencies are always measured by the wall clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// Option configures an App built by New.
+type Option func(*App)
+
+// New returns an App configured by options and started now.
+func New(options ...Option) *App {
+	a := &App{
+		responses:      make(map[string]ResponseConfig),
+		rules:          make(map[string][]Rule),
+		store:          &memoryStore{},
+		subscribers:    make(map[chan Event]struct{}),
+		subscriberKeys: make(map[chan Event]map[string]bool),
+		notices:        make(map[chan Event]chan StreamNotice),
+		drops:          make(map[chan Event]int),
+		delivered:      make(map[chan Event]int),
+		rateWindows:    make(map[string]rateWindow),
+		captureBuckets: make(map[string]captureBucket),
+		schemas:        make(map[string]*responseSchema),
+		openAPISpecs:   make(map[string]*openAPISpec),
+		avroSchemas:    make(map[string]*avroSchema),
+		jwksSets:       make(map[string]jwksEntry),
+		state:          make(map[string]*mockState),
+		scenarios:      make(map[string]string),
+		shutdown:       make(chan struct{}),
+		overrides:      make(map[string]*responseOverride),
+		arrivals:       make(map[string][]time.Time),
+		samples:        make(map[string][]webhookSample),
+		latency:        make(map[string]phaseHistograms),
+		slowRequests:   make(map[string]int),
+		ruleHistory:    make(map[string][]RuleVersion),
+		deliveries:     make(map[string][]NotifierDelivery),
+		rejections:     RejectionStats{Causes: make(map[string]int), Keys: make(map[string]int)},
+		plugins:        make(map[string]*pluginProcess),
+	}
+	for _, option := range options {
+		option(a)
+	}
+	a.startedAt = a.now()
+	return a
+}
+
+// WithMaxEvents keeps the n newest captured events instead of maxEvents.
+func WithMaxEvents(n int) Option {
+	return func(a *App) { a.eventLimit = n }
+}
+
+// WithClock makes the app tell the time by c instead of the wall clock.
+func WithClock(c Clock) Option {
+	return func(a *App) { a.clock = c }
+}
+
+// WithStreamBuffer lets SSE subscribers fall behind by n messages before
+// further ones are dropped, instead of defaultStreamBuffer.
+func WithStreamBuffer(n int) Option {
+	return func(a *App) { a.streamBuffer = n }
+}
+
+// WithBasePath serves the app under the -base-path prefix path, as returned
+// by parseBasePath.
+func WithBasePath(path string) Option {
+	return func(a *App) { a.basePath = path }
+}
+
+// WithoutUI serves the webhook endpoints and API without the dashboard.
+func WithoutUI() Option {
+	return func(a *App) { a.noUI = true }
+}
+
+// WithPluginsDir runs the plugins key configs name from dir.
+func WithPluginsDir(dir string) Option {
+	return func(a *App) { a.pluginsDir = dir }
+}
+
+// WithStore keeps captured events in s instead of in memory.
+func WithStore(s EventStore) Option {
+	return func(a *App) { a.store = s }
+}
+
+// WithSink publishes captured events to s, such as a natssink.Sink.
+func WithSink(s EventSink) Option {
+	return func(a *App) { a.addSink(s) }
+}
+
+// WithBridge shares the live stream with other instances through b, such as a
+// redisbridge.Bridge.
+func WithBridge(b Bridge) Option {
+	return func(a *App) { a.setBridge(b) }
+}
+
+// now returns the time by the app's clock.
+func (a *App) now() time.Time {
+	if a.clock != nil {
+		return a.clock.Now()
+	}
+	return time.Now()
+}
+
+// maxEventsLocked returns how many captured events are kept.
+func (a *App) maxEventsLocked() int {
+	if a.eventLimit > 0 {
+		return a.eventLimit
+	}
+	return maxEvents
+}
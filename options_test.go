@@ -0,0 +1,94 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock standing still at a set time.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+// countingSink counts the events published to it, failing with err if set.
+type countingSink struct {
+	published int
+	err       error
+	closed    bool
+}
+
+func (s *countingSink) Name() string        { return "counting" }
+func (s *countingSink) Publish(Event) error { s.published++; return s.err }
+func (s *countingSink) Close() error        { s.closed = true; return nil }
+
+// namedStore is a memoryStore going by another name.
+type namedStore struct {
+	memoryStore
+	name string
+}
+
+func (s *namedStore) Name() string { return s.name }
+
+func TestNew(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	sink := &countingSink{}
+	app := New(WithMaxEvents(3), WithClock(clock), WithStreamBuffer(4), WithBasePath("/hooklab"), WithoutUI(), WithSink(sink))
+
+	for range 5 {
+		app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+		clock.t = clock.t.Add(time.Minute)
+	}
+	app.mu.Lock()
+	events := append([]Event(nil), app.store.Events()...)
+	app.mu.Unlock()
+	if len(events) != 3 || events[0].ID != 5 || events[2].ID != 3 {
+		t.Fatalf("expected the 3 newest events, got %+v", events)
+	}
+	if want := time.Date(2026, 3, 1, 12, 4, 0, 0, time.UTC); !events[0].Timestamp.Equal(want) {
+		t.Errorf("expected the event stamped by the clock at %v, got %v", want, events[0].Timestamp)
+	}
+
+	info := app.info(clock.Now())
+	if info.Limits.MaxEvents != 3 || info.Limits.StreamBuffer != 4 || time.Duration(info.Uptime) != 5*time.Minute {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if app.basePath != "/hooklab" || !app.noUI || sink.published != 5 {
+		t.Errorf("expected the options applied, got base path %q, no UI %v, %d events published", app.basePath, app.noUI, sink.published)
+	}
+
+	// Analytics and temporary configs go by the clock too.
+	w := httptest.NewRecorder()
+	app.analyticsHandler(w, httptest.NewRequest(http.MethodGet, "/api/analytics?key=orders&window=1h&bucket=1m", nil))
+	var analytics Analytics
+	if err := json.Unmarshal(w.Body.Bytes(), &analytics); err != nil || analytics.Count != 5 {
+		t.Errorf("expected the 5 webhooks in the clock's last hour, got %s", w.Body)
+	}
+	app.setTemporaryResponseConfig("orders", ResponseConfig{StatusCode: http.StatusTeapot}, time.Hour)
+	if expiry, ok := app.getOverrideExpiry("orders"); !ok || !expiry.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("expected the override to expire an hour after %v, got %v", clock.Now(), expiry)
+	}
+	app.deleteResponseConfig("orders")
+
+	// A custom store keeps the events and names itself in /api/info.
+	store := &namedStore{name: "test"}
+	app = New(WithStore(store))
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+	if _, ok := app.getEvent(1); !ok || len(store.events) != 1 || app.info(app.now()).Storage.Events != "test" {
+		t.Errorf("expected the event kept in the custom store, got %+v", store.events)
+	}
+
+	// Without options, the defaults apply.
+	app = New()
+	if app.maxEventsLocked() != maxEvents || app.startedAt.IsZero() || app.streamBuffer != 0 {
+		t.Errorf("unexpected defaults %+v", app)
+	}
+
+	// An App not built by New isn't served.
+	if _, err := Handler(&App{}); err == nil {
+		t.Error("expected the zero App refused")
+	}
+}
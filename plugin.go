@@ -0,0 +1,349 @@
+package hooklab
+
+// This file contains plugins: programs in the -plugins-dir directory, written
+// in any language, that a key's webhooks are passed to for transforming,
+// validating, or notifying other systems. Each runs as a long-lived subprocess
+// answering one JSON line on stdout for every JSON line hooklab writes to its
+// stdin, and is restarted if it exits or stops answering.
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plugin kinds.
+const (
+	PluginTransform = "transform" // Replaces the body and headers before the webhook is validated, stored, and evaluated
+	PluginValidate  = "validate"  // Judges the webhook valid or not, optionally refusing invalid ones
+	PluginNotify    = "notify"    // Receives the stored event in the background; its answer is only checked for errors
+)
+
+// defaultPluginTimeout is how long a plugin gets to answer unless its config
+// sets a timeout.
+const defaultPluginTimeout = 5 * time.Second
+
+// pluginStopTimeout is how long a plugin gets to exit once its stdin is
+// closed before it is killed.
+const pluginStopTimeout = 2 * time.Second
+
+// PluginConfig is a plugin the webhooks of a key are passed to. A key's
+// plugins run in order.
+type PluginConfig struct {
+	Name           string   `json:"name"`                     // File name of the program in -plugins-dir
+	Kind           string   `json:"kind"`                     // transform, validate, or notify
+	Timeout        Duration `json:"timeout,omitempty"`        // How long to wait for an answer (default 5s)
+	Reject         bool     `json:"reject,omitempty"`         // Refuse webhooks the validate plugin finds invalid with 422
+	RecordRejected bool     `json:"recordRejected,omitempty"` // Store refused webhooks as rejected events
+}
+
+// PluginRequest is the JSON line written to a plugin for every webhook.
+// Notify plugins get the stored event instead of the request fields.
+type PluginRequest struct {
+	ID      int                 `json:"id"`                // Echoed in the answer
+	Kind    string              `json:"kind"`              // transform, validate, or notify
+	Key     string              `json:"key"`               // Webhook key
+	Method  string              `json:"method,omitempty"`  // HTTP method
+	Path    string              `json:"path,omitempty"`    // Request path
+	Headers map[string][]string `json:"headers,omitempty"` // Request headers
+	Body    string              `json:"body,omitempty"`    // Request body, as transformed by earlier plugins
+	Event   *Event              `json:"event,omitempty"`   // Stored event, for notify plugins
+}
+
+// PluginResponse is the JSON line a plugin answers a request with.
+type PluginResponse struct {
+	ID      int                 `json:"id"`                // ID of the request answered
+	Body    *string             `json:"body,omitempty"`    // Replacement body, for transform plugins; unchanged if left out
+	Headers map[string][]string `json:"headers,omitempty"` // Replacement headers, for transform plugins; unchanged if left out
+	Valid   *bool               `json:"valid,omitempty"`   // Whether the webhook is valid, for validate plugins
+	Message string              `json:"message,omitempty"` // Why it isn't, for validate plugins
+	Error   string              `json:"error,omitempty"`   // Why the plugin couldn't process the request
+}
+
+// PluginResult is the outcome of passing a webhook to a plugin, stored on the
+// event for validate plugins and for plugins that failed.
+type PluginResult struct {
+	Plugin  string `json:"plugin"`            // Plugin name
+	Kind    string `json:"kind"`              // transform or validate
+	Valid   *bool  `json:"valid,omitempty"`   // The validate plugin's verdict
+	Message string `json:"message,omitempty"` // Why the webhook is invalid
+	Error   string `json:"error,omitempty"`   // Why the plugin failed; a failed plugin leaves the webhook unchanged and unjudged
+}
+
+// validate checks that the plugin is named by a plain file name and has a
+// known kind.
+func (c PluginConfig) validate() error {
+	if c.Name == "" || c.Name == "." || c.Name == ".." || strings.ContainsAny(c.Name, `/\`) {
+		return fmt.Errorf("name %q must be the file name of a program in -plugins-dir", c.Name)
+	}
+	switch c.Kind {
+	case PluginTransform, PluginValidate, PluginNotify:
+	default:
+		return fmt.Errorf("unknown kind %q, want transform, validate, or notify", c.Kind)
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if (c.Reject || c.RecordRejected) && c.Kind != PluginValidate {
+		return errors.New("reject and recordRejected only apply to validate plugins")
+	}
+	return nil
+}
+
+// validatePlugins checks the plugins of a response config.
+func validatePlugins(plugins []PluginConfig) error {
+	for i, plugin := range plugins {
+		if err := plugin.validate(); err != nil {
+			return errors.New("plugins[" + strconv.Itoa(i) + "]: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// pluginEnv returns the plugins expression variable: whether no validate
+// plugin found the webhook invalid, and the messages of those that did.
+func pluginEnv(results []PluginResult) map[string]interface{} {
+	valid := true
+	messages := []string{}
+	for _, result := range results {
+		if result.Valid != nil && !*result.Valid {
+			valid = false
+			messages = append(messages, result.Message)
+		}
+	}
+	return map[string]interface{}{
+		"valid":    valid,
+		"messages": messages,
+	}
+}
+
+// pluginProcess is a running plugin, answering one request at a time.
+type pluginProcess struct {
+	path    string
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	answers chan []byte // lines the plugin writes; closed once it exits
+	lastID  int
+}
+
+// start runs the plugin. The caller must hold p.mu.
+func (p *pluginProcess) start() error {
+	cmd := exec.Command(p.path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	answers := make(chan []byte)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 4*maxBodySize)
+		for scanner.Scan() {
+			answers <- append([]byte(nil), scanner.Bytes()...)
+		}
+		cmd.Wait()
+		close(answers)
+	}()
+	p.cmd, p.stdin, p.answers = cmd, stdin, answers
+	return nil
+}
+
+// stop closes the plugin's stdin, killing it unless it exits within grace.
+// The caller must hold p.mu.
+func (p *pluginProcess) stop(grace time.Duration) {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	timeout := time.After(grace)
+	for exited := false; !exited; {
+		select {
+		case _, ok := <-p.answers:
+			exited = !ok
+		case <-timeout:
+			p.cmd.Process.Kill()
+			timeout = nil
+		}
+	}
+	p.cmd = nil
+}
+
+// call writes request to the plugin, starting it if it isn't running, and
+// returns its answer. A plugin that doesn't read the request and answer it
+// within timeout is stopped, so the next request restarts it.
+func (p *pluginProcess) call(request PluginRequest, timeout time.Duration) (PluginResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return PluginResponse{}, err
+		}
+	}
+	p.lastID++
+	request.ID = p.lastID
+	line, err := json.Marshal(request)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+
+	// The write blocks once the pipe is full if the plugin stops reading, so
+	// it runs under the deadline too; stopping the plugin ends it.
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	written := make(chan error, 1)
+	go func() {
+		_, err := p.stdin.Write(append(line, '\n'))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			p.stop(0)
+			return PluginResponse{}, fmt.Errorf("writing the request: %w", err)
+		}
+	case <-timer.C:
+		p.stop(0)
+		return PluginResponse{}, fmt.Errorf("request not read within %v", timeout)
+	}
+
+	select {
+	case answer, ok := <-p.answers:
+		if !ok {
+			p.stop(0)
+			return PluginResponse{}, errors.New("exited without answering")
+		}
+		var response PluginResponse
+		if err := json.Unmarshal(answer, &response); err != nil {
+			p.stop(0)
+			return PluginResponse{}, fmt.Errorf("invalid answer: %w", err)
+		}
+		if response.ID != request.ID {
+			p.stop(0)
+			return PluginResponse{}, fmt.Errorf("answered request %d instead of %d", response.ID, request.ID)
+		}
+		if response.Error != "" {
+			return response, errors.New(response.Error)
+		}
+		return response, nil
+	case <-timer.C:
+		p.stop(0)
+		return PluginResponse{}, fmt.Errorf("no answer within %v", timeout)
+	}
+}
+
+// plugin returns the process of the plugin named name, or an error if
+// plugins are disabled.
+func (a *App) plugin(name string) (*pluginProcess, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pluginsDir == "" {
+		return nil, errors.New("plugins are disabled; start hooklab with -plugins-dir")
+	}
+	if p, ok := a.plugins[name]; ok {
+		return p, nil
+	}
+	p := &pluginProcess{path: filepath.Join(a.pluginsDir, name)}
+	a.plugins[name] = p
+	return p, nil
+}
+
+// callPlugin passes request to the plugin config names.
+func (a *App) callPlugin(config PluginConfig, request PluginRequest) (PluginResponse, error) {
+	p, err := a.plugin(config.Name)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	request.Kind = config.Kind
+	return p.call(request, cmp.Or(time.Duration(config.Timeout), defaultPluginTimeout))
+}
+
+// runPlugins passes the webhook r of key, with body text, through the
+// transform and validate plugins of the key in order. Transforms replace r's
+// headers and the returned text. It returns the results to store on the event
+// and, if a validate plugin refuses the webhook, the rejection.
+func (a *App) runPlugins(key string, plugins []PluginConfig, r *http.Request, text string) (string, []PluginResult, *rejection) {
+	var results []PluginResult
+	for _, config := range plugins {
+		if config.Kind == PluginNotify {
+			continue
+		}
+		response, err := a.callPlugin(config, PluginRequest{Key: key, Method: r.Method, Path: r.URL.Path, Headers: r.Header, Body: text})
+		result := PluginResult{Plugin: config.Name, Kind: config.Kind}
+		if err != nil {
+			log.Printf("Plugin %s failed on a webhook to key %q: %v", config.Name, key, err)
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		if config.Kind == PluginTransform {
+			if response.Body != nil {
+				text = *response.Body
+			}
+			if response.Headers != nil {
+				r.Header = http.Header(response.Headers)
+			}
+			continue
+		}
+
+		valid := response.Valid == nil || *response.Valid
+		result.Valid, result.Message = &valid, response.Message
+		results = append(results, result)
+		if !valid && config.Reject {
+			return text, results, &rejection{status: http.StatusUnprocessableEntity, cause: RejectPlugin, reason: "refused by plugin " + config.Name + ": " + response.Message, record: config.RecordRejected}
+		}
+	}
+	return text, results, nil
+}
+
+// notifyPlugins passes event to the notify plugins of key in the background,
+// counted as deliveries in flight so draining waits for them.
+func (a *App) notifyPlugins(key string, event Event) {
+	for _, config := range a.getResponseConfig(key).Plugins {
+		if config.Kind != PluginNotify {
+			continue
+		}
+		done := a.startForward()
+		go func() {
+			defer done()
+			if _, err := a.callPlugin(config, PluginRequest{Key: key, Event: &event}); err != nil {
+				log.Printf("Plugin %s failed on event %d: %v", config.Name, event.ID, err)
+			}
+		}()
+	}
+}
+
+// closePlugins stops every running plugin.
+func (a *App) closePlugins() {
+	a.mu.Lock()
+	plugins := a.plugins
+	a.plugins = make(map[string]*pluginProcess)
+	a.mu.Unlock()
+
+	for _, p := range plugins {
+		p.mu.Lock()
+		p.stop(pluginStopTimeout)
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,220 @@
+package hooklab
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPluginProcess is not a test: it is the plugin the tests below run, by
+// way of a script in the plugins directory that executes the test binary with
+// HOOKLAB_TEST_PLUGIN set to the behavior wanted.
+func TestPluginProcess(t *testing.T) {
+	behavior := os.Getenv("HOOKLAB_TEST_PLUGIN")
+	if behavior == "" {
+		t.Skip("only run as a plugin")
+	}
+	if behavior == "deaf" {
+		// Never read stdin, so large requests fill the pipe.
+		time.Sleep(time.Hour)
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var request PluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			os.Exit(2)
+		}
+		response := PluginResponse{ID: request.ID}
+		switch behavior {
+		case "redact":
+			body := strings.ReplaceAll(request.Body, "4242424242424242", "****")
+			response.Body = &body
+			response.Headers = map[string][]string{"X-Redacted": {"yes"}}
+		case "amount":
+			var order struct{ Amount int }
+			json.Unmarshal([]byte(request.Body), &order)
+			valid := order.Amount > 0
+			response.Valid = &valid
+			if !valid {
+				response.Message = "amount must be positive"
+			}
+		case "notify":
+			f, _ := os.OpenFile(os.Getenv("HOOKLAB_TEST_PLUGIN_OUT"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			fmt.Fprintf(f, "%s %d\n", request.Event.Key, request.Event.ID)
+			f.Close()
+		case "silent":
+			continue
+		}
+		line, _ := json.Marshal(response)
+		fmt.Println(string(line))
+	}
+	os.Exit(0)
+}
+
+// writePlugin adds a plugin to dir that runs TestPluginProcess with behavior.
+func writePlugin(t *testing.T, dir, name, behavior string, env ...string) {
+	t.Helper()
+	script := fmt.Sprintf("#!/bin/sh\nHOOKLAB_TEST_PLUGIN=%s %s exec %s -test.run='^TestPluginProcess$'\n",
+		behavior, strings.Join(env, " "), strconv.Quote(os.Args[0]))
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "notified")
+	writePlugin(t, dir, "redact", "redact")
+	writePlugin(t, dir, "amount", "amount")
+	writePlugin(t, dir, "notify", "notify", "HOOKLAB_TEST_PLUGIN_OUT="+out)
+	writePlugin(t, dir, "silent", "silent")
+
+	app := New(WithPluginsDir(dir))
+	defer app.closePlugins()
+	app.setResponseConfig("payments", ResponseConfig{Response: map[string]any{"ok": true}, StatusCode: http.StatusOK, Plugins: []PluginConfig{
+		{Name: "redact", Kind: PluginTransform},
+		{Name: "amount", Kind: PluginValidate},
+		{Name: "notify", Kind: PluginNotify},
+	}})
+	app.addRule("payments", Rule{Condition: `!plugins.valid`, StatusCode: http.StatusConflict, Enabled: true})
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: http.StatusOK, Plugins: []PluginConfig{
+		{Name: "amount", Kind: PluginValidate, Reject: true, RecordRejected: true},
+	}})
+	app.setResponseConfig("slow", ResponseConfig{StatusCode: http.StatusOK, Plugins: []PluginConfig{
+		{Name: "silent", Kind: PluginTransform, Timeout: Duration(100 * time.Millisecond)},
+	}})
+
+	send := func(key, body string) int {
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/"+key, strings.NewReader(body)))
+		return w.Code
+	}
+	latest := func() Event {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		return app.store.Events()[0]
+	}
+
+	if code := send("payments", `{"card":"4242424242424242","amount":5}`); code != http.StatusOK {
+		t.Errorf("expected a valid payment answered with 200, got %d", code)
+	}
+	event := latest()
+	if event.Body != `{"card":"****","amount":5}` || http.Header(event.Headers).Get("X-Redacted") != "yes" {
+		t.Errorf("expected the body and headers transformed, got %q and %v", event.Body, event.Headers)
+	}
+	if len(event.Plugins) != 1 || event.Plugins[0].Valid == nil || !*event.Plugins[0].Valid {
+		t.Errorf("expected the validate plugin's verdict stored, got %+v", event.Plugins)
+	}
+
+	if code := send("payments", `{"amount":0}`); code != http.StatusConflict {
+		t.Errorf("expected the rule on plugins.valid to answer 409, got %d", code)
+	}
+	if event := latest(); len(event.Plugins) != 1 || event.Plugins[0].Message != "amount must be positive" {
+		t.Errorf("expected the validate plugin's message stored, got %+v", event.Plugins)
+	}
+
+	if code := send("orders", `{"amount":-1}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("expected an invalid order refused with 422, got %d", code)
+	}
+	if event := latest(); event.Key != "orders" || !strings.Contains(event.Rejected, "amount must be positive") {
+		t.Errorf("expected the refused order recorded, got %+v", event)
+	}
+	if stats := app.rejectionStats(); stats.Causes[RejectPlugin] != 1 {
+		t.Errorf("expected one plugin rejection counted, got %+v", stats)
+	}
+
+	if code := send("slow", `{"amount":1}`); code != http.StatusOK {
+		t.Errorf("expected a webhook whose plugin timed out answered anyway, got %d", code)
+	}
+	if event := latest(); event.Body != `{"amount":1}` || len(event.Plugins) != 1 || !strings.Contains(event.Plugins[0].Error, "no answer within") {
+		t.Errorf("expected the body unchanged and the timeout stored, got %q and %+v", event.Body, event.Plugins)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !app.waitForForwards(ctx) {
+		t.Fatal("notify plugin deliveries didn't finish")
+	}
+	notified, _ := os.ReadFile(out)
+	if string(notified) != "payments 1\npayments 2\n" {
+		t.Errorf("expected the notify plugin to get both payments, got %q", notified)
+	}
+}
+
+func TestPluginNotReading(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "deaf", "deaf")
+	app := New(WithPluginsDir(dir))
+	defer app.closePlugins()
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: http.StatusOK, Plugins: []PluginConfig{
+		{Name: "deaf", Kind: PluginTransform, Timeout: Duration(200 * time.Millisecond)},
+	}})
+
+	// Each request is larger than the pipe the plugin never reads, which
+	// must not block past the timeout.
+	body := `{"data":"` + strings.Repeat("x", 512*1024) + `"}`
+	for i := range 3 {
+		done := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(body)))
+			done <- w.Code
+		}()
+		select {
+		case code := <-done:
+			if code != http.StatusOK {
+				t.Errorf("webhook %d: expected it answered anyway, got %d", i, code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("webhook %d: blocked on a plugin that doesn't read its requests", i)
+		}
+	}
+	app.mu.Lock()
+	results := app.store.Events()[0].Plugins
+	app.mu.Unlock()
+	if len(results) != 1 || results[0].Error == "" {
+		t.Errorf("expected the plugin failure stored, got %+v", results)
+	}
+}
+
+func TestPluginsDisabled(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: http.StatusOK, Plugins: []PluginConfig{{Name: "amount", Kind: PluginValidate, Reject: true}}})
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the webhook answered without plugins, got %d", w.Code)
+	}
+	app.mu.Lock()
+	results := app.store.Events()[0].Plugins
+	app.mu.Unlock()
+	if len(results) != 1 || !strings.Contains(results[0].Error, "-plugins-dir") {
+		t.Errorf("expected the plugin failure stored, got %+v", results)
+	}
+}
+
+func TestValidatePlugins(t *testing.T) {
+	for _, plugins := range [][]PluginConfig{
+		{{Name: "", Kind: PluginTransform}},
+		{{Name: "../bin/sh", Kind: PluginTransform}},
+		{{Name: "redact", Kind: "filter"}},
+		{{Name: "redact", Kind: PluginTransform, Timeout: -1}},
+		{{Name: "notify", Kind: PluginNotify, Reject: true}},
+	} {
+		if err := validateResponseConfig(ResponseConfig{Plugins: plugins}); err == nil {
+			t.Errorf("expected %+v refused", plugins)
+		}
+	}
+	if err := validateResponseConfig(ResponseConfig{Plugins: []PluginConfig{{Name: "amount", Kind: PluginValidate, Reject: true}}}); err != nil {
+		t.Errorf("expected a validate plugin accepted, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package redisbridge is the Redis pub/sub bridge that lets several Hooklab
+// replicas share one live stream: every event broadcast by an instance is
+// published to a Redis channel, and events published by other instances are
+// delivered to this instance's SSE subscribers:
+//
+//	bridge, err := redisbridge.New("redis://localhost:6379", redisbridge.DefaultChannel)
+//	...
+//	app := hooklab.New(hooklab.WithBridge(bridge))
+package redisbridge
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/essajiwa/hooklab"
+	"github.com/essajiwa/hooklab/internal/instance"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultChannel is the pub/sub channel used when -redis-channel is not set.
+const DefaultChannel = "hooklab:events"
+
+// publishTimeout bounds how long a broadcast waits for Redis.
+const publishTimeout = time.Second
+
+// message is the JSON message instances exchange on the channel.
+type message struct {
+	Instance string        `json:"instance"` // Instance that captured the event
+	Event    hooklab.Event `json:"event"`
+}
+
+// Bridge fans broadcast events out to other instances through Redis.
+type Bridge struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	channel  string
+	instance string
+}
+
+// New connects to the Redis server at url (e.g. redis://localhost:6379/0) and
+// subscribes to channel.
+func New(url, channel string) (*Bridge, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(options)
+	pubsub := client.Subscribe(context.Background(), channel)
+	// Wait for the subscription so a bad address fails at startup.
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		pubsub.Close()
+		client.Close()
+		return nil, err
+	}
+	return &Bridge{client: client, pubsub: pubsub, channel: channel, instance: instance.Name()}, nil
+}
+
+// Name returns "Redis".
+func (b *Bridge) Name() string { return "Redis" }
+
+// Publish sends an event captured by this instance to the other instances.
+func (b *Bridge) Publish(event hooklab.Event) error {
+	data, err := json.Marshal(message{Instance: b.instance, Event: event})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Receive passes the events published by other instances to deliver until the
+// bridge is closed. The client resubscribes on its own after reconnecting.
+func (b *Bridge) Receive(deliver func(hooklab.Event)) {
+	for msg := range b.pubsub.Channel() {
+		var message message
+		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+			log.Printf("Ignoring malformed message on Redis channel %s: %v", b.channel, err)
+			continue
+		}
+		if message.Instance == b.instance {
+			continue
+		}
+		message.Event.Instance = message.Instance
+		deliver(message.Event)
+	}
+}
+
+// Close unsubscribes and closes the connection.
+func (b *Bridge) Close() error {
+	b.pubsub.Close()
+	return b.client.Close()
+}
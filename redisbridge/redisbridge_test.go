@@ -0,0 +1,50 @@
+package redisbridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/essajiwa/hooklab"
+)
+
+func TestBridgeRelaysEvents(t *testing.T) {
+	server := miniredis.RunT(t)
+	received := make([]chan hooklab.Event, 2)
+	bridges := make([]*Bridge, 2)
+	for i := range bridges {
+		bridge, err := New("redis://"+server.Addr(), DefaultChannel)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		bridge.instance = []string{"pod-a", "pod-b"}[i]
+		bridges[i] = bridge
+		received[i] = make(chan hooklab.Event, 1)
+		go bridge.Receive(func(event hooklab.Event) { received[i] <- event })
+		defer bridge.Close()
+	}
+
+	if err := bridges[0].Publish(hooklab.Event{ID: 1, Key: "payments", Body: `{"amount":5}`}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	select {
+	case event := <-received[1]:
+		if event.Instance != "pod-a" || event.Key != "payments" || event.Body != `{"amount":5}` {
+			t.Errorf("unexpected relayed event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the relayed event")
+	}
+	// An instance doesn't receive its own events.
+	select {
+	case event := <-received[0]:
+		t.Errorf("unexpected own event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	if _, err := New("http://localhost:6379", DefaultChannel); err == nil {
+		t.Error("expected an error for a non-Redis URL")
+	}
+}
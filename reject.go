@@ -0,0 +1,100 @@
+package hooklab
+
+// This file contains the refusal of webhooks that fail a key's checks, such as
+// an IP filter, capture throttling, capture token, signature, or validate
+// plugin, or that arrive while the server drains, and the counters of refused
+// webhooks reported by /api/stats.
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Causes of refused webhooks, as counted in stats.
+const (
+	RejectIP        = "ip"
+	RejectThrottled = "throttled"
+	RejectToken     = "token"
+	RejectSignature = "signature"
+	RejectStale     = "stale"    // A valid signature over a timestamp outside the key's tolerance
+	RejectDraining  = "draining" // The server is shutting down
+	RejectPlugin    = "plugin"   // A validate plugin found the webhook invalid
+)
+
+// maxRejectionKeys is how many webhook keys refused webhooks are counted for
+// separately. Refusals to further keys, such as the random paths of a
+// scanner, are counted under rejectionOtherKeys.
+const maxRejectionKeys = 100
+
+// rejectionOtherKeys is the key refused webhooks to keys past maxRejectionKeys
+// are counted under.
+const rejectionOtherKeys = "(other)"
+
+// rejection describes why a webhook is refused.
+type rejection struct {
+	status int    // Response status
+	cause  string // RejectIP, RejectThrottled, RejectToken, RejectSignature, RejectStale, RejectDraining, or RejectPlugin
+	reason string // Error returned to the sender and stored on recorded events
+	record bool   // Store the refused webhook as a rejected event
+}
+
+// RejectionStats counts refused webhooks since startup.
+type RejectionStats struct {
+	Total  int            `json:"total"`
+	Causes map[string]int `json:"causes"` // Refused webhooks per cause, e.g. "ip"
+	Keys   map[string]int `json:"keys"`   // Refused webhooks per webhook key, up to maxRejectionKeys, then under "(other)"
+}
+
+// rejectWebhook refuses a webhook to key and counts it. When the rejection is
+// recorded, the request is stored as an event marked rejected and broadcast, but
+// not evaluated against rules or published.
+func (a *App) rejectWebhook(w http.ResponseWriter, r *http.Request, key, body string, rej rejection) {
+	a.countRejection(key, rej.cause)
+	trace.SpanFromContext(r.Context()).SetAttributes(attrRejected.String(rej.cause))
+	setResponseStatus(r.Context(), rej.status)
+	if rej.record {
+		event := a.storeEvent(r, key, parseBody(body))
+		a.broadcastEvent(a.markRejected(event, rej.reason))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rej.status)
+	json.NewEncoder(w).Encode(map[string]string{"error": rej.reason})
+}
+
+// markRejected records on a stored event why it was refused and returns the
+// updated event.
+func (a *App) markRejected(event Event, reason string) Event {
+	event.Rejected = reason
+	a.saveEvent(event)
+	return event
+}
+
+// countRejection counts a webhook to key refused for cause.
+func (a *App) countRejection(key, cause string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rejections.Total++
+	a.rejections.Causes[cause]++
+	if _, ok := a.rejections.Keys[key]; !ok && len(a.rejections.Keys) >= maxRejectionKeys {
+		key = rejectionOtherKeys
+	}
+	a.rejections.Keys[key]++
+}
+
+// rejectionStats returns a copy of the refused webhook counters.
+func (a *App) rejectionStats() RejectionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := RejectionStats{Total: a.rejections.Total, Causes: make(map[string]int), Keys: make(map[string]int)}
+	for cause, n := range a.rejections.Causes {
+		stats.Causes[cause] = n
+	}
+	for key, n := range a.rejections.Keys {
+		stats.Keys[key] = n
+	}
+	return stats
+}
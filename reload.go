@@ -0,0 +1,214 @@
+package hooklab
+
+// This file contains reloading the -config file while running, on SIGHUP or
+// POST /api/admin/reload. Changed response configs, rules, and limits are
+// applied in place, so stored events and open SSE streams are kept; other
+// changed settings are reported as needing a restart.
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadableFlags are the flags a reload applies; the file's other settings
+// only take effect on restart.
+var reloadableFlags = []string{"allow-ips", "deny-ips", "capture-rate", "capture-burst", "slow-request", "stream-buffer"}
+
+// configReloader re-reads the -config file and applies what changed since it
+// was last read.
+type configReloader struct {
+	mu              sync.Mutex // serializes reloads
+	path            string
+	flags           *flag.FlagSet   // the serve flags, holding the applied settings
+	explicit        map[string]bool // flags set on the command line, which keep overriding the file
+	config          *FileConfig     // the file as last applied
+	defaultResponse ResponseConfig  // the -response config, restored when the file drops its default
+}
+
+// ReloadResult lists what a reload changed.
+type ReloadResult struct {
+	Responses []string `json:"responses"` // Keys whose response config was replaced or removed
+	Rules     []string `json:"rules"`     // Keys whose rules were replaced
+	Limits    []string `json:"limits"`    // Limit flags that changed
+	Restart   []string `json:"restart"`   // Changed settings that only take effect on restart
+}
+
+// newConfigReloader returns a reloader for the config file at path, which was
+// applied as config to flags, of which explicit were set on the command line.
+func newConfigReloader(path string, flags *flag.FlagSet, explicit map[string]bool, config *FileConfig, defaultResponse ResponseConfig) *configReloader {
+	return &configReloader{path: path, flags: flags, explicit: explicit, config: config, defaultResponse: defaultResponse}
+}
+
+// flagValue returns the parsed value of the flag name in fs.
+func flagValue[T any](fs *flag.FlagSet, name string) T {
+	return fs.Lookup(name).Value.(flag.Getter).Get().(T)
+}
+
+// reload re-reads the file and applies it to app. A file that fails to load or
+// validate changes nothing.
+func (c *configReloader) reload(app *App) (ReloadResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := ReloadResult{Responses: []string{}, Rules: []string{}, Limits: []string{}, Restart: []string{}}
+	next, err := loadFileConfig(c.path)
+	if err != nil {
+		return ReloadResult{}, err
+	}
+	if c.explicit["auth"] || c.explicit["auth-file"] {
+		next.Auth = AuthFileConfig{}
+	}
+	if explicitVerbosity(c.explicit) {
+		next.Verbosity = ""
+	}
+
+	// Flags the file no longer sets go back to their defaults.
+	values := next.flagValues()
+	previous := make(map[string]string)
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if c.explicit[f.Name] {
+			return
+		}
+		value, ok := values[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if value == f.Value.String() {
+			return
+		}
+		if !slices.Contains(reloadableFlags, f.Name) {
+			result.Restart = append(result.Restart, f.Name)
+			return
+		}
+		previous[f.Name] = f.Value.String()
+		result.Limits = append(result.Limits, f.Name)
+		if err == nil {
+			err = c.flags.Set(f.Name, value)
+		}
+	})
+	if !slices.Equal(c.config.Auth.Users, next.Auth.Users) {
+		result.Restart = append(result.Restart, "auth.users")
+	}
+
+	ipFilter := IPFilter{Allow: parseIPList(c.flags.Lookup("allow-ips").Value.String()), Deny: parseIPList(c.flags.Lookup("deny-ips").Value.String())}
+	captureLimit := CaptureLimit{Rate: flagValue[float64](c.flags, "capture-rate"), Burst: flagValue[int](c.flags, "capture-burst")}
+	slowRequest := flagValue[time.Duration](c.flags, "slow-request")
+	streamBuffer := flagValue[int](c.flags, "stream-buffer")
+	switch {
+	case err != nil:
+	case ipFilter.validate() != nil:
+		err = fmt.Errorf("limits.allowIPs or limits.denyIPs: %w", ipFilter.validate())
+	case captureLimit.validate() != nil:
+		err = fmt.Errorf("limits.captureRate or limits.captureBurst: %w", captureLimit.validate())
+	case slowRequest < 0:
+		err = fmt.Errorf("limits.slowRequest %v: must not be negative", slowRequest)
+	case streamBuffer < 1:
+		err = fmt.Errorf("limits.streamBuffer %d: must be at least 1", streamBuffer)
+	}
+	if err != nil {
+		for name, value := range previous {
+			c.flags.Set(name, value)
+		}
+		return ReloadResult{}, err
+	}
+
+	for _, name := range result.Limits {
+		switch name {
+		case "allow-ips", "deny-ips":
+			app.setIPFilter(ipFilter)
+		case "capture-rate", "capture-burst":
+			app.setCaptureLimit(captureLimit)
+		case "slow-request":
+			app.setSlowRequest(slowRequest)
+		case "stream-buffer":
+			app.setStreamBuffer(streamBuffer)
+		}
+	}
+
+	// Keys the file didn't change keep any edits made through the API.
+	for key, config := range next.Responses {
+		if (key == "default" && c.explicit["response"]) || reflect.DeepEqual(c.config.Responses[key], config) {
+			continue
+		}
+		app.setResponseConfig(key, config)
+		result.Responses = append(result.Responses, key)
+	}
+	for key := range c.config.Responses {
+		if _, ok := next.Responses[key]; ok || (key == "default" && c.explicit["response"]) {
+			continue
+		}
+		if key == "default" {
+			app.setResponseConfig(key, c.defaultResponse)
+		} else {
+			app.deleteResponseConfig(key)
+		}
+		result.Responses = append(result.Responses, key)
+	}
+	for key, rules := range next.Rules {
+		if !reflect.DeepEqual(c.config.Rules[key], rules) {
+			app.replaceRules(key, rules)
+			result.Rules = append(result.Rules, key)
+		}
+	}
+	for key := range c.config.Rules {
+		if _, ok := next.Rules[key]; !ok {
+			app.replaceRules(key, nil)
+			result.Rules = append(result.Rules, key)
+		}
+	}
+	c.config = next
+
+	for _, list := range [][]string{result.Responses, result.Rules, result.Limits, result.Restart} {
+		slices.Sort(list)
+	}
+	return result, nil
+}
+
+// reloadConfig reloads the -config file and logs the outcome.
+func (a *App) reloadConfig() (ReloadResult, error) {
+	if a.reloader == nil {
+		return ReloadResult{}, errors.New("hooklab was started without -config")
+	}
+	result, err := a.reloader.reload(a)
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current config: %v", err)
+		return result, err
+	}
+	log.Printf("Reloaded %s: responses [%s], rules [%s], limits [%s]", a.reloader.path,
+		strings.Join(result.Responses, ","), strings.Join(result.Rules, ","), strings.Join(result.Limits, ","))
+	if len(result.Restart) > 0 {
+		log.Printf("Restart hooklab to apply the changed %s", strings.Join(result.Restart, ", "))
+	}
+	return result, nil
+}
+
+// reloadHandler handles POST /api/admin/reload requests, reloading the -config
+// file and returning what changed.
+func (a *App) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if a.reloader == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "hooklab was started without -config"})
+		return
+	}
+	result, err := a.reloadConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
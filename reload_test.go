@@ -0,0 +1,194 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reloadFlags returns the serve flags a reload looks at, parsed from args.
+func reloadFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Int("port", 8080, "")
+	fs.String("response", `{"result":"ok"}`, "")
+	fs.String("allow-ips", "", "")
+	fs.String("deny-ips", "", "")
+	fs.Float64("capture-rate", 0, "")
+	fs.Int("capture-burst", defaultCaptureBurst, "")
+	fs.Duration("slow-request", 0, "")
+	fs.Int("stream-buffer", defaultStreamBuffer, "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// startWithConfig applies the config file at path to a new app the way serve
+// does, and returns the app.
+func startWithConfig(t *testing.T, path string, fs *flag.FlagSet) *App {
+	t.Helper()
+	config, err := loadFileConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit := explicitFlags(fs)
+	if err := config.applyFlags(fs, explicit); err != nil {
+		t.Fatal(err)
+	}
+	app := New()
+	defaultResponse := ResponseConfig{Response: map[string]string{"result": "ok"}, StatusCode: http.StatusOK}
+	app.setResponseConfig("default", defaultResponse)
+	app.applyFileConfig(config, explicit["response"])
+	app.reloader = newConfigReloader(path, fs, explicit, config, defaultResponse)
+	return app
+}
+
+func TestReloadConfig(t *testing.T) {
+	path := writeConfig(t, `
+limits:
+  captureRate: 5
+  slowRequest: 100ms
+responses:
+  default:
+    response: {result: file}
+  orders:
+    response: {ok: true}
+  legacy:
+    response: {ok: true}
+rules:
+  orders:
+    - name: Large
+      condition: body.amount > 1000
+      statusCode: 402
+      enabled: true
+  payments:
+    - name: Refused
+      condition: "true"
+      statusCode: 500
+      enabled: true
+`)
+	fs := reloadFlags(t, "-capture-burst", "7")
+	app := startWithConfig(t, path, fs)
+	stream := app.addSubscriber()
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":5}`)))
+	<-stream
+	app.setResponseConfig("notes", ResponseConfig{StatusCode: http.StatusAccepted})
+	paymentRules := app.getRules("payments")
+
+	os.WriteFile(path, []byte(`
+port: 9000
+limits:
+  captureRate: 10
+  captureBurst: 50
+responses:
+  orders:
+    response: {ok: false}
+    statusCode: 409
+rules:
+  orders:
+    - name: Huge
+      condition: body.amount > 5000
+      statusCode: 402
+      enabled: true
+  payments:
+    - name: Refused
+      condition: "true"
+      statusCode: 500
+      enabled: true
+`), 0o600)
+	result, err := app.reloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Responses, []string{"default", "legacy", "orders"}) || !slices.Equal(result.Rules, []string{"orders"}) {
+		t.Errorf("unexpected responses and rules changed: %+v", result)
+	}
+	if !slices.Equal(result.Limits, []string{"capture-rate", "slow-request"}) || !slices.Equal(result.Restart, []string{"port"}) {
+		t.Errorf("unexpected flags changed: %+v", result)
+	}
+
+	if got := app.getResponseConfig("orders").StatusCode; got != http.StatusConflict {
+		t.Errorf("expected the changed orders response, got status %d", got)
+	}
+	if got := app.getResponseConfig("default").Response; !reflect.DeepEqual(got, map[string]string{"result": "ok"}) {
+		t.Errorf("expected the -response default back, got %v", got)
+	}
+	if _, ok := app.getResponseConfigs()["legacy"]; ok {
+		t.Error("expected the dropped legacy response to be removed")
+	}
+	if got := app.getResponseConfig("notes").StatusCode; got != http.StatusAccepted {
+		t.Errorf("expected a response made through the API to be kept, got status %d", got)
+	}
+	if rules := app.getRules("orders"); len(rules) != 1 || rules[0].Name != "Huge" {
+		t.Errorf("unexpected orders rules %+v", rules)
+	}
+	if rules := app.getRules("payments"); rules[0].ID != paymentRules[0].ID {
+		t.Error("expected unchanged rules to keep their IDs")
+	}
+	if stats := app.streamStats(); stats.Subscribers != 1 {
+		t.Errorf("expected the open stream to be kept, got %d subscribers", stats.Subscribers)
+	}
+	app.mu.Lock()
+	captureLimit, slowRequest := app.captureLimit, app.slowRequest
+	app.mu.Unlock()
+	if captureLimit != (CaptureLimit{Rate: 10, Burst: 7}) || slowRequest != 0 {
+		t.Errorf("expected -capture-burst to keep overriding the file, got %+v and slow request %v", captureLimit, slowRequest)
+	}
+	if _, ok := app.getEvent(1); !ok {
+		t.Error("expected the stored events to be kept")
+	}
+}
+
+func TestReloadConfigInvalid(t *testing.T) {
+	path := writeConfig(t, "limits:\n  captureRate: 5\n")
+	fs := reloadFlags(t)
+	app := startWithConfig(t, path, fs)
+
+	for _, content := range []string{"limits:\n  captureRate: -1\n", "limits:\n  allowIPs: [nonsense]\n", "prot: 8080"} {
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := app.reloadConfig(); err == nil {
+			t.Errorf("%q: expected the reload to fail", content)
+		}
+		if got := flagValue[float64](fs, "capture-rate"); got != 5 {
+			t.Errorf("%q: expected the flags to be left alone, got capture rate %v", content, got)
+		}
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	app := New()
+	w := httptest.NewRecorder()
+	app.reloadHandler(w, httptest.NewRequest(http.MethodPost, "/api/admin/reload", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 without -config, got %d", w.Code)
+	}
+
+	path := writeConfig(t, "responses:\n  orders:\n    statusCode: 201\n")
+	app = startWithConfig(t, path, reloadFlags(t))
+	os.WriteFile(path, []byte("responses:\n  orders:\n    statusCode: 202\n"), 0o600)
+	w = httptest.NewRecorder()
+	app.reloadHandler(w, httptest.NewRequest(http.MethodPost, "/api/admin/reload", nil))
+	var result ReloadResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !slices.Equal(result.Responses, []string{"orders"}) {
+		t.Errorf("unexpected reload response %d %+v", w.Code, result)
+	}
+
+	w = httptest.NewRecorder()
+	app.reloadHandler(w, httptest.NewRequest(http.MethodGet, "/api/admin/reload", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", w.Code)
+	}
+	if role := requiredRole(httptest.NewRequest(http.MethodPost, "/api/admin/reload", nil)); role != RoleAdmin {
+		t.Errorf("expected reloading to need an admin, got %s", role)
+	}
+}
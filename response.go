@@ -0,0 +1,620 @@
+package hooklab
+
+// This file contains response behaviors layered on top of the configured JSON
+// response, such as request echoing, simulated rate limiting, chunked streaming, bandwidth throttling,
+// connection drops, held (black-holed) connections, and malformed responses.
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Connection drop modes for ResponseConfig.Drop.
+const (
+	DropClose   = "close"    // Close the connection without writing a response
+	DropReset   = "reset"    // Reset the connection (TCP RST) without writing a response
+	DropMidBody = "mid-body" // Write headers and half the body, then close the connection
+)
+
+// Malformation modes for ResponseConfig.Malformed.
+const (
+	MalformedJSON        = "invalid-json"       // Truncate the JSON body so it no longer parses
+	MalformedLength      = "wrong-length"       // Declare a Content-Length longer than the body
+	MalformedContentType = "wrong-content-type" // Send the JSON body as text/html
+)
+
+// RateLimitConfig simulates an upstream rate limit: at most Limit requests are
+// answered normally per Window, the rest receive 429 Too Many Requests.
+type RateLimitConfig struct {
+	Limit  int      `json:"limit"`  // Requests allowed per window
+	Window Duration `json:"window"` // Window length, e.g. "1m"
+}
+
+// ChunkConfig streams the response body in chunks of Size bytes, flushing each
+// chunk and pausing for Delay before writing the next one.
+type ChunkConfig struct {
+	Size  int      `json:"size"`  // Bytes per chunk
+	Delay Duration `json:"delay"` // Pause between chunks, e.g. "500ms"
+}
+
+// EchoConfig reflects the incoming request back as the response body.
+type EchoConfig struct {
+	Headers  []string `json:"headers,omitempty"`  // Headers to include (case-insensitive); empty includes all
+	Envelope string   `json:"envelope,omitempty"` // Wrap the echo under this field name, e.g. "echo"
+}
+
+// CookieConfig is a cookie set on the mock response via Set-Cookie.
+type CookieConfig struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"` // Template rendered against the request
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	MaxAge   int    `json:"maxAge,omitempty"` // Seconds; negative deletes the cookie
+	Secure   bool   `json:"secure,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	SameSite string `json:"sameSite,omitempty"` // lax, strict, or none
+}
+
+// sameSiteModes maps the accepted sameSite values to their http.SameSite mode.
+var sameSiteModes = map[string]http.SameSite{
+	"":       http.SameSiteDefaultMode,
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// cookie builds the http.Cookie for the config with the given rendered value.
+func (c CookieConfig) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   c.MaxAge,
+		Secure:   c.Secure,
+		HttpOnly: c.HTTPOnly,
+		SameSite: sameSiteModes[strings.ToLower(c.SameSite)],
+	}
+}
+
+// maxRateWindows bounds the rate limit windows tracked at once; past it,
+// windows that have ended are forgotten, then arbitrary ones.
+const maxRateWindows = 10000
+
+// rateWindow tracks the requests counted in the current fixed window for a key.
+type rateWindow struct {
+	start  time.Time
+	length time.Duration
+	count  int
+}
+
+// rateLimitStatus is the outcome of counting a request against a rate limit.
+type rateLimitStatus struct {
+	limit     int
+	remaining int
+	reset     time.Time
+	allowed   bool
+}
+
+// validateResponseConfig checks the optional behaviors of a response configuration.
+func validateResponseConfig(config ResponseConfig) error {
+	if err := validateTemplates(config.Response); err != nil {
+		return errors.New("invalid response template: " + err.Error())
+	}
+	if config.StatusCodeExpr != "" {
+		if err := validateStatusCodeExpr(config.StatusCodeExpr); err != nil {
+			return errors.New("invalid status code expression: " + err.Error())
+		}
+	}
+	if config.Delay < 0 {
+		return errors.New("delay must not be negative")
+	}
+	if config.ForwardTo != "" {
+		if err := validateTarget(config.ForwardTo); err != nil {
+			return errors.New("forwardTo " + err.Error())
+		}
+	}
+	if config.Redeliver != nil {
+		if err := config.Redeliver.validate(); err != nil {
+			return err
+		}
+	}
+	for i, cookie := range config.Cookies {
+		field := "cookies[" + strconv.Itoa(i) + "]"
+		if _, ok := sameSiteModes[strings.ToLower(cookie.SameSite)]; !ok {
+			return errors.New(field + ".sameSite: must be lax, strict, or none")
+		}
+		if _, err := parseTemplate(cookie.Value); err != nil {
+			return errors.New(field + ".value: invalid template: " + err.Error())
+		}
+		// Validate with a placeholder value since the real one is only known per request.
+		if err := cookie.cookie("value").Valid(); err != nil {
+			return errors.New(field + ": " + err.Error())
+		}
+	}
+	if err := validateGraphQL(config.GraphQL); err != nil {
+		return err
+	}
+	for mediaType, text := range config.Representations {
+		if _, _, err := mime.ParseMediaType(mediaType); err != nil || strings.Contains(mediaType, "*") {
+			return errors.New("representations: invalid media type " + strconv.Quote(mediaType))
+		}
+		if _, err := parseTemplate(text); err != nil {
+			return errors.New("representations." + mediaType + ": invalid template: " + err.Error())
+		}
+	}
+	if config.Location != "" {
+		if _, err := parseTemplate(config.Location); err != nil {
+			return errors.New("invalid location template: " + err.Error())
+		}
+	}
+	if config.Capture != nil {
+		if err := config.Capture.validate(); err != nil {
+			return err
+		}
+	}
+	if config.Verify != nil {
+		if err := config.Verify.validate(); err != nil {
+			return err
+		}
+	}
+	if config.IPFilter != nil {
+		if err := config.IPFilter.validate(); err != nil {
+			return err
+		}
+	}
+	if config.JWT != nil {
+		if err := config.JWT.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validatePlugins(config.Plugins); err != nil {
+		return err
+	}
+	if rl := config.RateLimit; rl != nil {
+		if rl.Limit <= 0 {
+			return errors.New("rateLimit.limit must be positive")
+		}
+		if rl.Window <= 0 {
+			return errors.New("rateLimit.window must be positive")
+		}
+	}
+	if chunked := config.Chunked; chunked != nil {
+		if chunked.Size <= 0 {
+			return errors.New("chunked.size must be positive")
+		}
+		if chunked.Delay < 0 {
+			return errors.New("chunked.delay must not be negative")
+		}
+	}
+	if config.BytesPerSecond < 0 {
+		return errors.New("bytesPerSecond must not be negative")
+	}
+	switch config.RuleMatch {
+	case "", RuleMatchFirst, RuleMatchLast, RuleMatchMerge:
+	default:
+		return errors.New("ruleMatch must be first, last, or merge")
+	}
+	if config.Hold < 0 {
+		return errors.New("hold must not be negative")
+	}
+	switch config.Drop {
+	case "", DropClose, DropReset, DropMidBody:
+	default:
+		return errors.New("drop must be one of: close, reset, mid-body")
+	}
+	switch config.Malformed {
+	case "", MalformedJSON, MalformedLength, MalformedContentType:
+	default:
+		return errors.New("malformed must be one of: invalid-json, wrong-length, wrong-content-type")
+	}
+	for method, override := range config.Methods {
+		if len(override.Methods) > 0 {
+			return errors.New("methods." + method + ": nested method overrides are not supported")
+		}
+		if override.RateLimit != nil {
+			return errors.New("methods." + method + ": rateLimit applies to the whole key")
+		}
+		if override.Capture != nil {
+			return errors.New("methods." + method + ": capture applies to the whole key")
+		}
+		if override.Verify != nil {
+			return errors.New("methods." + method + ": verify applies to the whole key")
+		}
+		if override.IPFilter != nil {
+			return errors.New("methods." + method + ": ipFilter applies to the whole key")
+		}
+		if override.JWT != nil {
+			return errors.New("methods." + method + ": jwt applies to the whole key")
+		}
+		if err := validateResponseConfig(override); err != nil {
+			return errors.New("methods." + method + ": " + err.Error())
+		}
+	}
+	for i, variant := range config.Variants {
+		prefix := "variants[" + strconv.Itoa(i) + "]: "
+		if variant.Weight <= 0 {
+			return errors.New(prefix + "weight must be positive")
+		}
+		if len(variant.Variants) > 0 || len(variant.Methods) > 0 {
+			return errors.New(prefix + "nested variants and method overrides are not supported")
+		}
+		if variant.RateLimit != nil {
+			return errors.New(prefix + "rateLimit applies to the whole key")
+		}
+		if err := validateResponseConfig(variant.ResponseConfig); err != nil {
+			return errors.New(prefix + err.Error())
+		}
+	}
+	return nil
+}
+
+// checkRateLimit counts a request for key against the given limit using fixed windows.
+// Requests over the limit are not counted, so the window resets on schedule.
+func (a *App) checkRateLimit(key string, limit RateLimitConfig, now time.Time) rateLimitStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	window := time.Duration(limit.Window)
+	current, ok := a.rateWindows[key]
+	if !ok && len(a.rateWindows) >= maxRateWindows {
+		a.pruneRateWindowsLocked(now)
+	}
+	if !ok || now.Sub(current.start) >= window {
+		current = rateWindow{start: now, length: window}
+	}
+
+	status := rateLimitStatus{
+		limit: limit.Limit,
+		reset: current.start.Add(window),
+	}
+	if current.count < limit.Limit {
+		current.count++
+		status.allowed = true
+	}
+	status.remaining = limit.Limit - current.count
+	a.rateWindows[key] = current
+	return status
+}
+
+// pruneRateWindowsLocked forgets windows that have ended by now, which behave
+// like new ones. If that isn't enough, it forgets arbitrary windows, so
+// webhooks spread over many keys can't grow the map without bound. The caller
+// must hold a.mu.
+func (a *App) pruneRateWindowsLocked(now time.Time) {
+	for key, window := range a.rateWindows {
+		if now.Sub(window.start) >= window.length {
+			delete(a.rateWindows, key)
+		}
+	}
+	for key := range a.rateWindows {
+		if len(a.rateWindows) < maxRateWindows {
+			break
+		}
+		delete(a.rateWindows, key)
+	}
+}
+
+// setRateLimitHeaders writes the conventional X-RateLimit-* headers and, for
+// rejected requests, Retry-After in whole seconds.
+func setRateLimitHeaders(w http.ResponseWriter, status rateLimitStatus, now time.Time) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(status.reset.Unix(), 10))
+	if !status.allowed {
+		setRetryAfter(w, status.reset.Sub(now))
+	}
+}
+
+// writeRateLimited writes the 429 response returned once a key's limit is exhausted.
+func writeRateLimited(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{"error": "rate limit exceeded"})
+}
+
+// writeResponse writes the configured JSON response, including the templated
+// body and Location header and any body streaming behavior. env is the request's
+// expression environment, used by status code expressions.
+func (a *App) writeResponse(w http.ResponseWriter, r *http.Request, key string, body *requestBody, env map[string]interface{}, config ResponseConfig) {
+	if !injectDelay(r.Context(), time.Duration(config.Delay)) {
+		return
+	}
+	if config.ForwardTo != "" {
+		done := a.startForward()
+		defer done()
+		forwardResponse(w, r, body.text, config.ForwardTo)
+		return
+	}
+
+	renderStart := time.Now()
+	data := requestTemplateData(r, key, body)
+	data["captures"] = config.captures
+	funcs := a.templateFuncs(key)
+	if config.StatusCodeExpr != "" {
+		// Like rule conditions, expressions that fail at request time are skipped
+		// and the static StatusCode is used instead.
+		if code, err := evaluateStatusCode(config.StatusCodeExpr, env); err == nil {
+			config.StatusCode = code
+		}
+	}
+
+	payload, contentType, err := renderPayload(r, data, funcs, config)
+	if err != nil {
+		setResponseStatus(r.Context(), http.StatusInternalServerError)
+		http.Error(w, "Error rendering response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if len(config.Representations) > 0 {
+		w.Header().Add("Vary", "Accept")
+	}
+	if config.Location != "" {
+		location, err := renderTemplate(config.Location, data, funcs)
+		if err != nil {
+			setResponseStatus(r.Context(), http.StatusInternalServerError)
+			http.Error(w, "Error rendering location", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", location)
+	}
+	for _, cookie := range config.Cookies {
+		value, err := renderTemplate(cookie.Value, data, funcs)
+		if err != nil {
+			setResponseStatus(r.Context(), http.StatusInternalServerError)
+			http.Error(w, "Error rendering cookie", http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, cookie.cookie(value))
+	}
+	timePhase(r.Context(), PhaseRender, renderStart)
+	payload = malformResponse(w.Header(), payload, config.Malformed)
+	if config.Hold > 0 || config.Blackhole {
+		if !a.holdConnection(r.Context(), config) {
+			return
+		}
+		if config.Drop == "" {
+			config.Drop = DropClose
+		}
+	}
+	setResponseStatus(r.Context(), cmp.Or(config.StatusCode, http.StatusOK))
+	if config.Drop != "" {
+		if err := dropConnection(w, config.StatusCode, payload, config.Drop); err != nil {
+			http.Error(w, "Error dropping connection: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if config.StatusCode != 0 {
+		w.WriteHeader(config.StatusCode)
+	}
+	if err := writeBody(w, r, payload, config); err != nil {
+		http.Error(w, "Error creating response", http.StatusInternalServerError)
+	}
+}
+
+// renderPayload renders the response body and returns it with its content type.
+// The representation is negotiated from the request's Accept header; JSON from
+// Response (or the echo document) is the default.
+func renderPayload(r *http.Request, data map[string]interface{}, funcs template.FuncMap, config ResponseConfig) ([]byte, string, error) {
+	if config.Echo == nil && len(config.Representations) > 0 {
+		mediaType := negotiateMediaType(r.Header.Get("Accept"), config.Representations)
+		if mediaType != "" {
+			rendered, err := renderTemplate(config.Representations[mediaType], data, funcs)
+			if err != nil {
+				return nil, "", err
+			}
+			return []byte(rendered), mediaType, nil
+		}
+	}
+
+	var response interface{}
+	if config.Echo != nil {
+		response = echoRequest(r, data, config.Echo)
+	} else {
+		value := config.Response
+		if document, ok := config.graphQLResult(data["body"]); ok {
+			value = document
+		}
+		rendered, err := renderValue(value, data, funcs)
+		if err != nil {
+			return nil, "", err
+		}
+		response = rendered
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return nil, "", err
+	}
+	return append(payload, '\n'), "application/json", nil
+}
+
+// echoRequest builds the echo document for a request from its template data:
+// method, path, query, the selected headers, and the parsed body.
+func echoRequest(r *http.Request, data map[string]interface{}, echo *EchoConfig) interface{} {
+	headers := r.Header
+	if len(echo.Headers) > 0 {
+		headers = make(http.Header)
+		for _, name := range echo.Headers {
+			if values := r.Header.Values(name); len(values) > 0 {
+				headers[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	}
+
+	document := map[string]interface{}{
+		"method":  data["method"],
+		"path":    data["path"],
+		"query":   r.URL.Query(),
+		"headers": headers,
+		"body":    data["body"],
+	}
+	if echo.Envelope != "" {
+		return map[string]interface{}{echo.Envelope: document}
+	}
+	return document
+}
+
+// malformResponse corrupts the payload or headers according to mode and returns
+// the payload to write. An overstated Content-Length makes the server close the
+// connection once the shorter body has been written.
+func malformResponse(header http.Header, payload []byte, mode string) []byte {
+	switch mode {
+	case MalformedJSON:
+		trimmed := bytes.TrimRight(payload, "\n")
+		if len(trimmed) > 1 {
+			return trimmed[:len(trimmed)-1]
+		}
+		return []byte("{")
+	case MalformedLength:
+		header.Set("Content-Length", strconv.Itoa(len(payload)+16))
+	case MalformedContentType:
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	return payload
+}
+
+// writeBody writes the response payload. Without chunking or throttling the payload
+// is written at once; otherwise it is streamed until done or the client goes away.
+func writeBody(w http.ResponseWriter, r *http.Request, payload []byte, config ResponseConfig) error {
+	if config.Chunked == nil && config.BytesPerSecond <= 0 {
+		_, err := w.Write(payload)
+		return err
+	}
+
+	ctx := r.Context()
+	size := len(payload)
+	var delay time.Duration
+	if config.Chunked != nil {
+		size = config.Chunked.Size
+		delay = time.Duration(config.Chunked.Delay)
+	}
+
+	for len(payload) > 0 {
+		n := min(size, len(payload))
+		if err := writeThrottled(ctx, w, payload[:n], config.BytesPerSecond); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if ctx.Err() != nil {
+			return nil
+		}
+		if len(payload) > 0 && !injectDelay(ctx, delay) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// writeThrottled writes p and flushes it, capped at bytesPerSecond when positive.
+// Throttled data is sent in slices of roughly a tenth of a second each.
+func writeThrottled(ctx context.Context, w http.ResponseWriter, p []byte, bytesPerSecond int) error {
+	flusher, _ := w.(http.Flusher)
+	step := len(p)
+	if bytesPerSecond > 0 {
+		step = max(bytesPerSecond/10, 1)
+	}
+
+	for len(p) > 0 {
+		n := min(step, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		p = p[n:]
+		if bytesPerSecond > 0 && !injectDelay(ctx, time.Duration(n)*time.Second/time.Duration(bytesPerSecond)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// dropConnection hijacks the client connection and terminates it according to mode,
+// so senders can be tested against connection failures instead of HTTP errors.
+func dropConnection(w http.ResponseWriter, statusCode int, payload []byte, mode string) error {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("connection hijacking unsupported")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch mode {
+	case DropReset:
+		raw := conn
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			raw = tlsConn.NetConn()
+		}
+		if tcpConn, ok := raw.(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+		// Closing the TLS connection would send a close_notify alert first.
+		return raw.Close()
+	case DropMidBody:
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		header := w.Header().Clone()
+		header.Set("Content-Length", strconv.Itoa(len(payload)))
+		fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+		header.Write(buf)
+		buf.WriteString("\r\n")
+		buf.Write(payload[:len(payload)/2])
+		return buf.Flush()
+	}
+	return nil
+}
+
+// holdConnection keeps a request unanswered for config.Hold, or indefinitely for a
+// black hole. It returns false if the client gave up first, in which case there is
+// nobody left to answer; otherwise the caller drops the connection.
+func (a *App) holdConnection(ctx context.Context, config ResponseConfig) bool {
+	defer timePhase(ctx, PhaseDelay, time.Now())
+	var elapsed <-chan time.Time
+	if !config.Blackhole {
+		timer := time.NewTimer(time.Duration(config.Hold))
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-a.shutdownSignal():
+		return true
+	case <-elapsed:
+		return true
+	}
+}
+
+// sleepContext pauses for d, returning false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,561 @@
+package hooklab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationJSON(t *testing.T) {
+	var d Duration
+	if err := json.Unmarshal([]byte(`"1m30s"`), &d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Duration(d) != 90*time.Second {
+		t.Errorf("Duration unmarshal: got %v want 1m30s", time.Duration(d))
+	}
+
+	encoded, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(encoded) != `"1m30s"` {
+		t.Errorf("Duration marshal: got %s", encoded)
+	}
+
+	if err := json.Unmarshal([]byte(`90`), &d); err == nil {
+		t.Error("expected error for numeric duration")
+	}
+	if err := json.Unmarshal([]byte(`"soon"`), &d); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
+
+func TestCheckRateLimitWindow(t *testing.T) {
+	app := New()
+	limit := RateLimitConfig{Limit: 2, Window: Duration(time.Minute)}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if status := app.checkRateLimit("orders", limit, now); !status.allowed {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+
+	status := app.checkRateLimit("orders", limit, now.Add(10*time.Second))
+	if status.allowed {
+		t.Error("third request in window should be rejected")
+	}
+	if status.remaining != 0 {
+		t.Errorf("expected 0 remaining, got %d", status.remaining)
+	}
+	if !status.reset.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected reset time: got %v want %v", status.reset, now.Add(time.Minute))
+	}
+
+	if status := app.checkRateLimit("other", limit, now); !status.allowed {
+		t.Error("limits should be tracked per key")
+	}
+
+	if status := app.checkRateLimit("orders", limit, now.Add(time.Minute)); !status.allowed || status.remaining != 1 {
+		t.Errorf("new window should reset the counter: got %+v", status)
+	}
+}
+
+func TestPruneRateWindows(t *testing.T) {
+	app := New()
+	limit := RateLimitConfig{Limit: 1, Window: Duration(time.Minute)}
+	now := time.Now()
+	for i := 0; i < maxRateWindows; i++ {
+		app.checkRateLimit(strconv.Itoa(i), limit, now)
+	}
+
+	if status := app.checkRateLimit("orders", limit, now); !status.allowed {
+		t.Error("expected a new key to get a window when the map is full")
+	}
+	if n := len(app.rateWindows); n > maxRateWindows {
+		t.Errorf("expected at most %d windows, got %d", maxRateWindows, n)
+	}
+	app.checkRateLimit("payments", limit, now.Add(time.Minute))
+	if n := len(app.rateWindows); n != 1 {
+		t.Errorf("expected ended windows to be forgotten, got %d", n)
+	}
+}
+
+func TestWebhookHandlerRateLimited(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{
+		Response:   map[string]string{"result": "ok"},
+		StatusCode: http.StatusOK,
+		RateLimit:  &RateLimitConfig{Limit: 1, Window: Duration(time.Hour)},
+	})
+
+	first := httptest.NewRecorder()
+	app.webhookHandler(first, httptest.NewRequest(http.MethodPost, "/webhook/orders", nil))
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request wrong status: got %v want 200", first.Code)
+	}
+	if got := first.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("first request wrong X-RateLimit-Remaining: got %q want 0", got)
+	}
+
+	second := httptest.NewRecorder()
+	app.webhookHandler(second, httptest.NewRequest(http.MethodPost, "/webhook/orders", nil))
+	if second.Code != http.StatusTooManyRequests {
+		t.Errorf("second request wrong status: got %v want 429", second.Code)
+	}
+	if got := second.Header().Get("Retry-After"); got == "" {
+		t.Error("second request missing Retry-After header")
+	}
+	if got := second.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("second request wrong X-RateLimit-Limit: got %q want 1", got)
+	}
+
+	app.mu.Lock()
+	captured := len(app.store.Events())
+	app.mu.Unlock()
+	if captured != 2 {
+		t.Errorf("rate-limited requests should still be captured: got %d events want 2", captured)
+	}
+}
+
+func TestResponseHandlerPostInvalidRateLimit(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"rateLimit":{"limit":0,"window":"1m"}}`,
+		`{"rateLimit":{"limit":5}}`,
+		`{"rateLimit":{"limit":5,"window":"often"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response?key=orders", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("response handler wrong status for %s: got %v want 400", body, res.Code)
+		}
+	}
+}
+
+func TestWebhookHandlerChunkedResponse(t *testing.T) {
+	app := New()
+	app.setResponseConfig("slow", ResponseConfig{
+		Response:   map[string]string{"status": "accepted"},
+		StatusCode: http.StatusOK,
+		Chunked:    &ChunkConfig{Size: 4, Delay: Duration(time.Millisecond)},
+	})
+
+	writer := &sseWriter{}
+	app.webhookHandler(writer, httptest.NewRequest(http.MethodPost, "/webhook/slow", nil))
+
+	if got := writer.buffer.String(); got != "{\"status\":\"accepted\"}\n" {
+		t.Errorf("chunked response body: got %q", got)
+	}
+}
+
+func TestWriteBodyChunkedStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil).WithContext(ctx)
+	res := httptest.NewRecorder()
+
+	config := ResponseConfig{Chunked: &ChunkConfig{Size: 2, Delay: Duration(time.Hour)}}
+	if err := writeBody(res, req, []byte("abcdef"), config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := res.Body.String(); got != "ab" {
+		t.Errorf("writeBody should stop after first chunk when cancelled: got %q", got)
+	}
+	if !res.Flushed {
+		t.Error("writeBody should flush each chunk")
+	}
+}
+
+func TestWriteBodyThrottled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	res := httptest.NewRecorder()
+
+	start := time.Now()
+	payload := []byte("0123456789abcdefghij")
+	if err := writeBody(res, req, payload, ResponseConfig{BytesPerSecond: 100}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if res.Body.String() != string(payload) {
+		t.Errorf("throttled body: got %q want %q", res.Body.String(), payload)
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("20 bytes at 100 B/s should take about 200ms, took %v", elapsed)
+	}
+}
+
+func TestResponseHandlerPostNegativeBandwidth(t *testing.T) {
+	app := New()
+	req := httptest.NewRequest(http.MethodPost, "/api/response?key=slow", bytes.NewBufferString(`{"bytesPerSecond":-1}`))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("response handler wrong status for negative bandwidth: got %v want 400", res.Code)
+	}
+}
+
+func TestWebhookHandlerDropConnection(t *testing.T) {
+	app := New()
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	for _, mode := range []string{DropClose, DropReset} {
+		app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: http.StatusOK, Drop: mode})
+		res, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+		if err == nil {
+			res.Body.Close()
+			t.Errorf("drop %q: expected connection error, got status %v", mode, res.StatusCode)
+		}
+	}
+
+	app.mu.Lock()
+	captured := len(app.store.Events())
+	app.mu.Unlock()
+	if captured != 2 {
+		t.Errorf("dropped requests should still be captured: got %d events want 2", captured)
+	}
+}
+
+func TestWebhookHandlerDropMidBody(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{
+		Response:   map[string]string{"status": "accepted"},
+		StatusCode: http.StatusAccepted,
+		Drop:       DropMidBody,
+	})
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("expected headers before the drop, got error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("mid-body drop wrong status: got %v want 202", res.StatusCode)
+	}
+	if _, err := io.ReadAll(res.Body); err == nil {
+		t.Error("expected error reading truncated body")
+	}
+}
+
+func TestWebhookHandlerDropUnsupported(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: http.StatusOK, Drop: DropClose})
+
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("drop without hijacker wrong status: got %v want 500", res.Code)
+	}
+}
+
+func TestMalformResponse(t *testing.T) {
+	payload := []byte("{\"ok\":true}\n")
+
+	header := make(http.Header)
+	got := malformResponse(header, payload, MalformedJSON)
+	if json.Valid(got) {
+		t.Errorf("invalid-json should not produce valid JSON: got %q", got)
+	}
+
+	header = make(http.Header)
+	got = malformResponse(header, payload, MalformedContentType)
+	if string(got) != string(payload) || header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("wrong-content-type: got body %q content type %q", got, header.Get("Content-Type"))
+	}
+
+	header = make(http.Header)
+	malformResponse(header, payload, MalformedLength)
+	if header.Get("Content-Length") != "28" {
+		t.Errorf("wrong-length: got Content-Length %q want 28", header.Get("Content-Length"))
+	}
+}
+
+func TestWebhookHandlerWrongContentLength(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: map[string]bool{"ok": true}, StatusCode: http.StatusOK, Malformed: MalformedLength})
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if _, err := io.ReadAll(res.Body); err == nil {
+		t.Error("expected error reading body shorter than Content-Length")
+	}
+}
+
+func TestResponseHandlerPostInvalidMalformed(t *testing.T) {
+	app := New()
+	req := httptest.NewRequest(http.MethodPost, "/api/response", bytes.NewBufferString(`{"malformed":"sometimes"}`))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("response handler wrong status for unknown malformed mode: got %v want 400", res.Code)
+	}
+}
+
+func TestPickVariantWeights(t *testing.T) {
+	config := ResponseConfig{
+		Response:   "base",
+		StatusCode: http.StatusOK,
+		Variants: []ResponseVariant{
+			{Weight: 3, ResponseConfig: ResponseConfig{Response: "ok", StatusCode: http.StatusOK}},
+			{Weight: 1, ResponseConfig: ResponseConfig{Response: "error", StatusCode: http.StatusInternalServerError}},
+		},
+	}
+
+	counts := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		counts[config.pickVariant().StatusCode]++
+	}
+	if counts[http.StatusOK] < 2700 || counts[http.StatusOK] > 3300 {
+		t.Errorf("expected about 75%% success responses, got %d of 4000", counts[http.StatusOK])
+	}
+	if counts[http.StatusOK]+counts[http.StatusInternalServerError] != 4000 {
+		t.Errorf("pickVariant returned the base config: %v", counts)
+	}
+
+	if got := (ResponseConfig{Response: "base"}).pickVariant(); got.Response != "base" {
+		t.Errorf("config without variants should be returned as is: got %v", got.Response)
+	}
+}
+
+func TestResponseHandlerPostVariants(t *testing.T) {
+	app := New()
+	body := `{"variants":[{"weight":1,"response":{"ok":false},"statusCode":503}]}`
+	res := httptest.NewRecorder()
+	app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response?key=flaky", bytes.NewBufferString(body)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("response handler post wrong status: got %v want 200", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook/flaky", nil))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("webhook handler should answer with the only variant: got %v want 503", res.Code)
+	}
+
+	for _, invalid := range []string{
+		`{"variants":[{"weight":0,"statusCode":200}]}`,
+		`{"variants":[{"weight":1,"variants":[{"weight":1}]}]}`,
+		`{"variants":[{"weight":1,"drop":"sometimes"}]}`,
+	} {
+		res := httptest.NewRecorder()
+		app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response?key=flaky", bytes.NewBufferString(invalid)))
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("response handler wrong status for %s: got %v want 400", invalid, res.Code)
+		}
+	}
+}
+
+func TestWebhookHandlerHoldThenClose(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: http.StatusOK, Hold: Duration(50 * time.Millisecond)})
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	start := time.Now()
+	res, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+	if err == nil {
+		res.Body.Close()
+		t.Fatalf("held request should never be answered, got status %v", res.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("connection closed before hold elapsed: %v", elapsed)
+	}
+}
+
+func TestWebhookHandlerBlackhole(t *testing.T) {
+	app := New()
+	app.setResponseConfig("default", ResponseConfig{Response: "ok", StatusCode: http.StatusOK, Blackhole: true})
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if res, err := client.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`)); err == nil {
+		res.Body.Close()
+		t.Fatalf("black-holed request should time out, got status %v", res.StatusCode)
+	}
+
+	app.mu.Lock()
+	captured := len(app.store.Events())
+	app.mu.Unlock()
+	if captured != 1 {
+		t.Errorf("black-holed request should be captured: got %d events want 1", captured)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		res, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+		if err == nil {
+			res.Body.Close()
+		}
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	app.beginShutdown()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("black-holed request should be dropped on shutdown, not answered")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not release black-holed request")
+	}
+}
+
+func TestWebhookHandlerEcho(t *testing.T) {
+	app := New()
+	app.setResponseConfig("mirror", ResponseConfig{
+		StatusCode: http.StatusOK,
+		Echo:       &EchoConfig{Headers: []string{"x-signature"}, Envelope: "echo"},
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/webhook/mirror?attempt=2", strings.NewReader(`{"id":7}`))
+	req.Header.Set("X-Signature", "sha256=abc")
+	req.Header.Set("Authorization", "Bearer secret")
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, req)
+
+	var payload struct {
+		Echo struct {
+			Method  string              `json:"method"`
+			Path    string              `json:"path"`
+			Query   map[string][]string `json:"query"`
+			Headers map[string][]string `json:"headers"`
+			Body    map[string]float64  `json:"body"`
+		} `json:"echo"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to parse echo response: %v", err)
+	}
+	echo := payload.Echo
+	if echo.Method != http.MethodPut || echo.Path != "/webhook/mirror" || echo.Query["attempt"][0] != "2" {
+		t.Errorf("echo returned wrong request line: %+v", echo)
+	}
+	if echo.Body["id"] != 7 {
+		t.Errorf("echo returned wrong body: %+v", echo.Body)
+	}
+	if len(echo.Headers) != 1 || echo.Headers["X-Signature"][0] != "sha256=abc" {
+		t.Errorf("echo should only include selected headers: %+v", echo.Headers)
+	}
+}
+
+func TestEchoRequestAllHeadersWithoutEnvelope(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("plain"))
+	req.Header.Set("X-One", "1")
+	req.Header.Set("X-Two", "2")
+
+	document := echoRequest(req, requestTemplateData(req, "default", parseBody("plain")), &EchoConfig{}).(map[string]interface{})
+	if headers := document["headers"].(http.Header); len(headers) != 2 {
+		t.Errorf("echo without header selection should include all headers: %v", headers)
+	}
+	if document["body"] != "plain" {
+		t.Errorf("echo should return non-JSON bodies as strings: %v", document["body"])
+	}
+}
+
+func TestWebhookHandlerStatusCodeExpr(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{
+		Response:       map[string]interface{}{"ok": true},
+		StatusCode:     http.StatusAccepted,
+		StatusCodeExpr: `method == "DELETE" ? 409 : body.code`,
+	})
+
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{http.MethodDelete, ``, http.StatusConflict},
+		{http.MethodPost, `{"code": 201}`, http.StatusCreated},
+		{http.MethodPost, `{"code": 42}`, http.StatusAccepted},    // out of range falls back
+		{http.MethodPost, `{"code": "x"}`, http.StatusAccepted},   // non-numeric falls back
+		{http.MethodPost, `{"code": 201.5}`, http.StatusAccepted}, // fractional falls back
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/webhook/orders", strings.NewReader(tt.body))
+		res := httptest.NewRecorder()
+		app.webhookHandler(res, req)
+		if res.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.body, tt.want, res.Code)
+		}
+	}
+}
+
+func TestResponseHandlerPostInvalidStatusCodeExpr(t *testing.T) {
+	app := New()
+	req := httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(`{"statusCode":200,"statusCodeExpr":"1 +"}`))
+	res := httptest.NewRecorder()
+	app.responseHandler(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", res.Code)
+	}
+}
+
+func TestWebhookHandlerCookies(t *testing.T) {
+	app := New()
+	app.setResponseConfig("oauth", ResponseConfig{
+		StatusCode: http.StatusFound,
+		Location:   "/done",
+		Cookies: []CookieConfig{
+			{Name: "session", Value: "sess_{{.query.code}}", Path: "/", MaxAge: 3600, Secure: true, HTTPOnly: true, SameSite: "Lax"},
+			{Name: "state", MaxAge: -1},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/webhook/oauth?code=abc", nil)
+	res := httptest.NewRecorder()
+	app.webhookHandler(res, req)
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d: %v", len(cookies), res.Header()["Set-Cookie"])
+	}
+	session := cookies[0]
+	if session.Name != "session" || session.Value != "sess_abc" || session.Path != "/" || session.MaxAge != 3600 {
+		t.Errorf("unexpected session cookie: %+v", session)
+	}
+	if !session.Secure || !session.HttpOnly || session.SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie flags not set: %+v", session)
+	}
+	if cookies[1].Name != "state" || cookies[1].MaxAge >= 0 {
+		t.Errorf("state cookie should be deleted: %+v", cookies[1])
+	}
+}
+
+func TestResponseHandlerPostInvalidCookies(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"cookies":[{"name":"","value":"x"}]}`,
+		`{"cookies":[{"name":"bad name","value":"x"}]}`,
+		`{"cookies":[{"name":"a","value":"x","sameSite":"sometimes"}]}`,
+		`{"cookies":[{"name":"a","value":"{{.query"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		app.responseHandler(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, res.Code)
+		}
+	}
+}
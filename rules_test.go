@@ -1,17 +1,21 @@
-package main
+package hooklab
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // ==================== Rule CRUD Tests ====================
 
 func TestGetRulesEmpty(t *testing.T) {
-	app := &App{}
+	app := New()
 	rules := app.getRules("test-key")
 	if len(rules) != 0 {
 		t.Errorf("expected empty rules, got %d", len(rules))
@@ -19,7 +23,7 @@ func TestGetRulesEmpty(t *testing.T) {
 }
 
 func TestAddRule(t *testing.T) {
-	app := &App{}
+	app := New()
 	rule := Rule{
 		Name:       "Test Rule",
 		Condition:  "body.amount > 100",
@@ -45,7 +49,7 @@ func TestAddRule(t *testing.T) {
 }
 
 func TestAddMultipleRules(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	app.addRule("key1", Rule{Name: "Rule 1", Priority: 2})
 	app.addRule("key1", Rule{Name: "Rule 2", Priority: 1})
@@ -67,7 +71,7 @@ func TestAddMultipleRules(t *testing.T) {
 }
 
 func TestUpdateRule(t *testing.T) {
-	app := &App{}
+	app := New()
 	created := app.addRule("test", Rule{Name: "Original", Priority: 1})
 
 	updated := Rule{
@@ -97,7 +101,7 @@ func TestUpdateRule(t *testing.T) {
 }
 
 func TestUpdateRuleNotFound(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{Name: "Existing"})
 
 	success := app.updateRule("test", "nonexistent", Rule{Name: "New"})
@@ -105,7 +109,7 @@ func TestUpdateRuleNotFound(t *testing.T) {
 		t.Error("expected update to fail for nonexistent rule")
 	}
 
-	app2 := &App{}
+	app2 := New()
 	success = app2.updateRule("test", "any", Rule{})
 	if success {
 		t.Error("expected update to fail with nil rules map")
@@ -113,7 +117,7 @@ func TestUpdateRuleNotFound(t *testing.T) {
 }
 
 func TestDeleteRule(t *testing.T) {
-	app := &App{}
+	app := New()
 	rule1 := app.addRule("test", Rule{Name: "Rule 1"})
 	app.addRule("test", Rule{Name: "Rule 2"})
 
@@ -132,7 +136,7 @@ func TestDeleteRule(t *testing.T) {
 }
 
 func TestDeleteRuleNotFound(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{Name: "Existing"})
 
 	success := app.deleteRule("test", "nonexistent")
@@ -140,7 +144,7 @@ func TestDeleteRuleNotFound(t *testing.T) {
 		t.Error("expected delete to fail for nonexistent rule")
 	}
 
-	app2 := &App{}
+	app2 := New()
 	success = app2.deleteRule("test", "any")
 	if success {
 		t.Error("expected delete to fail with nil rules map")
@@ -148,7 +152,7 @@ func TestDeleteRuleNotFound(t *testing.T) {
 }
 
 func TestSetRules(t *testing.T) {
-	app := &App{}
+	app := New()
 	rules := []Rule{
 		{ID: "r1", Name: "Rule 1"},
 		{ID: "r2", Name: "Rule 2"},
@@ -163,11 +167,8 @@ func TestSetRules(t *testing.T) {
 }
 
 func TestGetRulesNilKeyRules(t *testing.T) {
-	app := &App{
-		rules: map[string][]Rule{
-			"other": {{Name: "Other"}},
-		},
-	}
+	app := New()
+	app.rules["other"] = []Rule{{Name: "Other"}}
 
 	rules := app.getRules("nonexistent")
 	if len(rules) != 0 {
@@ -178,7 +179,7 @@ func TestGetRulesNilKeyRules(t *testing.T) {
 // ==================== Rule Evaluation Tests ====================
 
 func TestEvaluateRulesNoRules(t *testing.T) {
-	app := &App{}
+	app := New()
 	result, err := app.evaluateRules("test", `{"amount": 100}`, "POST", nil)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -189,7 +190,7 @@ func TestEvaluateRulesNoRules(t *testing.T) {
 }
 
 func TestEvaluateRulesSimpleMatch(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "High Amount",
 		Condition:  "body.amount > 50",
@@ -212,7 +213,7 @@ func TestEvaluateRulesSimpleMatch(t *testing.T) {
 }
 
 func TestEvaluateRulesNoMatch(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "High Amount",
 		Condition:  "body.amount > 100",
@@ -232,7 +233,7 @@ func TestEvaluateRulesNoMatch(t *testing.T) {
 }
 
 func TestEvaluateRulesDisabledRule(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Disabled Rule",
 		Condition:  "true",
@@ -252,7 +253,7 @@ func TestEvaluateRulesDisabledRule(t *testing.T) {
 }
 
 func TestEvaluateRulesPriorityOrder(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Low Priority",
 		Condition:  "true",
@@ -280,7 +281,7 @@ func TestEvaluateRulesPriorityOrder(t *testing.T) {
 }
 
 func TestEvaluateRulesMethodCondition(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "POST Only",
 		Condition:  `method == "POST"`,
@@ -302,7 +303,7 @@ func TestEvaluateRulesMethodCondition(t *testing.T) {
 }
 
 func TestEvaluateRulesHeaderCondition(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Has Auth",
 		Condition:  `"Authorization" in headers`,
@@ -328,7 +329,7 @@ func TestEvaluateRulesHeaderCondition(t *testing.T) {
 }
 
 func TestEvaluateRulesInvalidExpression(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Invalid",
 		Condition:  "this is not valid syntax !!!",
@@ -348,7 +349,7 @@ func TestEvaluateRulesInvalidExpression(t *testing.T) {
 }
 
 func TestEvaluateRulesNonJSONBody(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Always Match",
 		Condition:  "true",
@@ -368,7 +369,7 @@ func TestEvaluateRulesNonJSONBody(t *testing.T) {
 }
 
 func TestEvaluateRulesComplexCondition(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Complex",
 		Condition:  `body.type == "payment" && body.amount >= 100`,
@@ -395,7 +396,7 @@ func TestEvaluateRulesComplexCondition(t *testing.T) {
 }
 
 func TestEvaluateRulesExpressionRuntimeError(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Runtime Error",
 		Condition:  "body.nonexistent.deep.path > 0",
@@ -415,7 +416,7 @@ func TestEvaluateRulesExpressionRuntimeError(t *testing.T) {
 }
 
 func TestEvaluateRulesEmptyBody(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{
 		Name:       "Always True",
 		Condition:  "true",
@@ -437,7 +438,7 @@ func TestEvaluateRulesEmptyBody(t *testing.T) {
 // ==================== Rules API Handler Tests ====================
 
 func TestRulesHandlerGet(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test-key", Rule{Name: "Rule 1", Enabled: true})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/rules?key=test-key", nil)
@@ -462,7 +463,7 @@ func TestRulesHandlerGet(t *testing.T) {
 }
 
 func TestRulesHandlerGetDefaultKey(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("default", Rule{Name: "Default Rule"})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/rules", nil)
@@ -483,7 +484,7 @@ func TestRulesHandlerGetDefaultKey(t *testing.T) {
 }
 
 func TestRulesHandlerPost(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	body := `{"name":"New Rule","condition":"body.test == true","response":{"ok":true},"statusCode":200,"priority":1,"enabled":true}`
 	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body))
@@ -513,7 +514,7 @@ func TestRulesHandlerPost(t *testing.T) {
 }
 
 func TestRulesHandlerPostInvalidJSON(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader("not json"))
 	w := httptest.NewRecorder()
@@ -526,7 +527,7 @@ func TestRulesHandlerPostInvalidJSON(t *testing.T) {
 }
 
 func TestRulesHandlerPostInvalidExpression(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	body := `{"name":"Bad Rule","condition":"invalid !!! syntax","response":{},"statusCode":200,"enabled":true}`
 	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body))
@@ -548,7 +549,7 @@ func TestRulesHandlerPostInvalidExpression(t *testing.T) {
 }
 
 func TestRulesHandlerPostEmptyCondition(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	body := `{"name":"Empty Condition","condition":"","response":{},"statusCode":200,"enabled":true}`
 	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body))
@@ -563,7 +564,7 @@ func TestRulesHandlerPostEmptyCondition(t *testing.T) {
 }
 
 func TestRulesHandlerPut(t *testing.T) {
-	app := &App{}
+	app := New()
 	created := app.addRule("test", Rule{Name: "Original", Priority: 1, Enabled: true})
 
 	body := `{"name":"Updated","condition":"true","response":{"updated":true},"statusCode":201,"priority":2,"enabled":true}`
@@ -584,7 +585,7 @@ func TestRulesHandlerPut(t *testing.T) {
 }
 
 func TestRulesHandlerPutNoID(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodPut, "/api/rules?key=test", strings.NewReader(`{}`))
 	w := httptest.NewRecorder()
@@ -596,8 +597,58 @@ func TestRulesHandlerPutNoID(t *testing.T) {
 	}
 }
 
+func TestRulesHandlerPutReplaceAll(t *testing.T) {
+	app := New()
+	kept := app.addRule("test", Rule{Name: "Kept", Condition: "true", Enabled: true})
+	removed := app.addRule("test", Rule{Name: "Removed", Condition: "true", Enabled: true})
+
+	body := `[
+		{"id":"` + kept.ID + `","name":"Kept v2","condition":"body.a == 1","statusCode":201,"priority":1,"enabled":true},
+		{"id":"sync-1","name":"Synced","condition":"true","priority":2,"enabled":true},
+		{"name":"New","condition":"true","priority":3,"enabled":true}
+	]`
+	w := httptest.NewRecorder()
+	app.rulesHandler(w, httptest.NewRequest(http.MethodPut, "/api/rules?key=test", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	rules := app.getRules("test")
+	if len(rules) != 3 || rules[0].ID != kept.ID || rules[0].Name != "Kept v2" || rules[1].ID != "sync-1" || rules[2].ID == "" {
+		t.Fatalf("unexpected rules after replace: %+v", rules)
+	}
+	if versions, _ := app.getRuleHistory("test", kept.ID); len(versions) != 2 {
+		t.Errorf("expected the kept rule to gain a version, got %d", len(versions))
+	}
+	if _, ok := app.ruleHistory[removed.ID]; ok {
+		t.Error("expected the removed rule's history to be discarded")
+	}
+}
+
+func TestRulesHandlerPutReplaceAllInvalid(t *testing.T) {
+	app := New()
+	app.addRule("test", Rule{Name: "Original", Condition: "true", Enabled: true})
+	other := app.addRule("other", Rule{Name: "Other", Condition: "true", Enabled: true})
+
+	for _, body := range []string{
+		`{"name":"not an array"}`,
+		`[{"name":"Good","condition":"true"},{"name":"Bad","condition":"invalid !!! syntax"}]`,
+		`[{"id":"a","condition":"true"},{"id":"a","condition":"true"}]`,
+		`[{"id":"` + other.ID + `","condition":"true"}]`,
+	} {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPut, "/api/rules?key=test", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+	if rules := app.getRules("test"); len(rules) != 1 || rules[0].Name != "Original" {
+		t.Errorf("expected rules to be unchanged, got %+v", rules)
+	}
+}
+
 func TestRulesHandlerPutNotFound(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	body := `{"name":"Updated"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/rules?key=test&id=nonexistent", strings.NewReader(body))
@@ -612,7 +663,7 @@ func TestRulesHandlerPutNotFound(t *testing.T) {
 }
 
 func TestRulesHandlerPutInvalidExpression(t *testing.T) {
-	app := &App{}
+	app := New()
 	created := app.addRule("test", Rule{Name: "Original"})
 
 	body := `{"name":"Bad","condition":"invalid !!! syntax"}`
@@ -627,8 +678,63 @@ func TestRulesHandlerPutInvalidExpression(t *testing.T) {
 	}
 }
 
+func TestRulesHandlerPatch(t *testing.T) {
+	app := New()
+	created := app.addRule("test", Rule{
+		Name:       "Original",
+		Condition:  "true",
+		Response:   map[string]interface{}{"ok": true},
+		StatusCode: 201,
+		Priority:   3,
+		Enabled:    true,
+	})
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/rules?key=test&id="+created.ID, strings.NewReader(`{"enabled":false,"id":"other"}`))
+	w := httptest.NewRecorder()
+
+	app.rulesHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	rule := app.getRules("test")[0]
+	if rule.Enabled || rule.ID != created.ID || rule.Name != "Original" || rule.Condition != "true" || rule.StatusCode != 201 || rule.Priority != 3 {
+		t.Errorf("expected only enabled to change, got %+v", rule)
+	}
+	if !reflect.DeepEqual(rule.Response, map[string]interface{}{"ok": true}) {
+		t.Errorf("expected response to be kept, got %v", rule.Response)
+	}
+}
+
+func TestRulesHandlerPatchErrors(t *testing.T) {
+	app := New()
+	created := app.addRule("test", Rule{Name: "Original", Condition: "true", Enabled: true})
+
+	tests := []struct {
+		url  string
+		body string
+		want int
+	}{
+		{"/api/rules?key=test", `{"enabled":false}`, http.StatusBadRequest},
+		{"/api/rules?key=test&id=nonexistent", `{"enabled":false}`, http.StatusNotFound},
+		{"/api/rules?key=test&id=" + created.ID, `not json`, http.StatusBadRequest},
+		{"/api/rules?key=test&id=" + created.ID, `{"enabled":"yes"}`, http.StatusBadRequest},
+		{"/api/rules?key=test&id=" + created.ID, `{"condition":"invalid !!! syntax"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPatch, tt.url, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.url, tt.body, tt.want, w.Code)
+		}
+	}
+	if rule := app.getRules("test")[0]; !rule.Enabled || rule.Condition != "true" {
+		t.Errorf("expected failed patches to leave the rule unchanged, got %+v", rule)
+	}
+}
+
 func TestRulesHandlerDelete(t *testing.T) {
-	app := &App{}
+	app := New()
 	created := app.addRule("test", Rule{Name: "To Delete"})
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/rules?key=test&id="+created.ID, nil)
@@ -647,7 +753,7 @@ func TestRulesHandlerDelete(t *testing.T) {
 }
 
 func TestRulesHandlerDeleteNoID(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/rules?key=test", nil)
 	w := httptest.NewRecorder()
@@ -660,7 +766,7 @@ func TestRulesHandlerDeleteNoID(t *testing.T) {
 }
 
 func TestRulesHandlerDeleteNotFound(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/rules?key=test&id=nonexistent", nil)
 	w := httptest.NewRecorder()
@@ -673,9 +779,9 @@ func TestRulesHandlerDeleteNotFound(t *testing.T) {
 }
 
 func TestRulesHandlerMethodNotAllowed(t *testing.T) {
-	app := &App{}
+	app := New()
 
-	req := httptest.NewRequest(http.MethodPatch, "/api/rules?key=test", nil)
+	req := httptest.NewRequest(http.MethodOptions, "/api/rules?key=test", nil)
 	w := httptest.NewRecorder()
 
 	app.rulesHandler(w, req)
@@ -686,7 +792,7 @@ func TestRulesHandlerMethodNotAllowed(t *testing.T) {
 }
 
 func TestRulesHandlerPostReadError(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", &errorReader{})
 	w := httptest.NewRecorder()
@@ -699,7 +805,7 @@ func TestRulesHandlerPostReadError(t *testing.T) {
 }
 
 func TestRulesHandlerPutReadError(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodPut, "/api/rules?key=test&id=123", &errorReader{})
 	w := httptest.NewRecorder()
@@ -712,7 +818,7 @@ func TestRulesHandlerPutReadError(t *testing.T) {
 }
 
 func TestRulesHandlerPutInvalidJSON(t *testing.T) {
-	app := &App{}
+	app := New()
 
 	req := httptest.NewRequest(http.MethodPut, "/api/rules?key=test&id=123", strings.NewReader("not json"))
 	w := httptest.NewRecorder()
@@ -725,7 +831,7 @@ func TestRulesHandlerPutInvalidJSON(t *testing.T) {
 }
 
 func TestRulesHandlerGetWriteError(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("test", Rule{Name: "Rule 1"})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/rules?key=test", nil)
@@ -741,7 +847,7 @@ func TestRulesHandlerGetWriteError(t *testing.T) {
 // ==================== Webhook Handler with Rules Tests ====================
 
 func TestWebhookHandlerWithRuleMatch(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("payments", Rule{
 		Name:       "High Amount",
 		Condition:  "body.amount > 100",
@@ -770,8 +876,34 @@ func TestWebhookHandlerWithRuleMatch(t *testing.T) {
 	}
 }
 
+func TestWebhookHandlerRuleKeepsKeyTransport(t *testing.T) {
+	app := New()
+	app.setResponseConfig("payments", ResponseConfig{
+		Response:       "default",
+		StatusCode:     http.StatusOK,
+		BytesPerSecond: 40,
+		Cookies:        []CookieConfig{{Name: "session", Value: "abc"}},
+	})
+	app.addRule("payments", Rule{Condition: "body.amount > 100", Response: "throttled body", StatusCode: http.StatusAccepted, Enabled: true})
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{"amount": 500}`)))
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusAccepted || strings.TrimSpace(w.Body.String()) != `"throttled body"` {
+		t.Fatalf("expected the rule's response, got %d %s", w.Code, w.Body)
+	}
+	if elapsed < 300*time.Millisecond {
+		t.Errorf("expected the key's 40 B/s cap on the rule's 16 byte body, took %v", elapsed)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "session=abc") {
+		t.Errorf("expected the key's cookie, got %q", cookie)
+	}
+}
+
 func TestWebhookHandlerWithRuleNoMatch(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("payments", ResponseConfig{
 		Response:   map[string]string{"default": "response"},
 		StatusCode: 200,
@@ -805,7 +937,7 @@ func TestWebhookHandlerWithRuleNoMatch(t *testing.T) {
 }
 
 func TestWebhookHandlerWithDisabledRule(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("test", ResponseConfig{
 		Response:   map[string]string{"default": "yes"},
 		StatusCode: 200,
@@ -832,7 +964,7 @@ func TestWebhookHandlerWithDisabledRule(t *testing.T) {
 // ==================== getKeys Tests ====================
 
 func TestGetKeysEmpty(t *testing.T) {
-	app := &App{}
+	app := New()
 	keys := app.getKeys()
 
 	if len(keys) != 1 {
@@ -844,7 +976,7 @@ func TestGetKeysEmpty(t *testing.T) {
 }
 
 func TestGetKeysFromResponses(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("response-key", ResponseConfig{Response: "test", StatusCode: 200})
 
 	keys := app.getKeys()
@@ -862,8 +994,8 @@ func TestGetKeysFromResponses(t *testing.T) {
 }
 
 func TestGetKeysFromEvents(t *testing.T) {
-	app := &App{}
-	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/event-key", nil), "event-key", "test")
+	app := New()
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/event-key", nil), "event-key", parseBody("test"))
 
 	keys := app.getKeys()
 
@@ -880,7 +1012,7 @@ func TestGetKeysFromEvents(t *testing.T) {
 }
 
 func TestGetKeysFromRules(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.addRule("rule-key", Rule{Name: "test", Condition: "true", Enabled: true})
 
 	keys := app.getKeys()
@@ -898,9 +1030,9 @@ func TestGetKeysFromRules(t *testing.T) {
 }
 
 func TestGetKeysCombined(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("resp-key", ResponseConfig{Response: "test", StatusCode: 200})
-	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/event-key", nil), "event-key", "test")
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/event-key", nil), "event-key", parseBody("test"))
 	app.addRule("rule-key", Rule{Name: "test", Condition: "true", Enabled: true})
 
 	keys := app.getKeys()
@@ -925,7 +1057,7 @@ func TestGetKeysCombined(t *testing.T) {
 }
 
 func TestGetKeysSorted(t *testing.T) {
-	app := &App{}
+	app := New()
 	app.setResponseConfig("zebra", ResponseConfig{Response: "test", StatusCode: 200})
 	app.setResponseConfig("alpha", ResponseConfig{Response: "test", StatusCode: 200})
 	app.setResponseConfig("beta", ResponseConfig{Response: "test", StatusCode: 200})
@@ -939,3 +1071,760 @@ func TestGetKeysSorted(t *testing.T) {
 		}
 	}
 }
+
+func TestWebhookHandlerWithRuleRedirect(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{
+		Name:       "Moved",
+		Condition:  `method == "POST"`,
+		StatusCode: http.StatusMovedPermanently,
+		Location:   "/webhook/payments-v2",
+		Enabled:    true,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("expected status 301 from rule, got %d", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "/webhook/payments-v2" {
+		t.Errorf("expected Location /webhook/payments-v2, got %q", got)
+	}
+}
+
+func TestKeyCopyHandler(t *testing.T) {
+	app := New()
+	app.setResponseConfig("payments", ResponseConfig{Response: map[string]string{"ok": "true"}, StatusCode: http.StatusAccepted})
+	original := app.addRule("payments", Rule{Name: "High", Condition: "body.amount > 100", Enabled: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/keys/payments/copy?to=payments-staging", nil)
+	w := httptest.NewRecorder()
+	app.keyCopyHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if config := app.getResponseConfig("payments-staging"); config.StatusCode != http.StatusAccepted {
+		t.Errorf("expected copied status 202, got %d", config.StatusCode)
+	}
+	copied := app.getRules("payments-staging")
+	if len(copied) != 1 || copied[0].Name != "High" {
+		t.Fatalf("expected copied rule, got %+v", copied)
+	}
+	if copied[0].ID == original.ID {
+		t.Error("copied rule should get a new ID")
+	}
+
+	app.deleteRule("payments-staging", copied[0].ID)
+	if len(app.getRules("payments")) != 1 {
+		t.Error("deleting a copied rule should not affect the source key")
+	}
+}
+
+func TestKeyCopyHandlerErrors(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{Condition: "true", Enabled: true})
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodPost, "/api/keys/missing/copy?to=other", http.StatusNotFound},
+		{http.MethodPost, "/api/keys/payments/copy", http.StatusBadRequest},
+		{http.MethodPost, "/api/keys/payments/copy?to=payments", http.StatusBadRequest},
+		{http.MethodGet, "/api/keys/payments/copy?to=other", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/keys/payments/clone?to=other", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.keyCopyHandler(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+	}
+}
+
+func TestWebhookHandlerRuleStatusCodeExpr(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{
+		Condition:      "true",
+		Response:       map[string]string{"status": "checked"},
+		StatusCode:     200,
+		StatusCodeExpr: "body.amount > 1000 ? 402 : 200",
+		Enabled:        true,
+	})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"amount": 5000}`, http.StatusPaymentRequired},
+		{`{"amount": 10}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.body, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRulesHandlerPostInvalidStatusCodeExpr(t *testing.T) {
+	app := New()
+
+	body := `{"name":"Bad Status","condition":"true","statusCode":200,"statusCodeExpr":"body.amount >","enabled":true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	app.rulesHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid status code expression, got %d", w.Code)
+	}
+}
+
+func TestWebhookHandlerRuleActionDelay(t *testing.T) {
+	app := New()
+	app.addRule("slow", Rule{
+		Condition:  "true",
+		Response:   map[string]string{"status": "late"},
+		StatusCode: http.StatusAccepted,
+		Action:     ActionDelay,
+		Delay:      Duration(50 * time.Millisecond),
+		Enabled:    true,
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/slow", nil))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected response to be delayed, took %v", elapsed)
+	}
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected status 202, got %d", w.Code)
+	}
+}
+
+func TestWebhookHandlerRuleActionDrop(t *testing.T) {
+	app := New()
+	app.addRule("flaky", Rule{Condition: `body.fail == true`, Action: ActionDrop, Enabled: true})
+	server := httptest.NewServer(http.HandlerFunc(app.webhookHandler))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/webhook/flaky", "application/json", strings.NewReader(`{"fail":true}`))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the connection to be dropped")
+	}
+
+	resp, err = http.Post(server.URL+"/webhook/flaky", "application/json", strings.NewReader(`{"fail":false}`))
+	if err != nil {
+		t.Fatalf("non-matching request should be answered: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestWebhookHandlerRuleActionForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", r.Method)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte("upstream:"), body...))
+	}))
+	defer upstream.Close()
+
+	app := New()
+	app.addRule("proxy", Rule{Condition: "true", Action: ActionForward, ForwardTo: upstream.URL, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPut, "/webhook/proxy", strings.NewReader("hello")))
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected relayed status 201, got %d", w.Code)
+	}
+	if w.Header().Get("X-Upstream") != http.MethodPut {
+		t.Errorf("expected relayed upstream header, got %q", w.Header().Get("X-Upstream"))
+	}
+	if w.Body.String() != "upstream:hello" {
+		t.Errorf("unexpected relayed body: %q", w.Body.String())
+	}
+}
+
+func TestWebhookHandlerRuleActionForwardUnreachable(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	app := New()
+	app.addRule("proxy", Rule{Condition: "true", Action: ActionForward, ForwardTo: upstream.URL, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/proxy", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502, got %d", w.Code)
+	}
+}
+
+func TestWebhookHandlerRuleActionTag(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{Condition: `body.amount > 100`, Action: ActionTag, Tags: []string{"large", "review"}, Priority: 0, Enabled: true})
+	app.addRule("orders", Rule{Condition: `body.currency != "USD"`, Action: ActionTag, Tags: []string{"fx", "review"}, Priority: 1, Enabled: true})
+	app.addRule("orders", Rule{Condition: "true", Response: map[string]string{"ok": "yes"}, StatusCode: http.StatusOK, Priority: 2, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":500,"currency":"EUR"}`)))
+
+	if strings.TrimSpace(w.Body.String()) != `{"ok":"yes"}` {
+		t.Errorf("tag rules should not produce the response, got %q", w.Body.String())
+	}
+	tags := app.store.Events()[0].Tags
+	if strings.Join(tags, ",") != "large,review,fx" {
+		t.Errorf("unexpected event tags: %v", tags)
+	}
+}
+
+func TestWebhookHandlerRuleTrace(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{Response: map[string]string{"ok": "key"}, StatusCode: http.StatusOK, RuleHeader: true})
+	tag := app.addRule("orders", Rule{Name: "Large", Condition: `body.amount > 100`, Action: ActionTag, Tags: []string{"large"}, Priority: 0, Enabled: true})
+	disabled := app.addRule("orders", Rule{Name: "Off", Condition: "true", Priority: 1, Enabled: false})
+	euro := app.addRule("orders", Rule{Name: "Euro", Condition: `body.currency == "EUR"`, Priority: 2, Enabled: true})
+	broken := app.addRule("orders", Rule{Name: "Broken", Condition: `body.items[0] > 1`, Priority: 3, Enabled: true})
+	usd := app.addRule("orders", Rule{Name: "USD", Condition: `body.currency == "USD"`, StatusCode: http.StatusAccepted, Priority: 4, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":500,"currency":"USD","items":[]}`)))
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if got := w.Header().Get("X-Hooklab-Rule"); got != usd.ID {
+		t.Errorf("expected X-Hooklab-Rule %q, got %q", usd.ID, got)
+	}
+
+	event := app.store.Events()[0]
+	if strings.Join(event.MatchedRules, ",") != usd.ID {
+		t.Errorf("expected matched rule %q, got %v", usd.ID, event.MatchedRules)
+	}
+	want := []struct {
+		id      string
+		matched bool
+		skipped bool
+		failed  bool
+	}{
+		{tag.ID, true, false, false},
+		{disabled.ID, false, true, false},
+		{euro.ID, false, false, false},
+		{broken.ID, false, false, true},
+		{usd.ID, true, false, false},
+	}
+	if len(event.RuleTrace) != len(want) {
+		t.Fatalf("expected %d trace entries, got %+v", len(want), event.RuleTrace)
+	}
+	for i, tt := range want {
+		got := event.RuleTrace[i]
+		if got.RuleID != tt.id || got.Matched != tt.matched || (got.Skipped != "") != tt.skipped || (got.Error != "") != tt.failed {
+			t.Errorf("trace[%d]: unexpected entry %+v", i, got)
+		}
+	}
+	if len(event.RuleErrors) != 1 || event.RuleErrors[0].RuleID != broken.ID {
+		t.Errorf("expected the broken rule in ruleErrors, got %+v", event.RuleErrors)
+	}
+
+	// Without a matching rule the header reports that the key's response was used.
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":1,"currency":"GBP","items":[0]}`)))
+	if got := w.Header().Get("X-Hooklab-Rule"); got != "none" {
+		t.Errorf("expected X-Hooklab-Rule none, got %q", got)
+	}
+	if len(app.store.Events()[0].MatchedRules) != 0 {
+		t.Errorf("expected no matched rule, got %v", app.store.Events()[0].MatchedRules)
+	}
+}
+
+func TestEvaluateRulesMatchStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     ResponseConfig
+	}{
+		{"", ResponseConfig{Delay: Duration(time.Second)}},
+		{RuleMatchFirst, ResponseConfig{Delay: Duration(time.Second)}},
+		{RuleMatchLast, ResponseConfig{Response: "fallback", StatusCode: http.StatusOK}},
+		{RuleMatchMerge, ResponseConfig{Response: "paid", StatusCode: http.StatusCreated, Delay: Duration(time.Second)}},
+	}
+	for _, tt := range tests {
+		app := New()
+		app.setResponseConfig("payments", ResponseConfig{StatusCode: http.StatusOK, RuleMatch: tt.strategy})
+		app.addRule("payments", Rule{Condition: `body.region == "eu"`, Action: ActionDelay, Delay: Duration(time.Second), Priority: 0, Enabled: true})
+		app.addRule("payments", Rule{Condition: `body.type == "payment"`, Response: "paid", StatusCode: http.StatusCreated, Priority: 1, Enabled: true})
+		app.addRule("payments", Rule{Condition: `body.type == "refund"`, Response: "refund", StatusCode: http.StatusAccepted, Priority: 2, Enabled: true})
+		app.addRule("payments", Rule{Condition: "true", Response: "fallback", StatusCode: http.StatusOK, Priority: 3, Enabled: true})
+
+		config, err := app.evaluateRules("payments", `{"region":"eu","type":"payment"}`, http.MethodPost, nil)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.strategy, err)
+		}
+		if config == nil || !reflect.DeepEqual(*config, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.strategy, tt.want, config)
+		}
+	}
+}
+
+func TestResponseHandlerInvalidRuleMatch(t *testing.T) {
+	app := New()
+	w := httptest.NewRecorder()
+	app.responseHandler(w, httptest.NewRequest(http.MethodPost, "/api/response?key=payments", strings.NewReader(`{"statusCode":200,"ruleMatch":"random"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestWebhookHandlerRuleCaptures(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{
+		Condition: `body.type == "order"`,
+		Captures: map[string]string{
+			"orderId": `jsonpath("$.order.id", body)`,
+			"region":  `regexFind("^[a-z]+", body.order.ref)`,
+			"broken":  `body.missing.field`,
+		},
+		Response:   map[string]interface{}{"id": "{{.captures.orderId}}", "region": "{{.captures.region}}", "broken": "{{.captures.broken}}", "type": "{{.body.type}}"},
+		StatusCode: http.StatusOK,
+		Enabled:    true,
+	})
+	app.addRule("orders", Rule{Condition: "true", Response: map[string]interface{}{"id": "{{.captures.orderId}}"}, StatusCode: http.StatusOK, Priority: 1, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"type":"order","order":{"id":"ord_1","ref":"eu-42"}}`)))
+	want := `{"broken":"","id":"ord_1","region":"eu","type":"order"}`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if errs := app.store.Events()[0].RuleErrors; len(errs) != 1 || !strings.Contains(errs[0].Error, `capture "broken"`) {
+		t.Errorf("expected the failing capture in ruleErrors, got %+v", errs)
+	}
+
+	// Rules without captures render .captures as empty.
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"type":"refund"}`)))
+	if got := strings.TrimSpace(w.Body.String()); got != `{"id":""}` {
+		t.Errorf("expected empty capture, got %s", got)
+	}
+}
+
+func TestRulesHandlerPostInvalidCapture(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"condition":"true","captures":{"id":"body.id +"}}`,
+		`{"condition":"true","captures":{"":"body.id"}}`,
+	} {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestWebhookHandlerGlobalRules(t *testing.T) {
+	app := New()
+	app.addRule(globalRuleKey, Rule{Condition: `!("Authorization" in headers)`, StatusCode: http.StatusUnauthorized, Priority: 5, Enabled: true})
+	app.addRule(globalRuleKey, Rule{Condition: "true", Action: ActionTag, Tags: []string{"seen"}, Enabled: true})
+	app.addRule("orders", Rule{Condition: "true", StatusCode: http.StatusCreated, Priority: 0, Enabled: true})
+
+	tests := []struct {
+		key  string
+		auth bool
+		want int
+	}{
+		{"orders", false, http.StatusUnauthorized},
+		{"orders", true, http.StatusCreated},
+		{"payments", false, http.StatusUnauthorized},
+		{"payments", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/"+tt.key, strings.NewReader(`{}`))
+		if tt.auth {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s (auth %v): expected status %d, got %d", tt.key, tt.auth, tt.want, w.Code)
+		}
+		if tags := app.store.Events()[0].Tags; len(tags) != 1 || tags[0] != "seen" {
+			t.Errorf("%s: expected the global tag, got %v", tt.key, tags)
+		}
+	}
+}
+
+func TestEvaluateRulesElseResponse(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{Condition: `body.disabled == true`, Priority: 0, Enabled: false, ElseStatusCode: http.StatusTeapot})
+	app.addRule("orders", Rule{
+		Condition:      `body.amount > 100`,
+		Response:       map[string]interface{}{"review": true},
+		StatusCode:     http.StatusAccepted,
+		ElseResponse:   map[string]interface{}{"review": false},
+		ElseStatusCode: http.StatusOK,
+		Priority:       1,
+		Enabled:        true,
+	})
+	app.addRule("orders", Rule{Condition: "true", StatusCode: http.StatusNotFound, Priority: 2, Enabled: true})
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantReview bool
+	}{
+		{`{"amount":500}`, http.StatusAccepted, true},
+		{`{"amount":5}`, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		config, err := app.evaluateRules("orders", tt.body, http.MethodPost, nil)
+		if err != nil || config == nil {
+			t.Fatalf("%s: expected a response, got %v (%v)", tt.body, config, err)
+		}
+		if config.StatusCode != tt.wantStatus || config.Response.(map[string]interface{})["review"] != tt.wantReview {
+			t.Errorf("%s: expected %d review=%v, got %d %v", tt.body, tt.wantStatus, tt.wantReview, config.StatusCode, config.Response)
+		}
+	}
+
+	// A condition that fails to evaluate is not false, so evaluation continues.
+	config, _ := app.evaluateRules("orders", `"not an object"`, http.MethodPost, nil)
+	if config == nil || config.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the catch-all rule, got %+v", config)
+	}
+}
+
+func TestWebhookHandlerElseResponseTrace(t *testing.T) {
+	app := New()
+	rule := app.addRule("orders", Rule{Condition: `body.amount > 100`, StatusCode: http.StatusAccepted, ElseStatusCode: http.StatusNoContent, Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"amount":1}`)))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	event := app.store.Events()[0]
+	if len(event.RuleTrace) != 1 || event.RuleTrace[0].Matched || !event.RuleTrace[0].Else {
+		t.Errorf("expected the else branch in the trace, got %+v", event.RuleTrace)
+	}
+	if len(event.MatchedRules) != 1 || event.MatchedRules[0] != rule.ID {
+		t.Errorf("expected %s to produce the response, got %v", rule.ID, event.MatchedRules)
+	}
+}
+
+func TestRulesValidateHandler(t *testing.T) {
+	app := New()
+	event := app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/payments", nil), "payments", parseBody(`{"amount":"12.50"}`))
+
+	tests := []struct {
+		body   string
+		valid  bool
+		result bool
+	}{
+		{`{"condition":"body.amount > 100","sample":{"amount":500}}`, true, true},
+		{`{"condition":"body.amount > 100","sample":{"amount":5}}`, true, false},
+		{`{"condition":"body.amount > 100","sample":{"amount":"500"}}`, false, false},
+		{`{"condition":"body.amount > 100","sample":"amount=500"}`, false, false},
+		{`{"condition":"body == \"amount=500\"","sample":"amount=500"}`, true, true},
+		{`{"condition":"method == \"PUT\" && headers[\"X-Event\"][0] == \"paid\"","method":"PUT","headers":{"x-event":["paid"]}}`, true, true},
+		{`{"condition":"body.amount > 100","eventId":` + strconv.Itoa(event.ID) + `}`, false, false},
+		{`{"condition":"key == \"payments\" && !seen(key, \"body.amount\", body.amount)","eventId":` + strconv.Itoa(event.ID) + `}`, true, true},
+		{`{"condition":"body.amount +","sample":{}}`, false, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.rulesValidateHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules/validate?key=payments", strings.NewReader(tt.body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.body, w.Code)
+		}
+		var got struct {
+			Valid  bool   `json:"valid"`
+			Result bool   `json:"result"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.body, err)
+		}
+		if got.Valid != tt.valid || got.Result != tt.result || got.Valid == (got.Error != "") {
+			t.Errorf("%s: expected valid=%v result=%v, got %+v", tt.body, tt.valid, tt.result, got)
+		}
+	}
+}
+
+func TestRulesValidateHandlerErrors(t *testing.T) {
+	app := New()
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, `not json`, http.StatusBadRequest},
+		{http.MethodPost, `{"sample":{}}`, http.StatusBadRequest},
+		{http.MethodPost, `{"condition":"true","eventId":42}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.rulesValidateHandler(w, httptest.NewRequest(tt.method, "/api/rules/validate", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.body, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRulesHandlerPostInvalidAction(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"condition":"true","action":"explode"}`,
+		`{"condition":"true","action":"delay"}`,
+		`{"condition":"true","action":"drop","drop":"sideways"}`,
+		`{"condition":"true","action":"forward"}`,
+		`{"condition":"true","action":"forward","forwardTo":"not-a-url"}`,
+		`{"condition":"true","action":"tag"}`,
+		`{"condition":"true","action":"tag","tags":["a"],"elseStatusCode":200}`,
+		`{"condition":"true","elseResponse":{"id":"{{.body.id"}}`,
+	} {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestWebhookHandlerRequestVariables(t *testing.T) {
+	tests := []struct {
+		condition string
+		match     bool
+	}{
+		{`path endsWith "/payments"`, true},
+		{`query.token == "abc"`, true},
+		{`query.missing == ""`, true},
+		{`cookies.session == "s1"`, true},
+		{`remoteAddr == "192.0.2.7"`, true},
+		{`contentType == "application/json"`, true},
+		{`query.token == "other"`, false},
+	}
+	for _, tt := range tests {
+		app := New()
+		app.addRule("payments", Rule{Condition: tt.condition, StatusCode: http.StatusTeapot, Enabled: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments?token=abc", strings.NewReader(`{}`))
+		req.RemoteAddr = "192.0.2.7:51234"
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+
+		if matched := w.Code == http.StatusTeapot; matched != tt.match {
+			t.Errorf("%s: expected match=%v, got status %d", tt.condition, tt.match, w.Code)
+		}
+	}
+}
+
+func TestRulesHandlerPostRequestVariables(t *testing.T) {
+	app := New()
+	body := `{"condition":"path endsWith \"/x\" && query.a == \"1\" && cookies.b != \"\" && remoteAddr != \"\" && contentType == \"text/plain\"","enabled":true}`
+	w := httptest.NewRecorder()
+	app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected rule using request variables to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRulesReorderHandler(t *testing.T) {
+	app := New()
+	a := app.addRule("orders", Rule{Name: "a", Condition: "true", Priority: 5, Enabled: true})
+	b := app.addRule("orders", Rule{Name: "b", Condition: "true", Priority: 1, Enabled: true})
+	c := app.addRule("orders", Rule{Name: "c", Condition: "true", Priority: 9, Enabled: true})
+
+	body := `{"ids":["` + c.ID + `","` + a.ID + `","` + b.ID + `"]}`
+	w := httptest.NewRecorder()
+	app.rulesReorderHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules/reorder?key=orders", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Rules []Rule `json:"rules"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	var names []string
+	for i, rule := range response.Rules {
+		names = append(names, rule.Name)
+		if rule.Priority != i {
+			t.Errorf("rule %s: expected priority %d, got %d", rule.Name, i, rule.Priority)
+		}
+	}
+	if strings.Join(names, ",") != "c,a,b" {
+		t.Errorf("unexpected order: %v", names)
+	}
+}
+
+func TestRulesReorderHandlerErrors(t *testing.T) {
+	app := New()
+	a := app.addRule("orders", Rule{Name: "a", Condition: "true", Priority: 0})
+	b := app.addRule("orders", Rule{Name: "b", Condition: "true", Priority: 1})
+
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{http.MethodPost, `{"ids":["` + b.ID + `"]}`, http.StatusBadRequest},
+		{http.MethodPost, `{"ids":["` + b.ID + `","` + b.ID + `"]}`, http.StatusBadRequest},
+		{http.MethodPost, `{"ids":["` + b.ID + `","rule_999"]}`, http.StatusBadRequest},
+		{http.MethodPost, `not json`, http.StatusBadRequest},
+		{http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.rulesReorderHandler(w, httptest.NewRequest(tt.method, "/api/rules/reorder?key=orders", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.body, tt.want, w.Code)
+		}
+	}
+
+	rules := app.getRules("orders")
+	if rules[0].ID != a.ID || rules[1].ID != b.ID {
+		t.Error("failed reorders should leave priorities unchanged")
+	}
+}
+
+func TestEvaluateRulesGroups(t *testing.T) {
+	app := New()
+	app.addRule("github", Rule{Name: "signature valid", Condition: `headers["X-Signature"][0] == "ok"`, Then: "payloads", Priority: 0, Enabled: true})
+	app.addRule("github", Rule{Name: "invalid signature", Condition: "true", StatusCode: 401, Priority: 1, Enabled: true})
+	app.addRule("github", Rule{Name: "push", Condition: `body.event == "push"`, StatusCode: 202, Group: "payloads", Priority: 0, Enabled: true})
+	app.addRule("github", Rule{Name: "ping", Condition: `body.event == "ping"`, StatusCode: 204, Group: "payloads", Priority: 1, Enabled: true})
+
+	tests := []struct {
+		signature string
+		body      string
+		want      int
+	}{
+		{"ok", `{"event":"push"}`, 202},
+		{"ok", `{"event":"ping"}`, 204},
+		{"bad", `{"event":"push"}`, 401},
+		{"ok", `{"event":"issues"}`, 401}, // no rule in the group matched: resume after the gate
+	}
+	for _, tt := range tests {
+		result, _ := app.evaluateRules("github", tt.body, "POST", map[string][]string{"X-Signature": {tt.signature}})
+		if result == nil || result.StatusCode != tt.want {
+			t.Errorf("%s %s: expected status %d, got %+v", tt.signature, tt.body, tt.want, result)
+		}
+	}
+}
+
+func TestEvaluateRulesGroupCycle(t *testing.T) {
+	app := New()
+	app.addRule("loop", Rule{Condition: "true", Then: "a", Enabled: true})
+	app.addRule("loop", Rule{Condition: "true", Group: "a", Then: "b", Enabled: true})
+	app.addRule("loop", Rule{Condition: "true", Group: "b", Then: "a", Enabled: true})
+
+	result, _ := app.evaluateRules("loop", "", "POST", nil)
+	if result != nil {
+		t.Errorf("expected cyclic chain to match nothing, got %+v", result)
+	}
+}
+
+func TestRulesHandlerPostInvalidThen(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"condition":"true","group":"a","then":"a"}`,
+		`{"condition":"true","then":"a","action":"drop"}`,
+	} {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestRulesExportHandlerYAMLRoundTrip(t *testing.T) {
+	source := New()
+	source.addRule("payments", Rule{Name: "High", Condition: "body.amount > 100", Response: map[string]interface{}{"status": "review"}, StatusCode: 202, Priority: 1, Enabled: true})
+	source.addRule("payments", Rule{Name: "Slow", Condition: "true", Action: ActionDelay, Delay: Duration(2 * time.Second), Priority: 2, Enabled: true})
+
+	w := httptest.NewRecorder()
+	source.rulesExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/export?key=payments&format=yaml", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("expected YAML content type, got %q", ct)
+	}
+	exported := w.Body.String()
+	if !strings.Contains(exported, "condition: body.amount > 100") || !strings.Contains(exported, "delay: 2s") {
+		t.Errorf("unexpected YAML export:\n%s", exported)
+	}
+
+	target := New()
+	target.addRule("payments", Rule{Name: "Old", Condition: "true"})
+	w = httptest.NewRecorder()
+	target.rulesExportHandler(w, httptest.NewRequest(http.MethodPut, "/api/rules/export?key=payments&format=yaml", strings.NewReader(exported)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	rules := target.getRules("payments")
+	if len(rules) != 2 || rules[0].Name != "High" || rules[1].Name != "Slow" {
+		t.Fatalf("import should replace the rule set, got %+v", rules)
+	}
+	if rules[0].ID == "" || rules[0].ID == rules[1].ID {
+		t.Errorf("imported rules should get new IDs: %q, %q", rules[0].ID, rules[1].ID)
+	}
+	if time.Duration(rules[1].Delay) != 2*time.Second || rules[0].StatusCode != 202 {
+		t.Errorf("imported rule fields lost: %+v", rules)
+	}
+}
+
+func TestRulesExportHandlerJSON(t *testing.T) {
+	app := New()
+	app.addRule("default", Rule{Name: "Any", Condition: "true", Enabled: true})
+
+	w := httptest.NewRecorder()
+	app.rulesExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/rules/export", nil))
+	var document struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil || len(document.Rules) != 1 {
+		t.Errorf("unexpected JSON export: %s", w.Body.String())
+	}
+}
+
+func TestRulesExportHandlerErrors(t *testing.T) {
+	app := New()
+	app.addRule("default", Rule{Name: "Keep", Condition: "true"})
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/api/rules/export?format=xml", "", http.StatusBadRequest},
+		{http.MethodPut, "/api/rules/export?format=yaml", "rules: [unterminated", http.StatusBadRequest},
+		{http.MethodPut, "/api/rules/export", "{", http.StatusBadRequest},
+		{http.MethodPut, "/api/rules/export", `{"rules":[{"condition":"true"},{"condition":"!!!"}]}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/rules/export", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.rulesExportHandler(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+	}
+	if rules := app.getRules("default"); len(rules) != 1 || rules[0].Name != "Keep" {
+		t.Errorf("failed imports should leave rules unchanged, got %+v", rules)
+	}
+}
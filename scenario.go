@@ -0,0 +1,134 @@
+package hooklab
+
+// This file contains scenarios: named state machines that let rules respond
+// differently across a sequence of webhooks (WireMock-style states).
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// scenarioStarted is the state every scenario is in until a rule moves it on.
+const scenarioStarted = "Started"
+
+// Scenario reports the current state of a named scenario.
+type Scenario struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// scenarioState returns the current state of the named scenario.
+func (a *App) scenarioState(name string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if state, ok := a.scenarios[name]; ok {
+		return state
+	}
+	return scenarioStarted
+}
+
+// moveScenario moves the named scenario to state to if it is in state from, or
+// from any state when from is empty, checking and moving under one lock so
+// concurrent webhooks can't both make the transition. It returns the state
+// the scenario was in and whether it moved.
+func (a *App) moveScenario(name, from, to string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, ok := a.scenarios[name]
+	if !ok {
+		state = scenarioStarted
+	}
+	if from != "" && state != from {
+		return state, false
+	}
+	a.scenarios[name] = to
+	return state, true
+}
+
+// resetScenarios returns the named scenario, or every scenario when name is empty,
+// to the Started state.
+func (a *App) resetScenarios(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if name == "" {
+		a.scenarios = make(map[string]string)
+		return
+	}
+	delete(a.scenarios, name)
+}
+
+// getScenarios returns every scenario referenced by a rule or moved to a state,
+// sorted by name.
+func (a *App) getScenarios() []Scenario {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	states := make(map[string]string)
+	for _, rules := range a.rules {
+		for _, rule := range rules {
+			if rule.Scenario != "" {
+				states[rule.Scenario] = scenarioStarted
+			}
+		}
+	}
+	for name, state := range a.scenarios {
+		states[name] = state
+	}
+
+	scenarios := make([]Scenario, 0, len(states))
+	for name, state := range states {
+		scenarios = append(scenarios, Scenario{Name: name, State: state})
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios
+}
+
+// scenariosHandler handles requests to /api/scenarios.
+// GET lists scenarios with their current state, PUT sets a scenario's state from
+// a { name, state } payload, and DELETE resets the scenario given by the "name"
+// query parameter (or all scenarios when omitted).
+func (a *App) scenariosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"scenarios": a.getScenarios(),
+		}); err != nil {
+			http.Error(w, "Error creating response", http.StatusInternalServerError)
+		}
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		var scenario Scenario
+		if err := json.Unmarshal(body, &scenario); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if scenario.Name == "" || scenario.State == "" {
+			http.Error(w, "Scenario name and state required", http.StatusBadRequest)
+			return
+		}
+		a.moveScenario(scenario.Name, "", scenario.State)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	case http.MethodDelete:
+		a.resetScenarios(r.URL.Query().Get("name"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,133 @@
+package hooklab
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEvaluateRulesScenarioTransition(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{
+		Name:      "Cancel",
+		Condition: `body.type == "cancel"`,
+		Response:  map[string]string{"status": "cancelled"},
+		Enabled:   true,
+		Scenario:  "order",
+		NewState:  "Cancelled",
+	})
+	app.addRule("payments", Rule{
+		Name:          "Charge after cancel",
+		Condition:     `body.type == "charge"`,
+		Response:      map[string]string{"error": "order cancelled"},
+		StatusCode:    http.StatusConflict,
+		Enabled:       true,
+		Scenario:      "order",
+		RequiredState: "Cancelled",
+	})
+
+	send := func(body string) int {
+		res := httptest.NewRecorder()
+		app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(body)))
+		return res.Code
+	}
+
+	if code := send(`{"type":"charge"}`); code != http.StatusOK {
+		t.Errorf("charge before cancel: got %v want 200", code)
+	}
+	if state := app.scenarioState("order"); state != scenarioStarted {
+		t.Errorf("scenario should start in %q, got %q", scenarioStarted, state)
+	}
+	send(`{"type":"cancel"}`)
+	if state := app.scenarioState("order"); state != "Cancelled" {
+		t.Errorf("cancel should move scenario to Cancelled, got %q", state)
+	}
+	if code := send(`{"type":"charge"}`); code != http.StatusConflict {
+		t.Errorf("charge after cancel: got %v want 409", code)
+	}
+}
+
+func TestEvaluateRulesScenarioConcurrent(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{
+		Condition:     "true",
+		StatusCode:    http.StatusCreated,
+		Enabled:       true,
+		Scenario:      "order",
+		RequiredState: scenarioStarted,
+		NewState:      "Created",
+	})
+
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`)))
+			if res.Code == http.StatusCreated {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := created.Load(); n != 1 {
+		t.Errorf("expected one webhook to make the transition, got %d", n)
+	}
+}
+
+func TestScenariosHandler(t *testing.T) {
+	app := New()
+	app.addRule("payments", Rule{Condition: "true", Enabled: true, Scenario: "order"})
+
+	res := httptest.NewRecorder()
+	app.scenariosHandler(res, httptest.NewRequest(http.MethodPut, "/api/scenarios", bytes.NewBufferString(`{"name":"refund","state":"Requested"}`)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("scenarios handler put wrong status: got %v want 200", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	app.scenariosHandler(res, httptest.NewRequest(http.MethodGet, "/api/scenarios", nil))
+	var payload struct {
+		Scenarios []Scenario `json:"scenarios"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to parse scenarios payload: %v", err)
+	}
+	want := []Scenario{{Name: "order", State: scenarioStarted}, {Name: "refund", State: "Requested"}}
+	if len(payload.Scenarios) != len(want) || payload.Scenarios[0] != want[0] || payload.Scenarios[1] != want[1] {
+		t.Errorf("scenarios handler get: got %+v want %+v", payload.Scenarios, want)
+	}
+
+	res = httptest.NewRecorder()
+	app.scenariosHandler(res, httptest.NewRequest(http.MethodDelete, "/api/scenarios?name=refund", nil))
+	if state := app.scenarioState("refund"); state != scenarioStarted {
+		t.Errorf("delete should reset scenario, got %q", state)
+	}
+}
+
+func TestScenariosHandlerErrors(t *testing.T) {
+	app := New()
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{http.MethodPut, `{`, http.StatusBadRequest},
+		{http.MethodPut, `{"name":"order"}`, http.StatusBadRequest},
+		{http.MethodPost, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		app.scenariosHandler(res, httptest.NewRequest(tt.method, "/api/scenarios", bytes.NewBufferString(tt.body)))
+		if res.Code != tt.want {
+			t.Errorf("%s %q: got %v want %v", tt.method, tt.body, res.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package hooklab
+
+// This file contains time-window scheduling for rules: absolute activation
+// bounds and cron-style recurring windows.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression. A time is inside the
+// schedule when its minute, hour, day of month, month, and weekday all match.
+type cronSchedule struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+// cronFields lists the name and range of each cron field in order.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// parseCron parses a standard five-field cron expression ("min hour dom month dow").
+// Each field accepts *, numbers, ranges (a-b), lists (a,b), and steps (*/n, a-b/n).
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+
+	sets := make([][]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %s field %q: %w", cronFields[i].name, field, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the set of values in [min, max] selected by field.
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, errors.New("step must be a positive number")
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, errors.New("expected *, a number, or a range")
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, errors.New("expected a number after -")
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("values must be between %d and %d", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matches reports whether t falls inside the schedule. As in cron, when both day
+// of month and day of week are restricted, a time matching either one matches.
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// ruleWindow is a rule's parsed Schedule and Timezone.
+type ruleWindow struct {
+	schedule *cronSchedule
+	location *time.Location // nil for local time
+}
+
+// locations holds the time zones loaded so far by name, since loading one
+// reads the system's zone database.
+var locations sync.Map // name -> *time.Location
+
+// loadLocation returns the time zone named name, loading it once.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := locations.LoadOrStore(name, loc)
+	return actual.(*time.Location), nil
+}
+
+// parseRuleWindow parses a rule's Schedule and Timezone.
+func parseRuleWindow(rule Rule) (*ruleWindow, error) {
+	schedule, err := parseCron(rule.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	window := &ruleWindow{schedule: schedule}
+	if rule.Timezone != "" {
+		if window.location, err = loadLocation(rule.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", rule.Timezone)
+		}
+	}
+	return window, nil
+}
+
+// activeAt reports whether a rule's time window includes t: ActiveFrom and
+// ActiveUntil bound it absolutely, and Schedule restricts it to the minutes
+// matching a cron expression, evaluated in Timezone (local time by default).
+// The schedule is the one parsed by validateRule; rules stored without
+// validation have theirs parsed here, and are never active if it is invalid.
+func (rule Rule) activeAt(t time.Time) bool {
+	if rule.ActiveFrom != nil && t.Before(*rule.ActiveFrom) {
+		return false
+	}
+	if rule.ActiveUntil != nil && !t.Before(*rule.ActiveUntil) {
+		return false
+	}
+	if rule.Schedule == "" {
+		return true
+	}
+
+	window := rule.window
+	if window == nil {
+		var err error
+		if window, err = parseRuleWindow(rule); err != nil {
+			return false
+		}
+	}
+	if window.location != nil {
+		t = t.In(window.location)
+	}
+	return window.schedule.matches(t)
+}
+
+// validateRuleWindow checks a rule's activation bounds, schedule, time zone,
+// and TTL, and keeps the parsed schedule on the rule.
+func validateRuleWindow(rule *Rule) error {
+	if rule.ExpiresIn < 0 {
+		return errors.New("expiresIn must not be negative")
+	}
+	if rule.ActiveFrom != nil && rule.ActiveUntil != nil && !rule.ActiveFrom.Before(*rule.ActiveUntil) {
+		return errors.New("activeFrom must be before activeUntil")
+	}
+	rule.window = nil
+	if rule.Schedule != "" {
+		window, err := parseRuleWindow(*rule)
+		if err != nil {
+			return err
+		}
+		rule.window = window
+	} else if rule.Timezone != "" {
+		if _, err := loadLocation(rule.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", rule.Timezone)
+		}
+	}
+	return nil
+}
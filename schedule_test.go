@@ -0,0 +1,193 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronMatches(t *testing.T) {
+	// Wednesday 2026-03-04 10:30 UTC
+	wed := time.Date(2026, time.March, 4, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"* * * * *", wed, true},
+		{"30 10 * * *", wed, true},
+		{"31 10 * * *", wed, false},
+		{"*/15 9-17 * * 1-5", wed, true},
+		{"*/15 9-17 * * 1-5", wed.Add(time.Minute), false},
+		{"* 9-17 * * 1-5", wed.AddDate(0, 0, 3), false}, // Saturday
+		{"* * * * 0", wed.AddDate(0, 0, 4), true},       // Sunday as 0
+		{"* * * * 7", wed.AddDate(0, 0, 4), true},       // Sunday as 7
+		{"* * 1,4 3 *", wed, true},
+		{"* * 5 * 3", wed, true}, // day of month or day of week
+		{"* * 5 * 4", wed, false},
+		{"0-29/10 * * * *", wed, false},
+		{"20-40/10 * * * *", wed, true},
+		{"15/5 * * * *", wed, true},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.matches(tt.at); got != tt.want {
+			t.Errorf("%s at %v: got %v, want %v", tt.spec, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "1- * * * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestRuleActiveAt(t *testing.T) {
+	now := time.Date(2026, time.March, 4, 10, 30, 0, 0, time.UTC)
+	from := now.Add(-time.Hour)
+	until := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{"no window", Rule{}, true},
+		{"inside bounds", Rule{ActiveFrom: &from, ActiveUntil: &until}, true},
+		{"before start", Rule{ActiveFrom: &until}, false},
+		{"after end", Rule{ActiveUntil: &from}, false},
+		{"end is exclusive", Rule{ActiveUntil: &now}, false},
+		{"schedule in time zone", Rule{Schedule: "* 11 * * *", Timezone: "Europe/Berlin"}, true},
+		{"schedule in UTC", Rule{Schedule: "* 11 * * *", Timezone: "UTC"}, false},
+		{"invalid schedule", Rule{Schedule: "nope"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.activeAt(now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		// Validated rules go by the schedule parsed during validation.
+		if validateRule(&tt.rule) != nil {
+			continue
+		}
+		if got := tt.rule.activeAt(now); got != tt.want {
+			t.Errorf("%s, validated: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	rule := Rule{Schedule: "* 9-17 * * 1-5", Timezone: "Europe/Berlin"}
+	other := rule
+	if err := validateRule(&rule); err != nil || rule.window == nil {
+		t.Fatalf("expected the schedule kept on the rule, got %v", err)
+	}
+	validateRule(&other)
+	if other.window.location != rule.window.location {
+		t.Error("expected the time zone loaded once")
+	}
+}
+
+func TestEvaluateRulesSkipsInactiveRules(t *testing.T) {
+	app := New()
+	past := time.Now().Add(-time.Hour)
+	app.addRule("maintenance", Rule{Condition: "true", StatusCode: 503, ActiveUntil: &past, Priority: 0, Enabled: true})
+	app.addRule("maintenance", Rule{Condition: "true", StatusCode: 200, Priority: 1, Enabled: true})
+
+	result, _ := app.evaluateRules("maintenance", "", "POST", nil)
+	if result == nil || result.StatusCode != 200 {
+		t.Errorf("expired window should be skipped, got %+v", result)
+	}
+}
+
+func TestRulesHandlerPostInvalidWindow(t *testing.T) {
+	app := New()
+	for _, body := range []string{
+		`{"condition":"true","schedule":"* * *"}`,
+		`{"condition":"true","timezone":"Mars/Olympus"}`,
+		`{"condition":"true","activeFrom":"2026-01-02T00:00:00Z","activeUntil":"2026-01-01T00:00:00Z"}`,
+	} {
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=test", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestRuleExpiresIn(t *testing.T) {
+	app := New()
+	w := httptest.NewRecorder()
+	app.rulesHandler(w, httptest.NewRequest(http.MethodPost, "/api/rules?key=chaos", strings.NewReader(`{"name":"Fail","condition":"true","statusCode":500,"expiresIn":"30m","enabled":true}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	rule := app.getRules("chaos")[0]
+	if rule.ExpiresAt == nil || time.Until(*rule.ExpiresAt) < 29*time.Minute {
+		t.Fatalf("expected expiry about 30m from now, got %v", rule.ExpiresAt)
+	}
+	if !rule.Enabled || rule.Expired {
+		t.Fatal("rule should be active before it expires")
+	}
+
+	// Move the expiry into the past, as if 30 minutes had elapsed.
+	app.mu.Lock()
+	past := time.Now().Add(-time.Second)
+	app.rules["chaos"][0].ExpiresAt = &past
+	app.mu.Unlock()
+
+	rule = app.getRules("chaos")[0]
+	if rule.Enabled || !rule.Expired {
+		t.Errorf("expired rule should be disabled and flagged, got enabled=%v expired=%v", rule.Enabled, rule.Expired)
+	}
+	if result, _ := app.evaluateRules("chaos", "", "POST", nil); result != nil {
+		t.Errorf("expired rule should not match, got %+v", result)
+	}
+
+	// Updating the rule with a TTL re-arms it.
+	updated := rule
+	updated.Enabled = true
+	if !app.updateRule("chaos", rule.ID, updated) {
+		t.Fatal("update failed")
+	}
+	if rule = app.getRules("chaos")[0]; !rule.Enabled || rule.Expired {
+		t.Errorf("updated rule should be active again, got enabled=%v expired=%v", rule.Enabled, rule.Expired)
+	}
+}
+
+func TestRulePatchKeepsExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	app := New(WithClock(clock))
+	rule := app.addRule("chaos", Rule{Name: "Fail", Condition: "true", StatusCode: 500, ExpiresIn: Duration(30 * time.Minute), Enabled: true})
+	deadline := *rule.ExpiresAt
+
+	patch := func(body string) Rule {
+		t.Helper()
+		clock.t = clock.t.Add(5 * time.Minute)
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(http.MethodPatch, "/api/rules?key=chaos&id="+rule.ID, strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s: expected status 200, got %d: %s", body, w.Code, w.Body.String())
+		}
+		return app.getRules("chaos")[0]
+	}
+	for _, body := range []string{`{"name":"Renamed"}`, `{"enabled":false}`, `{"enabled":true}`} {
+		if got := patch(body); got.ExpiresAt == nil || !got.ExpiresAt.Equal(deadline) {
+			t.Errorf("PATCH %s: expected the deadline kept at %v, got %v", body, deadline, got.ExpiresAt)
+		}
+	}
+	if got := patch(`{"expiresIn":"1h"}`); got.ExpiresAt == nil || !got.ExpiresAt.Equal(clock.t.Add(time.Hour)) {
+		t.Errorf("expected a new TTL to restart the countdown, got %v", got.ExpiresAt)
+	}
+	if got := patch(`{"expiresIn":"0s"}`); got.ExpiresAt != nil {
+		t.Errorf("expected removing the TTL to clear the deadline, got %v", got.ExpiresAt)
+	}
+}
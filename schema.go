@@ -0,0 +1,144 @@
+package hooklab
+
+// This file contains JSON Schema support for keeping configured mock responses
+// faithful to the real API contract of a webhook key.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// responseSchema is a JSON Schema attached to a webhook key together with its
+// compiled form used for validation.
+type responseSchema struct {
+	raw      json.RawMessage
+	compiled *jsonschema.Schema
+}
+
+// compileResponseSchema parses and compiles a JSON Schema document.
+func compileResponseSchema(raw []byte) (*responseSchema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+	return &responseSchema{raw: json.RawMessage(raw), compiled: compiled}, nil
+}
+
+// getResponseSchema returns the schema attached to the given webhook key, or nil.
+func (a *App) getResponseSchema(key string) *responseSchema {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.schemas[key]
+}
+
+// setResponseSchema attaches a schema to the given webhook key.
+func (a *App) setResponseSchema(key string, schema *responseSchema) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.schemas[key] = schema
+}
+
+// deleteResponseSchema detaches the schema from the given webhook key.
+// Returns true if a schema was removed.
+func (a *App) deleteResponseSchema(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.schemas[key]; !ok {
+		return false
+	}
+	delete(a.schemas, key)
+	return true
+}
+
+// validateResponseBody checks a mock response body against the schema attached to key.
+// Keys without a schema accept any body.
+func (a *App) validateResponseBody(key string, response interface{}) error {
+	schema := a.getResponseSchema(key)
+	if schema == nil {
+		return nil
+	}
+
+	// Round-trip through JSON so the value has the shape the validator expects.
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	if err := schema.compiled.Validate(instance); err != nil {
+		return fmt.Errorf("response does not match schema: %w", err)
+	}
+	return nil
+}
+
+// schemaHandler handles GET, PUT, and DELETE requests to /api/schema.
+// The "key" query parameter selects the webhook key whose response schema is managed.
+func (a *App) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schema := a.getResponseSchema(key)
+		if schema == nil {
+			http.Error(w, "Schema not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":    key,
+			"schema": schema.raw,
+		})
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		schema, err := compileResponseSchema(body)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid schema: " + err.Error(),
+			})
+			return
+		}
+		a.setResponseSchema(key, schema)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	case http.MethodDelete:
+		if !a.deleteResponseSchema(key) {
+			http.Error(w, "Schema not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
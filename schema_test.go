@@ -0,0 +1,93 @@
+package hooklab
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "status"],
+	"properties": {
+		"id": {"type": "string"},
+		"status": {"enum": ["pending", "paid"]}
+	}
+}`
+
+func TestSchemaHandlerLifecycle(t *testing.T) {
+	app := New()
+
+	res := httptest.NewRecorder()
+	app.schemaHandler(res, httptest.NewRequest(http.MethodPut, "/api/schema?key=orders", bytes.NewBufferString(orderSchema)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("schema handler put wrong status: got %v want 200", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	app.schemaHandler(res, httptest.NewRequest(http.MethodGet, "/api/schema?key=orders", nil))
+	var payload map[string]interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to parse schema payload: %v", err)
+	}
+	if payload["key"] != "orders" || payload["schema"] == nil {
+		t.Errorf("schema handler get returned unexpected payload: %v", payload)
+	}
+
+	res = httptest.NewRecorder()
+	app.schemaHandler(res, httptest.NewRequest(http.MethodDelete, "/api/schema?key=orders", nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("schema handler delete wrong status: got %v want 200", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	app.schemaHandler(res, httptest.NewRequest(http.MethodGet, "/api/schema?key=orders", nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("schema handler get after delete wrong status: got %v want 404", res.Code)
+	}
+}
+
+func TestSchemaHandlerInvalidSchema(t *testing.T) {
+	app := New()
+	for _, body := range []string{`{`, `{"type": 5}`} {
+		res := httptest.NewRecorder()
+		app.schemaHandler(res, httptest.NewRequest(http.MethodPut, "/api/schema?key=orders", bytes.NewBufferString(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("schema handler wrong status for %s: got %v want 400", body, res.Code)
+		}
+	}
+}
+
+func TestResponseHandlerRejectsSchemaDrift(t *testing.T) {
+	app := New()
+	schema, err := compileResponseSchema([]byte(orderSchema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	app.setResponseSchema("orders", schema)
+
+	valid := `{"response":{"id":"ord_1","status":"paid"},"statusCode":200}`
+	res := httptest.NewRecorder()
+	app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response?key=orders", bytes.NewBufferString(valid)))
+	if res.Code != http.StatusOK {
+		t.Errorf("response handler wrong status for valid body: got %v want 200", res.Code)
+	}
+
+	drifted := `{"response":{"id":"ord_1","status":"refunded"},"statusCode":200}`
+	res = httptest.NewRecorder()
+	app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response?key=orders", bytes.NewBufferString(drifted)))
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("response handler wrong status for drifted body: got %v want 400", res.Code)
+	}
+	if config := app.getResponseConfig("orders"); config.Response.(map[string]interface{})["status"] != "paid" {
+		t.Errorf("drifted body should not be stored: got %v", config.Response)
+	}
+
+	res = httptest.NewRecorder()
+	app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response?key=other", bytes.NewBufferString(drifted)))
+	if res.Code != http.StatusOK {
+		t.Errorf("keys without a schema should accept any body: got %v want 200", res.Code)
+	}
+}
@@ -1,36 +1,236 @@
-package main
+package hooklab
 
 // This file contains the HTTP server setup and route registration.
 
 import (
-	"embed"
+	"bytes"
+	"errors"
 	"fmt"
+	"html"
 	"io/fs"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-//go:embed web/*
-var webFS embed.FS
-
 // newServer creates and configures the HTTP server with all routes.
 // It registers webhook handlers, API endpoints, and serves static files from the embedded filesystem.
+// Everything but the webhook endpoints requires basic authentication when credentials are set.
 func newServer(app *App, port int) (*http.Server, error) {
+	handler, err := Handler(app)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler, Protocols: webhookProtocols()}, nil
+}
+
+// Handler returns everything hooklab serves on one server: the webhook
+// endpoints, the API, and the dashboard, behind app's logins. It can be
+// mounted under a path of another server, such as /debug/hooks/, with or
+// without http.StripPrefix, when app's base path is that path. Over TLS, the
+// server should speak HTTP/1.1 only, like webhookProtocols: the drop, hold, and
+// black hole modes hijack the connection, which HTTP/2 doesn't allow.
+func Handler(app *App) (http.Handler, error) {
+	if app.store == nil {
+		return nil, errors.New("hooklab: the App wasn't built by New")
+	}
 	mux := http.NewServeMux()
+	registerCaptureRoutes(mux, app)
+	if err := registerAdminRoutes(mux, app); err != nil {
+		return nil, err
+	}
+	return withBasePath(app.basePath, app.requireAuth(mux)), nil
+}
+
+// newSplitServers creates two servers instead of one: a capture server on port
+// serving only the webhook endpoints, and an admin server on adminAddr, such as
+// 127.0.0.1:9090, serving the API and dashboard, so the two can be exposed
+// differently.
+func newSplitServers(app *App, port int, adminAddr string) (capture, admin *http.Server, err error) {
+	_, adminPort, err := net.SplitHostPort(adminAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("admin address %q: %w", adminAddr, err)
+	}
+	// The capture server listens on every interface.
+	if port != 0 && adminPort == strconv.Itoa(port) {
+		return nil, nil, fmt.Errorf("admin address %q uses the capture port", adminAddr)
+	}
+
+	captureMux := http.NewServeMux()
+	registerCaptureRoutes(captureMux, app)
+	adminMux := http.NewServeMux()
+	if err := registerAdminRoutes(adminMux, app); err != nil {
+		return nil, nil, err
+	}
+
+	capture = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: withBasePath(app.basePath, captureMux), Protocols: webhookProtocols()}
+	admin = &http.Server{Addr: adminAddr, Handler: withBasePath(app.basePath, app.requireAuth(adminMux))}
+	return capture, admin, nil
+}
+
+// registerCaptureRoutes registers the webhook endpoints.
+func registerCaptureRoutes(mux *http.ServeMux, app *App) {
 	mux.HandleFunc("/webhook", app.webhookHandler)
 	mux.HandleFunc("/webhook/", app.webhookHandler)
+}
+
+// registerAdminRoutes registers the API endpoints and the dashboard.
+func registerAdminRoutes(mux *http.ServeMux, app *App) error {
 	mux.HandleFunc("/api/events", app.eventsHandler)
 	mux.HandleFunc("/api/stream", app.eventsStreamHandler)
 	mux.HandleFunc("/api/response", app.responseHandler)
 	mux.HandleFunc("/api/response/", app.responseHandler)
+	mux.HandleFunc("/api/responses", app.responsesHandler)
+	mux.HandleFunc("/api/schema", app.schemaHandler)
+	mux.HandleFunc("/api/openapi", app.openAPIHandler)
+	mux.HandleFunc("/api/avro", app.avroHandler)
+	mux.HandleFunc("/api/state", app.stateHandler)
 	mux.HandleFunc("/api/rules", app.rulesHandler)
+	mux.HandleFunc("/api/rules/reorder", app.rulesReorderHandler)
+	mux.HandleFunc("/api/rules/export", app.rulesExportHandler)
+	mux.HandleFunc("/api/rules/validate", app.rulesValidateHandler)
+	mux.HandleFunc("/api/rules/conflicts", app.rulesConflictsHandler)
+	mux.HandleFunc("/api/rules/history", app.ruleHistoryHandler)
+	mux.HandleFunc("/api/rules/diff", app.ruleDiffHandler)
+	mux.HandleFunc("/api/rules/restore", app.ruleRestoreHandler)
+	mux.HandleFunc("/api/rules/templates", app.ruleTemplatesHandler)
+	mux.HandleFunc("/api/rules/templates/", app.ruleTemplatesHandler)
+	mux.HandleFunc("/api/scenarios", app.scenariosHandler)
+	mux.HandleFunc("/api/notifiers", app.notifiersHandler)
+	mux.HandleFunc("/api/notifiers/deliveries", app.notifierDeliveriesHandler)
+	mux.HandleFunc("/api/alerts", app.alertsHandler)
+	mux.HandleFunc("/api/assert", app.assertHandler)
+	mux.HandleFunc("/api/stats", app.statsHandler)
+	mux.HandleFunc("/api/info", app.infoHandler)
+	mux.HandleFunc("/api/analytics", app.analyticsHandler)
+	mux.HandleFunc("/api/latency", app.latencyHandler)
+	mux.HandleFunc("/metrics", app.metricsHandler)
 	mux.HandleFunc("/api/keys", app.keysHandler)
+	mux.HandleFunc("/api/keys/", app.keyCopyHandler)
+	mux.HandleFunc("/api/admin/reload", app.reloadHandler)
 
+	if app.noUI || !embeddedUI {
+		mux.HandleFunc("/", noUIHandler)
+		return nil
+	}
 	webDir, err := fs.Sub(webFS, "web")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	mux.Handle("/", app.webHandler(webDir))
+	return nil
+}
+
+// listenURL returns the URL the server listening on ln is reached at, under
+// the -base-path prefix base. host names the server, such as a -domain; when
+// empty, the listener's address is used, or localhost for every interface.
+func listenURL(server *http.Server, ln net.Listener, host, base string) string {
+	scheme, defaultPort := "http", "80"
+	if server.TLSConfig != nil {
+		scheme, defaultPort = "https", "443"
+	}
+	addrHost, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		// Not a TCP address, such as a Unix socket from systemd.
+		return ""
 	}
-	mux.Handle("/", http.FileServer(http.FS(webDir)))
+	if host == "" {
+		host = addrHost
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			host = "localhost"
+		}
+	}
+	if port != defaultPort {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host + base + "/"
+}
+
+// setListenURLs records the URLs the servers are reached at, for /api/info.
+// adminURL is empty unless -admin-addr splits the servers.
+func (a *App) setListenURLs(url, adminURL string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.url = url
+	a.adminURL = adminURL
+}
+
+// parseBasePath checks a -base-path such as /hooklab and returns it without a
+// trailing slash; "" and "/" mean no prefix.
+func parseBasePath(path string) (string, error) {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", errors.New("must start with /")
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid segment %q", segment)
+		}
+		if strings.ContainsFunc(segment, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r))
+		}) {
+			return "", fmt.Errorf("segment %q may only hold letters, digits, and -._~", segment)
+		}
+	}
+	return path, nil
+}
+
+// withBasePath serves next under the -base-path prefix base, redirecting the
+// bare prefix to its trailing-slash form. Requests without the prefix are
+// served too, for reverse proxies that strip it.
+func withBasePath(base string, next http.Handler) http.Handler {
+	if base == "" {
+		return next
+	}
+	strip := http.StripPrefix(base, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == base:
+			target := base + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, base+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// noUIHandler answers requests for the dashboard when it is disabled with
+// -no-ui or left out of the build.
+func noUIHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "404 page not found; the dashboard is disabled, only /webhook and /api are served", http.StatusNotFound)
+}
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
-	return server, nil
+// webHandler serves the embedded dashboard. Under a -base-path, its pages get
+// a <base> element, which their relative API and page URLs resolve against.
+func (a *App) webHandler(webDir fs.FS) http.Handler {
+	files := http.FileServer(http.FS(webDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if a.basePath == "" || !strings.HasSuffix(name, ".html") || r.URL.Path == "/index.html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		page, err := fs.ReadFile(webDir, name)
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		base := `<head>` + "\n    " + `<base href="` + html.EscapeString(a.basePath) + `/" />`
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(bytes.Replace(page, []byte("<head>"), []byte(base), 1))
+	})
 }
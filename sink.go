@@ -0,0 +1,50 @@
+package hooklab
+
+// This file contains event sinks: external systems, such as a message bus, that
+// every captured webhook is published to so it can drive further automation.
+// The sinks hooklab ships, in natssink, kafkasink, and mqttsink, are their own
+// packages, so embedding hooklab doesn't pull in their clients.
+
+import "log"
+
+// EventSink publishes captured events to an external system. Publish must not
+// block the webhook response for long; sinks buffer or send in the background.
+type EventSink interface {
+	Name() string              // Names the sink in logs and /api/info, e.g. "NATS"
+	Publish(event Event) error // Sends event; failures are logged
+	Close() error              // Flushes what is buffered, once the server stops
+}
+
+// addSink registers a sink that every captured event is published to.
+func (a *App) addSink(sink EventSink) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sinks = append(a.sinks, sink)
+}
+
+// publishEvent publishes event to every registered sink, logging failures.
+func (a *App) publishEvent(event Event) {
+	a.mu.Lock()
+	sinks := a.sinks
+	a.mu.Unlock()
+
+	for _, sink := range sinks {
+		if err := sink.Publish(event); err != nil {
+			log.Printf("Publishing event %d to %s failed: %v", event.ID, sink.Name(), err)
+		}
+	}
+}
+
+// closeSinks flushes and closes every registered sink.
+func (a *App) closeSinks() {
+	a.mu.Lock()
+	sinks := a.sinks
+	a.sinks = nil
+	a.mu.Unlock()
+
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Closing %s failed: %v", sink.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package hooklab
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublishEventFailureDoesNotAffectResponse(t *testing.T) {
+	sink := &countingSink{err: errors.New("nats: connection closed")}
+	app := New(WithSink(sink))
+
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`)))
+	if w.Code != http.StatusOK || len(app.store.Events()) != 1 || sink.published != 1 {
+		t.Errorf("expected the webhook to be captured, published, and answered, got %d with %d events", w.Code, len(app.store.Events()))
+	}
+
+	app.closeSinks()
+	if !sink.closed {
+		t.Error("expected closing sinks to close the sink")
+	}
+}
@@ -1,15 +1,23 @@
-package main
+package hooklab
 
 // This file contains Server-Sent Events (SSE) handlers for real-time event streaming.
+// Captured webhooks are sent as unnamed messages; other changes are sent as
+// named notices (see StreamNotice) so UIs can keep every panel up to date.
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // eventsStreamHandler handles GET /api/stream requests for Server-Sent Events.
-// It establishes a persistent connection and streams webhook events in real-time.
+// It establishes a persistent connection and streams webhook events in real-time,
+// optionally only those of the keys given by "key" query parameters. With
+// "backlog", up to that many recent stored events are sent first.
 // Sends heartbeat pings every 25 seconds to keep the connection alive.
 func (a *App) eventsStreamHandler(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
@@ -17,6 +25,10 @@ func (a *App) eventsStreamHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
+	if _, err := streamBacklog(r); err != nil {
+		http.Error(w, "Invalid backlog", http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -31,28 +43,255 @@ func (a *App) eventsStreamHandler(w http.ResponseWriter, r *http.Request) {
 // eventsStreamLoop is the main event loop for SSE connections.
 // It listens for new events, heartbeat ticks, and context cancellation.
 func (a *App) eventsStreamLoop(w http.ResponseWriter, r *http.Request, flusher http.Flusher, ticks <-chan time.Time) {
-	subscriber := a.addSubscriber()
+	keys := streamKeys(r)
+	subscriber := a.addSubscriber(keys...)
 	defer a.removeSubscriber(subscriber)
+	notices := a.subscriberNotices(subscriber)
+
+	// Events stored before the subscriber was added may still be broadcast to it;
+	// skip those already sent with the backlog. Events relayed from other
+	// instances are numbered separately and never part of the backlog.
+	backlog, _ := streamBacklog(r)
+	sent := 0
+	for _, event := range a.recentEvents(keys, backlog) {
+		writeStreamEvent(w, event)
+		sent = event.ID
+	}
+	if sent > 0 {
+		flusher.Flush()
+	}
 
+	reported := 0
 	for {
+		// Tell the client when messages were dropped since the last report, so it
+		// knows to reload rather than trust its view.
+		if dropped := a.subscriberDrops(subscriber); dropped > reported {
+			writeStreamNotice(w, StreamNotice{Type: NoticeDropped, Data: map[string]int{"dropped": dropped}})
+			flusher.Flush()
+			reported = dropped
+		}
+
 		select {
 		case <-r.Context().Done():
 			return
 		case <-ticks:
 			_, _ = w.Write([]byte(": ping\n\n"))
 			flusher.Flush()
+		case notice := <-notices:
+			writeStreamNotice(w, notice)
+			flusher.Flush()
 		case event, ok := <-subscriber:
 			if !ok {
 				return
 			}
-			payload, err := json.Marshal(event)
-			if err != nil {
+			if event.Instance == "" && event.ID <= sent {
 				continue
 			}
-			_, _ = w.Write([]byte("data: "))
-			_, _ = w.Write(payload)
-			_, _ = w.Write([]byte("\n\n"))
+			writeStreamEvent(w, event)
 			flusher.Flush()
 		}
 	}
 }
+
+// writeStreamEvent writes event as an SSE message.
+func writeStreamEvent(w http.ResponseWriter, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = w.Write([]byte("data: "))
+	_, _ = w.Write(payload)
+	_, _ = w.Write([]byte("\n\n"))
+}
+
+// writeStreamNotice writes notice as a named SSE message.
+func writeStreamNotice(w http.ResponseWriter, notice StreamNotice) {
+	payload, err := json.Marshal(notice.Data)
+	if err != nil {
+		return
+	}
+	_, _ = w.Write([]byte("event: " + notice.Type + "\ndata: "))
+	_, _ = w.Write(payload)
+	_, _ = w.Write([]byte("\n\n"))
+}
+
+// recentEvents returns up to n of the most recent stored events of keys (or of
+// every key when keys is empty), oldest first, the order they were streamed in.
+func (a *App) recentEvents(keys []string, n int) []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var events []Event
+	for _, event := range a.store.Events() {
+		if len(events) == n {
+			break
+		}
+		if len(keys) == 0 || slices.Contains(keys, event.Key) {
+			events = append(events, event)
+		}
+	}
+	slices.Reverse(events)
+	return events
+}
+
+// streamKeys returns the webhook keys a stream request is limited to, from
+// repeated or comma-separated "key" query parameters, e.g. "?key=payments,orders".
+// It returns nil to stream every key.
+func streamKeys(r *http.Request) []string {
+	var keys []string
+	for _, value := range r.URL.Query()["key"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// streamBacklog returns the number of stored events a stream request asks to
+// receive before live events, from the "backlog" query parameter (default 0).
+func streamBacklog(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("backlog")
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New("backlog must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// Stream notice types, sent as SSE event names.
+const (
+	NoticeConfig     = "config"      // A key's response config was set or deleted: {key, config} or {key, deleted}
+	NoticeRules      = "rules"       // A key's rules changed: {key}
+	NoticeMatch      = "match"       // A rule matched a webhook: a RuleNotification
+	NoticeKeyCreated = "key-created" // A key got its first event, config, or rule: {key}
+	NoticeKeyDeleted = "key-deleted" // A key lost its last event, config, and rules: {key}
+	NoticeDropped    = "dropped"     // Messages were dropped for this stream: {dropped}, the total so far
+)
+
+// defaultStreamBuffer is how many webhook events, and separately how many
+// notices, a subscriber can fall behind by before further ones are dropped.
+const defaultStreamBuffer = 16
+
+// dropLocked counts a message dropped for a subscriber that fell behind.
+// The caller must hold a.mu.
+func (a *App) dropLocked(ch chan Event) {
+	a.drops[ch]++
+	a.droppedTotal++
+}
+
+// deliveredLocked counts a message queued for a subscriber. The caller must
+// hold a.mu.
+func (a *App) deliveredLocked(ch chan Event) {
+	a.delivered[ch]++
+	a.deliveredTotal++
+}
+
+// subscriberDrops returns how many messages were dropped for a subscriber.
+func (a *App) subscriberDrops(ch chan Event) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.drops[ch]
+}
+
+// StreamNotice is a named stream message about something other than a captured webhook.
+type StreamNotice struct {
+	Type string      // SSE event name, one of the Notice constants
+	Key  string      // Webhook key the notice is about, for subscriber key filters
+	Data interface{} // Message data, sent as JSON
+}
+
+// subscriberNotices returns the notice channel of a subscriber, or nil if it has none.
+func (a *App) subscriberNotices(ch chan Event) chan StreamNotice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.notices[ch]
+}
+
+// broadcastNotice sends a notice to all registered SSE subscribers of key.
+func (a *App) broadcastNotice(noticeType, key string, data interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.broadcastNoticeLocked(noticeType, key, data)
+}
+
+// broadcastNoticeLocked sends a notice to all registered SSE subscribers of key;
+// notices about global rules go to every subscriber. Non-blocking: if a
+// subscriber has fallen behind, the notice is dropped for it and counted.
+// The caller must hold a.mu.
+func (a *App) broadcastNoticeLocked(noticeType, key string, data interface{}) {
+	notice := StreamNotice{Type: noticeType, Key: key, Data: data}
+	a.broadcasts++
+	for ch, notices := range a.notices {
+		if keys, ok := a.subscriberKeys[ch]; ok && key != globalRuleKey && !keys[key] {
+			continue
+		}
+		select {
+		case notices <- notice:
+			a.deliveredLocked(ch)
+		default:
+			a.dropLocked(ch)
+		}
+	}
+}
+
+// keyKnownLocked reports whether key has events, a response config, or rules,
+// as listed by getKeys. The caller must hold a.mu.
+func (a *App) keyKnownLocked(key string) bool {
+	if key == "default" {
+		return true
+	}
+	if _, ok := a.responses[key]; ok {
+		return true
+	}
+	if _, ok := a.rules[key]; ok {
+		return true
+	}
+	for _, event := range a.store.Events() {
+		if event.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// keyChangedLocked announces key as created or deleted if it became known or
+// unknown since known was checked. The caller must hold a.mu.
+func (a *App) keyChangedLocked(key string, known bool) {
+	switch now := a.keyKnownLocked(key); {
+	case now && !known:
+		a.broadcastNoticeLocked(NoticeKeyCreated, key, map[string]interface{}{"key": key})
+	case !now && known:
+		a.broadcastNoticeLocked(NoticeKeyDeleted, key, map[string]interface{}{"key": key})
+	}
+}
+
+// configChangedLocked announces the current response config of key, where known
+// is whether key was known before the change. Subscribers may be viewers, so
+// the config's secrets are redacted. The caller must hold a.mu.
+func (a *App) configChangedLocked(key string, known bool) {
+	change := ConfigChange{Kind: NoticeConfig, Key: key}
+	if config, ok := a.responses[key]; ok {
+		change.Response = &config
+		a.broadcastNoticeLocked(NoticeConfig, key, map[string]interface{}{"key": key, "config": config.redacted()})
+	} else {
+		a.broadcastNoticeLocked(NoticeConfig, key, map[string]interface{}{"key": key, "deleted": true})
+	}
+	a.queueConfigChangeLocked(change)
+	a.keyChangedLocked(key, known)
+}
+
+// rulesChangedLocked announces a change to the rules of key, where known is
+// whether key was known before the change. The caller must hold a.mu.
+func (a *App) rulesChangedLocked(key string, known bool) {
+	a.broadcastNoticeLocked(NoticeRules, key, map[string]interface{}{"key": key})
+	a.queueConfigChangeLocked(ConfigChange{Kind: NoticeRules, Key: key, Rules: slices.Clone(a.rules[key])})
+	a.keyChangedLocked(key, known)
+}
@@ -1,14 +1,17 @@
-package main
+package hooklab
 
 import (
 	"context"
+	"encoding/json"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestEventsStreamHandlerNoFlusher(t *testing.T) {
-	app := &App{}
+	app := New()
 	req := httptest.NewRequest("GET", "/api/stream", nil)
 	writer := &noFlushWriter{}
 	app.eventsStreamHandler(writer, req)
@@ -18,7 +21,7 @@ func TestEventsStreamHandlerNoFlusher(t *testing.T) {
 }
 
 func TestEventsStreamLoopHeartbeat(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
@@ -68,7 +71,7 @@ func containsHelper(s, substr string) bool {
 }
 
 func TestEventsStreamLoopEvent(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
@@ -101,7 +104,7 @@ func TestEventsStreamLoopEvent(t *testing.T) {
 }
 
 func TestEventsStreamLoopChannelClosed(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
@@ -128,7 +131,7 @@ func TestEventsStreamLoopChannelClosed(t *testing.T) {
 }
 
 func TestEventsStreamLoopContextDone(t *testing.T) {
-	app := &App{}
+	app := New()
 	ctx, cancel := context.WithCancel(context.Background())
 	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
 	writer := &sseWriter{}
@@ -154,7 +157,7 @@ func TestEventsStreamLoopContextDone(t *testing.T) {
 }
 
 func TestBroadcastEventWithFullChannel(t *testing.T) {
-	app := &App{subscribers: make(map[chan Event]struct{})}
+	app := New()
 	// Create a channel with buffer 1 and fill it
 	ch := make(chan Event, 1)
 	ch <- Event{ID: 0}
@@ -164,3 +167,269 @@ func TestBroadcastEventWithFullChannel(t *testing.T) {
 	app.broadcastEvent(Event{ID: 1})
 	// Test passes if it doesn't deadlock
 }
+
+func TestBroadcastEventKeyFilter(t *testing.T) {
+	app := New()
+	all := app.addSubscriber()
+	filtered := app.addSubscriber("payments", "orders")
+	defer app.removeSubscriber(all)
+	defer app.removeSubscriber(filtered)
+
+	for _, key := range []string{"github", "orders"} {
+		app.broadcastEvent(Event{ID: 1, Key: key})
+		if event := <-all; event.Key != key {
+			t.Errorf("expected unfiltered subscriber to get %s, got %s", key, event.Key)
+		}
+	}
+	select {
+	case event := <-filtered:
+		if event.Key != "orders" {
+			t.Errorf("expected only the orders event, got %s", event.Key)
+		}
+	default:
+		t.Fatal("expected the orders event")
+	}
+	select {
+	case event := <-filtered:
+		t.Errorf("unexpected event %+v", event)
+	default:
+	}
+}
+
+func TestStreamKeys(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"?key=payments", []string{"payments"}},
+		{"?key=payments&key=orders", []string{"payments", "orders"}},
+		{"?key=payments,%20orders,", []string{"payments", "orders"}},
+	}
+	for _, tt := range tests {
+		got := streamKeys(httptest.NewRequest("GET", "/api/stream"+tt.query, nil))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestEventsStreamLoopBacklog(t *testing.T) {
+	app := New()
+	for _, key := range []string{"payments", "orders", "payments", "payments"} {
+		app.storeEvent(httptest.NewRequest("POST", "/webhook/"+key, nil), key, parseBody("{}"))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/stream?key=payments&backlog=2", nil).WithContext(ctx)
+	writer := &sseWriter{}
+	ticks := make(chan time.Time)
+
+	done := make(chan struct{})
+	go func() {
+		app.eventsStreamLoop(writer, req, writer, ticks)
+		close(done)
+	}()
+
+	// Wait for subscriber to be added
+	time.Sleep(10 * time.Millisecond)
+
+	// An event already sent with the backlog is not sent again.
+	app.broadcastEvent(app.store.Events()[0])
+	app.broadcastEvent(app.storeEvent(httptest.NewRequest("POST", "/webhook/payments", nil), "payments", parseBody("{}")))
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("eventsStreamLoop did not exit")
+	}
+
+	var ids []int
+	for _, message := range strings.Split(strings.TrimSpace(writer.buffer.String()), "\n\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "data: ")), &event); err != nil {
+			t.Fatalf("failed to decode %q: %v", message, err)
+		}
+		ids = append(ids, event.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{3, 4, 5}) {
+		t.Errorf("expected events 3, 4, 5, got %v", ids)
+	}
+}
+
+func TestEventsStreamHandlerInvalidBacklog(t *testing.T) {
+	app := New()
+	for _, backlog := range []string{"-1", "many"} {
+		w := httptest.NewRecorder()
+		app.eventsStreamHandler(w, httptest.NewRequest("GET", "/api/stream?backlog="+backlog, nil))
+		if w.Code != 400 {
+			t.Errorf("backlog %s: expected status 400, got %d", backlog, w.Code)
+		}
+	}
+}
+
+func TestStreamNotices(t *testing.T) {
+	app := New()
+	ch := app.addSubscriber("payments")
+	defer app.removeSubscriber(ch)
+	notices := app.subscriberNotices(ch)
+
+	app.setResponseConfig("payments", ResponseConfig{StatusCode: 202})
+	rule := app.addRule("payments", Rule{Name: "Large", Condition: "body.amount > 100", StatusCode: 402, Enabled: true})
+	app.addRule("orders", Rule{Condition: "true", Enabled: true})
+	app.addRule(globalRuleKey, Rule{Condition: "false", Enabled: true})
+	app.webhookHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook/payments", strings.NewReader(`{"amount":500}`)))
+	app.deleteRule("payments", rule.ID)
+	app.deleteResponseConfig("payments")
+
+	want := []string{
+		NoticeConfig, NoticeKeyCreated, // first config of payments
+		NoticeRules,                   // payments rule added; orders is filtered out
+		NoticeRules, NoticeKeyCreated, // global rules reach every subscriber
+		NoticeMatch,
+		NoticeRules,
+		NoticeConfig, // payments still has an event and its (empty) rules
+	}
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case notice := <-notices:
+			got = append(got, notice.Type)
+			if notice.Type == NoticeMatch {
+				if match := notice.Data.(RuleNotification); match.RuleID != rule.ID || match.Key != "payments" {
+					t.Errorf("unexpected match %+v", match)
+				}
+			}
+		default:
+			t.Fatalf("expected notices %v, got %v", want, got)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notices %v, got %v", want, got)
+	}
+	select {
+	case notice := <-notices:
+		t.Errorf("unexpected notice %+v", notice)
+	default:
+	}
+}
+
+func TestStreamNoticeKeyLifecycle(t *testing.T) {
+	app := New()
+	ch := app.addSubscriber()
+	defer app.removeSubscriber(ch)
+	notices := app.subscriberNotices(ch)
+
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: 200})
+	app.deleteResponseConfig("orders")
+	app.storeEvent(httptest.NewRequest("POST", "/webhook/github", nil), "github", parseBody("{}"))
+	app.storeEvent(httptest.NewRequest("POST", "/webhook/github", nil), "github", parseBody("{}"))
+
+	var got []string
+	for len(notices) > 0 {
+		notice := <-notices
+		got = append(got, notice.Type+" "+notice.Key)
+	}
+	want := []string{"config orders", "key-created orders", "config orders", "key-deleted orders", "key-created github"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notices %v, got %v", want, got)
+	}
+}
+
+func TestEventsStreamLoopNotice(t *testing.T) {
+	app := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
+	writer := &sseWriter{}
+	ticks := make(chan time.Time)
+
+	done := make(chan struct{})
+	go func() {
+		app.eventsStreamLoop(writer, req, writer, ticks)
+		close(done)
+	}()
+
+	// Wait for subscriber to be added
+	time.Sleep(10 * time.Millisecond)
+	app.setResponseConfig("payments", ResponseConfig{StatusCode: 202})
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("eventsStreamLoop did not exit")
+	}
+
+	output := writer.buffer.String()
+	if !strings.Contains(output, "event: config\ndata: {\"config\":{") || !strings.Contains(output, "event: key-created\ndata: {\"key\":\"payments\"}\n\n") {
+		t.Errorf("expected config and key-created notices, got: %s", output)
+	}
+}
+
+func TestBroadcastEventCountsDrops(t *testing.T) {
+	app := New(WithStreamBuffer(2))
+	slow := app.addSubscriber()
+	other := app.addSubscriber("orders")
+
+	for id := 1; id <= 5; id++ {
+		app.broadcastEvent(Event{ID: id, Key: "payments"})
+	}
+	if len(slow) != 2 {
+		t.Errorf("expected a buffer of 2 events, got %d", len(slow))
+	}
+	if got := app.subscriberDrops(slow); got != 3 {
+		t.Errorf("expected 3 drops, got %d", got)
+	}
+	if got := app.subscriberDrops(other); got != 0 {
+		t.Errorf("expected filtered events not to count as drops, got %d", got)
+	}
+
+	// Totals outlive the subscriber.
+	app.removeSubscriber(slow)
+	if stats := app.streamStats(); stats.Dropped != 3 || stats.Subscribers != 1 {
+		t.Errorf("unexpected stats after removing subscriber: %+v", stats)
+	}
+	app.removeSubscriber(other)
+}
+
+func TestEventsStreamLoopReportsDrops(t *testing.T) {
+	app := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/stream", nil).WithContext(ctx)
+	writer := &sseWriter{}
+	ticks := make(chan time.Time)
+
+	done := make(chan struct{})
+	go func() {
+		app.eventsStreamLoop(writer, req, writer, ticks)
+		close(done)
+	}()
+
+	// Wait for subscriber to be added
+	time.Sleep(10 * time.Millisecond)
+
+	// Simulate two dropped messages, then wake the loop with an event.
+	app.mu.Lock()
+	for ch := range app.subscribers {
+		app.dropLocked(ch)
+		app.dropLocked(ch)
+	}
+	app.mu.Unlock()
+	app.broadcastEvent(Event{ID: 1})
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("eventsStreamLoop did not exit")
+	}
+	if !strings.Contains(writer.buffer.String(), "event: dropped\ndata: {\"dropped\":2}\n\n") {
+		t.Errorf("expected a dropped notice, got: %s", writer.buffer.String())
+	}
+}
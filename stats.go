@@ -0,0 +1,82 @@
+package hooklab
+
+// This file contains the /api/stats endpoint, reporting runtime counters such as
+// how well SSE subscribers keep up with the stream and how many webhooks were
+// refused.
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// StreamStats describes the SSE subscribers and the messages dropped for them.
+type StreamStats struct {
+	Subscribers int               `json:"subscribers"`
+	Buffer      int               `json:"buffer"`     // Messages a subscriber can fall behind by
+	Broadcasts  int               `json:"broadcasts"` // Events and notices broadcast since startup
+	Delivered   int               `json:"delivered"`  // Messages queued for subscribers since startup, including closed streams
+	Dropped     int               `json:"dropped"`    // Messages dropped since startup, including for closed streams
+	Lagging     int               `json:"lagging"`    // Open streams that have had messages dropped
+	Streams     []SubscriberStats `json:"streams"`
+}
+
+// SubscriberStats describes one open SSE stream.
+type SubscriberStats struct {
+	Keys      []string `json:"keys,omitempty"` // Keys the stream is limited to; empty streams every key
+	Pending   int      `json:"pending"`        // Messages waiting to be sent
+	Delivered int      `json:"delivered"`      // Messages queued for the stream
+	Dropped   int      `json:"dropped"`        // Messages dropped because the stream fell behind
+}
+
+// streamStats returns the current stream statistics.
+func (a *App) streamStats() StreamStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := StreamStats{
+		Subscribers: len(a.subscribers),
+		Buffer:      cmp.Or(a.streamBuffer, defaultStreamBuffer),
+		Broadcasts:  a.broadcasts,
+		Delivered:   a.deliveredTotal,
+		Dropped:     a.droppedTotal,
+		Streams:     make([]SubscriberStats, 0, len(a.subscribers)),
+	}
+	for ch := range a.subscribers {
+		var keys []string
+		for key := range a.subscriberKeys[ch] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if a.drops[ch] > 0 {
+			stats.Lagging++
+		}
+		stats.Streams = append(stats.Streams, SubscriberStats{
+			Keys:      keys,
+			Pending:   len(ch) + len(a.notices[ch]),
+			Delivered: a.delivered[ch],
+			Dropped:   a.drops[ch],
+		})
+	}
+	slices.SortFunc(stats.Streams, func(x, y SubscriberStats) int {
+		return cmp.Or(y.Dropped-x.Dropped, strings.Compare(strings.Join(x.Keys, ","), strings.Join(y.Keys, ",")))
+	})
+	return stats
+}
+
+// statsHandler handles GET /api/stats requests, returning
+// {"stream": StreamStats, "rejected": RejectionStats}.
+func (a *App) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream":   a.streamStats(),
+		"rejected": a.rejectionStats(),
+	})
+}
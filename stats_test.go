@@ -0,0 +1,44 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsHandler(t *testing.T) {
+	app := New(WithStreamBuffer(1))
+	all := app.addSubscriber()
+	filtered := app.addSubscriber("payments", "orders")
+	defer app.removeSubscriber(all)
+	defer app.removeSubscriber(filtered)
+
+	app.broadcastEvent(Event{ID: 1, Key: "github"})
+	app.broadcastEvent(Event{ID: 2, Key: "github"})
+
+	w := httptest.NewRecorder()
+	app.statsHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var got struct {
+		Stream StreamStats `json:"stream"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	stats := got.Stream
+	if stats.Subscribers != 2 || stats.Buffer != 1 || stats.Broadcasts != 2 || stats.Delivered != 1 || stats.Dropped != 1 || stats.Lagging != 1 || len(stats.Streams) != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if s := stats.Streams[0]; len(s.Keys) != 0 || s.Pending != 1 || s.Delivered != 1 || s.Dropped != 1 {
+		t.Errorf("expected the unfiltered stream first with 1 drop, got %+v", s)
+	}
+	if s := stats.Streams[1]; len(s.Keys) != 2 || s.Keys[0] != "orders" || s.Pending != 0 || s.Dropped != 0 {
+		t.Errorf("unexpected filtered stream %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	app.statsHandler(w, httptest.NewRequest(http.MethodPost, "/api/stats", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package hooklab
+
+// This file contains event stores: where an App keeps its captured events. By
+// default they are kept in memory; WithStore puts them somewhere else, such as
+// a database shared by several instances.
+
+// EventStore keeps the captured events of an App, newest first. The app calls
+// it with its lock held, so implementations needn't be safe for concurrent
+// use, but shouldn't block for long.
+type EventStore interface {
+	Name() string               // Names where events are kept in /api/info, e.g. "memory"
+	Add(event Event, limit int) // Stores event as the newest, dropping the oldest ones past limit
+	Update(event Event) bool    // Replaces the stored event with event's ID, reporting whether it is still stored
+	Events() []Event            // Returns the stored events, newest first; callers don't modify it
+}
+
+// memoryStore is the default EventStore, keeping events in a slice.
+type memoryStore struct {
+	events []Event
+}
+
+// Name returns "memory".
+func (s *memoryStore) Name() string { return "memory" }
+
+// Add prepends event, dropping the oldest events past limit.
+func (s *memoryStore) Add(event Event, limit int) {
+	s.events = append([]Event{event}, s.events...)
+	if len(s.events) > limit {
+		s.events = s.events[:limit]
+	}
+}
+
+// Update replaces the stored event with event's ID.
+func (s *memoryStore) Update(event Event) bool {
+	for i := range s.events {
+		if s.events[i].ID == event.ID {
+			s.events[i] = event
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns the stored events.
+func (s *memoryStore) Events() []Event {
+	return s.events
+}
@@ -0,0 +1,106 @@
+package hooklab
+
+// This file contains systemd socket activation: when systemd opens the
+// listening sockets and passes them in (LISTEN_FDS), hooklab serves on those
+// instead of binding its own, so the port stays open, with connections
+// queueing, while hooklab restarts.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets in.
+const listenFDsStart = 3
+
+// adminSocketName is the FileDescriptorName= of the socket for the -admin-addr
+// server.
+const adminSocketName = "admin"
+
+// activatedSocket is a listening socket passed by systemd.
+type activatedSocket struct {
+	name     string // FileDescriptorName= of the socket unit, if any
+	listener net.Listener
+}
+
+// activatedSockets returns the sockets systemd passed to this process, or none
+// when it wasn't socket activated. The LISTEN_* variables are removed, so
+// processes hooklab starts don't take them for their own.
+func activatedSockets() ([]activatedSocket, error) {
+	return socketsFrom(listenFDsStart)
+}
+
+// socketsFrom returns the sockets described by the LISTEN_* variables, whose
+// file descriptors start at first.
+func socketsFrom(first int) ([]activatedSocket, error) {
+	pid, count, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || count == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", count)
+	}
+	nameList := strings.Split(names, ":")
+
+	sockets := make([]activatedSocket, 0, n)
+	for i := range n {
+		fd := first + i
+		socket := activatedSocket{}
+		if names != "" && len(nameList) == n {
+			socket.name = nameList[i]
+		}
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// FileListener works on a duplicate, so the passed descriptor is closed.
+		socket.listener, err = net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, s := range sockets {
+				s.listener.Close()
+			}
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+// pairSockets decides which server serves on which activated socket: the one
+// named "admin" goes to the admin server, and the others go to the capture
+// server, then the admin server, in order. Servers left without a socket
+// listen on their own address.
+func pairSockets(capture, admin *http.Server, sockets []activatedSocket) (map[*http.Server]net.Listener, error) {
+	listeners := make(map[*http.Server]net.Listener)
+	var unnamed []net.Listener
+	for _, socket := range sockets {
+		if socket.name != adminSocketName {
+			unnamed = append(unnamed, socket.listener)
+			continue
+		}
+		if admin == nil {
+			return nil, errors.New(`systemd passed an "admin" socket, but -admin-addr isn't set`)
+		}
+		if listeners[admin] != nil {
+			return nil, errors.New(`systemd passed more than one "admin" socket`)
+		}
+		listeners[admin] = socket.listener
+	}
+	for _, server := range []*http.Server{capture, admin} {
+		if len(unnamed) == 0 || server == nil || listeners[server] != nil {
+			continue
+		}
+		listeners[server], unnamed = unnamed[0], unnamed[1:]
+	}
+	if len(unnamed) > 0 {
+		return nil, fmt.Errorf("systemd passed %d sockets, more than hooklab serves on", len(sockets))
+	}
+	return listeners, nil
+}
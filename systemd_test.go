@@ -0,0 +1,111 @@
+//go:build unix
+
+package hooklab
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// passSocket returns the file descriptor of a new listening socket, as systemd
+// would pass it, and the socket's address.
+func passSocket(t *testing.T) (int, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd, ln.Addr().String()
+}
+
+func TestActivatedSockets(t *testing.T) {
+	fd, addr := passSocket(t)
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "admin")
+
+	sockets, err := socketsFrom(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sockets) != 1 || sockets[0].name != "admin" || sockets[0].listener.Addr().String() != addr {
+		t.Fatalf("unexpected sockets %+v", sockets)
+	}
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("expected the LISTEN_* variables to be removed")
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go serveListener(server, sockets[0].listener)
+	defer server.Close()
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the passed socket to be served, got %d", resp.StatusCode)
+	}
+
+	// Variables meant for another process are ignored.
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if sockets, err := socketsFrom(fd); err != nil || sockets != nil {
+		t.Errorf("expected no sockets for another process, got %v, %v", sockets, err)
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "none")
+	if _, err := socketsFrom(fd); err == nil {
+		t.Error("expected an invalid LISTEN_FDS to be refused")
+	}
+}
+
+func TestPairSockets(t *testing.T) {
+	listen := func(name string) activatedSocket {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		return activatedSocket{name: name, listener: ln}
+	}
+	capture, admin := &http.Server{}, &http.Server{}
+
+	first, second := listen(""), listen("")
+	listeners, err := pairSockets(capture, admin, []activatedSocket{first, second})
+	if err != nil || listeners[capture] != first.listener || listeners[admin] != second.listener {
+		t.Errorf("expected the sockets in order, got %v, %v", listeners, err)
+	}
+
+	named, web := listen("admin"), listen("web")
+	listeners, err = pairSockets(capture, admin, []activatedSocket{named, web})
+	if err != nil || listeners[capture] != web.listener || listeners[admin] != named.listener {
+		t.Errorf("expected the admin socket by name, got %v, %v", listeners, err)
+	}
+
+	listeners, err = pairSockets(capture, admin, []activatedSocket{first})
+	if err != nil || listeners[capture] != first.listener || listeners[admin] != nil {
+		t.Errorf("expected the admin server to listen itself, got %v, %v", listeners, err)
+	}
+
+	if _, err := pairSockets(capture, nil, []activatedSocket{named}); err == nil {
+		t.Error("expected an admin socket without an admin server to be refused")
+	}
+	if _, err := pairSockets(capture, nil, []activatedSocket{first, second}); err == nil {
+		t.Error("expected a socket too many to be refused")
+	}
+}
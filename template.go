@@ -0,0 +1,324 @@
+package hooklab
+
+// This file contains request templating used to build dynamic response values
+// such as redirect locations and response bodies, plus the per-key mock state
+// that templates can read and update.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// mockState holds the counters and stored values of a webhook key, shared by all
+// templates rendered for that key.
+type mockState struct {
+	Counters map[string]int         `json:"counters"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+// validationFuncs declares the template functions, with the signatures of
+// templateFuncs, so templates can be parsed (and validated) without an App. The
+// implementations are replaced at render time.
+var validationFuncs = template.FuncMap{
+	"counter": func(string) int { return 0 },
+	"set":     func(string, interface{}) string { return "" },
+	"get":     func(string) interface{} { return nil },
+}
+
+// requestTemplateData builds the data passed to response templates.
+// Templates can reference:
+//   - .key: webhook key
+//   - .method: HTTP method
+//   - .path: request path
+//   - .query: map of query parameters (first value)
+//   - .headers: map of header names to their first value
+//   - .body: parsed JSON body (or raw string if not valid JSON)
+func requestTemplateData(r *http.Request, key string, body *requestBody) map[string]interface{} {
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+
+	headers := make(map[string]string)
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	return map[string]interface{}{
+		"key":     key,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   query,
+		"headers": headers,
+		"body":    body.value,
+	}
+}
+
+// templateFuncs returns the stateful functions available to templates rendered for key:
+//   - counter "name": increments the named counter and returns its new value
+//   - set "name" value: stores a value and renders nothing
+//   - get "name": returns a stored value
+func (a *App) templateFuncs(key string) template.FuncMap {
+	return template.FuncMap{
+		"counter": func(name string) int {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			state := a.mockStateLocked(key)
+			state.Counters[name]++
+			return state.Counters[name]
+		},
+		"set": func(name string, value interface{}) string {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			a.mockStateLocked(key).Values[name] = value
+			return ""
+		},
+		"get": func(name string) interface{} {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			return a.mockStateLocked(key).Values[name]
+		},
+	}
+}
+
+// mockStateLocked returns the mock state for key, creating it if needed.
+// The caller must hold a.mu.
+func (a *App) mockStateLocked(key string) *mockState {
+	state, ok := a.state[key]
+	if !ok {
+		state = &mockState{
+			Counters: make(map[string]int),
+			Values:   make(map[string]interface{}),
+		}
+		a.state[key] = state
+	}
+	return state
+}
+
+// getMockState returns a copy of the mock state for key.
+func (a *App) getMockState(key string) mockState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := a.mockStateLocked(key)
+	snapshot := mockState{
+		Counters: make(map[string]int, len(state.Counters)),
+		Values:   make(map[string]interface{}, len(state.Values)),
+	}
+	for name, value := range state.Counters {
+		snapshot.Counters[name] = value
+	}
+	for name, value := range state.Values {
+		snapshot.Values[name] = value
+	}
+	return snapshot
+}
+
+// resetMockState clears the counters and stored values of key.
+func (a *App) resetMockState(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.state, key)
+}
+
+// maxCachedTemplates bounds the parsed template cache; it is cleared when full.
+const maxCachedTemplates = 1024
+
+// parsedTemplate is the outcome of parsing a template, cached by templateCache.
+type parsedTemplate struct {
+	tmpl *template.Template
+	err  error
+}
+
+// templateCache holds parsed templates shared by all keys, by template text, so
+// a response template is parsed once rather than on every request.
+var templateCache = struct {
+	sync.Mutex
+	templates map[string]parsedTemplate
+}{templates: make(map[string]parsedTemplate)}
+
+// emptyIfNilFunc is the function every printing action of a template is piped
+// into, so missing map keys and JSON nulls render as nothing instead of
+// text/template's "<no value>".
+const emptyIfNilFunc = "hooklabEmptyIfNil"
+
+// parseTemplate compiles a response template, parsing it on first use. Missing
+// map keys render as empty values.
+func parseTemplate(text string) (*template.Template, error) {
+	templateCache.Lock()
+	cached, ok := templateCache.templates[text]
+	templateCache.Unlock()
+	if ok {
+		return cached.tmpl, cached.err
+	}
+
+	tmpl, err := template.New("response").Option("missingkey=zero").Funcs(validationFuncs).Funcs(template.FuncMap{
+		emptyIfNilFunc: func(value interface{}) interface{} {
+			if value == nil {
+				return ""
+			}
+			return value
+		},
+	}).Parse(text)
+	if err == nil {
+		for _, t := range tmpl.Templates() {
+			emptyNilOutput(t.Tree, t.Root)
+		}
+	}
+
+	templateCache.Lock()
+	if len(templateCache.templates) >= maxCachedTemplates {
+		clear(templateCache.templates)
+	}
+	templateCache.templates[text] = parsedTemplate{tmpl: tmpl, err: err}
+	templateCache.Unlock()
+	return tmpl, err
+}
+
+// emptyNilOutput pipes the value of every action below node that prints one
+// into emptyIfNilFunc.
+func emptyNilOutput(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			emptyNilOutput(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			ident := parse.NewIdentifier(emptyIfNilFunc).SetTree(tree).SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+		}
+	case *parse.IfNode:
+		emptyNilOutput(tree, n.List)
+		emptyNilOutput(tree, n.ElseList)
+	case *parse.RangeNode:
+		emptyNilOutput(tree, n.List)
+		emptyNilOutput(tree, n.ElseList)
+	case *parse.WithNode:
+		emptyNilOutput(tree, n.List)
+		emptyNilOutput(tree, n.ElseList)
+	}
+}
+
+// renderTemplate executes a response template against the given data using funcs,
+// which may be nil for templates that don't touch mock state.
+// Strings without template actions are returned unchanged.
+func renderTemplate(text string, data map[string]interface{}, funcs template.FuncMap) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	if funcs != nil {
+		// The cached template is shared, so the funcs go on a copy.
+		if tmpl, err = tmpl.Clone(); err != nil {
+			return "", err
+		}
+		tmpl.Funcs(funcs)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// renderValue renders every template string inside a JSON value, such as a
+// configured response body. Maps and slices are copied, never modified in place.
+func renderValue(value interface{}, data map[string]interface{}, funcs template.FuncMap) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return renderTemplate(v, data, funcs)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			out, err := renderValue(item, data, funcs)
+			if err != nil {
+				return nil, err
+			}
+			rendered[name] = out
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			out, err := renderValue(item, data, funcs)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = out
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// validateTemplates parses every template string inside a JSON value.
+func validateTemplates(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "{{") {
+			_, err := parseTemplate(v)
+			return err
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := validateTemplates(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := validateTemplates(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stateHandler handles GET and DELETE requests to /api/state.
+// GET returns the counters and stored values of a key; DELETE resets them.
+func (a *App) stateHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "default"
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		state := a.getMockState(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":      key,
+			"counters": state.Counters,
+			"values":   state.Values,
+		})
+	case http.MethodDelete:
+		a.resetMockState(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
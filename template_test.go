@@ -0,0 +1,154 @@
+package hooklab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidationFuncs(t *testing.T) {
+	funcs := New().templateFuncs("orders")
+	if len(funcs) != len(validationFuncs) {
+		t.Fatalf("expected %d validation funcs, got %d", len(funcs), len(validationFuncs))
+	}
+	for name, f := range funcs {
+		if got, want := reflect.TypeOf(validationFuncs[name]), reflect.TypeOf(f); got != want {
+			t.Errorf("%s: expected the validation func typed %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestRenderTemplatePlainText(t *testing.T) {
+	got, err := renderTemplate("https://example.com/next", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "https://example.com/next" {
+		t.Errorf("renderTemplate plain text: got %q", got)
+	}
+}
+
+func TestRenderTemplateRequestData(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/orders?ref=abc", nil)
+	req.Header.Set("X-Tenant", "acme")
+	data := requestTemplateData(req, "orders", parseBody(`{"id":"ord_1"}`))
+
+	got, err := renderTemplate(`/{{.key}}/{{.body.id}}?ref={{.query.ref}}&tenant={{index .headers "X-Tenant"}}`, data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/orders/ord_1?ref=abc&tenant=acme"; got != want {
+		t.Errorf("renderTemplate: got %q want %q", got, want)
+	}
+}
+
+func TestRenderTemplateMissingKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	data := requestTemplateData(req, "default", parseBody(`{}`))
+
+	got, err := renderTemplate("/items/{{.body.id}}", data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "/items/" {
+		t.Errorf("renderTemplate missing key: got %q want /items/", got)
+	}
+}
+
+func TestRenderTemplateNoValueText(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	data := requestTemplateData(req, "default", parseBody(`{"note":"<no value>","gone":null}`))
+
+	text := `{{.body.note}}|{{.body.gone}}|{{if true}}{{.body.missing}}{{end}}|{{with .body.note}}{{.}}{{end}}`
+	got, err := renderTemplate(text, data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "<no value>|||<no value>"; got != want {
+		t.Errorf("expected literal text kept and missing values empty, got %q want %q", got, want)
+	}
+	first, _ := parseTemplate(text)
+	if again, _ := parseTemplate(text); again != first {
+		t.Error("expected the parsed template reused")
+	}
+}
+
+func TestWebhookHandlerTemplatedCounters(t *testing.T) {
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{
+		Response: map[string]interface{}{
+			"order":    `ord_{{counter "orders"}}`,
+			"previous": `{{get "last_ref"}}{{set "last_ref" .body.ref}}`,
+		},
+		StatusCode: http.StatusOK,
+	})
+
+	send := func(ref string) map[string]string {
+		res := httptest.NewRecorder()
+		app.webhookHandler(res, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"ref":"`+ref+`"}`)))
+		var payload map[string]string
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return payload
+	}
+
+	first := send("a")
+	if first["order"] != "ord_1" || first["previous"] != "" {
+		t.Errorf("first response: got %v", first)
+	}
+	second := send("b")
+	if second["order"] != "ord_2" || second["previous"] != "a" {
+		t.Errorf("second response: got %v", second)
+	}
+
+	if state := app.getMockState("orders"); state.Counters["orders"] != 2 || state.Values["last_ref"] != "b" {
+		t.Errorf("unexpected mock state: %+v", state)
+	}
+	if state := app.getMockState("other"); len(state.Counters) != 0 {
+		t.Errorf("mock state should be per key: %+v", state)
+	}
+}
+
+func TestStateHandler(t *testing.T) {
+	app := New()
+	app.templateFuncs("orders")["counter"].(func(string) int)("orders")
+
+	res := httptest.NewRecorder()
+	app.stateHandler(res, httptest.NewRequest(http.MethodGet, "/api/state?key=orders", nil))
+	var payload mockState
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to parse state payload: %v", err)
+	}
+	if payload.Counters["orders"] != 1 {
+		t.Errorf("state handler returned wrong counter: %+v", payload)
+	}
+
+	res = httptest.NewRecorder()
+	app.stateHandler(res, httptest.NewRequest(http.MethodDelete, "/api/state?key=orders", nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("state handler delete wrong status: got %v want 200", res.Code)
+	}
+	if state := app.getMockState("orders"); state.Counters["orders"] != 0 {
+		t.Errorf("state should be reset: %+v", state)
+	}
+
+	res = httptest.NewRecorder()
+	app.stateHandler(res, httptest.NewRequest(http.MethodPost, "/api/state", nil))
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("state handler wrong status for POST: got %v want 405", res.Code)
+	}
+}
+
+func TestResponseHandlerPostInvalidBodyTemplate(t *testing.T) {
+	app := New()
+	body := `{"response":{"id":"{{counter \"orders\""}}`
+	res := httptest.NewRecorder()
+	app.responseHandler(res, httptest.NewRequest(http.MethodPost, "/api/response", strings.NewReader(body)))
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("response handler wrong status for invalid body template: got %v want 400", res.Code)
+	}
+}
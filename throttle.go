@@ -0,0 +1,115 @@
+package hooklab
+
+// This file contains capture throttling: a token bucket per client address and
+// webhook key, set by flag, that refuses webhooks before their body is read, so
+// an accidental load test against the capture endpoint can't exhaust the
+// instance. Unlike a key's rateLimit, which simulates an upstream limit,
+// throttled webhooks are never stored.
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxCaptureBuckets bounds the buckets tracked at once; past it, buckets that
+// have refilled are forgotten, then arbitrary ones.
+const maxCaptureBuckets = 10000
+
+// defaultCaptureBurst is the default of -capture-burst.
+const defaultCaptureBurst = 20
+
+// CaptureLimit allows each client address Burst webhooks to a key at once,
+// refilled at Rate per second.
+type CaptureLimit struct {
+	Rate  float64 // Webhooks per second per client and key; 0 disables throttling
+	Burst int     // Webhooks a client can send to a key at once
+}
+
+// captureBucket is the token bucket of one client and key.
+type captureBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// validate checks that an enabled limit has a positive burst.
+func (l CaptureLimit) validate() error {
+	if l.Rate < 0 {
+		return errors.New("rate must not be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+// setCaptureLimit sets the limit applied to webhooks of every client and key.
+func (a *App) setCaptureLimit(limit CaptureLimit) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.captureLimit = limit
+	a.captureBuckets = make(map[string]captureBucket)
+}
+
+// takeCaptureToken takes a token from the bucket of client and key at now. When
+// the bucket is empty it returns false and how long until a token is available.
+func (a *App) takeCaptureToken(client, key string, now time.Time) (bool, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limit := a.captureLimit
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	id := client + " " + key
+	bucket, ok := a.captureBuckets[id]
+	if !ok {
+		if len(a.captureBuckets) >= maxCaptureBuckets {
+			a.pruneCaptureBucketsLocked(now)
+		}
+		bucket = captureBucket{tokens: float64(limit.Burst), last: now}
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	a.captureBuckets[id] = bucket
+	if allowed {
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+}
+
+// pruneCaptureBucketsLocked forgets buckets that have refilled by now, which
+// behave like new ones. If that isn't enough, it forgets arbitrary buckets, so
+// clients spread over many addresses can't grow the map without bound. The
+// caller must hold a.mu.
+func (a *App) pruneCaptureBucketsLocked(now time.Time) {
+	limit := a.captureLimit
+	for id, bucket := range a.captureBuckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(a.captureBuckets, id)
+		}
+	}
+	for id := range a.captureBuckets {
+		if len(a.captureBuckets) < maxCaptureBuckets {
+			break
+		}
+		delete(a.captureBuckets, id)
+	}
+}
+
+// setRetryAfter writes Retry-After in whole seconds, at least 1.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
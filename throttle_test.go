@@ -0,0 +1,104 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTakeCaptureToken(t *testing.T) {
+	app := New()
+	now := time.Now()
+	if ok, _ := app.takeCaptureToken("192.0.2.1", "payments", now); !ok {
+		t.Fatal("expected no throttling without a limit")
+	}
+
+	app.setCaptureLimit(CaptureLimit{Rate: 2, Burst: 3})
+	for i := 0; i < 3; i++ {
+		if ok, _ := app.takeCaptureToken("192.0.2.1", "payments", now); !ok {
+			t.Fatalf("webhook %d: expected the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := app.takeCaptureToken("192.0.2.1", "payments", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("expected a throttled webhook to wait 500ms, got %v, %v", ok, wait)
+	}
+
+	// Other clients and keys have their own buckets.
+	if ok, _ := app.takeCaptureToken("192.0.2.2", "payments", now); !ok {
+		t.Error("expected another client to be allowed")
+	}
+	if ok, _ := app.takeCaptureToken("192.0.2.1", "orders", now); !ok {
+		t.Error("expected another key to be allowed")
+	}
+
+	// Tokens refill at the rate.
+	if ok, _ := app.takeCaptureToken("192.0.2.1", "payments", now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected a token after 500ms")
+	}
+	if ok, _ := app.takeCaptureToken("192.0.2.1", "payments", now.Add(500*time.Millisecond)); ok {
+		t.Error("expected only one token after 500ms")
+	}
+}
+
+func TestPruneCaptureBuckets(t *testing.T) {
+	app := New()
+	app.setCaptureLimit(CaptureLimit{Rate: 1, Burst: 1})
+	now := time.Now()
+	app.captureBuckets = make(map[string]captureBucket)
+	for i := 0; i < maxCaptureBuckets; i++ {
+		app.captureBuckets[string(rune(i))] = captureBucket{last: now}
+	}
+
+	app.takeCaptureToken("192.0.2.1", "payments", now)
+	if n := len(app.captureBuckets); n > maxCaptureBuckets {
+		t.Errorf("expected at most %d buckets, got %d", maxCaptureBuckets, n)
+	}
+	app.takeCaptureToken("192.0.2.2", "payments", now.Add(time.Minute))
+	if n := len(app.captureBuckets); n != 1 {
+		t.Errorf("expected refilled buckets to be forgotten, got %d", n)
+	}
+}
+
+func TestCaptureLimitValidate(t *testing.T) {
+	for _, limit := range []CaptureLimit{{}, {Rate: 5, Burst: 1}} {
+		if err := limit.validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", limit, err)
+		}
+	}
+	for _, limit := range []CaptureLimit{{Rate: -1}, {Rate: 5}} {
+		if err := limit.validate(); err == nil {
+			t.Errorf("%+v: expected an error", limit)
+		}
+	}
+}
+
+func TestWebhookHandlerThrottled(t *testing.T) {
+	app := New()
+	app.setCaptureLimit(CaptureLimit{Rate: 0.1, Burst: 2})
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`))
+		req.RemoteAddr = "198.51.100.7:5000"
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests {
+			if w.Header().Get("Retry-After") != "10" || !strings.Contains(w.Body.String(), "too many webhooks") {
+				t.Errorf("unexpected throttled response %v %s", w.Header(), w.Body.String())
+			}
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected two webhooks then 429, got %v", codes)
+	}
+	if len(app.store.Events()) != 2 {
+		t.Errorf("expected throttled webhooks not to be stored, got %d events", len(app.store.Events()))
+	}
+	if stats := app.rejectionStats(); stats.Causes[RejectThrottled] != 1 {
+		t.Errorf("expected the throttled webhook to be counted, got %+v", stats)
+	}
+}
@@ -0,0 +1,58 @@
+package hooklab
+
+// This file contains native TLS: with -tls-cert and -tls-key, hooklab serves
+// HTTPS directly, since many providers refuse to deliver webhooks to plain HTTP
+// endpoints.
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// loadTLSConfig loads the PEM certificate chain and private key files into a
+// server TLS config. With neither file it returns nil, serving plain HTTP.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// webhookProtocols returns the protocols servers answering webhooks speak:
+// HTTP/1.1 only, even over TLS where HTTP/2 would otherwise be negotiated,
+// since the drop, hold, and black hole modes hijack the connection, which
+// HTTP/2 doesn't allow. It also leaves h2 out of the ALPN protocols of an
+// ACME TLS config.
+func webhookProtocols() *http.Protocols {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	return &protocols
+}
+
+// listen opens the server's address for serveListener. With port 0, the
+// listener's address holds the port picked.
+func listen(server *http.Server) (net.Listener, error) {
+	return net.Listen("tcp", server.Addr)
+}
+
+// serveListener serves HTTPS on ln when the server has a TLS config and plain
+// HTTP otherwise. ln is opened by listen, or by someone else such as systemd.
+func serveListener(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		// The certificate is already in TLSConfig.
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
@@ -0,0 +1,200 @@
+package hooklab
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key to
+// dir, returning their paths and the certificate.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hooklab test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir)
+
+	if config, err := loadTLSConfig("", ""); config != nil || err != nil {
+		t.Errorf("expected plain HTTP without files, got %v, %v", config, err)
+	}
+	if _, err := loadTLSConfig(certFile, ""); err == nil {
+		t.Error("expected an error for -tls-cert without -tls-key")
+	}
+	if _, err := loadTLSConfig(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(config.Certificates) != 1 || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	certFile, keyFile, cert := writeTestCert(t, t.TempDir())
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	app := New()
+	server, err := newServer(app, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Addr = addr
+	server.TLSConfig = config
+	done := make(chan error, 1)
+	ln, err := listen(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { done <- serveListener(server, ln) }()
+	defer func() {
+		server.Close()
+		if err := <-done; err != http.ErrServerClosed {
+			t.Errorf("unexpected serve error %v", err)
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	var resp *http.Response
+	for attempt := 0; attempt < 50; attempt++ {
+		if resp, err = client.Post("https://"+addr+"/webhook/secure", "application/json", nil); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("expected a 200 over TLS, got %d", resp.StatusCode)
+	}
+	if event, ok := app.getEvent(1); !ok || event.Key != "secure" {
+		t.Errorf("expected the webhook to be captured, got %+v", event)
+	}
+}
+
+func TestFaultModesOverTLS(t *testing.T) {
+	certFile, keyFile, cert := writeTestCert(t, t.TempDir())
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Offer HTTP/2 the way an ACME config does.
+	config.NextProtos = []string{"h2", "http/1.1"}
+
+	app := New()
+	app.setResponseConfig("close", ResponseConfig{StatusCode: http.StatusOK, Drop: DropClose})
+	app.setResponseConfig("reset", ResponseConfig{StatusCode: http.StatusOK, Drop: DropReset})
+	app.setResponseConfig("midbody", ResponseConfig{Response: map[string]any{"message": "partial"}, StatusCode: http.StatusOK, Drop: DropMidBody})
+	app.setResponseConfig("hold", ResponseConfig{StatusCode: http.StatusOK, Hold: Duration(50 * time.Millisecond)})
+	app.setResponseConfig("blackhole", ResponseConfig{StatusCode: http.StatusOK, Blackhole: true})
+	server, err := newServer(app, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Addr = "127.0.0.1:0"
+	server.TLSConfig = config
+	ln, err := listen(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveListener(server, ln)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true},
+	}
+	send := func(key string) (*http.Response, error) {
+		return client.Post("https://"+ln.Addr().String()+"/webhook/"+key, "application/json", strings.NewReader(`{}`))
+	}
+
+	for _, key := range []string{"close", "reset", "hold", "blackhole"} {
+		resp, err := send(key)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: expected the connection dropped, got %s over %s", key, resp.Status, resp.Proto)
+		} else if key == "blackhole" && !errors.Is(err, os.ErrDeadlineExceeded) && !strings.Contains(err.Error(), "Timeout") {
+			t.Errorf("blackhole: expected the request held until the client gave up, got %v", err)
+		}
+	}
+
+	resp, err := send("midbody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Proto != "HTTP/1.1" {
+		t.Fatalf("expected a 200 over HTTP/1.1, got %s over %s", resp.Status, resp.Proto)
+	}
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected the body cut short, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package hooklab
+
+// This file contains OpenTelemetry tracing: each webhook gets a server span,
+// continuing the sender's trace when it passes a traceparent header, with child
+// spans for storage, rule evaluation, and forwarding. Spans are exported over
+// OTLP/HTTP when an endpoint is configured, and dropped otherwise.
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates hooklab's spans. Until tracing is set up it creates no-op spans.
+var tracer = otel.Tracer("github.com/essajiwa/hooklab")
+
+// Span attribute keys specific to hooklab.
+const (
+	attrKey      = attribute.Key("hooklab.key")
+	attrEventID  = attribute.Key("hooklab.event.id")
+	attrTags     = attribute.Key("hooklab.tags")
+	attrMatched  = attribute.Key("hooklab.rules.matched")
+	attrRejected = attribute.Key("hooklab.rejected")
+)
+
+// setupTracing exports spans over OTLP/HTTP to endpoint, e.g.
+// http://localhost:4318, or to the endpoint the standard OTEL_EXPORTER_OTLP_*
+// environment variables name when endpoint is empty. Without either, tracing
+// stays disabled. The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var options []otlptracehttp.Option
+	if endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("hooklab")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// startWebhookSpan starts the server span of a webhook to key, continuing the
+// trace of the sender's traceparent header, and returns r with the span in its
+// context.
+func startWebhookSpan(r *http.Request, key string) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, r.Method+" /webhook/{key}",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute("/webhook/{key}"),
+			semconv.URLPath(r.URL.Path),
+			semconv.ClientAddress(clientAddr(r).String()),
+			attrKey.String(key),
+		),
+	)
+	return r.WithContext(ctx), span
+}
+
+// setSpanStatusCode records the status a webhook is answered with on the
+// request's span. Server errors mark the span as failed.
+func setSpanStatusCode(ctx context.Context, status int) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// startForwardSpan starts the client span of a request forwarding a webhook
+// and passes the trace on in the request's traceparent header.
+func startForwardSpan(req *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracer.Start(req.Context(), "forward "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.Redacted()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		span.SetAttributes(semconv.ServerPort(port))
+	}
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,115 @@
+package hooklab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording every span for the rest
+// of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestWebhookHandlerTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	forwarded := make(chan string, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer target.Close()
+
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{ForwardTo: target.URL})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("span %q is in trace %s, not the sender's", span.Name(), got)
+		}
+		spans[span.Name()] = span
+	}
+	server, ok := spans["POST /webhook/{key}"]
+	if !ok {
+		t.Fatalf("expected a server span, got %v", spans)
+	}
+	if server.SpanKind() != trace.SpanKindServer || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected server span kind %v parent %v", server.SpanKind(), server.Parent().SpanID())
+	}
+	for _, name := range []string{"match tag rules", "store event", "evaluate rules", "forward POST"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected a %q span", name)
+			continue
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("expected %q to be a child of the server span", name)
+		}
+	}
+	var status int64
+	for _, attr := range server.Attributes() {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	if status != http.StatusAccepted {
+		t.Errorf("expected server span status code 202, got %d", status)
+	}
+
+	forward := spans["forward POST"]
+	if forward == nil {
+		return
+	}
+	want := "00-" + traceID + "-" + forward.SpanContext().SpanID().String() + "-01"
+	if got := <-forwarded; got != want {
+		t.Errorf("expected forwarded traceparent %s, got %s", want, got)
+	}
+}
+
+func TestSetupTracingDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	provider := otel.GetTracerProvider()
+
+	shutdown, err := setupTracing(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if otel.GetTracerProvider() != provider {
+		t.Error("expected tracing to stay disabled without an endpoint")
+	}
+}
@@ -0,0 +1,194 @@
+package hooklab
+
+// This file contains the expression helpers that let rules react to recent
+// traffic: rate(), backed by a per-key log of webhook arrivals, e.g. to simulate
+// throttling only once a key receives too many requests, and seen() and
+// countMatching(), which look at earlier captured events, e.g. to answer the
+// first delivery of a webhook differently from its retries.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	maxRateWindow = time.Hour // Longest window rate() can look back over
+	maxArrivals   = 10000     // Arrivals remembered per webhook key
+)
+
+// recordArrival logs a webhook received for key at now, forgetting arrivals that
+// are older than maxRateWindow or beyond the maxArrivals most recent ones.
+func (a *App) recordArrival(key string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	times := a.arrivals[key]
+	cutoff := now.Add(-maxRateWindow)
+	times = times[sort.Search(len(times), func(i int) bool { return times[i].After(cutoff) }):]
+	if len(times) >= maxArrivals {
+		times = times[len(times)-maxArrivals+1:]
+	}
+	a.arrivals[key] = append(times, now)
+}
+
+// requestRate returns how many webhooks key received in the window ending at now.
+func (a *App) requestRate(key string, window time.Duration, now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	times := a.arrivals[key]
+	cutoff := now.Add(-window)
+	return len(times) - sort.Search(len(times), func(i int) bool { return times[i].After(cutoff) })
+}
+
+// rateFunc returns the rate(key, window) expression helper, counting the webhooks
+// key received in the window (e.g. "1m") ending at now.
+func (a *App) rateFunc(now time.Time) func(key, window string) (int, error) {
+	return func(key, window string) (int, error) {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return 0, err
+		}
+		if d <= 0 || d > maxRateWindow {
+			return 0, fmt.Errorf("rate window must be positive and at most %v", maxRateWindow)
+		}
+		return a.requestRate(key, d, now), nil
+	}
+}
+
+// errHelperUnavailable is returned by the traffic helpers outside of webhook handling.
+var errHelperUnavailable = errors.New("only available while handling a webhook")
+
+// priorEvents returns the stored events of key with an ID up to lastID, newest first.
+func (a *App) priorEvents(key string, lastID int) []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var events []Event
+	for _, event := range a.store.Events() {
+		if event.Key == key && event.ID <= lastID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// eventEnv builds the expression environment of a stored event. Variables that
+// are not stored with events, such as query and cookies, are empty.
+func eventEnv(event Event) map[string]interface{} {
+	env := expressionEnv(parseBody(event.Body), event.Method, event.Headers)
+	env["path"] = event.Path
+	env["key"] = event.Key
+	env["signature"] = signatureEnv(event.Signature)
+	env["cert"] = clientCertEnv(event.ClientCert)
+	env["openapi"] = openAPIEnv(event.OpenAPI)
+	env["avro"] = avroEnv(event.Avro)
+	env["jwt"] = jwtEnv(event.JWT)
+	env["plugins"] = pluginEnv(event.Plugins)
+	return env
+}
+
+// seenFunc returns the seen(key, expression, value) expression helper, reporting
+// whether an earlier stored event of key (with an ID up to lastID) has expression,
+// e.g. "body.id", evaluate to value.
+func (a *App) seenFunc(lastID int) func(key, expression string, value interface{}) (bool, error) {
+	return func(key, expression string, value interface{}) (bool, error) {
+		// Surface syntax errors rather than treating every event as a mismatch.
+		if _, err := compileExpression(expression, validationEnv(), false); err != nil {
+			return false, err
+		}
+		for _, event := range a.priorEvents(key, lastID) {
+			env := eventEnv(event)
+			program, err := compileExpression(expression, env, false)
+			if err != nil {
+				continue
+			}
+			if got, err := runExpression(program, env); err == nil && sameValue(got, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// countMatchingFunc returns the countMatching(condition, window) expression helper,
+// counting the earlier stored events of key (with an ID up to lastID) received in
+// the window ending at now for which condition is true.
+func (a *App) countMatchingFunc(key string, lastID int, now time.Time) func(condition, window string) (int, error) {
+	return func(condition, window string) (int, error) {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return 0, err
+		}
+		if d <= 0 {
+			return 0, errors.New("countMatching window must be positive")
+		}
+		if _, err := compileExpression(condition, validationEnv(), true); err != nil {
+			return 0, err
+		}
+
+		count := 0
+		cutoff := now.Add(-d)
+		for _, event := range a.priorEvents(key, lastID) {
+			if event.Timestamp.Before(cutoff) {
+				continue
+			}
+			if matched, err := conditionMatches(condition, eventEnv(event)); err == nil && matched {
+				count++
+			}
+		}
+		return count, nil
+	}
+}
+
+// sameValue reports whether two expression values are equal, treating numbers of
+// different types (e.g. an int literal and a JSON float64) as equal when their
+// values are.
+func sameValue(a, b interface{}) bool {
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if okA && okB {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toFloat converts numeric values to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// webhookEnv builds the expression environment for a webhook request to key,
+// adding the key and the traffic helpers to requestEnv. It must be built before
+// the request's own event is stored, so seen() and countMatching() only see
+// earlier events.
+func (a *App) webhookEnv(r *http.Request, key string, body *requestBody) map[string]interface{} {
+	a.mu.Lock()
+	lastID := a.lastID
+	a.mu.Unlock()
+
+	env := requestEnv(r, body)
+	a.addTrafficHelpers(env, key, lastID, a.now())
+	return env
+}
+
+// addTrafficHelpers sets the key and the traffic helpers of env for a request to
+// key at now, where seen() and countMatching() see stored events up to lastID.
+func (a *App) addTrafficHelpers(env map[string]interface{}, key string, lastID int, now time.Time) {
+	env["key"] = key
+	env["rate"] = a.rateFunc(now)
+	env["seen"] = a.seenFunc(lastID)
+	env["countMatching"] = a.countMatchingFunc(key, lastID, now)
+}
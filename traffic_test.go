@@ -0,0 +1,150 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestRate(t *testing.T) {
+	app := New()
+	now := time.Now()
+	app.recordArrival("orders", now.Add(-2*time.Hour))
+	app.recordArrival("orders", now.Add(-30*time.Minute))
+	app.recordArrival("orders", now.Add(-30*time.Second))
+	app.recordArrival("orders", now)
+	app.recordArrival("payments", now)
+
+	if n := len(app.arrivals["orders"]); n != 3 {
+		t.Errorf("expected arrivals older than %v to be forgotten, have %d", maxRateWindow, n)
+	}
+	tests := []struct {
+		window string
+		want   int
+	}{
+		{"10s", 1},
+		{"1m", 2},
+		{"1h", 3},
+	}
+	rate := app.rateFunc(now)
+	for _, tt := range tests {
+		got, err := rate("orders", tt.window)
+		if err != nil || got != tt.want {
+			t.Errorf("rate(orders, %s): expected %d, got %d (%v)", tt.window, tt.want, got, err)
+		}
+	}
+	for _, window := range []string{"soon", "0s", "2h"} {
+		if _, err := rate("orders", window); err == nil {
+			t.Errorf("rate(orders, %s): expected error", window)
+		}
+	}
+}
+
+func TestRecordArrivalCap(t *testing.T) {
+	app := New()
+	now := time.Now()
+	for i := 0; i < maxArrivals+5; i++ {
+		app.recordArrival("busy", now)
+	}
+	if n := len(app.arrivals["busy"]); n != maxArrivals {
+		t.Errorf("expected %d arrivals, have %d", maxArrivals, n)
+	}
+}
+
+func TestWebhookHandlerRateRule(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{Condition: `rate(key, "1m") > 2`, StatusCode: http.StatusTooManyRequests, Enabled: true})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+		if w.Code != want {
+			t.Errorf("request %d: expected status %d, got %d", i+1, want, w.Code)
+		}
+	}
+
+	// Other keys have their own traffic.
+	w := httptest.NewRecorder()
+	app.addRule("payments", Rule{Condition: `rate("orders", "1m") > 2 && rate(key, "1m") == 1`, StatusCode: http.StatusServiceUnavailable, Enabled: true})
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(`{}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestWebhookHandlerSeenRule(t *testing.T) {
+	app := New()
+	app.addRule("orders", Rule{Condition: `seen(key, "body.id", body.id)`, Response: map[string]interface{}{"duplicate": true}, StatusCode: http.StatusOK, Priority: 0, Enabled: true})
+	app.addRule("orders", Rule{Condition: "true", StatusCode: http.StatusCreated, Priority: 1, Enabled: true})
+
+	for i, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{"id":"evt_1"}`, http.StatusCreated},
+		{`{"id":"evt_1"}`, http.StatusOK},
+		{`{"id":"evt_2"}`, http.StatusCreated},
+		{`{"id":"evt_2"}`, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("request %d %s: expected status %d, got %d", i+1, tt.body, tt.want, w.Code)
+		}
+	}
+
+	// Events of other keys are only seen when asked for.
+	seen := app.seenFunc(app.lastID)
+	if ok, err := seen("payments", "body.id", "evt_1"); err != nil || ok {
+		t.Errorf("expected evt_1 to be unseen for payments, got %v (%v)", ok, err)
+	}
+	if ok, err := seen("orders", "len(body.id)", 5); err != nil || !ok {
+		t.Errorf("expected numbers of different types to compare equal, got %v (%v)", ok, err)
+	}
+	if _, err := seen("orders", "body.id +", "x"); err == nil {
+		t.Error("expected syntax error")
+	}
+}
+
+func TestCountMatching(t *testing.T) {
+	app := New()
+	now := time.Now()
+	for i, body := range []string{`{"type":"retry"}`, `{"type":"retry"}`, `{"type":"new"}`, `raw`} {
+		app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/orders", nil), "orders", parseBody(body))
+		if i == 0 {
+			event := app.store.Events()[0]
+			event.Timestamp = now.Add(-10 * time.Minute)
+			app.store.Update(event)
+		}
+	}
+	app.storeEvent(httptest.NewRequest(http.MethodPost, "/webhook/payments", nil), "payments", parseBody(`{"type":"retry"}`))
+
+	count := app.countMatchingFunc("orders", app.lastID, now)
+	tests := []struct {
+		condition string
+		window    string
+		want      int
+	}{
+		{`body.type == "retry"`, "5m", 1},
+		{`body.type == "retry"`, "1h", 2},
+		{"true", "1h", 4},
+	}
+	for _, tt := range tests {
+		got, err := count(tt.condition, tt.window)
+		if err != nil || got != tt.want {
+			t.Errorf("countMatching(%s, %s): expected %d, got %d (%v)", tt.condition, tt.window, tt.want, got, err)
+		}
+	}
+	for _, args := range [][2]string{{"true", "later"}, {"true", "-1m"}, {"body.type ==", "1m"}} {
+		if _, err := count(args[0], args[1]); err == nil {
+			t.Errorf("countMatching(%s, %s): expected error", args[0], args[1])
+		}
+	}
+
+	// Outside webhook handling the helpers fail, so the condition does not match.
+	if matched, err := conditionMatches(`countMatching("true", "1m") > 0`, expressionEnv(parseBody(`{}`), http.MethodPost, nil)); matched || err == nil {
+		t.Errorf("expected unavailable helper error, got %v (%v)", matched, err)
+	}
+}
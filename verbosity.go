@@ -0,0 +1,111 @@
+package hooklab
+
+// This file contains the per-webhook log: by default a summary line for every
+// webhook answered, -v adds its headers and -vv its body for debugging, and
+// -quiet logs none, for CI runs where the output should stay readable.
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Verbosity is how much is logged about every webhook.
+type Verbosity int
+
+// Verbosities, from least to most logged.
+const (
+	VerbosityQuiet   Verbosity = iota // Nothing (-quiet)
+	VerbositySummary                  // One line with the status and duration (default)
+	VerbosityHeaders                  // The summary and the request headers (-v)
+	VerbosityBody                     // The summary, headers, and body (-vv)
+)
+
+// verbosityNames are the names of the verbosities in the config file.
+var verbosityNames = []string{"quiet", "summary", "headers", "body"}
+
+// String returns the config file name of v.
+func (v Verbosity) String() string {
+	if v < 0 || int(v) >= len(verbosityNames) {
+		return fmt.Sprintf("Verbosity(%d)", int(v))
+	}
+	return verbosityNames[v]
+}
+
+// parseVerbosity returns the verbosity named name, as in the config file.
+func parseVerbosity(name string) (Verbosity, error) {
+	i := slices.Index(verbosityNames, name)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown verbosity %q, want quiet, summary, headers, or body", name)
+	}
+	return Verbosity(i), nil
+}
+
+// verbosityFromFlags returns the verbosity the -quiet, -v, and -vv flags ask
+// for, refusing -quiet together with either of the others.
+func verbosityFromFlags(quiet, v, vv bool) (Verbosity, error) {
+	switch {
+	case quiet && (v || vv):
+		return 0, fmt.Errorf("-quiet can't be combined with -v or -vv")
+	case quiet:
+		return VerbosityQuiet, nil
+	case vv:
+		return VerbosityBody, nil
+	case v:
+		return VerbosityHeaders, nil
+	}
+	return VerbositySummary, nil
+}
+
+// explicitVerbosity reports whether a verbosity flag is among the explicit
+// ones, which then replaces the config file's verbosity altogether.
+func explicitVerbosity(explicit map[string]bool) bool {
+	return explicit["quiet"] || explicit["v"] || explicit["vv"]
+}
+
+// setVerbosity sets how much is logged about every webhook.
+func (a *App) setVerbosity(v Verbosity) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.verbosity = v
+}
+
+// logWebhook logs the webhook r of key, answered with status after elapsed, as
+// much as the verbosity asks for. eventID is 0 for webhooks refused before
+// they were stored, and body is what was read of them.
+func (a *App) logWebhook(r *http.Request, key string, status int, elapsed time.Duration, eventID int, matched []string, body string) {
+	a.mu.Lock()
+	verbosity := a.verbosity
+	a.mu.Unlock()
+	if verbosity == VerbosityQuiet {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Webhook %s %s on key %q from %s: %d in %v", r.Method, r.URL.Path, key, clientAddr(r), status, elapsed.Round(time.Microsecond))
+	if eventID != 0 {
+		fmt.Fprintf(&b, " (event %d", eventID)
+		if len(matched) > 0 {
+			fmt.Fprintf(&b, "; matched rules: %s", strings.Join(matched, ","))
+		}
+		b.WriteString(")")
+	}
+	if verbosity >= VerbosityHeaders {
+		for _, name := range slices.Sorted(maps.Keys(r.Header)) {
+			for _, value := range r.Header[name] {
+				fmt.Fprintf(&b, "\n    %s: %s", name, value)
+			}
+		}
+	}
+	if verbosity >= VerbosityBody && body != "" {
+		b.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			b.WriteString("\n    " + line)
+		}
+	}
+	log.Print(b.String())
+}
@@ -0,0 +1,79 @@
+package hooklab
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerbosityFromFlags(t *testing.T) {
+	tests := []struct {
+		quiet, v, vv bool
+		want         Verbosity
+	}{
+		{false, false, false, VerbositySummary},
+		{true, false, false, VerbosityQuiet},
+		{false, true, false, VerbosityHeaders},
+		{false, false, true, VerbosityBody},
+		{false, true, true, VerbosityBody},
+	}
+	for _, tt := range tests {
+		if got, err := verbosityFromFlags(tt.quiet, tt.v, tt.vv); err != nil || got != tt.want {
+			t.Errorf("quiet=%v v=%v vv=%v: expected %v, got %v, %v", tt.quiet, tt.v, tt.vv, tt.want, got, err)
+		}
+	}
+	if _, err := verbosityFromFlags(true, true, false); err == nil {
+		t.Error("expected -quiet with -v to be refused")
+	}
+	if got, err := parseVerbosity("headers"); err != nil || got != VerbosityHeaders {
+		t.Errorf("expected headers, got %v, %v", got, err)
+	}
+}
+
+func TestWebhookLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(io.Discard)
+
+	app := New()
+	app.setResponseConfig("orders", ResponseConfig{StatusCode: http.StatusAccepted})
+	send := func() string {
+		out.Reset()
+		r := httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader("{\n\"amount\": 5}"))
+		r.Header.Set("X-Request-Id", "abc")
+		app.webhookHandler(httptest.NewRecorder(), r)
+		return out.String()
+	}
+
+	if got := send(); got != "" {
+		t.Errorf("expected nothing logged when quiet, got %q", got)
+	}
+
+	app.setVerbosity(VerbositySummary)
+	got := send()
+	if !strings.Contains(got, `Webhook POST /webhook/orders on key "orders" from 192.0.2.1: 202 in `) || !strings.Contains(got, "(event 2)") {
+		t.Errorf("unexpected summary line %q", got)
+	}
+	if strings.Contains(got, "X-Request-Id") || strings.Count(got, "\n") != 1 {
+		t.Errorf("expected only the summary line, got %q", got)
+	}
+
+	app.setVerbosity(VerbosityHeaders)
+	if got := send(); !strings.Contains(got, "\n    X-Request-Id: abc\n") || strings.Contains(got, "amount") {
+		t.Errorf("expected the headers without the body, got %q", got)
+	}
+
+	app.setVerbosity(VerbosityBody)
+	if got := send(); !strings.Contains(got, "\n    X-Request-Id: abc\n\n    {\n    \"amount\": 5}\n") {
+		t.Errorf("expected the headers and the indented body, got %q", got)
+	}
+
+	app.setIPFilter(IPFilter{Deny: parseIPList("192.0.2.1")})
+	if got := send(); !strings.Contains(got, ": 403 in ") || strings.Contains(got, "(event") {
+		t.Errorf("expected a refused webhook to be logged without an event, got %q", got)
+	}
+}
@@ -0,0 +1,188 @@
+package hooklab
+
+// This file contains native verification of provider webhook signatures, such as
+// GitHub's X-Hub-Signature-256 and Slack's X-Slack-Signature. The result is
+// stored on the event and exposed to rules as the signature variable, and
+// failures can be refused outright. Signed timestamps are checked against a
+// tolerance, so replayed deliveries are caught as stale. It also answers Slack's URL verification
+// challenge, so a Slack app can be pointed at a key without configuring it.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature providers.
+const (
+	ProviderGitHub = "github"
+	ProviderSlack  = "slack"
+)
+
+// slackTimestampTolerance is how far a Slack request timestamp may be from now
+// before the request is treated as a replay, unless the key sets maxAge.
+const slackTimestampTolerance = 5 * time.Minute
+
+// VerifyConfig verifies the signatures of a key's webhooks with the secret of
+// their provider.
+type VerifyConfig struct {
+	GitHubSecret       string   `json:"githubSecret,omitempty"`       // Secret of the GitHub webhook, for X-Hub-Signature-256
+	SlackSigningSecret string   `json:"slackSigningSecret,omitempty"` // Signing secret of the Slack app, for X-Slack-Signature
+	MaxAge             Duration `json:"maxAge,omitempty"`             // How far a signed timestamp may be from now, e.g. "2m" (Slack default 5m)
+	Reject             bool     `json:"reject,omitempty"`             // Refuse webhooks that fail verification with 401
+	RecordRejected     bool     `json:"recordRejected,omitempty"`     // Store refused webhooks as rejected events
+}
+
+// SignatureResult is the outcome of verifying a webhook's signature.
+type SignatureResult struct {
+	Provider string   `json:"provider"`        // Provider whose scheme was checked, e.g. "github"
+	Valid    bool     `json:"valid"`           // Whether the signature matched and its timestamp was fresh
+	Error    string   `json:"error,omitempty"` // Why verification failed
+	Age      Duration `json:"age,omitempty"`   // How long before receipt the delivery was signed, for timestamped schemes
+	Stale    bool     `json:"stale,omitempty"` // The signed timestamp was further from now than the tolerance
+}
+
+// validate checks that exactly one provider secret is set, and that maxAge is
+// only set for providers that sign a timestamp.
+func (c VerifyConfig) validate() error {
+	if (c.GitHubSecret == "") == (c.SlackSigningSecret == "") {
+		return errors.New("verify: set one of githubSecret or slackSigningSecret")
+	}
+	if c.MaxAge < 0 {
+		return errors.New("verify.maxAge must not be negative")
+	}
+	if c.MaxAge > 0 && c.GitHubSecret != "" {
+		return errors.New("verify.maxAge: GitHub signatures don't include a timestamp")
+	}
+	return nil
+}
+
+// verify checks the signature of a webhook with headers and body received at
+// now. For schemes that sign a timestamp, it records the delivery's age and
+// refuses it as stale when the timestamp is further from now than the tolerance.
+func (c VerifyConfig) verify(headers map[string][]string, body string, now time.Time) *SignatureResult {
+	var result *SignatureResult
+	var err error
+	if c.SlackSigningSecret != "" {
+		result = &SignatureResult{Provider: ProviderSlack}
+		var age time.Duration
+		age, err = verifySlack(c.SlackSigningSecret, headers, body, now)
+		result.Age = Duration(age)
+		if tolerance := c.tolerance(); err == nil && (age > tolerance || age < -tolerance) {
+			result.Stale = true
+			err = fmt.Errorf("X-Slack-Request-Timestamp is %s off, more than %s", age.Abs().Round(time.Second), tolerance)
+		}
+	} else {
+		result = &SignatureResult{Provider: ProviderGitHub}
+		err = verifyGitHub(c.GitHubSecret, headers, body)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Valid = true
+	}
+	return result
+}
+
+// tolerance returns how far a signed timestamp may be from now.
+func (c VerifyConfig) tolerance() time.Duration {
+	if c.MaxAge > 0 {
+		return time.Duration(c.MaxAge)
+	}
+	return slackTimestampTolerance
+}
+
+// verifyGitHub checks the X-Hub-Signature-256 header, "sha256=" followed by the
+// hex HMAC-SHA256 of the body keyed with secret.
+func verifyGitHub(secret string, headers map[string][]string, body string) error {
+	header := headerValue(headers, "X-Hub-Signature-256")
+	if header == "" {
+		return errors.New("missing X-Hub-Signature-256 header")
+	}
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return errors.New("X-Hub-Signature-256 must start with sha256=")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("X-Hub-Signature-256 is not hex")
+	}
+	if !hmac.Equal(got, hmacSum(sha256.New, secret, body)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// verifySlack checks the X-Slack-Signature header, "v0=" followed by the hex
+// HMAC-SHA256 of "v0:{timestamp}:{body}" keyed with secret, where timestamp is the
+// X-Slack-Request-Timestamp header. It returns how long before now the timestamp
+// is, negative for timestamps in the future.
+func verifySlack(secret string, headers map[string][]string, body string, now time.Time) (time.Duration, error) {
+	timestamp := headerValue(headers, "X-Slack-Request-Timestamp")
+	if timestamp == "" {
+		return 0, errors.New("missing X-Slack-Request-Timestamp header")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return 0, errors.New("X-Slack-Request-Timestamp is not a Unix time")
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+
+	header := headerValue(headers, "X-Slack-Signature")
+	if header == "" {
+		return age, errors.New("missing X-Slack-Signature header")
+	}
+	signature, ok := strings.CutPrefix(header, "v0=")
+	if !ok {
+		return age, errors.New("X-Slack-Signature must start with v0=")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return age, errors.New("X-Slack-Signature is not hex")
+	}
+	if !hmac.Equal(got, hmacSum(sha256.New, secret, "v0:"+timestamp+":"+body)) {
+		return age, errors.New("signature mismatch")
+	}
+	return age, nil
+}
+
+// slackChallenge returns the challenge of a Slack url_verification request body.
+func slackChallenge(body string) (string, bool) {
+	var request struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		return "", false
+	}
+	return request.Challenge, request.Type == "url_verification" && request.Challenge != ""
+}
+
+// writeSlackChallenge answers a Slack url_verification request.
+func writeSlackChallenge(w http.ResponseWriter, challenge string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"challenge": challenge})
+}
+
+// signatureEnv returns the signature expression variable for result: provider,
+// valid, error, age in seconds, and stale. Without verification, provider is ""
+// and valid is false.
+func signatureEnv(result *SignatureResult) map[string]interface{} {
+	if result == nil {
+		result = &SignatureResult{}
+	}
+	return map[string]interface{}{
+		"provider": result.Provider,
+		"valid":    result.Valid,
+		"error":    result.Error,
+		"age":      time.Duration(result.Age).Seconds(),
+		"stale":    result.Stale,
+	}
+}
@@ -0,0 +1,246 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyGitHub(t *testing.T) {
+	body := `{"action":"opened"}`
+	valid := "sha256=" + hexHMAC("It's a Secret to Everybody", body)
+
+	tests := []struct {
+		header string
+		err    string
+	}{
+		{valid, ""},
+		{"", "missing X-Hub-Signature-256 header"},
+		{strings.TrimPrefix(valid, "sha256="), "X-Hub-Signature-256 must start with sha256="},
+		{"sha256=zz", "X-Hub-Signature-256 is not hex"},
+		{"sha256=" + hexHMAC("wrong secret", body), "signature mismatch"},
+	}
+	for _, tt := range tests {
+		headers := http.Header{}
+		if tt.header != "" {
+			headers.Set("X-Hub-Signature-256", tt.header)
+		}
+		err := verifyGitHub("It's a Secret to Everybody", headers, body)
+		if got := errString(err); got != tt.err {
+			t.Errorf("%q: expected error %q, got %q", tt.header, tt.err, got)
+		}
+	}
+}
+
+func TestWebhookHandlerVerifiesGitHubSignature(t *testing.T) {
+	app := New()
+	app.setResponseConfig("github", ResponseConfig{StatusCode: http.StatusOK, Verify: &VerifyConfig{GitHubSecret: "s3cret"}})
+	app.addRule("github", Rule{Condition: "!signature.valid", StatusCode: http.StatusForbidden, Response: map[string]string{"error": "bad signature"}, Enabled: true})
+
+	body := `{"zen":"Keep it logically awesome."}`
+	send := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		return w
+	}
+
+	if w := send("sha256=" + hexHMAC("s3cret", body)); w.Code != http.StatusOK {
+		t.Errorf("expected a valid signature to pass, got %d", w.Code)
+	}
+	if w := send("sha256=" + hexHMAC("other", body)); w.Code != http.StatusForbidden {
+		t.Errorf("expected the rule to see the invalid signature, got %d", w.Code)
+	}
+	if invalid, valid := app.store.Events()[0].Signature, app.store.Events()[1].Signature; invalid == nil || invalid.Valid || invalid.Error != "signature mismatch" || valid == nil || !valid.Valid || valid.Provider != ProviderGitHub {
+		t.Errorf("unexpected stored signatures %+v and %+v", invalid, valid)
+	}
+
+	// With reject, failures are refused before rules run.
+	app.setResponseConfig("github", ResponseConfig{StatusCode: http.StatusOK, Verify: &VerifyConfig{GitHubSecret: "s3cret", Reject: true, RecordRejected: true}})
+	w := send("sha256=" + hexHMAC("other", body))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalid signature: signature mismatch") {
+		t.Errorf("expected a 401 for an invalid signature, got %d %s", w.Code, w.Body.String())
+	}
+	if event := app.store.Events()[0]; event.Rejected != "invalid signature: signature mismatch" {
+		t.Errorf("expected the refused webhook to be recorded, got %+v", event)
+	}
+
+	// Keys that don't verify report no provider.
+	app.addRule("orders", Rule{Condition: `signature.provider == ""`, StatusCode: http.StatusAccepted, Enabled: true})
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/orders", strings.NewReader(`{}`)))
+	if w.Code != http.StatusAccepted || app.store.Events()[0].Signature != nil {
+		t.Errorf("expected an unverified key to have no signature, got %d %+v", w.Code, app.store.Events()[0].Signature)
+	}
+}
+
+func TestResponseHandlerValidatesVerify(t *testing.T) {
+	app := New()
+	w := httptest.NewRecorder()
+	app.responseHandler(w, httptest.NewRequest(http.MethodPost, "/api/response?key=github", strings.NewReader(`{"response":{},"statusCode":200,"verify":{"reject":true}}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "githubSecret") {
+		t.Errorf("expected a missing secret error, got %d %s", w.Code, w.Body.String())
+	}
+	if err := (VerifyConfig{GitHubSecret: "a", SlackSigningSecret: "b"}).validate(); err == nil {
+		t.Error("expected an error with two provider secrets")
+	}
+}
+
+func hexHMAC(secret, data string) string {
+	return expressionFuncs()["hmacSHA256"].(func(string, string) string)(secret, data)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestVerifySlack(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&command=%2Fweather"
+	timestamp := "1531420618"
+	valid := "v0=" + hexHMAC("8f742231b10e8888abcd99yyyzzz85a5", "v0:"+timestamp+":"+body)
+
+	tests := []struct {
+		timestamp, signature string
+		err                  string
+	}{
+		{timestamp, valid, ""},
+		{"", valid, "missing X-Slack-Request-Timestamp header"},
+		{"yesterday", valid, "X-Slack-Request-Timestamp is not a Unix time"},
+		{timestamp, "", "missing X-Slack-Signature header"},
+		{timestamp, strings.TrimPrefix(valid, "v0="), "X-Slack-Signature must start with v0="},
+		{timestamp, "v0=" + hexHMAC("wrong", "v0:"+timestamp+":"+body), "signature mismatch"},
+	}
+	for _, tt := range tests {
+		headers := http.Header{}
+		if tt.timestamp != "" {
+			headers.Set("X-Slack-Request-Timestamp", tt.timestamp)
+		}
+		if tt.signature != "" {
+			headers.Set("X-Slack-Signature", tt.signature)
+		}
+		_, err := verifySlack("8f742231b10e8888abcd99yyyzzz85a5", headers, body, now)
+		if got := errString(err); got != tt.err {
+			t.Errorf("%s %s: expected error %q, got %q", tt.timestamp, tt.signature, tt.err, got)
+		}
+	}
+}
+
+func TestVerifySlackTimestamp(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	body := `{"type":"event_callback"}`
+	sign := func(sent time.Time) http.Header {
+		timestamp := strconv.FormatInt(sent.Unix(), 10)
+		headers := http.Header{}
+		headers.Set("X-Slack-Request-Timestamp", timestamp)
+		headers.Set("X-Slack-Signature", "v0="+hexHMAC("s3cret", "v0:"+timestamp+":"+body))
+		return headers
+	}
+
+	tests := []struct {
+		maxAge Duration
+		sent   time.Time
+		valid  bool
+		err    string
+	}{
+		{0, now.Add(-4 * time.Minute), true, ""},
+		{0, now.Add(-6 * time.Minute), false, "X-Slack-Request-Timestamp is 6m0s off, more than 5m0s"},
+		{0, now.Add(6 * time.Minute), false, "X-Slack-Request-Timestamp is 6m0s off, more than 5m0s"},
+		{Duration(time.Minute), now.Add(-90 * time.Second), false, "X-Slack-Request-Timestamp is 1m30s off, more than 1m0s"},
+		{Duration(10 * time.Minute), now.Add(-6 * time.Minute), true, ""},
+	}
+	for _, tt := range tests {
+		config := VerifyConfig{SlackSigningSecret: "s3cret", MaxAge: tt.maxAge}
+		result := config.verify(sign(tt.sent), body, now)
+		if result.Valid != tt.valid || result.Stale == tt.valid || result.Error != tt.err || result.Age != Duration(now.Sub(tt.sent)) {
+			t.Errorf("maxAge %v, sent %v: unexpected result %+v", time.Duration(tt.maxAge), now.Sub(tt.sent), result)
+		}
+	}
+
+	// A stale delivery with a bad signature reports the signature.
+	headers := sign(now.Add(-time.Hour))
+	headers.Set("X-Slack-Signature", "v0="+hexHMAC("other", "v0:0:"+body))
+	if result := (VerifyConfig{SlackSigningSecret: "s3cret"}).verify(headers, body, now); result.Stale || result.Error != "signature mismatch" {
+		t.Errorf("expected a signature mismatch, got %+v", result)
+	}
+
+	if err := (VerifyConfig{GitHubSecret: "s3cret", MaxAge: Duration(time.Minute)}).validate(); err == nil {
+		t.Error("expected maxAge to be refused for GitHub")
+	}
+	if err := (VerifyConfig{SlackSigningSecret: "s3cret", MaxAge: Duration(-time.Minute)}).validate(); err == nil {
+		t.Error("expected a negative maxAge to be refused")
+	}
+}
+
+func TestWebhookHandlerRejectsStaleDelivery(t *testing.T) {
+	app := New()
+	app.setResponseConfig("slack", ResponseConfig{StatusCode: http.StatusOK, Verify: &VerifyConfig{SlackSigningSecret: "s3cret", MaxAge: Duration(2 * time.Minute)}})
+	app.addRule("slack", Rule{Condition: "signature.stale && signature.age > 100", StatusCode: http.StatusConflict, Enabled: true})
+
+	body := `{"type":"event_callback"}`
+	send := func() *httptest.ResponseRecorder {
+		timestamp := strconv.FormatInt(time.Now().Add(-3*time.Minute).Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/webhook/slack", strings.NewReader(body))
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hexHMAC("s3cret", "v0:"+timestamp+":"+body))
+		w := httptest.NewRecorder()
+		app.webhookHandler(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusConflict {
+		t.Errorf("expected rules to see the stale delivery, got %d", w.Code)
+	}
+	if signature := app.store.Events()[0].Signature; signature == nil || !signature.Stale || time.Duration(signature.Age) < 3*time.Minute {
+		t.Errorf("expected staleness on the event, got %+v", signature)
+	}
+
+	app.setResponseConfig("slack", ResponseConfig{StatusCode: http.StatusOK, Verify: &VerifyConfig{SlackSigningSecret: "s3cret", MaxAge: Duration(2 * time.Minute), Reject: true}})
+	if w := send(); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "more than 2m0s") {
+		t.Errorf("expected the stale delivery to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if stats := app.rejectionStats(); stats.Causes[RejectStale] != 1 {
+		t.Errorf("expected the stale delivery to be counted, got %+v", stats)
+	}
+}
+
+func TestWebhookHandlerAnswersSlackChallenge(t *testing.T) {
+	app := New()
+	app.setResponseConfig("slack", ResponseConfig{StatusCode: http.StatusOK, Response: map[string]bool{"ok": true}, Verify: &VerifyConfig{SlackSigningSecret: "s3cret", Reject: true}})
+
+	body := `{"token":"Jhj5dZrVaK7ZwHHjRyZWjbDl","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhook/slack", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hexHMAC("s3cret", "v0:"+timestamp+":"+body))
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}` {
+		t.Errorf("expected the challenge to be answered, got %d %s", w.Code, w.Body.String())
+	}
+	if event := app.store.Events()[0]; event.Signature == nil || !event.Signature.Valid || event.Signature.Provider != ProviderSlack {
+		t.Errorf("expected a verified Slack event, got %+v", event)
+	}
+
+	// An unsigned challenge is refused like any other webhook of the key.
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/slack", strings.NewReader(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned challenge to be refused, got %d", w.Code)
+	}
+
+	// Keys without verification answer challenges too.
+	w = httptest.NewRecorder()
+	app.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/webhook/other", strings.NewReader(`{"type":"url_verification","challenge":"abc"}`)))
+	if strings.TrimSpace(w.Body.String()) != `{"challenge":"abc"}` {
+		t.Errorf("expected the challenge to be answered, got %s", w.Body.String())
+	}
+}
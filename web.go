@@ -0,0 +1,14 @@
+//go:build !noui
+
+package hooklab
+
+// This file embeds the dashboard. Building with -tags noui leaves it out, for
+// an API-only binary (see web_noui.go).
+
+import "embed"
+
+//go:embed web/*
+var webFS embed.FS
+
+// embeddedUI reports whether the dashboard is built into the binary.
+const embeddedUI = true
@@ -0,0 +1,15 @@
+//go:build noui
+
+package hooklab
+
+// This file stands in for web.go in binaries built with -tags noui: the
+// dashboard isn't embedded, so the binary is smaller and serves only the
+// webhook endpoints and the API, as with -no-ui.
+
+import "embed"
+
+// webFS is empty without the dashboard.
+var webFS embed.FS
+
+// embeddedUI reports whether the dashboard is built into the binary.
+const embeddedUI = false
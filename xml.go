@@ -0,0 +1,175 @@
+package hooklab
+
+// This file contains XML body parsing: XML and SOAP payloads are parsed into a
+// structure rules can navigate like JSON, e.g. body.Envelope.Body.GetQuote, and
+// re-indented for the API and UI, since some legacy providers still deliver
+// SOAP-ish callbacks.
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element of a parsed XML document. Names keep the prefix they
+// were written with in Space, e.g. "soap" for soap:Envelope.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string // Character data directly inside the element, trimmed
+}
+
+// xmlDocument is a parsed XML document: the prolog, such as <?xml ...?>, and
+// the root element.
+type xmlDocument struct {
+	prolog []string
+	root   *xmlNode
+}
+
+// errNotXML is returned by parseXMLDocument for bodies that aren't a
+// well-formed XML document with one root element.
+var errNotXML = errors.New("not a well-formed XML document")
+
+// parseXMLDocument parses a well-formed XML document with one root element.
+// Comments are dropped.
+func parseXMLDocument(body string) (*xmlDocument, error) {
+	doc := &xmlDocument{}
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	var stack []*xmlNode
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			if doc.root == nil || len(stack) > 0 {
+				return nil, errNotXML
+			}
+			return doc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if len(stack) == 0 {
+				doc.prolog = append(doc.prolog, "<?"+t.Target+" "+string(t.Inst)+"?>")
+			}
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name, attrs: t.Attr}
+			if len(stack) == 0 {
+				if doc.root != nil {
+					return nil, errNotXML
+				}
+				doc.root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			// RawToken leaves matching end elements to the caller.
+			if len(stack) == 0 || stack[len(stack)-1].name != t.Name {
+				return nil, errNotXML
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			switch {
+			case text == "":
+			case len(stack) == 0:
+				return nil, errNotXML
+			default:
+				node := stack[len(stack)-1]
+				node.text += text
+			}
+		}
+	}
+}
+
+// value returns the document as the value rules see: a map from the root
+// element's local name to its value. Elements with only text are strings;
+// others are maps of child elements by local name, with attributes as "@name"
+// and text as "#text". Repeated children become lists. Namespace declarations
+// are left out.
+func (d *xmlDocument) value() map[string]interface{} {
+	return map[string]interface{}{d.root.name.Local: d.root.value()}
+}
+
+// value returns the rule value of the element.
+func (n *xmlNode) value() interface{} {
+	fields := make(map[string]interface{})
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		fields["@"+attr.Name.Local] = attr.Value
+	}
+	if len(fields) == 0 && len(n.children) == 0 {
+		return n.text
+	}
+	if n.text != "" {
+		fields["#text"] = n.text
+	}
+	for _, child := range n.children {
+		name := child.name.Local
+		switch existing := fields[name].(type) {
+		case nil:
+			fields[name] = child.value()
+		case []interface{}:
+			fields[name] = append(existing, child.value())
+		default:
+			fields[name] = []interface{}{existing, child.value()}
+		}
+	}
+	return fields
+}
+
+// pretty returns the document re-indented with two spaces per level, keeping
+// namespace prefixes as written.
+func (d *xmlDocument) pretty() string {
+	var b strings.Builder
+	for _, line := range d.prolog {
+		b.WriteString(line + "\n")
+	}
+	d.root.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// write writes the element at depth, with text-only elements on one line.
+func (n *xmlNode) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent + "<" + xmlName(n.name))
+	for _, attr := range n.attrs {
+		b.WriteString(" " + xmlName(attr.Name) + `="`)
+		xml.EscapeText(b, []byte(attr.Value))
+		b.WriteString(`"`)
+	}
+	if n.text == "" && len(n.children) == 0 {
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">")
+	if len(n.children) == 0 {
+		xml.EscapeText(b, []byte(n.text))
+		b.WriteString("</" + xmlName(n.name) + ">\n")
+		return
+	}
+	b.WriteString("\n")
+	if n.text != "" {
+		b.WriteString(indent + "  ")
+		xml.EscapeText(b, []byte(n.text))
+		b.WriteString("\n")
+	}
+	for _, child := range n.children {
+		child.write(b, depth+1)
+	}
+	b.WriteString(indent + "</" + xmlName(n.name) + ">\n")
+}
+
+// xmlName formats a raw name with its prefix, e.g. "soap:Envelope".
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,119 @@
+package hooklab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const soapNotify = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <Notify type="payment"><Amount currency="USD">120.50</Amount>
+      <Item>A</Item>
+      <Item>B</Item>
+      <Note/>
+    </Notify>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestXMLDocumentValue(t *testing.T) {
+	doc, err := parseXMLDocument(soapNotify)
+	if err != nil {
+		t.Fatalf("expected SOAP envelope to parse, got %v", err)
+	}
+	got := doc.value()
+	want := map[string]interface{}{
+		"Envelope": map[string]interface{}{
+			"Body": map[string]interface{}{
+				"Notify": map[string]interface{}{
+					"@type":  "payment",
+					"Amount": map[string]interface{}{"@currency": "USD", "#text": "120.50"},
+					"Item":   []interface{}{"A", "B"},
+					"Note":   "",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+
+	for _, body := range []string{`<a><b></a>`, `<a></b>`, `<a/><b/>`, `text<a/>`, `plain text`, ``} {
+		if _, err := parseXMLDocument(body); err == nil {
+			t.Errorf("parseXMLDocument(%q): expected not to parse", body)
+		}
+	}
+}
+
+func TestBodyValue(t *testing.T) {
+	if got := bodyValue(`{"id":1}`); !reflect.DeepEqual(got, map[string]interface{}{"id": float64(1)}) {
+		t.Errorf("JSON body: got %#v", got)
+	}
+	if got := bodyValue(`<id>1</id>`); !reflect.DeepEqual(got, map[string]interface{}{"id": "1"}) {
+		t.Errorf("XML body: got %#v", got)
+	}
+	if got := bodyValue(`hello`); got != "hello" {
+		t.Errorf("text body: got %#v", got)
+	}
+	if got := bodyValue(``); got != nil {
+		t.Errorf("empty body: got %#v", got)
+	}
+}
+
+func TestPrettyBody(t *testing.T) {
+	got := parseBody(`<?xml version="1.0"?><soap:Envelope xmlns:soap="urn:s"><soap:Body><Ping id="a&amp;b">x &lt; y</Ping><Empty/></soap:Body></soap:Envelope>`).prettyBody()
+	want := `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="urn:s">
+  <soap:Body>
+    <Ping id="a&amp;b">x &lt; y</Ping>
+    <Empty/>
+  </soap:Body>
+</soap:Envelope>`
+	if got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := parseBody(`{"id":1}`).prettyBody(); got != "" {
+		t.Errorf("expected JSON not to be pretty-printed as XML, got %q", got)
+	}
+}
+
+func TestWebhookHandlerXMLRules(t *testing.T) {
+	app := New()
+	app.addRule("soap", Rule{
+		Condition:  `body.Envelope.Body.Notify["@type"] == "payment" && float(body.Envelope.Body.Notify.Amount["#text"]) > 100`,
+		StatusCode: http.StatusAccepted,
+		Enabled:    true,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/soap", strings.NewReader(soapNotify))
+	req.Header.Set("Content-Type", "text/xml")
+	w := httptest.NewRecorder()
+	app.webhookHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	events := app.store.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if !strings.HasPrefix(events[0].PrettyBody, "<?xml") || !strings.Contains(events[0].PrettyBody, "\n      <Amount currency=\"USD\">120.50</Amount>\n") {
+		t.Errorf("unexpected pretty body:\n%s", events[0].PrettyBody)
+	}
+	if events[0].Body != soapNotify {
+		t.Error("expected raw body to be kept")
+	}
+}
+
+func TestRequestTemplateDataXMLBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/soap", nil)
+	data := requestTemplateData(req, "soap", parseBody(`<Ping><Id>42</Id></Ping>`))
+	body := data["body"].(map[string]interface{})
+	if got := body["Ping"].(map[string]interface{})["Id"]; got != "42" {
+		t.Errorf("expected template body Ping.Id 42, got %#v", got)
+	}
+}